@@ -1,17 +1,20 @@
 package aof
 
 import (
+	"fmt"
 	"gmr/go-cache/config"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/lib/logger"
 	"gmr/go-cache/lib/utils"
 	"gmr/go-cache/redis/connection"
-	"gmr/go-cache/redis/parser"
 	"gmr/go-cache/redis/protocol"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 /**
@@ -29,32 +32,91 @@ const (
 	aofQueueSize = 1 << 16
 )
 
+const (
+	// FsyncAlways 每次写入后fsync，命令在数据落盘后才返回
+	FsyncAlways = "always"
+	// FsyncEverySec 每秒fsync一次，宕机最多丢失一秒的数据
+	FsyncEverySec = "everysec"
+	// FsyncNo 由操作系统决定何时刷盘
+	FsyncNo = "no"
+)
+
 type payload struct {
 	cmdLine CmdLine
 	dbIndex int
+	// wg 不为空时，写入并fsync之后调用Done通知等待的命令
+	wg *sync.WaitGroup
+}
+
+// Listener 在命令写入aof后被回调，用于replication等需要获取写命令的场景
+type Listener interface {
+	Callback(dbIndex int, cmdLine CmdLine)
 }
 
 // Handler接收channel数据，写入到AOF file
 type Handler struct {
-	db          database.EmbedDB
-	tmpDBMaker  func() database.EmbedDB
-	aofChan     chan *payload
-	aofFile     *os.File
+	db         database.EmbedDB
+	tmpDBMaker func() database.EmbedDB
+	aofChan    chan *payload
+	aofFile    *os.File
+	// aofFilename 文件名前缀，aofDir中的文件为 <aofFilename>.<seq>.base.rdb 和 <aofFilename>.<seq>.incr.aof
 	aofFilename string
+	aofDir      string
+	manifest    *manifest
+	// rewriting 同一时间只能进行一次重写或生成rdb，避免读取的文件被删除
+	rewriting sync.Mutex
 	// aof协程向主协程通信的channel
 	aofFinished chan struct{}
 	// 暂停aof以启动/完成aof重写进度
 	pausingAof sync.RWMutex
 	currentDB  int
+	// 写入aof之后需要通知的listener
+	listeners map[Listener]struct{}
+	// fsync策略: always, everysec, no
+	aofFsync string
+	// 关闭everysec的fsync协程
+	fsyncStop chan struct{}
+}
+
+// parseFsync 解析appendfsync配置，未配置或者非法时使用everysec
+func parseFsync(policy string) string {
+	policy = strings.ToLower(policy)
+	switch policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return policy
+	case "":
+		return FsyncEverySec
+	}
+	logger.Warn("illegal appendfsync " + policy + ", use " + FsyncEverySec)
+	return FsyncEverySec
 }
 
 func NewAOFHandler(db database.EmbedDB, tmpDBMaker func() database.EmbedDB) (*Handler, error) {
 	handler := &Handler{}
-	handler.aofFilename = config.Properties.AppendFilename
+	handler.aofFilename = defaultAppendFilename
+	if config.Properties.AppendFilename != "" {
+		handler.aofFilename = filepath.Base(config.Properties.AppendFilename)
+	}
+	handler.aofDir = defaultAppendDirname
+	if config.Properties.AppendDirname != "" {
+		handler.aofDir = config.Properties.AppendDirname
+	}
 	handler.db = db
 	handler.tmpDBMaker = tmpDBMaker
-	handler.LoadAof(0)
-	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	handler.listeners = make(map[Listener]struct{})
+	if err := handler.openManifest(); err != nil {
+		return nil, err
+	}
+	if err := handler.LoadAof(0); err != nil {
+		return nil, err
+	}
+	if handler.manifest.lastIncr() == nil {
+		handler.manifest.incrs = append(handler.manifest.incrs, handler.manifest.nextIncr(handler.aofFilename))
+		if err := handler.manifest.save(handler.manifestPath()); err != nil {
+			return nil, err
+		}
+	}
+	aofFile, err := os.OpenFile(handler.path(handler.manifest.lastIncr()), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return nil, err
 	}
@@ -62,98 +124,264 @@ func NewAOFHandler(db database.EmbedDB, tmpDBMaker func() database.EmbedDB) (*Ha
 	handler.aofFile = aofFile
 	handler.aofChan = make(chan *payload, aofQueueSize)
 	handler.aofFinished = make(chan struct{})
+	handler.aofFsync = parseFsync(config.Properties.AppendFsync)
+	handler.fsyncStop = make(chan struct{})
 
 	go func() {
 		handler.handleAof()
 	}()
+	if handler.aofFsync == FsyncEverySec {
+		go handler.fsyncEverySecond()
+	}
 	return handler, nil
 }
 
+func (handler *Handler) manifestPath() string {
+	return filepath.Join(handler.aofDir, handler.aofFilename+manifestSuffix)
+}
+
+func (handler *Handler) path(info *aofInfo) string {
+	return filepath.Join(handler.aofDir, info.name)
+}
+
+// openManifest 读取manifest，不存在时将旧版本的单个aof文件作为base
+func (handler *Handler) openManifest() error {
+	if err := os.MkdirAll(handler.aofDir, 0755); err != nil {
+		return err
+	}
+	m, err := loadManifest(handler.manifestPath())
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		handler.manifest = m
+		return nil
+	}
+	m = &manifest{}
+	legacy := config.Properties.AppendFilename
+	if info, err := os.Stat(legacy); legacy != "" && err == nil && !info.IsDir() {
+		base := m.nextBase(handler.aofFilename, false)
+		if err := os.Rename(legacy, handler.path(base)); err != nil {
+			return err
+		}
+		m.base = base
+		logger.Info("upgrade " + legacy + " to multi part aof " + handler.path(base))
+	}
+	handler.manifest = m
+	return m.save(handler.manifestPath())
+}
+
+// AddAof 将命令发送给aof协程，appendfsync为always时等待命令落盘后返回
 func (handler *Handler) AddAof(dbIndex int, cmdLine CmdLine) {
 	if config.Properties.AppendOnly && handler.aofChan != nil {
-		handler.aofChan <- &payload{
+		p := &payload{
 			cmdLine: cmdLine,
 			dbIndex: dbIndex,
 		}
+		if handler.aofFsync == FsyncAlways {
+			p.wg = &sync.WaitGroup{}
+			p.wg.Add(1)
+		}
+		handler.aofChan <- p
+		if p.wg != nil {
+			p.wg.Wait()
+		}
 	}
 }
 
 func (handler *Handler) handleAof() {
 	handler.currentDB = 0
+	batch := make([]*payload, 0)
 	for p := range handler.aofChan {
-		handler.pausingAof.RLock()
-		if p.dbIndex != handler.currentDB {
-			data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
-			_, err := handler.aofFile.Write(data)
-			if err != nil {
-				logger.Error(err)
-				continue
+		// 组提交: 取出channel中已经排队的命令一起写入，只需要fsync一次
+		batch = append(batch[:0], p)
+		drained := false
+		for !drained && len(batch) < aofQueueSize {
+			select {
+			case next, ok := <-handler.aofChan:
+				if ok {
+					batch = append(batch, next)
+				} else {
+					drained = true
+				}
+			default:
+				drained = true
 			}
-			handler.currentDB = p.dbIndex
 		}
-		data := protocol.MakeMultiBulkReply(p.cmdLine).ToBytes()
+		handler.writeBatch(batch)
+	}
+	handler.aofFinished <- struct{}{}
+}
+
+// writeBatch 写入一组命令，appendfsync为always时fsync后通知等待的命令
+func (handler *Handler) writeBatch(batch []*payload) {
+	handler.pausingAof.RLock()
+	for _, p := range batch {
+		handler.writePayload(p)
+	}
+	if handler.aofFsync == FsyncAlways {
+		if err := handler.aofFile.Sync(); err != nil {
+			logger.Error("fsync failed: " + err.Error())
+		}
+	}
+	handler.pausingAof.RUnlock()
+	for _, p := range batch {
+		if p.wg != nil {
+			p.wg.Done()
+		}
+	}
+}
+
+// writePayload 写入一条命令，调用方需持有pausingAof读锁
+func (handler *Handler) writePayload(p *payload) {
+	if p.dbIndex != handler.currentDB {
+		data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
 		_, err := handler.aofFile.Write(data)
 		if err != nil {
 			logger.Error(err)
+			return
+		}
+		handler.currentDB = p.dbIndex
+	}
+	data := protocol.MakeMultiBulkReply(p.cmdLine).ToBytes()
+	_, err := handler.aofFile.Write(data)
+	if err != nil {
+		logger.Error(err)
+	}
+	for listener := range handler.listeners {
+		listener.Callback(p.dbIndex, p.cmdLine)
+	}
+}
+
+// fsyncEverySecond appendfsync为everysec时每秒fsync一次aof文件
+func (handler *Handler) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-handler.fsyncStop:
+			return
+		case <-ticker.C:
+		}
+		handler.pausingAof.RLock()
+		if err := handler.aofFile.Sync(); err != nil {
+			logger.Error("fsync failed: " + err.Error())
 		}
 		handler.pausingAof.RUnlock()
 	}
-	handler.aofFinished <- struct{}{}
 }
 
-func (handler *Handler) LoadAof(maxBytes int) {
+// AddListener 注册listener，之后写入aof的命令都会回调listener
+func (handler *Handler) AddListener(listener Listener) {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	handler.listeners[listener] = struct{}{}
+}
+
+// RemoveListener 移除listener
+func (handler *Handler) RemoveListener(listener Listener) {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	delete(handler.listeners, listener)
+}
+
+// LoadAof 依次加载base和incr文件，maxBytes大于0时只读取最后一个文件的前maxBytes字节
+// 最后一个文件末尾命令不完整时，如果开启了aof-load-truncated则截断到最后一条完整命令，否则返回错误
+func (handler *Handler) LoadAof(maxBytes int) error {
+	lastSize := int64(-1)
+	if maxBytes > 0 {
+		lastSize = int64(maxBytes)
+	}
+	return handler.loadFiles(handler.manifest.files(), lastSize, maxBytes <= 0)
+}
+
+// loadFiles 按顺序加载文件，lastSize不小于0时只读取最后一个文件的前lastSize字节
+// repair为true时允许截断最后一个文件末尾不完整的命令
+func (handler *Handler) loadFiles(files []*aofInfo, lastSize int64, repair bool) error {
 	aofChan := handler.aofChan
 	handler.aofChan = nil
 	defer func(aofChan chan *payload) {
 		handler.aofChan = aofChan
 	}(aofChan)
 
-	file, err := os.Open(handler.aofFilename)
+	for i, info := range files {
+		last := i == len(files)-1
+		var err error
+		if info.isRDB() {
+			err = handler.loadRDB(handler.path(info))
+		} else if last {
+			err = handler.loadAofFile(handler.path(info), lastSize, repair)
+		} else {
+			err = handler.loadAofFile(handler.path(info), -1, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAofFile 重放一个aof文件，每个文件从db 0开始
+func (handler *Handler) loadAofFile(filename string, maxBytes int64, repair bool) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		if _, ok := err.(*os.PathError); ok {
-			return
+		if os.IsNotExist(err) {
+			return nil
 		}
-		logger.Warn(err)
-		return
+		return err
 	}
 	defer file.Close()
 
 	var reader io.Reader
-	if maxBytes > 0 {
-		reader = io.LimitReader(file, int64(maxBytes))
+	if maxBytes >= 0 {
+		reader = io.LimitReader(file, maxBytes)
 	} else {
 		reader = file
 	}
-	ch := parser.ParseStream(reader)
+	cmdReader := newCmdReader(reader)
 	fakeConn := &connection.FakeConn{}
-	for p := range ch {
-		if p.Err != nil {
-			if p.Err == io.EOF {
-				break
-			}
-			logger.Error("parse error: " + p.Err.Error())
-			continue
-		}
-		if p.Data == nil {
-			logger.Error("empty payload")
-			continue
+	for {
+		cmdLine, err := cmdReader.next()
+		if err == io.EOF {
+			return nil
 		}
-		r, ok := p.Data.(*protocol.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk protocol")
-			continue
+		if err != nil {
+			return handleLoadError(filename, cmdReader.offset, err, repair)
 		}
-		ret := handler.db.Exec(fakeConn, r.Args)
+		ret := handler.db.Exec(fakeConn, cmdLine)
 		if protocol.IsErrorReply(ret) {
 			logger.Error("exec err", ret.ToBytes())
 		}
 	}
 }
 
+// handleLoadError 处理读取aof时遇到的错误，offset为最后一条完整命令结束的位置
+func handleLoadError(filename string, offset int64, err error, repair bool) error {
+	if err != ErrTruncated {
+		return fmt.Errorf("bad file format reading the append only file %s at offset %d: %v, "+
+			"make a backup and use 'go-cache check-aof --fix %s' to repair it",
+			filename, offset, err, filename)
+	}
+	if !repair || !config.Properties.AofLoadTruncated {
+		return fmt.Errorf("unexpected end of file reading the append only file %s at offset %d, "+
+			"set aof-load-truncated yes or use 'go-cache check-aof --fix %s' to repair it",
+			filename, offset, filename)
+	}
+	logger.Warn(fmt.Sprintf("short read while loading the append only file %s, truncating to offset %d",
+		filename, offset))
+	return os.Truncate(filename, offset)
+}
+
 func (handler *Handler) Close() {
 	if handler.aofFile != nil {
+		close(handler.fsyncStop)
 		close(handler.aofChan)
 		<-handler.aofFinished
+		if handler.aofFsync != FsyncNo {
+			if err := handler.aofFile.Sync(); err != nil {
+				logger.Warn(err)
+			}
+		}
 		err := handler.aofFile.Close()
 		if err != nil {
 			logger.Warn(err)
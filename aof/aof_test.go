@@ -0,0 +1,118 @@
+package aof
+
+import (
+	"bytes"
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: aof_test
+ * @Version: 1.0.0
+ * @Description: appendfsync策略的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+func TestParseFsync(t *testing.T) {
+	cases := map[string]string{
+		"":         FsyncEverySec,
+		"always":   FsyncAlways,
+		"ALWAYS":   FsyncAlways,
+		"everysec": FsyncEverySec,
+		"no":       FsyncNo,
+		"never":    FsyncEverySec,
+	}
+	for policy, expected := range cases {
+		if actual := parseFsync(policy); actual != expected {
+			t.Errorf("parseFsync(%q) expect %s, actual: %s", policy, expected, actual)
+		}
+	}
+}
+
+func setupAofConfig(t *testing.T, policy string) {
+	appendOnly, filename, dirname, fsync := config.Properties.AppendOnly, config.Properties.AppendFilename,
+		config.Properties.AppendDirname, config.Properties.AppendFsync
+	t.Cleanup(func() {
+		config.Properties.AppendOnly, config.Properties.AppendFilename = appendOnly, filename
+		config.Properties.AppendDirname, config.Properties.AppendFsync = dirname, fsync
+	})
+	config.Properties.AppendOnly = true
+	config.Properties.AppendFilename = "appendonly.aof"
+	config.Properties.AppendDirname = t.TempDir()
+	config.Properties.AppendFsync = policy
+}
+
+func TestFsyncPolicies(t *testing.T) {
+	for _, policy := range []string{FsyncAlways, FsyncEverySec, FsyncNo} {
+		t.Run(policy, func(t *testing.T) {
+			setupAofConfig(t, policy)
+			handler, err := NewAOFHandler(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filename := handler.path(handler.manifest.lastIncr())
+			if handler.aofFsync != policy {
+				t.Fatalf("expect policy %s, actual: %s", policy, handler.aofFsync)
+			}
+
+			size := 100
+			var wg sync.WaitGroup
+			for i := 0; i < size; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					cmdLine := utils.ToCmdLine("SET", "key"+strconv.Itoa(i), "value")
+					handler.AddAof(0, cmdLine)
+					if policy != FsyncAlways {
+						return
+					}
+					// always策略下AddAof返回时命令已经写入文件
+					data, err := os.ReadFile(filename)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if !bytes.Contains(data, protocol.MakeMultiBulkReply(cmdLine).ToBytes()) {
+						t.Errorf("command %d is not in aof file after AddAof returned", i)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			// 关闭之后所有命令都已经写入文件
+			handler.Close()
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < size; i++ {
+				cmd := protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", "key"+strconv.Itoa(i), "value")).ToBytes()
+				if !bytes.Contains(data, cmd) {
+					t.Errorf("command %d is lost after close", i)
+				}
+			}
+		})
+	}
+}
+
+func TestAddAofDisabled(t *testing.T) {
+	setupAofConfig(t, FsyncAlways)
+	handler, err := NewAOFHandler(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := handler.path(handler.manifest.lastIncr())
+	// 关闭appendonly之后不再写入aof，always策略也不会阻塞
+	config.Properties.AppendOnly = false
+	handler.AddAof(0, utils.ToCmdLine("SET", "a", "1"))
+	handler.Close()
+	if info, err := os.Stat(filename); err != nil || info.Size() != 0 {
+		t.Errorf("expect empty aof file, actual: %v, %v", info, err)
+	}
+}
@@ -0,0 +1,153 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+/**
+ * @Author: wanglei
+ * @File: check
+ * @Version: 1.0.0
+ * @Description: 逐条读取aof中的命令并记录偏移量，用于检测宕机导致的末尾命令不完整，
+ *               以及check-aof工具截断损坏的aof文件
+ * @Date: 2026/10/18 10:12
+ */
+
+// ErrTruncated aof文件末尾的命令没有写完整
+var ErrTruncated = errors.New("unexpected end of file")
+
+// cmdReader 逐条读取aof中的命令，offset为最后一条完整命令结束的位置
+type cmdReader struct {
+	reader *bufio.Reader
+	offset int64
+	// read 当前命令已经读取的字节数
+	read int64
+}
+
+func newCmdReader(reader io.Reader) *cmdReader {
+	return &cmdReader{
+		reader: bufio.NewReader(reader),
+	}
+}
+
+// readLine 读取以CRLF结尾的一行，返回的内容不包含CRLF
+func (r *cmdReader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadBytes('\n')
+	r.read += int64(len(line))
+	if err == io.EOF {
+		if len(line) == 0 && r.read == 0 {
+			return nil, io.EOF
+		}
+		return nil, ErrTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("line should end with CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+// readLength 读取*或者$开头的长度
+func (r *cmdReader) readLength(prefix byte) (int, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return 0, err
+	}
+	if len(line) == 0 || line[0] != prefix {
+		return 0, fmt.Errorf("expect '%c', got '%s'", prefix, line)
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("illegal length '%s'", line)
+	}
+	return n, nil
+}
+
+// next 读取下一条命令，文件正常结束时返回io.EOF，末尾命令不完整时返回ErrTruncated
+func (r *cmdReader) next() (CmdLine, error) {
+	r.read = 0
+	argc, err := r.readLength('*')
+	if err != nil {
+		return nil, err
+	}
+	if argc == 0 {
+		return nil, errors.New("empty command")
+	}
+	cmdLine := make(CmdLine, 0, argc)
+	for i := 0; i < argc; i++ {
+		argLen, err := r.readLength('$')
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, argLen+2)
+		n, err := io.ReadFull(r.reader, arg)
+		r.read += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		if err != nil {
+			return nil, err
+		}
+		if arg[argLen] != '\r' || arg[argLen+1] != '\n' {
+			return nil, errors.New("argument should end with CRLF")
+		}
+		cmdLine = append(cmdLine, arg[:argLen])
+	}
+	r.offset += r.read
+	return cmdLine, nil
+}
+
+// CheckResult aof文件的检查结果
+type CheckResult struct {
+	// Size 文件大小
+	Size int64
+	// Valid 最后一条完整命令结束的位置
+	Valid int64
+	// Commands 完整命令的数量
+	Commands int
+	// Err 为空时文件完整，ErrTruncated表示末尾命令不完整，其他错误表示文件格式错误
+	Err error
+}
+
+// CheckAof 检查aof文件中的每一条命令
+func CheckAof(filename string) (*CheckResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Size: info.Size()}
+	reader := newCmdReader(file)
+	for {
+		_, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.Err = err
+			break
+		}
+		result.Commands++
+	}
+	result.Valid = reader.offset
+	return result, nil
+}
+
+// FixAof 将aof文件截断到最后一条完整命令
+func FixAof(filename string, result *CheckResult) error {
+	if result.Valid >= result.Size {
+		return nil
+	}
+	return os.Truncate(filename, result.Valid)
+}
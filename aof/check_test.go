@@ -0,0 +1,131 @@
+package aof
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: check_test
+ * @Version: 1.0.0
+ * @Description: aof末尾命令不完整时的检查与修复测试
+ * @Date: 2026/10/18 3:10
+ */
+
+// recordDB 记录加载aof时重放的命令
+type recordDB struct {
+	database.EmbedDB
+	commands []string
+}
+
+func (db *recordDB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
+	db.commands = append(db.commands, string(cmdLine[1]))
+	return protocol.MakeOkReply()
+}
+
+// writeTruncatedAof 写入完整的命令以及被截断的最后一条命令，返回完整命令的长度
+func writeTruncatedAof(t *testing.T, filename string, cut int) int64 {
+	var data []byte
+	for _, key := range []string{"a", "b", "c"} {
+		data = append(data, protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", key, "1")).ToBytes()...)
+	}
+	valid := int64(len(data))
+	last := protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", "d", "1")).ToBytes()
+	data = append(data, last[:cut]...)
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return valid
+}
+
+func TestCheckAndFixTruncatedAof(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	last := protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", "d", "1")).ToBytes()
+	// 在最后一条命令的每个位置截断
+	for cut := 1; cut < len(last); cut++ {
+		valid := writeTruncatedAof(t, filename, cut)
+		result, err := CheckAof(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Err != ErrTruncated || result.Valid != valid || result.Commands != 3 {
+			t.Fatalf("cut at %d: expect truncated at %d with 3 commands, actual: %v at %d with %d commands",
+				cut, valid, result.Err, result.Valid, result.Commands)
+		}
+		if err := FixAof(filename, result); err != nil {
+			t.Fatal(err)
+		}
+		result, err = CheckAof(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Err != nil || result.Size != valid || result.Commands != 3 {
+			t.Fatalf("cut at %d: expect valid file of %d bytes after fix, actual: %v, %d bytes",
+				cut, valid, result.Err, result.Size)
+		}
+	}
+}
+
+func TestCheckBadFormatAof(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	data := string(protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", "a", "1")).ToBytes()) + "SET b 1\r\n"
+	if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := CheckAof(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 格式错误不是末尾截断，不能直接修复
+	if result.Err == nil || result.Err == ErrTruncated || result.Commands != 1 {
+		t.Errorf("expect format error after 1 command, actual: %v with %d commands", result.Err, result.Commands)
+	}
+}
+
+func TestLoadTruncatedAof(t *testing.T) {
+	loadTruncated := config.Properties.AofLoadTruncated
+	defer func() {
+		config.Properties.AofLoadTruncated = loadTruncated
+	}()
+	dir := t.TempDir()
+	incr := &aofInfo{name: "appendonly.aof.1.incr.aof", seq: 1, fileType: incrFileType}
+	filename := filepath.Join(dir, incr.name)
+	makeHandler := func(db *recordDB) *Handler {
+		return &Handler{db: db, aofDir: dir, manifest: &manifest{incrs: []*aofInfo{incr}}}
+	}
+
+	// 关闭aof-load-truncated时拒绝加载并保留文件
+	config.Properties.AofLoadTruncated = false
+	writeTruncatedAof(t, filename, 10)
+	db := &recordDB{}
+	handler := makeHandler(db)
+	if err := handler.LoadAof(0); err == nil || !strings.Contains(err.Error(), "unexpected end of file") {
+		t.Errorf("expect unexpected end of file error, actual: %v", err)
+	}
+	if info, _ := os.Stat(filename); info.Size() == 0 {
+		t.Errorf("aof file should not be truncated")
+	}
+
+	// 开启时截断到最后一条完整命令并继续加载
+	config.Properties.AofLoadTruncated = true
+	valid := writeTruncatedAof(t, filename, 10)
+	db = &recordDB{}
+	handler = makeHandler(db)
+	if err := handler.LoadAof(0); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(db.commands, ",") != "a,b,c" {
+		t.Errorf("expect a,b,c loaded, actual: %v", db.commands)
+	}
+	if info, _ := os.Stat(filename); info.Size() != valid {
+		t.Errorf("expect aof truncated to %d, actual: %d", valid, info.Size())
+	}
+}
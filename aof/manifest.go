@@ -0,0 +1,206 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: manifest
+ * @Version: 1.0.0
+ * @Description: multi part aof的manifest，记录一个base文件以及之后的incr文件
+ *               每行格式为 file <name> seq <seq> type <b|i>，与Redis 7相同
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	baseFileType = "b"
+	incrFileType = "i"
+
+	defaultAppendFilename = "appendonly.aof"
+	defaultAppendDirname  = "appendonlydir"
+
+	baseRDBSuffix  = ".base.rdb"
+	baseAofSuffix  = ".base.aof"
+	incrAofSuffix  = ".incr.aof"
+	manifestSuffix = ".manifest"
+)
+
+// aofInfo manifest中的一个文件
+type aofInfo struct {
+	name     string
+	seq      int
+	fileType string
+}
+
+func (info *aofInfo) isRDB() bool {
+	return strings.HasSuffix(info.name, baseRDBSuffix)
+}
+
+type manifest struct {
+	// base 为空时表示还没有进行过重写
+	base  *aofInfo
+	incrs []*aofInfo
+}
+
+// files 按加载顺序返回所有文件，base在前
+func (m *manifest) files() []*aofInfo {
+	result := make([]*aofInfo, 0, len(m.incrs)+1)
+	if m.base != nil {
+		result = append(result, m.base)
+	}
+	return append(result, m.incrs...)
+}
+
+// lastIncr 当前正在写入的incr文件
+func (m *manifest) lastIncr() *aofInfo {
+	if len(m.incrs) == 0 {
+		return nil
+	}
+	return m.incrs[len(m.incrs)-1]
+}
+
+func (m *manifest) nextBase(filename string, useRDB bool) *aofInfo {
+	seq := 1
+	if m.base != nil {
+		seq = m.base.seq + 1
+	}
+	suffix := baseAofSuffix
+	if useRDB {
+		suffix = baseRDBSuffix
+	}
+	return &aofInfo{
+		name:     filename + "." + strconv.Itoa(seq) + suffix,
+		seq:      seq,
+		fileType: baseFileType,
+	}
+}
+
+func (m *manifest) nextIncr(filename string) *aofInfo {
+	seq := 1
+	if last := m.lastIncr(); last != nil {
+		seq = last.seq + 1
+	}
+	return &aofInfo{
+		name:     filename + "." + strconv.Itoa(seq) + incrAofSuffix,
+		seq:      seq,
+		fileType: incrFileType,
+	}
+}
+
+// loadManifest 读取manifest，文件不存在时返回nil
+func loadManifest(path string) (*manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &manifest{}
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		info, err := parseManifestLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest %s line %d: %v", path, lineNo, err)
+		}
+		switch info.fileType {
+		case baseFileType:
+			if m.base != nil {
+				return nil, fmt.Errorf("invalid manifest %s: found duplicate base file", path)
+			}
+			m.base = info
+		case incrFileType:
+			m.incrs = append(m.incrs, info)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseManifestLine(line string) (*aofInfo, error) {
+	fields := strings.Fields(line)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("mismatched key and value")
+	}
+	info := &aofInfo{}
+	for i := 0; i < len(fields); i += 2 {
+		switch fields[i] {
+		case "file":
+			info.name = fields[i+1]
+		case "seq":
+			seq, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return nil, errors.New("illegal seq " + fields[i+1])
+			}
+			info.seq = seq
+		case "type":
+			info.fileType = fields[i+1]
+		}
+	}
+	if info.name == "" || filepath.Base(info.name) != info.name {
+		return nil, errors.New("illegal file name")
+	}
+	if info.fileType != baseFileType && info.fileType != incrFileType {
+		return nil, errors.New("unknown file type " + info.fileType)
+	}
+	return info, nil
+}
+
+// save 先写入临时文件再rename，保证manifest总是完整的
+func (m *manifest) save(path string) error {
+	var builder strings.Builder
+	for _, info := range m.files() {
+		builder.WriteString(fmt.Sprintf("file %s seq %d type %s\n", info.name, info.seq, info.fileType))
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(builder.String())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// ManifestFiles 返回manifest中按加载顺序排列的文件路径，用于check-aof
+func ManifestFiles(path string) ([]string, error) {
+	m, err := loadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("manifest " + path + " not found")
+	}
+	dir := filepath.Dir(path)
+	result := make([]string, 0)
+	for _, info := range m.files() {
+		result = append(result, filepath.Join(dir, info.name))
+	}
+	return result, nil
+}
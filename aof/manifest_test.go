@@ -0,0 +1,135 @@
+package aof
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: manifest_test
+ * @Version: 1.0.0
+ * @Description: manifest的解析以及multi part aof加载测试
+ * @Date: 2026/10/18 3:10
+ */
+
+func writeManifest(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "appendonly.aof"+manifestSuffix)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadManifest(t *testing.T) {
+	path := writeManifest(t, "# comment\n"+
+		"file appendonly.aof.2.incr.aof seq 2 type i\n"+
+		"\n"+
+		"file appendonly.aof.3.base.rdb seq 3 type b\n"+
+		"file appendonly.aof.3.incr.aof seq 3 type i\n")
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// base总是最先加载，incr按manifest中的顺序加载
+	names := make([]string, 0)
+	for _, info := range m.files() {
+		names = append(names, info.name)
+	}
+	expected := "appendonly.aof.3.base.rdb,appendonly.aof.2.incr.aof,appendonly.aof.3.incr.aof"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("expect %s, actual: %s", expected, strings.Join(names, ","))
+	}
+	if !m.base.isRDB() || m.base.seq != 3 {
+		t.Errorf("expect rdb base with seq 3, actual: %+v", m.base)
+	}
+	if next := m.nextBase("appendonly.aof", false); next.name != "appendonly.aof.4.base.aof" {
+		t.Errorf("expect next base appendonly.aof.4.base.aof, actual: %s", next.name)
+	}
+	if next := m.nextIncr("appendonly.aof"); next.name != "appendonly.aof.4.incr.aof" || next.seq != 4 {
+		t.Errorf("expect next incr appendonly.aof.4.incr.aof, actual: %s", next.name)
+	}
+
+	// 保存之后重新读取得到相同的文件列表
+	if err := m.save(path); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ManifestFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range strings.Split(expected, ",") {
+		if files[i] != filepath.Join(filepath.Dir(path), name) {
+			t.Errorf("expect %s, actual: %s", name, files[i])
+		}
+	}
+}
+
+func TestLoadIllegalManifest(t *testing.T) {
+	cases := []string{
+		"file a.1.base.aof seq 1 type b\nfile a.2.base.aof seq 2 type b\n",
+		"file ../a.1.incr.aof seq 1 type i\n",
+		"file a.1.incr.aof seq 1 type x\n",
+		"file a.1.incr.aof seq one type i\n",
+		"file a.1.incr.aof seq 1 type\n",
+		"seq 1 type i\n",
+	}
+	for _, content := range cases {
+		if _, err := loadManifest(writeManifest(t, content)); err == nil {
+			t.Errorf("expect error for manifest %q", content)
+		}
+	}
+	m, err := loadManifest(filepath.Join(t.TempDir(), "missing.manifest"))
+	if m != nil || err != nil {
+		t.Errorf("expect nil for missing manifest, actual: %v, %v", m, err)
+	}
+}
+
+func TestUpgradeAndReloadMultiPartAof(t *testing.T) {
+	setupAofConfig(t, FsyncAlways)
+	dir := config.Properties.AppendDirname
+	// 旧版本的单个aof文件升级为base文件
+	legacy := filepath.Join(dir, "legacy.aof")
+	config.Properties.AppendFilename = legacy
+	data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", "a", "1")).ToBytes()
+	if err := os.WriteFile(legacy, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db := &recordDB{}
+	handler, err := NewAOFHandler(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(db.commands, ",") != "a" {
+		t.Errorf("expect legacy aof loaded, actual: %v", db.commands)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("legacy aof should be moved into %s", dir)
+	}
+	handler.AddAof(0, utils.ToCmdLine("SET", "b", "1"))
+	handler.Close()
+
+	// 重启后依次加载base和incr文件
+	db = &recordDB{}
+	handler, err = NewAOFHandler(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	if strings.Join(db.commands, ",") != "a,b" {
+		t.Errorf("expect a,b loaded from base and incr, actual: %v", db.commands)
+	}
+	files, err := ManifestFiles(handler.manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "legacy.aof.1.base.aof" || filepath.Base(files[1]) != "legacy.aof.1.incr.aof" {
+		t.Errorf("unexpected manifest files: %v", files)
+	}
+}
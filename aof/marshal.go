@@ -1,10 +1,12 @@
 package aof
 
 import (
+	"errors"
 	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/list"
 	"gmr/go-cache/datastruct/set"
 	"gmr/go-cache/datastruct/sortedset"
+	"gmr/go-cache/datastruct/stream"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/redis/protocol"
 	"strconv"
@@ -37,6 +39,8 @@ func EntityToCmd(key string, entity *database.DataEntity) *protocol.MultiBulkRep
 		cmd = hashToCmd(key, val)
 	case *sortedset.SortedSet:
 		cmd = zSetToCmd(key, val)
+	case *stream.Stream:
+		cmd = streamToCmd(key, val)
 	}
 
 	return cmd
@@ -84,7 +88,7 @@ func setToCmd(key string, s *set.Set) *protocol.MultiBulkReply {
 var hmSetCmd = []byte("HMSET")
 
 func hashToCmd(key string, hash dict.Dict) *protocol.MultiBulkReply {
-	args := make([][]byte, 2*hash.Len()*2)
+	args := make([][]byte, 2+hash.Len()*2)
 	args[0] = hmSetCmd
 	args[1] = []byte(key)
 	i := 0
@@ -115,6 +119,173 @@ func zSetToCmd(key string, zset *sortedset.SortedSet) *protocol.MultiBulkReply {
 	return protocol.MakeMultiBulkReply(args)
 }
 
+var xRestoreCmd = []byte("XRESTORE")
+
+// streamToCmd stream的entries、consumer groups以及PEL无法用XADD重建，使用内部命令XRESTORE一次写入
+// XRESTORE key lastID entriesAdded maxDeletedID entryCount [id fieldCount field value ...]
+// groupCount [name lastID entriesRead consumerCount [name seenTime ...] pendingCount [id consumer deliveryTime deliveryCount ...] ...]
+func streamToCmd(key string, s *stream.Stream) *protocol.MultiBulkReply {
+	args := [][]byte{
+		xRestoreCmd,
+		[]byte(key),
+		[]byte(s.LastID().String()),
+		[]byte(strconv.FormatUint(s.EntriesAdded(), 10)),
+		[]byte(s.MaxDeletedID().String()),
+		[]byte(strconv.Itoa(s.Len())),
+	}
+	s.ForEach(func(entry *stream.Entry) bool {
+		args = append(args, []byte(entry.ID.String()), []byte(strconv.Itoa(len(entry.Fields))))
+		args = append(args, entry.Fields...)
+		return true
+	})
+
+	groups := s.Groups()
+	args = append(args, []byte(strconv.Itoa(len(groups))))
+	for _, group := range groups {
+		consumers := group.Consumers()
+		args = append(args,
+			[]byte(group.Name),
+			[]byte(group.LastID.String()),
+			[]byte(strconv.FormatInt(group.EntriesRead, 10)),
+			[]byte(strconv.Itoa(len(consumers))),
+		)
+		for _, consumer := range consumers {
+			args = append(args, []byte(consumer.Name), []byte(strconv.FormatInt(consumer.SeenTime, 10)))
+		}
+		pendings := group.PendingRange(stream.MinID, stream.MaxID, 0)
+		args = append(args, []byte(strconv.Itoa(len(pendings))))
+		for _, pending := range pendings {
+			args = append(args,
+				[]byte(pending.ID.String()),
+				[]byte(pending.Consumer.Name),
+				[]byte(strconv.FormatInt(pending.DeliveryTime, 10)),
+				[]byte(strconv.FormatUint(pending.DeliveryCount, 10)),
+			)
+		}
+	}
+	return protocol.MakeMultiBulkReply(args)
+}
+
+var errIllegalXRestore = errors.New("illegal XRESTORE arguments")
+
+// restoreReader 按顺序读取XRESTORE的参数
+type restoreReader struct {
+	args [][]byte
+	pos  int
+	err  error
+}
+
+func (r *restoreReader) next() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos >= len(r.args) {
+		r.err = errIllegalXRestore
+		return nil
+	}
+	arg := r.args[r.pos]
+	r.pos++
+	return arg
+}
+
+func (r *restoreReader) nextInt() int64 {
+	arg := r.next()
+	if r.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		r.err = err
+	}
+	return n
+}
+
+func (r *restoreReader) nextUint() uint64 {
+	arg := r.next()
+	if r.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		r.err = err
+	}
+	return n
+}
+
+func (r *restoreReader) nextID() stream.ID {
+	arg := r.next()
+	if r.err != nil {
+		return stream.ID{}
+	}
+	id, err := stream.ParseStrictID(string(arg))
+	if err != nil {
+		r.err = err
+	}
+	return id
+}
+
+// CmdToStream 解析streamToCmd生成的XRESTORE参数，args不包括命令名和key
+func CmdToStream(args [][]byte) (*stream.Stream, error) {
+	r := &restoreReader{args: args}
+	s := stream.MakeStream()
+	lastID := r.nextID()
+	entriesAdded := r.nextUint()
+	maxDeletedID := r.nextID()
+	entryCount := r.nextInt()
+	for i := int64(0); i < entryCount && r.err == nil; i++ {
+		id := r.nextID()
+		fieldCount := r.nextInt()
+		if r.err != nil {
+			break
+		}
+		if fieldCount < 0 || int64(len(args)-r.pos) < fieldCount {
+			return nil, errIllegalXRestore
+		}
+		fields := args[r.pos : r.pos+int(fieldCount)]
+		r.pos += int(fieldCount)
+		if err := s.Add(id, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	groupCount := r.nextInt()
+	for i := int64(0); i < groupCount && r.err == nil; i++ {
+		group, ok := s.CreateGroup(string(r.next()), r.nextID(), r.nextInt())
+		if r.err != nil {
+			break
+		}
+		if !ok {
+			return nil, errIllegalXRestore
+		}
+		consumerCount := r.nextInt()
+		for j := int64(0); j < consumerCount && r.err == nil; j++ {
+			group.CreateConsumer(string(r.next()), r.nextInt())
+		}
+		pendingCount := r.nextInt()
+		for j := int64(0); j < pendingCount && r.err == nil; j++ {
+			id := r.nextID()
+			consumer, ok := group.GetConsumer(string(r.next()))
+			deliveryTime := r.nextInt()
+			deliveryCount := r.nextUint()
+			if r.err != nil {
+				break
+			}
+			if !ok {
+				return nil, errIllegalXRestore
+			}
+			group.SetPending(id, consumer, deliveryTime, deliveryCount)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(args) {
+		return nil, errIllegalXRestore
+	}
+	s.SetID(lastID, entriesAdded, maxDeletedID)
+	return s, nil
+}
+
 var pExpireAtBytes = []byte("PEXPIREAT")
 
 func MakeExpireCmd(key string, expireAt time.Time) *protocol.MultiBulkReply {
@@ -1,17 +1,28 @@
 package aof
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	rdb "github.com/hdt3213/rdb/encoder"
 	"github.com/hdt3213/rdb/model"
+	rdbparser "github.com/hdt3213/rdb/parser"
 	"gmr/go-cache/config"
 	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/list"
 	"gmr/go-cache/datastruct/set"
 	"gmr/go-cache/datastruct/sortedset"
+	"gmr/go-cache/datastruct/stream"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/parser"
+	"gmr/go-cache/redis/protocol"
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -24,8 +35,34 @@ import (
  * @Date: 2023/08/22 9:39
  */
 
+// StreamAuxKey hdt3213/rdb的encoder不支持写入stream，每个stream以一个aux字段保存，
+// value为RESP格式的[dbIndex, 过期时间毫秒时间戳(0表示不过期), XRESTORE命令...]
+// 真正的Redis加载rdb时会静默丢弃不认识的aux字段，既不报错也不告警，
+// 所以包含stream的rdb文件交给Redis加载会丢失所有stream，这种格式的stream只能由go-cache加载
+const StreamAuxKey = "go-cache-stream"
+
+// FunctionAuxKey Redis Functions不属于任何db，每个library的代码以一个aux字段保存
+const FunctionAuxKey = "go-cache-function"
+
 func (handler *Handler) Rewrite2RDB() error {
-	ctx, err := handler.startRewrite2RDB()
+	rdbFilename := config.Properties.RDBFilename
+	if rdbFilename == "" {
+		rdbFilename = "dump.rdb"
+	}
+	return handler.rewrite2RDBFile(rdbFilename, nil, nil)
+}
+
+// Rewrite2RDBForReplication 为replication生成rdb文件
+// 在确定rdb快照位置时注册listener并调用hook，之后写入aof的命令都会交给listener
+func (handler *Handler) Rewrite2RDBForReplication(rdbFilename string, listener Listener, hook func()) error {
+	return handler.rewrite2RDBFile(rdbFilename, listener, hook)
+}
+
+func (handler *Handler) rewrite2RDBFile(rdbFilename string, listener Listener, hook func()) error {
+	handler.rewriting.Lock()
+	defer handler.rewriting.Unlock()
+
+	ctx, err := handler.startRewrite2RDB(listener, hook)
 	if err != nil {
 		return err
 	}
@@ -33,10 +70,6 @@ func (handler *Handler) Rewrite2RDB() error {
 	if err != nil {
 		return err
 	}
-	rdbFilename := config.Properties.RDBFilename
-	if rdbFilename == "" {
-		rdbFilename = "dump.rdb"
-	}
 	err = ctx.tmpFile.Close()
 	if err != nil {
 		return err
@@ -48,7 +81,7 @@ func (handler *Handler) Rewrite2RDB() error {
 	return nil
 }
 
-func (handler *Handler) startRewrite2RDB() (*RewriteCtx, error) {
+func (handler *Handler) startRewrite2RDB(listener Listener, hook func()) (*RewriteCtx, error) {
 	handler.pausingAof.Lock() // pausing aof
 	defer handler.pausingAof.Unlock()
 
@@ -57,10 +90,18 @@ func (handler *Handler) startRewrite2RDB() (*RewriteCtx, error) {
 		logger.Warn("fsync failed")
 		return nil, err
 	}
+	if listener != nil {
+		handler.listeners[listener] = struct{}{}
+	}
+	if hook != nil {
+		hook()
+	}
 
 	// get current aof file size
-	fileInfo, _ := os.Stat(handler.aofFilename)
-	filesize := fileInfo.Size()
+	fileInfo, err := handler.aofFile.Stat()
+	if err != nil {
+		return nil, err
+	}
 	// create tmp file
 	file, err := ioutil.TempFile("", "*.aof")
 	if err != nil {
@@ -69,15 +110,24 @@ func (handler *Handler) startRewrite2RDB() (*RewriteCtx, error) {
 	}
 	return &RewriteCtx{
 		tmpFile:  file,
-		fileSize: filesize,
+		files:    handler.manifest.files(),
+		fileSize: fileInfo.Size(),
+		useRDB:   true,
 	}, nil
 }
 
 func (handler *Handler) rewrite2RDB(ctx *RewriteCtx) error {
 	// load aof tmpFile
 	tmpHandler := handler.newRewriteHandler()
-	tmpHandler.LoadAof(int(ctx.fileSize))
-	encoder := rdb.NewEncoder(ctx.tmpFile).EnableCompress()
+	if err := tmpHandler.loadFiles(ctx.files, ctx.fileSize, false); err != nil {
+		return err
+	}
+	return writeRDB(ctx.tmpFile, tmpHandler.db)
+}
+
+// writeRDB 将db中的数据以rdb格式写入
+func writeRDB(writer io.Writer, db database.EmbedDB) error {
+	encoder := rdb.NewEncoder(writer).EnableCompress()
 	err := encoder.WriteHeader()
 	if err != nil {
 		return err
@@ -95,9 +145,42 @@ func (handler *Handler) rewrite2RDB(ctx *RewriteCtx) error {
 		}
 	}
 
+	for _, code := range db.FunctionLibraries() {
+		err = encoder.WriteAux(FunctionAuxKey, code)
+		if err != nil {
+			return err
+		}
+	}
+
+	// aux字段只能写在所有db之前，先写入stream并记录每个db中stream的数量
+	streamCounts := make([]int, config.Properties.Databases)
+	streamTTLCounts := make([]int, config.Properties.Databases)
+	for i := 0; i < config.Properties.Databases; i++ {
+		db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			s, ok := entity.Data.(*stream.Stream)
+			if !ok {
+				return true
+			}
+			streamCounts[i]++
+			if expiration != nil {
+				streamTTLCounts[i]++
+			}
+			err = encoder.WriteAux(StreamAuxKey, string(makeStreamAux(i, key, s, expiration)))
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		if streamCounts[i] > 0 {
+			logger.Warn(fmt.Sprintf("db %d: %d streams are saved as go-cache aux fields, Redis will drop them when loading this rdb", i, streamCounts[i]))
+		}
+	}
+
 	for i := 0; i < config.Properties.Databases; i++ {
-		keyCount, ttlCount := tmpHandler.db.GetDBSize(i)
-		if keyCount == 0 {
+		keyCount, ttlCount := db.GetDBSize(i)
+		keyCount -= streamCounts[i]
+		ttlCount -= streamTTLCounts[i]
+		if keyCount <= 0 {
 			continue
 		}
 		err = encoder.WriteDBHeader(uint(i), uint64(keyCount), uint64(ttlCount))
@@ -106,7 +189,7 @@ func (handler *Handler) rewrite2RDB(ctx *RewriteCtx) error {
 		}
 		// dump db
 		var err2 error
-		tmpHandler.db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+		db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
 			var opts []interface{}
 			if expiration != nil {
 				opts = append(opts, rdb.WithTTL(uint64(expiration.UnixNano()/1e6)))
@@ -147,6 +230,9 @@ func (handler *Handler) rewrite2RDB(ctx *RewriteCtx) error {
 					return true
 				})
 				err = encoder.WriteZSetObject(key, entries, opts...)
+			case *stream.Stream:
+				// 已经以aux字段写入
+				return true
 			}
 			if err != nil {
 				err2 = err
@@ -164,3 +250,205 @@ func (handler *Handler) rewrite2RDB(ctx *RewriteCtx) error {
 	}
 	return nil
 }
+
+// loadRDB 将rdb格式的base文件转换为命令后执行
+func (handler *Handler) loadRDB(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := rdbparser.NewDecoder(bufio.NewReader(file)).WithSpecialOpCode()
+	fakeConn := &connection.FakeConn{}
+	dbIndex := 0
+	err = decoder.Parse(func(o model.RedisObject) bool {
+		if aux, ok := o.(*model.AuxObject); ok && aux.Key == FunctionAuxKey {
+			ret := handler.db.Exec(fakeConn, utils.ToCmdLine("FUNCTION", "LOAD", "REPLACE", aux.Value))
+			if protocol.IsErrorReply(ret) {
+				logger.Error("exec err", ret.ToBytes())
+			}
+			return true
+		}
+		if aux, ok := o.(*model.AuxObject); ok && aux.Key == StreamAuxKey {
+			streamDB, expiration, cmdLine, err := ParseStreamAux(aux.Value)
+			if err != nil {
+				logger.Error("illegal stream aux field: " + err.Error())
+				return true
+			}
+			if streamDB != dbIndex {
+				dbIndex = streamDB
+				handler.db.Exec(fakeConn, utils.ToCmdLine("SELECT", strconv.Itoa(dbIndex)))
+			}
+			ret := handler.db.Exec(fakeConn, cmdLine)
+			if protocol.IsErrorReply(ret) {
+				logger.Error("exec err", ret.ToBytes())
+			}
+			if expiration != nil {
+				handler.db.Exec(fakeConn, MakeExpireCmd(string(cmdLine[1]), *expiration).Args)
+			}
+			return true
+		}
+		cmdLine := rdbObjectToCmd(o)
+		if cmdLine == nil {
+			return true
+		}
+		if o.GetDBIndex() != dbIndex {
+			dbIndex = o.GetDBIndex()
+			handler.db.Exec(fakeConn, utils.ToCmdLine("SELECT", strconv.Itoa(dbIndex)))
+		}
+		ret := handler.db.Exec(fakeConn, cmdLine)
+		if protocol.IsErrorReply(ret) {
+			logger.Error("exec err", ret.ToBytes())
+		}
+		if o.GetExpiration() != nil {
+			handler.db.Exec(fakeConn, MakeExpireCmd(o.GetKey(), *o.GetExpiration()).Args)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("load rdb file %s failed: %v", filename, err)
+	}
+	return nil
+}
+
+// rdbObjectToCmd 将rdb中的对象转换为写命令，不支持的类型返回nil
+func rdbObjectToCmd(o model.RedisObject) CmdLine {
+	key := []byte(o.GetKey())
+	switch obj := o.(type) {
+	case *model.StringObject:
+		return CmdLine{setCmd, key, obj.Value}
+	case *model.ListObject:
+		return append(CmdLine{rPushAllCmd, key}, obj.Values...)
+	case *model.SetObject:
+		return append(CmdLine{sAddCmd, key}, obj.Members...)
+	case *model.HashObject:
+		cmdLine := CmdLine{hmSetCmd, key}
+		for field, value := range obj.Hash {
+			cmdLine = append(cmdLine, []byte(field), value)
+		}
+		return cmdLine
+	case *model.ZSetObject:
+		cmdLine := CmdLine{zAddCmd, key}
+		for _, entry := range obj.Entries {
+			cmdLine = append(cmdLine, []byte(strconv.FormatFloat(entry.Score, 'f', -1, 64)), []byte(entry.Member))
+		}
+		return cmdLine
+	case *model.StreamObject:
+		return streamToCmd(o.GetKey(), StreamObjectToStream(obj)).Args
+	}
+	return nil
+}
+
+func makeStreamAux(dbIndex int, key string, s *stream.Stream, expiration *time.Time) []byte {
+	expireAt := "0"
+	if expiration != nil {
+		expireAt = strconv.FormatInt(expiration.UnixNano()/1e6, 10)
+	}
+	args := append([][]byte{[]byte(strconv.Itoa(dbIndex)), []byte(expireAt)}, streamToCmd(key, s).Args...)
+	return protocol.MakeMultiBulkReply(args).ToBytes()
+}
+
+// ParseStreamAux 解析StreamAuxKey的value，返回db、过期时间以及XRESTORE命令
+func ParseStreamAux(value string) (int, *time.Time, CmdLine, error) {
+	reply, err := parser.ParseOne([]byte(value))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	multiBulk, ok := reply.(*protocol.MultiBulkReply)
+	if !ok || len(multiBulk.Args) < 4 {
+		return 0, nil, nil, errors.New("not a stream aux value")
+	}
+	dbIndex, err := strconv.Atoi(string(multiBulk.Args[0]))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	expireAt, err := strconv.ParseInt(string(multiBulk.Args[1]), 10, 64)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	var expiration *time.Time
+	if expireAt > 0 {
+		t := time.Unix(0, expireAt*int64(time.Millisecond))
+		expiration = &t
+	}
+	return dbIndex, expiration, multiBulk.Args[2:], nil
+}
+
+// StreamObjectToStream 将Redis rdb中的stream转换为stream.Stream
+func StreamObjectToStream(obj *model.StreamObject) *stream.Stream {
+	s := stream.MakeStream()
+	for _, node := range obj.Entries {
+		for _, msg := range node.Msgs {
+			if msg.Deleted {
+				continue
+			}
+			_ = s.Add(toStreamID(msg.Id), streamMessageFields(node.Fields, msg.Fields))
+		}
+	}
+
+	for _, g := range obj.Groups {
+		entriesRead := int64(-1)
+		if obj.IsV2 {
+			entriesRead = int64(g.EntriesRead)
+		}
+		group, ok := s.CreateGroup(g.Name, toStreamID(g.LastId), entriesRead)
+		if !ok {
+			continue
+		}
+		nacks := make(map[stream.ID]*model.StreamNAck, len(g.Pending))
+		for _, nack := range g.Pending {
+			nacks[toStreamID(nack.Id)] = nack
+		}
+		for _, c := range g.Consumers {
+			consumer, _ := group.CreateConsumer(c.Name, int64(c.SeenTime))
+			for _, pendingID := range c.Pending {
+				id := toStreamID(pendingID)
+				if nack, ok := nacks[id]; ok {
+					group.SetPending(id, consumer, int64(nack.DeliveryTime), nack.DeliveryCount)
+				}
+			}
+		}
+	}
+
+	entriesAdded := obj.Length
+	if obj.IsV2 {
+		entriesAdded = obj.AddedEntriesCount
+	}
+	maxDeletedID := stream.MinID
+	if obj.MaxDeletedId != nil {
+		maxDeletedID = toStreamID(obj.MaxDeletedId)
+	}
+	s.SetID(toStreamID(obj.LastId), entriesAdded, maxDeletedID)
+	return s
+}
+
+func toStreamID(id *model.StreamId) stream.ID {
+	if id == nil {
+		return stream.MinID
+	}
+	return stream.ID{Ms: id.Ms, Seq: id.Sequence}
+}
+
+// streamMessageFields 按照master entry中field的顺序返回field和value，其他field按照名称排序
+func streamMessageFields(masterFields []string, fields map[string]string) [][]byte {
+	result := make([][]byte, 0, len(fields)*2)
+	seen := make(map[string]struct{}, len(masterFields))
+	for _, field := range masterFields {
+		if value, ok := fields[field]; ok {
+			result = append(result, []byte(field), []byte(value))
+			seen[field] = struct{}{}
+		}
+	}
+	var others []string
+	for field := range fields {
+		if _, ok := seen[field]; !ok {
+			others = append(others, field)
+		}
+	}
+	sort.Strings(others)
+	for _, field := range others {
+		result = append(result, []byte(field), []byte(fields[field]))
+	}
+	return result
+}
@@ -24,68 +24,95 @@ import (
 func (handler *Handler) newRewriteHandler() *Handler {
 	h := &Handler{}
 	h.aofFilename = handler.aofFilename
+	h.aofDir = handler.aofDir
 	h.db = handler.tmpDBMaker()
 	return h
 }
 
 // RewriteCtx holds context of an AOF rewriting procedure
 type RewriteCtx struct {
-	tmpFile  *os.File
+	tmpFile *os.File
+	// files 开始重写时需要加载的文件
+	files []*aofInfo
+	// fileSize 不小于0时只读取最后一个文件的前fileSize字节
 	fileSize int64
-	dbIdx    int // selected db index when startRewrite
+	// useRDB base文件是否为rdb格式
+	useRDB bool
 }
 
 // Rewrite carries out AOF rewrite
+// 开始时切换到新的incr文件，将之前的base和incr合并为新的base，完成后删除旧文件
 func (handler *Handler) Rewrite() error {
+	handler.rewriting.Lock()
+	defer handler.rewriting.Unlock()
+
 	ctx, err := handler.StartRewrite()
 	if err != nil {
 		return err
 	}
 	err = handler.DoRewrite(ctx)
 	if err != nil {
+		_ = ctx.tmpFile.Close()
+		_ = os.Remove(ctx.tmpFile.Name())
 		return err
 	}
-
-	handler.FinishRewrite(ctx)
-	return nil
+	return handler.FinishRewrite(ctx)
 }
 
 // DoRewrite actually rewrite aof file
 // makes DoRewrite public for testing only, please use Rewrite instead
 func (handler *Handler) DoRewrite(ctx *RewriteCtx) error {
-	tmpFile := ctx.tmpFile
-
 	// load aof tmpFile
 	tmpAof := handler.newRewriteHandler()
-	tmpAof.LoadAof(int(ctx.fileSize))
+	if err := tmpAof.loadFiles(ctx.files, ctx.fileSize, false); err != nil {
+		return err
+	}
+	if ctx.useRDB {
+		return writeRDB(ctx.tmpFile, tmpAof.db)
+	}
+	return writeAof(ctx.tmpFile, tmpAof.db)
+}
 
-	// rewrite aof tmpFile
+// writeAof 将db中的数据以命令的形式写入
+func writeAof(writer io.Writer, db database.EmbedDB) error {
+	// function不属于任何db，在所有数据之前写入
+	for _, code := range db.FunctionLibraries() {
+		data := protocol.MakeMultiBulkReply(utils.ToCmdLine("FUNCTION", "LOAD", "REPLACE", code)).ToBytes()
+		_, err := writer.Write(data)
+		if err != nil {
+			return err
+		}
+	}
 	for i := 0; i < config.Properties.Databases; i++ {
 		// select db
 		data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(i))).ToBytes()
-		_, err := tmpFile.Write(data)
+		_, err := writer.Write(data)
 		if err != nil {
 			return err
 		}
 		// dump db
-		tmpAof.db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+		db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
 			cmd := EntityToCmd(key, entity)
 			if cmd != nil {
-				_, _ = tmpFile.Write(cmd.ToBytes())
+				_, err = writer.Write(cmd.ToBytes())
 			}
-			if expiration != nil {
+			if err == nil && expiration != nil {
 				cmd := MakeExpireCmd(key, *expiration)
 				if cmd != nil {
-					_, _ = tmpFile.Write(cmd.ToBytes())
+					_, err = writer.Write(cmd.ToBytes())
 				}
 			}
-			return true
+			return err == nil
 		})
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // StartRewrite prepares rewrite procedure
+// 切换到新的incr文件并写入manifest，之前的文件不再变化，可以在不暂停aof的情况下读取
 func (handler *Handler) StartRewrite() (*RewriteCtx, error) {
 	handler.pausingAof.Lock() // pausing aof
 	defer handler.pausingAof.Unlock()
@@ -96,73 +123,80 @@ func (handler *Handler) StartRewrite() (*RewriteCtx, error) {
 		return nil, err
 	}
 
-	// get current aof file size
-	fileInfo, _ := os.Stat(handler.aofFilename)
-	filesize := fileInfo.Size()
+	files := handler.manifest.files()
+	incr := handler.manifest.nextIncr(handler.aofFilename)
+	incrFile, err := os.OpenFile(handler.path(incr), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	handler.manifest.incrs = append(handler.manifest.incrs, incr)
+	if err := handler.manifest.save(handler.manifestPath()); err != nil {
+		handler.manifest.incrs = handler.manifest.incrs[:len(handler.manifest.incrs)-1]
+		_ = incrFile.Close()
+		_ = os.Remove(incrFile.Name())
+		return nil, err
+	}
+	_ = handler.aofFile.Close()
+	handler.aofFile = incrFile
+	// 加载每个文件时都从db 0开始
+	handler.currentDB = 0
 
 	// create tmp file
-	file, err := ioutil.TempFile("", "*.aof")
+	file, err := ioutil.TempFile(handler.aofDir, "temp-rewrite-*")
 	if err != nil {
 		logger.Warn("tmp file create failed")
 		return nil, err
 	}
 	return &RewriteCtx{
 		tmpFile:  file,
-		fileSize: filesize,
-		dbIdx:    handler.currentDB,
+		files:    files,
+		fileSize: -1,
+		useRDB:   config.Properties.AofUseRdbPreamble,
 	}, nil
 }
 
 // FinishRewrite finish rewrite procedure
-func (handler *Handler) FinishRewrite(ctx *RewriteCtx) {
-	handler.pausingAof.Lock() // pausing aof
-	defer handler.pausingAof.Unlock()
-
+// 用新的base替换重写开始前的文件，manifest写入成功后删除旧文件
+func (handler *Handler) FinishRewrite(ctx *RewriteCtx) error {
 	tmpFile := ctx.tmpFile
-	// write commands executed during rewriting to tmp file
-	src, err := os.Open(handler.aofFilename)
-	if err != nil {
-		logger.Error("open aofFilename failed: " + err.Error())
-		return
+	err := tmpFile.Sync()
+	if err == nil {
+		err = tmpFile.Close()
 	}
-	defer func() {
-		_ = src.Close()
-	}()
-	_, err = src.Seek(ctx.fileSize, 0)
 	if err != nil {
-		logger.Error("seek failed: " + err.Error())
-		return
+		_ = os.Remove(tmpFile.Name())
+		return err
 	}
 
-	// sync tmpFile's db index with online aofFile
-	data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(ctx.dbIdx))).ToBytes()
-	_, err = tmpFile.Write(data)
-	if err != nil {
-		logger.Error("tmp file rewrite failed: " + err.Error())
-		return
+	handler.pausingAof.Lock() // pausing aof
+	defer handler.pausingAof.Unlock()
+
+	base := handler.manifest.nextBase(handler.aofFilename, ctx.useRDB)
+	if err := os.Rename(tmpFile.Name(), handler.path(base)); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
 	}
-	// copy data
-	_, err = io.Copy(tmpFile, src)
-	if err != nil {
-		logger.Error("copy aof filed failed: " + err.Error())
-		return
+	replaced := make(map[*aofInfo]struct{})
+	for _, info := range ctx.files {
+		replaced[info] = struct{}{}
 	}
-
-	// replace current aof file by tmp file
-	_ = handler.aofFile.Close()
-	_ = os.Rename(tmpFile.Name(), handler.aofFilename)
-
-	// reopen aof file for further write
-	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
-		panic(err)
+	m := &manifest{base: base}
+	for _, info := range handler.manifest.incrs {
+		if _, ok := replaced[info]; !ok {
+			m.incrs = append(m.incrs, info)
+		}
 	}
-	handler.aofFile = aofFile
+	if err := m.save(handler.manifestPath()); err != nil {
+		_ = os.Remove(handler.path(base))
+		return err
+	}
+	handler.manifest = m
 
-	// write select command again to ensure aof file has the same db index with  handler.currentDB
-	data = protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(handler.currentDB))).ToBytes()
-	_, err = handler.aofFile.Write(data)
-	if err != nil {
-		panic(err)
+	for _, info := range ctx.files {
+		if err := os.Remove(handler.path(info)); err != nil {
+			logger.Warn("remove " + info.name + " failed: " + err.Error())
+		}
 	}
+	logger.Info("aof rewrite finished, base " + base.name)
+	return nil
 }
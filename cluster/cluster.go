@@ -0,0 +1,220 @@
+package cluster
+
+import (
+	"fmt"
+	"gmr/go-cache/config"
+	database2 "gmr/go-cache/database"
+	"gmr/go-cache/datastruct/dict"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/consistenthash"
+	"gmr/go-cache/lib/hashslot"
+	"gmr/go-cache/lib/idgenerator"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/pool"
+	"gmr/go-cache/lib/raft"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+/**
+ * @Author: wanglei
+ * @File: cluster
+ * @Version: 1.0.0
+ * @Description: 集群模式，根据key将命令转发到所在节点执行
+ * @Date: 2026/10/18 10:12
+ */
+
+// 一致性hash中每个节点的虚拟节点数
+const replicas = 4
+
+// CmdLine 命令行参数
+type CmdLine = [][]byte
+
+// Cluster 集群中的一个节点，本地数据保存在db中，其他节点的数据通过连接池转发
+type Cluster struct {
+	self string
+
+	// mu保护节点列表、peerPicker和连接池，节点变更时会被替换
+	mu             sync.RWMutex
+	nodes          []string
+	peerPicker     PeerPicker
+	peerConnection map[string]*pool.Pool
+	// 节点变更后数据迁移期间的旧拓扑，迁移完成后清空
+	oldNodes       []string
+	oldPicker      PeerPicker
+	migratingNodes map[string]struct{}
+	migration      *migrationStatus
+	// rehashEpoch 开启failover时当前rehash对应的setnodes日志index，用于忽略过期的迁移完成通知
+	rehashEpoch uint64
+
+	// 开启cluster-failover时由Raft同步的拓扑，masters和replicas同样由mu保护
+	raft         *raft.Node
+	raftVoters   []string
+	failoverStop chan struct{}
+	// masters 发生过故障转移的分片当前的master
+	masters map[string]string
+	// replicas replica地址到所复制分片的映射
+	replicas map[string]string
+	// replicaOf 本节点当前复制的master，只在应用日志时修改
+	replicaOf string
+
+	db database.EmbedDB
+
+	// 本节点作为参与者的分布式事务
+	transactions dict.Dict
+	idGenerator  *idgenerator.IDGenerator
+}
+
+func MakeCluster() *Cluster {
+	cluster := &Cluster{
+		self:           config.Properties.Self,
+		db:             database2.NewStandaloneServer(),
+		peerConnection: make(map[string]*pool.Pool),
+		transactions:   dict.MakeConcurrentDict(16),
+		idGenerator:    idgenerator.MakeIDGenerator(config.Properties.Self),
+		migration:      &migrationStatus{},
+		masters:        make(map[string]string),
+		replicas:       make(map[string]string),
+	}
+
+	nodes := make([]string, 0, len(config.Properties.Peers)+1)
+	for _, peer := range config.Properties.Peers {
+		peer = strings.TrimSpace(peer)
+		if peer == "" || peer == cluster.self {
+			continue
+		}
+		nodes = append(nodes, peer)
+		cluster.peerConnection[peer] = makePeerPool(peer)
+	}
+	// replica不持有数据分片，也不参与选举
+	if config.Properties.ClusterReplicaOf == "" {
+		nodes = append(nodes, cluster.self)
+	}
+	cluster.peerPicker = makePeerPicker(nodes)
+	cluster.nodes = nodes
+	if config.Properties.ClusterFailover {
+		cluster.startFailover(append([]string{}, nodes...))
+	}
+	return cluster
+}
+
+// PeerPicker 根据key选择所在的节点
+type PeerPicker interface {
+	AddNode(nodes ...string)
+	PickNode(key string) string
+}
+
+// makePeerPicker 根据配置使用一致性hash或者Redis Cluster的hash slot
+func makePeerPicker(nodes []string) PeerPicker {
+	var picker PeerPicker
+	if config.Properties.ClusterSlots {
+		picker = hashslot.New()
+	} else {
+		picker = consistenthash.New(replicas, nil)
+	}
+	picker.AddNode(nodes...)
+	return picker
+}
+
+// CmdFunc 集群模式下需要特殊处理的命令
+type CmdFunc func(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply
+
+func (cluster *Cluster) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Reply) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error(fmt.Sprintf("error occurs: %v\n%s", err, string(debug.Stack())))
+			result = &protocol.UnknownErrorReply{}
+		}
+	}()
+
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		return database2.Auth(c, cmdLine[1:])
+	}
+	if !database2.IsAuthenticated(c) {
+		return protocol.MakeErrorReply("NOAUTH Authentication required")
+	}
+
+	internal := isPeerCommand(cmdName) || database2.IsInternalCommand(cmdName)
+	if internal && cmdName != peerCmd && c.GetRole() != connection.PeerCli {
+		return protocol.MakeErrorReply("ERR unknown command '" + cmdName + "'")
+	}
+
+	if !isPeerCommand(cmdName) {
+		write, read, _ := database2.GetRelatedKeys(cmdLine)
+		if errReply := cluster.checkSameSlot(append(write, read...)); errReply != nil {
+			return errReply
+		}
+	}
+
+	if c.InMultiState() {
+		return cluster.execTxInMulti(c, cmdLine)
+	}
+
+	cmdFunc, ok := router[cmdName]
+	if !ok {
+		cmdFunc = defaultFunc
+	}
+	return cmdFunc(cluster, c, cmdLine)
+}
+
+func (cluster *Cluster) AfterClientClose(c redis.Connection) {
+	cluster.db.AfterClientClose(c)
+}
+
+func (cluster *Cluster) Close() {
+	cluster.stopFailover()
+	cluster.db.Close()
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	for _, p := range cluster.peerConnection {
+		p.Close()
+	}
+}
+
+// pickNode 返回key所在分片当前的master
+func (cluster *Cluster) pickNode(key string) string {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	return cluster.resolveLocked(cluster.peerPicker.PickNode(key))
+}
+
+// getNodes 返回集群中所有分片当前的master，迁移期间包括旧拓扑中的节点
+func (cluster *Cluster) getNodes() []string {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	shards := unionStrings(cluster.nodes, cluster.oldNodes)
+	nodes := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		nodes = append(nodes, cluster.resolveLocked(shard))
+	}
+	return unionStrings(nodes)
+}
+
+// pickNodeForKeys 返回keys所在的节点，keys分布在多个节点上时返回错误
+func (cluster *Cluster) pickNodeForKeys(keys []string) (string, redis.Reply) {
+	node := ""
+	for _, key := range keys {
+		peer := cluster.pickNode(key)
+		if node == "" {
+			node = peer
+		} else if node != peer {
+			return "", protocol.MakeErrorReply("CROSSSLOT Keys in request don't hash to the same node")
+		}
+	}
+	return node, nil
+}
+
+// groupByPeer 将keys按所在节点分组
+func (cluster *Cluster) groupByPeer(keys []string) map[string][]string {
+	result := make(map[string][]string)
+	for _, key := range keys {
+		peer := cluster.pickNode(key)
+		result[peer] = append(result[peer], key)
+	}
+	return result
+}
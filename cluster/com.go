@@ -0,0 +1,216 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"errors"
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/pool"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/client"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"net"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: com
+ * @Version: 1.0.0
+ * @Description: 节点间通信，通过连接池向其他节点转发命令
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	peerMaxIdle   = 1
+	peerMaxActive = 16
+)
+
+// peerCmd 连接池建立连接之后发送的握手命令，通过之后连接可以执行节点间的内部命令
+const peerCmd = "_peer"
+
+// clusterSecret 节点握手使用的密钥，没有单独配置时使用requirepass
+func clusterSecret() string {
+	if config.Properties.ClusterSecret != "" {
+		return config.Properties.ClusterSecret
+	}
+	return config.Properties.RequirePass
+}
+
+// isPeerCommand 节点间的内部命令，客户端直接发送时会绕过路由和转发检查
+func isPeerCommand(cmdName string) bool {
+	if strings.HasPrefix(cmdName, "_") {
+		return true
+	}
+	switch cmdName {
+	case "prepare", "commit", "rollback":
+		return true
+	}
+	return false
+}
+
+// execPeer _peer node [secret]
+func execPeer(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 2 && len(cmdLine) != 3 {
+		return protocol.MakeArgNumErrorReply(peerCmd)
+	}
+	if secret := clusterSecret(); secret != "" {
+		if len(cmdLine) != 3 || subtle.ConstantTimeCompare(cmdLine[2], []byte(secret)) != 1 {
+			return protocol.MakeErrorReply("ERR invalid cluster secret")
+		}
+	} else if !cluster.isNodeHost(c) {
+		return protocol.MakeErrorReply("ERR peer handshake from unknown host")
+	}
+	c.SetRole(connection.PeerCli)
+	return protocol.MakeOkReply()
+}
+
+// isNodeHost 没有密钥时，只接受来自已知节点所在主机的握手
+func (cluster *Cluster) isNodeHost(c redis.Connection) bool {
+	conn, ok := c.(interface{ RemoteAddr() net.Addr })
+	if !ok {
+		return false
+	}
+	remoteHost, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+	remoteIP := net.ParseIP(remoteHost)
+	cluster.mu.RLock()
+	nodes := unionStrings(config.Properties.Peers, cluster.nodes, cluster.oldNodes)
+	for peer := range cluster.peerConnection {
+		nodes = append(nodes, peer)
+	}
+	cluster.mu.RUnlock()
+	for _, node := range nodes {
+		host, _, err := net.SplitHostPort(strings.TrimSpace(node))
+		if err != nil {
+			continue
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if ip.Equal(remoteIP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func makePeerPool(peer string) *pool.Pool {
+	factory := func() (interface{}, error) {
+		c, err := client.MakeClient(peer)
+		if err != nil {
+			return nil, err
+		}
+		c.Start()
+		if config.Properties.RequirePass != "" {
+			result := c.Send(utils.ToCmdLine("AUTH", config.Properties.RequirePass))
+			if !protocol.IsOKReply(result) {
+				c.Close()
+				return nil, errors.New("auth with peer failed: " + string(result.ToBytes()))
+			}
+		}
+		result := c.Send(utils.ToCmdLine(peerCmd, config.Properties.Self, clusterSecret()))
+		if !protocol.IsOKReply(result) {
+			c.Close()
+			return nil, errors.New("handshake with peer failed: " + string(result.ToBytes()))
+		}
+		return c, nil
+	}
+	finalizer := func(x interface{}) {
+		c, ok := x.(*client.Client)
+		if !ok || c.IsClosed() {
+			return
+		}
+		c.Close()
+	}
+	return pool.New(factory, finalizer, pool.Config{
+		MaxIdle:   peerMaxIdle,
+		MaxActive: peerMaxActive,
+	})
+}
+
+// getPeerPool 故障转移之后的master和replica不在配置中，连接池在第一次使用时创建
+func (cluster *Cluster) getPeerPool(peer string) *pool.Pool {
+	cluster.mu.RLock()
+	connPool, ok := cluster.peerConnection[peer]
+	cluster.mu.RUnlock()
+	if ok {
+		return connPool
+	}
+	cluster.mu.Lock()
+	defer cluster.mu.Unlock()
+	if connPool, ok = cluster.peerConnection[peer]; !ok {
+		connPool = makePeerPool(peer)
+		cluster.peerConnection[peer] = connPool
+	}
+	return connPool
+}
+
+func (cluster *Cluster) getPeerClient(peer string) (*client.Client, error) {
+	connPool := cluster.getPeerPool(peer)
+	raw, err := connPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := raw.(*client.Client)
+	if !ok {
+		return nil, errors.New("connection pool make wrong type")
+	}
+	return conn, nil
+}
+
+func (cluster *Cluster) returnPeerClient(peer string, peerClient *client.Client) {
+	connPool := cluster.getPeerPool(peer)
+	if peerClient.IsClosed() {
+		// 与peer的连接已经断开，不再放回连接池
+		connPool.Discard(peerClient)
+		return
+	}
+	connPool.Put(peerClient)
+}
+
+// relay 将命令转发到peer执行，peer为本节点时直接在本地执行
+func (cluster *Cluster) relay(peer string, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if peer == cluster.self {
+		return cluster.execSelf(c, cmdLine)
+	}
+	peerClient, err := cluster.getPeerClient(peer)
+	if err != nil {
+		return protocol.MakeErrorReply(err.Error())
+	}
+	defer cluster.returnPeerClient(peer, peerClient)
+
+	// 连接池中的连接是共享的，每次转发前选择当前连接的db
+	selectResult := peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex())))
+	if protocol.IsErrorReply(selectResult) {
+		return selectResult
+	}
+	return peerClient.Send(cmdLine)
+}
+
+// broadcast 在所有节点上执行命令，命令以_local转发，避免peer再次广播
+func (cluster *Cluster) broadcast(c redis.Connection, cmdLine CmdLine) map[string]redis.Reply {
+	localCmdLine := append([][]byte{[]byte(localCmd)}, cmdLine...)
+	result := make(map[string]redis.Reply)
+	for _, node := range cluster.getNodes() {
+		var reply redis.Reply
+		if node == cluster.self {
+			reply = cluster.db.Exec(c, cmdLine)
+		} else {
+			reply = cluster.relay(node, c, localCmdLine)
+		}
+		if protocol.IsErrorReply(reply) {
+			logger.Error("broadcast to " + node + " failed: " + string(reply.ToBytes()))
+		}
+		result[node] = reply
+	}
+	return result
+}
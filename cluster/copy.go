@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: copy
+ * @Version: 1.0.0
+ * @Description: 集群模式下的COPY，跨节点时通过分布式事务复制数据
+ * @Date: 2026/10/18 10:12
+ */
+
+// Copy COPY source destination [REPLACE]，集群模式下不支持DB选项
+func Copy(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 3 {
+		return protocol.MakeArgNumErrorReply("copy")
+	}
+	src := string(cmdLine[1])
+	dest := string(cmdLine[2])
+	replaceFlag := false
+	for _, arg := range cmdLine[3:] {
+		switch strings.ToLower(string(arg)) {
+		case "replace":
+			replaceFlag = true
+		case "db":
+			return protocol.MakeErrorReply("ERR COPY with DB option is not supported in cluster mode")
+		default:
+			return protocol.MakeSyntaxErrorReply()
+		}
+	}
+	if errReply := cluster.checkSameSlot([]string{src, dest}); errReply != nil {
+		return errReply
+	}
+	srcNode := cluster.pickNode(src)
+	destNode := cluster.pickNode(dest)
+	if srcNode == destNode {
+		return cluster.relay(srcNode, c, cmdLine)
+	}
+
+	return cluster.execCrossNode(c, []string{dest}, []string{src}, nil, func(tmpDB database.EmbedDB, conn redis.Connection) redis.Reply {
+		dump, ok := tmpDB.ExecWithLock(conn, utils.ToCmdLine("DumpKey", src)).(*protocol.MultiBulkReply)
+		if !ok || len(dump.Args) != 2 {
+			return protocol.MakeIntReply(0)
+		}
+		if !replaceFlag {
+			exist, ok := tmpDB.ExecWithLock(conn, utils.ToCmdLine("ExistIn", dest)).(*protocol.MultiBulkReply)
+			if ok && len(exist.Args) > 0 {
+				return protocol.MakeIntReply(0)
+			}
+		}
+		resp := tmpDB.ExecWithLock(conn, utils.ToCmdLineByByte("CopyTo", []byte(dest), dump.Args[0], dump.Args[1]))
+		if protocol.IsErrorReply(resp) {
+			return resp
+		}
+		return protocol.MakeIntReply(1)
+	})
+}
@@ -0,0 +1,308 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/raft"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: failover
+ * @Version: 1.0.0
+ * @Description: 由Raft日志维护的集群拓扑，leader检测master下线后自动提升replica
+ *               Raft状态保存在cluster-config-file中，voter固定为配置中的master节点
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	topologySetNodes  = "setnodes"
+	topologyMigrated  = "migrated"
+	topologyReplicate = "replicate"
+	topologyFailover  = "failover"
+
+	defaultNodeTimeout = 5000 * time.Millisecond
+	// proposeRetryDelay 没有leader时重试提议的间隔
+	proposeRetryDelay = time.Second
+	maxProposeRetry   = 30
+)
+
+// topologyCmd 一条拓扑变更日志
+// 分片以最初的master地址命名，故障转移之后通过masters找到当前的master
+type topologyCmd struct {
+	Op string `json:"op"`
+	// Node setnodes之外的命令操作的节点
+	Node string `json:"node,omitempty"`
+	// Shard replicate和failover所属的分片
+	Shard    string   `json:"shard,omitempty"`
+	OldNodes []string `json:"oldNodes,omitempty"`
+	NewNodes []string `json:"newNodes,omitempty"`
+	// Epoch migrated对应的setnodes日志index
+	Epoch uint64 `json:"epoch,omitempty"`
+}
+
+func nodeTimeout() time.Duration {
+	if config.Properties.ClusterNodeTimeout <= 0 {
+		return defaultNodeTimeout
+	}
+	return time.Duration(config.Properties.ClusterNodeTimeout) * time.Millisecond
+}
+
+// startFailover 启动Raft，replica节点向集群登记后开始复制master
+func (cluster *Cluster) startFailover(voters []string) {
+	cluster.raftVoters = voters
+	stateFile := config.Properties.ClusterConfigFile
+	if stateFile == "" {
+		stateFile = "raft-" + strconv.Itoa(config.Properties.Port) + ".json"
+	}
+	node, err := raft.NewNode(raft.Config{
+		ID:                cluster.self,
+		Voters:            voters,
+		HeartbeatInterval: raftHeartbeatInterval,
+		ElectionTimeout:   raftElectionTimeout,
+		Transport:         &raftTransport{cluster: cluster},
+		Apply:             cluster.applyTopology,
+		StateFile:         stateFile,
+	})
+	if err != nil {
+		panic(err)
+	}
+	cluster.raft = node
+	cluster.raft.Start()
+	cluster.failoverStop = make(chan struct{})
+	go cluster.detectFailure()
+
+	if master := config.Properties.ClusterReplicaOf; master != "" {
+		cluster.syncMaster(master)
+		go cluster.proposeWithRetry(&topologyCmd{Op: topologyReplicate, Node: cluster.self, Shard: master})
+	}
+}
+
+func (cluster *Cluster) stopFailover() {
+	if cluster.raft == nil {
+		return
+	}
+	close(cluster.failoverStop)
+	cluster.raft.Stop()
+}
+
+func (cluster *Cluster) proposeWithRetry(cmd *topologyCmd) {
+	for i := 0; i < maxProposeRetry; i++ {
+		err := cluster.propose(cmd)
+		if err == nil {
+			return
+		}
+		logger.Error("propose " + cmd.Op + " failed: " + err.Error())
+		time.Sleep(proposeRetryDelay)
+	}
+}
+
+// resolveLocked 返回分片当前的master，调用方需持有mu
+func (cluster *Cluster) resolveLocked(shard string) string {
+	if master, ok := cluster.masters[shard]; ok {
+		return master
+	}
+	return shard
+}
+
+// shardOfLocked 返回以addr为master的分片，调用方需持有mu
+func (cluster *Cluster) shardOfLocked(addr string) string {
+	for shard, master := range cluster.masters {
+		if master == addr {
+			return shard
+		}
+	}
+	return addr
+}
+
+// isMasterLocked 本节点是否为某个分片当前的master，调用方需持有mu
+func (cluster *Cluster) isMasterLocked() bool {
+	return containsNode(unionStrings(cluster.nodes, cluster.oldNodes), cluster.shardOfLocked(cluster.self)) &&
+		cluster.resolveLocked(cluster.shardOfLocked(cluster.self)) == cluster.self
+}
+
+// applyTopology 应用一条已提交的拓扑变更，所有节点以相同顺序应用
+func (cluster *Cluster) applyTopology(entry raft.Entry) {
+	cmd := &topologyCmd{}
+	if err := json.Unmarshal(entry.Data, cmd); err != nil {
+		logger.Error("illegal topology entry: " + err.Error())
+		return
+	}
+	switch cmd.Op {
+	case topologySetNodes:
+		if err := cluster.setNodes(cmd.OldNodes, cmd.NewNodes); err != nil {
+			logger.Error("apply setnodes failed: " + err.Error())
+			return
+		}
+		cluster.mu.Lock()
+		cluster.rehashEpoch = entry.Index
+		exporting := containsNode(cmd.OldNodes, cluster.shardOfLocked(cluster.self)) && cluster.isMasterLocked()
+		cluster.mu.Unlock()
+		if exporting && atomic.CompareAndSwapInt32(&cluster.migration.running, 0, 1) {
+			go cluster.migrate()
+		}
+	case topologyMigrated:
+		cluster.mu.RLock()
+		current := cluster.rehashEpoch == cmd.Epoch
+		cluster.mu.RUnlock()
+		if current {
+			cluster.finishMigration(cmd.Node)
+		}
+	case topologyReplicate:
+		cluster.mu.Lock()
+		shard := cluster.shardOfLocked(cmd.Shard)
+		cluster.replicas[cmd.Node] = shard
+		cluster.mu.Unlock()
+		cluster.raft.AddLearner(cmd.Node)
+		logger.Info(cmd.Node + " replicates " + shard)
+	case topologyFailover:
+		cluster.mu.Lock()
+		oldMaster := cluster.resolveLocked(cmd.Shard)
+		cluster.masters[cmd.Shard] = cmd.Node
+		delete(cluster.replicas, cmd.Node)
+		if oldMaster != cmd.Node {
+			// 旧master恢复后作为replica重新加入
+			cluster.replicas[oldMaster] = cmd.Shard
+		}
+		cluster.mu.Unlock()
+		cluster.raft.AddLearner(oldMaster)
+		logger.Info(fmt.Sprintf("failover of %s: %s -> %s", cmd.Shard, oldMaster, cmd.Node))
+	default:
+		logger.Error("unknown topology op: " + cmd.Op)
+	}
+	cluster.syncRole()
+}
+
+// adminConn 本节点内部执行管理命令使用的连接
+func adminConn() redis.Connection {
+	conn := &connection.FakeConn{}
+	conn.SetPassword(config.Properties.RequirePass)
+	return conn
+}
+
+// syncMaster 通过SLAVEOF切换本节点复制的master，master为空时切换为master
+func (cluster *Cluster) syncMaster(master string) {
+	cmdLine := utils.ToCmdLine("SLAVEOF", "NO", "ONE")
+	if master != "" {
+		host, port := splitHostPort(master)
+		cmdLine = utils.ToCmdLine("SLAVEOF", host, strconv.Itoa(port))
+	}
+	resp := cluster.db.Exec(adminConn(), cmdLine)
+	if protocol.IsErrorReply(resp) {
+		logger.Error("slaveof " + master + " failed: " + string(resp.ToBytes()))
+		return
+	}
+	cluster.replicaOf = master
+	if master == "" {
+		logger.Info("promoted to master")
+	} else {
+		logger.Info("replicating " + master)
+	}
+}
+
+// syncRole 根据拓扑调整本节点的复制关系，只在应用日志时调用
+// 既不是master也没有登记为replica的节点保持原状
+func (cluster *Cluster) syncRole() {
+	cluster.mu.RLock()
+	master, known := "", false
+	if shard, ok := cluster.replicas[cluster.self]; ok {
+		master, known = cluster.resolveLocked(shard), true
+	} else if cluster.isMasterLocked() {
+		known = true
+	}
+	cluster.mu.RUnlock()
+	if known && master != cluster.replicaOf {
+		cluster.syncMaster(master)
+	}
+}
+
+// shardMasters 返回所有分片及其当前的master
+func (cluster *Cluster) shardMasters() map[string]string {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	result := make(map[string]string)
+	for _, shard := range unionStrings(cluster.nodes, cluster.oldNodes) {
+		result[shard] = cluster.resolveLocked(shard)
+	}
+	return result
+}
+
+// shardReplicas 返回分片的所有replica，按地址排序
+func (cluster *Cluster) shardReplicas(shard string) []string {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	result := make([]string, 0)
+	for replica, s := range cluster.replicas {
+		if s == shard {
+			result = append(result, replica)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (cluster *Cluster) pingNode(node string) bool {
+	resp := cluster.relay(node, &connection.FakeConn{}, utils.ToCmdLine("PING"))
+	return !protocol.IsErrorReply(resp)
+}
+
+// detectFailure 由leader定期PING所有master，超过nodeTimeout无响应时提升一个可以连接的replica
+func (cluster *Cluster) detectFailure() {
+	ticker := time.NewTicker(raftElectionTimeout)
+	defer ticker.Stop()
+	lastSeen := make(map[string]time.Time)
+	for {
+		select {
+		case <-cluster.failoverStop:
+			return
+		case <-ticker.C:
+		}
+		if !cluster.raft.IsLeader() {
+			lastSeen = make(map[string]time.Time)
+			continue
+		}
+		now := time.Now()
+		for shard, master := range cluster.shardMasters() {
+			if master == cluster.self || cluster.pingNode(master) {
+				lastSeen[master] = now
+				continue
+			}
+			seen, ok := lastSeen[master]
+			if !ok {
+				// 刚成为leader，从现在开始计时
+				lastSeen[master] = now
+				continue
+			}
+			if now.Sub(seen) < nodeTimeout() {
+				continue
+			}
+			promoted := ""
+			for _, replica := range cluster.shardReplicas(shard) {
+				if replica != master && cluster.pingNode(replica) {
+					promoted = replica
+					break
+				}
+			}
+			if promoted == "" {
+				logger.Error(master + " is down and has no available replica")
+				continue
+			}
+			err := cluster.propose(&topologyCmd{Op: topologyFailover, Node: promoted, Shard: shard})
+			if err != nil {
+				logger.Error("failover " + master + " failed: " + err.Error())
+				continue
+			}
+			delete(lastSeen, master)
+		}
+	}
+}
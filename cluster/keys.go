@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+)
+
+/**
+ * @Author: wanglei
+ * @File: keys
+ * @Version: 1.0.0
+ * @Description: 集群模式下涉及多个节点的key命令
+ * @Date: 2026/10/18 10:12
+ */
+
+func argsToKeys(args [][]byte) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys
+}
+
+// sumIntReplies 将keys按节点分组执行命令，返回各节点IntReply之和
+func (cluster *Cluster) sumIntReplies(c redis.Connection, cmdName string, keys []string) redis.Reply {
+	var sum int64
+	for peer, group := range cluster.groupByPeer(keys) {
+		resp := cluster.relay(peer, c, utils.ToCmdLineByString(cmdName, group...))
+		if protocol.IsErrorReply(resp) {
+			return resp
+		}
+		intResp, ok := resp.(*protocol.IntReply)
+		if !ok {
+			return protocol.MakeErrorReply("ERR unexpected reply from " + peer + ": " + string(resp.ToBytes()))
+		}
+		sum += intResp.Code
+	}
+	return protocol.MakeIntReply(sum)
+}
+
+// Del 删除分布在多个节点上的key，返回删除的总数
+func Del(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("del")
+	}
+	return cluster.sumIntReplies(c, "DEL", argsToKeys(cmdLine[1:]))
+}
+
+// Exists 返回分布在多个节点上存在的key数量
+func Exists(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("exists")
+	}
+	return cluster.sumIntReplies(c, "EXISTS", argsToKeys(cmdLine[1:]))
+}
+
+// Keys 在所有节点上查找匹配的key并合并
+func Keys(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 2 {
+		return protocol.MakeArgNumErrorReply("keys")
+	}
+	result := make([][]byte, 0)
+	for _, resp := range cluster.broadcast(c, cmdLine) {
+		switch reply := resp.(type) {
+		case *protocol.MultiBulkReply:
+			result = append(result, reply.Args...)
+		case *protocol.EmptyMultiBulkReply:
+		default:
+			return resp
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// FlushDB 清空所有节点上的当前db
+func FlushDB(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	for _, resp := range cluster.broadcast(c, cmdLine) {
+		if protocol.IsErrorReply(resp) {
+			return resp
+		}
+	}
+	return protocol.MakeOkReply()
+}
+
+// FlushAll 清空所有节点上的数据
+func FlushAll(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	return FlushDB(cluster, c, cmdLine)
+}
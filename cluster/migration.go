@@ -0,0 +1,438 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"gmr/go-cache/config"
+	database2 "gmr/go-cache/database"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/client"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: migration
+ * @Version: 1.0.0
+ * @Description: 运行时增删节点，并将归属发生变化的key迁移到新节点
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	// 节点间同步拓扑以及迁移数据使用的内部命令
+	setNodesCmd        = "_setnodes"
+	migrateCmd         = "_migrate"
+	migrateDoneCmd     = "_migratedone"
+	migrationStatusCmd = "_migrationstatus"
+	// migratingCmd 新节点将命令转发给尚未迁移完的旧节点执行
+	migratingCmd = "_migrating"
+	// movedStatus 旧节点上已经不存在相关key，由新节点自己执行
+	movedStatus = "_moved"
+
+	migrateBatchSize  = 100
+	migrateRetryDelay = time.Second
+)
+
+// migrationStatus 本节点向外迁移数据的进度
+type migrationStatus struct {
+	running int32
+	total   int64
+	moved   int64
+	failed  int64
+}
+
+func (s *migrationStatus) String() string {
+	state := "idle"
+	if atomic.LoadInt32(&s.running) == 1 {
+		state = "migrating"
+	}
+	return fmt.Sprintf("state=%s moved=%d total=%d failed=%d", state,
+		atomic.LoadInt64(&s.moved), atomic.LoadInt64(&s.total), atomic.LoadInt64(&s.failed))
+}
+
+func makeTryAgainReply() redis.Reply {
+	return protocol.MakeErrorReply("TRYAGAIN Multiple keys request during rehashing")
+}
+
+// unionStrings 合并多个列表并去重，保持原有顺序
+func unionStrings(lists ...[]string) []string {
+	result := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, list := range lists {
+		for _, s := range list {
+			if _, ok := seen[s]; ok {
+				continue
+			}
+			seen[s] = struct{}{}
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func containsNode(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func (cluster *Cluster) isRehashing() bool {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	return cluster.oldPicker != nil
+}
+
+// importSource 返回keys迁入前所在且尚未迁移完成的节点
+// 不需要从其他节点迁入时返回空字符串，来自多个节点时返回TRYAGAIN
+func (cluster *Cluster) importSource(keys []string) (string, redis.Reply) {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	if cluster.oldPicker == nil {
+		return "", nil
+	}
+	source := ""
+	for _, key := range keys {
+		shard := cluster.oldPicker.PickNode(key)
+		node := cluster.resolveLocked(shard)
+		if node == cluster.self {
+			continue
+		}
+		if _, ok := cluster.migratingNodes[shard]; !ok {
+			continue
+		}
+		if source != "" && source != node {
+			return "", makeTryAgainReply()
+		}
+		source = node
+	}
+	return source, nil
+}
+
+// execSelf 在本节点执行命令，相关key可能尚未从旧节点迁入时先转发给旧节点
+func (cluster *Cluster) execSelf(c redis.Connection, cmdLine CmdLine) redis.Reply {
+	write, read, ok := database2.GetRelatedKeys(cmdLine)
+	if ok {
+		source, errReply := cluster.importSource(append(write, read...))
+		if errReply != nil {
+			return errReply
+		}
+		if source != "" {
+			resp := cluster.relay(source, c, append([][]byte{[]byte(migratingCmd)}, cmdLine...))
+			if status, ok := resp.(*protocol.StatusReply); !ok || status.Status != movedStatus {
+				return resp
+			}
+		}
+	}
+	return cluster.db.Exec(c, cmdLine)
+}
+
+// execMigrating 相关key都还在本节点时直接执行，都已迁出时返回movedStatus
+func execMigrating(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply(migratingCmd)
+	}
+	cmdLine = cmdLine[1:]
+	write, read, ok := database2.GetRelatedKeys(cmdLine)
+	if !ok {
+		return protocol.MakeErrorReply("ERR illegal command: " + string(cmdLine[0]))
+	}
+	keys := unionStrings(write, read)
+	dbIndex := c.GetDBIndex()
+	cluster.db.RWLocks(dbIndex, write, read)
+	defer cluster.db.RWUnLocks(dbIndex, write, read)
+
+	exist, _ := cluster.db.ExecWithLock(c, utils.ToCmdLineByString("ExistIn", keys...)).(*protocol.MultiBulkReply)
+	existCount := 0
+	if exist != nil {
+		existCount = len(exist.Args)
+	}
+	if existCount == 0 {
+		return protocol.MakeStatusReply(movedStatus)
+	}
+	if existCount != len(keys) {
+		return makeTryAgainReply()
+	}
+	result := cluster.db.ExecWithLock(c, cmdLine)
+	cluster.db.AddVersion(dbIndex, write...)
+	return result
+}
+
+// pingPeer 确认新节点可以连接
+func pingPeer(peer string) error {
+	connPool := makePeerPool(peer)
+	defer connPool.Close()
+	raw, err := connPool.Get()
+	if err != nil {
+		return err
+	}
+	peerClient, _ := raw.(*client.Client)
+	defer connPool.Put(peerClient)
+	resp := peerClient.Send(utils.ToCmdLine("PING"))
+	if protocol.IsErrorReply(resp) {
+		return fmt.Errorf("%s", string(resp.ToBytes()))
+	}
+	return nil
+}
+
+// changeNodes 增加或删除节点，先在所有节点上切换拓扑，再由旧拓扑中的节点迁出数据
+func (cluster *Cluster) changeNodes(c redis.Connection, add bool, node string) redis.Reply {
+	if cluster.isRehashing() {
+		return protocol.MakeErrorReply("ERR cluster is rehashing, try again later")
+	}
+	cluster.mu.RLock()
+	oldNodes := append([]string{}, cluster.nodes...)
+	cluster.mu.RUnlock()
+
+	newNodes := make([]string, 0, len(oldNodes)+1)
+	if add {
+		if containsNode(oldNodes, node) {
+			return protocol.MakeErrorReply("ERR node " + node + " already exists")
+		}
+		if err := pingPeer(node); err != nil {
+			return protocol.MakeErrorReply("ERR cannot connect to " + node + ": " + err.Error())
+		}
+		newNodes = append(append(newNodes, oldNodes...), node)
+	} else {
+		if !containsNode(oldNodes, node) {
+			return protocol.MakeErrorReply("ERR node " + node + " not found")
+		}
+		if len(oldNodes) == 1 {
+			return protocol.MakeErrorReply("ERR cannot remove the last node")
+		}
+		for _, n := range oldNodes {
+			if n != node {
+				newNodes = append(newNodes, n)
+			}
+		}
+	}
+
+	if cluster.raft != nil {
+		// 开启failover时拓扑变更写入Raft日志，由各节点应用时切换拓扑并开始迁移
+		err := cluster.propose(&topologyCmd{Op: topologySetNodes, OldNodes: oldNodes, NewNodes: newNodes})
+		if err != nil {
+			return protocol.MakeErrorReply("ERR " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	}
+
+	args := append([]string{strconv.Itoa(len(oldNodes))}, oldNodes...)
+	setNodesCmdLine := utils.ToCmdLineByString(setNodesCmd, append(args, newNodes...)...)
+	allNodes := unionStrings(oldNodes, newNodes)
+	for _, n := range allNodes {
+		if resp := cluster.relayTx(n, c, execSetNodes, setNodesCmdLine); protocol.IsErrorReply(resp) {
+			return resp
+		}
+	}
+	// 所有节点都切换拓扑之后再开始迁移，保证迁移完成的通知不会早于新拓扑到达
+	for _, n := range oldNodes {
+		if resp := cluster.relayTx(n, c, execMigrate, utils.ToCmdLine(migrateCmd)); protocol.IsErrorReply(resp) {
+			return resp
+		}
+	}
+	return protocol.MakeOkReply()
+}
+
+// execSetNodes _setnodes oldCount oldNode... newNode...
+func execSetNodes(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 3 {
+		return protocol.MakeArgNumErrorReply(setNodesCmd)
+	}
+	oldCount, err := strconv.Atoi(string(cmdLine[1]))
+	nodes := argsToKeys(cmdLine[2:])
+	if err != nil || oldCount < 0 || oldCount >= len(nodes) {
+		return protocol.MakeSyntaxErrorReply()
+	}
+	if err := cluster.setNodes(nodes[:oldCount], nodes[oldCount:]); err != nil {
+		return protocol.MakeErrorReply("ERR " + err.Error())
+	}
+	return protocol.MakeOkReply()
+}
+
+// setNodes 切换到新拓扑，旧拓扑保留到所有旧节点迁移完成
+func (cluster *Cluster) setNodes(oldNodes, newNodes []string) error {
+	oldPicker := makePeerPicker(oldNodes)
+	newPicker := makePeerPicker(newNodes)
+	migratingNodes := make(map[string]struct{})
+	for _, node := range oldNodes {
+		migratingNodes[node] = struct{}{}
+	}
+
+	cluster.mu.Lock()
+	defer cluster.mu.Unlock()
+	if cluster.oldPicker != nil {
+		return errors.New("cluster is rehashing, try again later")
+	}
+	cluster.nodes = newNodes
+	cluster.peerPicker = newPicker
+	cluster.oldNodes = oldNodes
+	cluster.oldPicker = oldPicker
+	cluster.migratingNodes = migratingNodes
+	logger.Info(fmt.Sprintf("cluster nodes changed from %v to %v", oldNodes, newNodes))
+	return nil
+}
+
+// execMigrate 开始将不再属于本节点的key迁出
+func execMigrate(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if !cluster.isRehashing() {
+		return protocol.MakeErrorReply("ERR cluster is not rehashing")
+	}
+	if !atomic.CompareAndSwapInt32(&cluster.migration.running, 0, 1) {
+		return protocol.MakeErrorReply("ERR migration is already running")
+	}
+	go cluster.migrate()
+	return protocol.MakeOkReply()
+}
+
+// migrate 分批迁出数据，有key迁移失败时重试，全部完成后通知所有节点
+func (cluster *Cluster) migrate() {
+	status := cluster.migration
+	atomic.StoreInt64(&status.total, 0)
+	atomic.StoreInt64(&status.moved, 0)
+	atomic.StoreInt64(&status.failed, 0)
+
+	for round := 0; ; round++ {
+		failed := 0
+		for dbIndex := 0; dbIndex < config.Properties.Databases; dbIndex++ {
+			keys := make([]string, 0)
+			cluster.db.ForEach(dbIndex, func(key string, data *database.DataEntity, expiration *time.Time) bool {
+				if cluster.pickNode(key) != cluster.self {
+					keys = append(keys, key)
+				}
+				return true
+			})
+			if round == 0 {
+				atomic.AddInt64(&status.total, int64(len(keys)))
+			}
+			for i := 0; i < len(keys); i += migrateBatchSize {
+				end := i + migrateBatchSize
+				if end > len(keys) {
+					end = len(keys)
+				}
+				failed += cluster.migrateBatch(dbIndex, keys[i:end])
+				logger.Info("migration progress: " + status.String())
+			}
+		}
+		if failed == 0 {
+			break
+		}
+		logger.Error(fmt.Sprintf("%d keys failed to migrate, retry later", failed))
+		time.Sleep(migrateRetryDelay)
+	}
+	atomic.StoreInt32(&status.running, 0)
+	logger.Info("migration finished: " + status.String())
+
+	cluster.mu.RLock()
+	shard := cluster.shardOfLocked(cluster.self)
+	epoch := cluster.rehashEpoch
+	cluster.mu.RUnlock()
+	if cluster.raft != nil {
+		cluster.proposeWithRetry(&topologyCmd{Op: topologyMigrated, Node: shard, Epoch: epoch})
+		return
+	}
+	doneCmdLine := utils.ToCmdLine(migrateDoneCmd, shard)
+	conn := &connection.FakeConn{}
+	for _, node := range cluster.getNodes() {
+		if resp := cluster.relayTx(node, conn, execMigrateDone, doneCmdLine); protocol.IsErrorReply(resp) {
+			logger.Error("notify " + node + " migration done failed: " + string(resp.ToBytes()))
+		}
+	}
+}
+
+// migrateBatch 锁定一批key，逐个导出到新节点后从本节点删除，返回失败的数量
+func (cluster *Cluster) migrateBatch(dbIndex int, keys []string) int {
+	conn := &connection.FakeConn{}
+	conn.SelectDB(dbIndex)
+	cluster.db.RWLocks(dbIndex, keys, nil)
+	defer cluster.db.RWUnLocks(dbIndex, keys, nil)
+
+	failed := 0
+	for _, key := range keys {
+		dump, ok := cluster.db.ExecWithLock(conn, utils.ToCmdLine("DumpKey", key)).(*protocol.MultiBulkReply)
+		if !ok || len(dump.Args) != 2 {
+			// 扫描之后key已被删除或过期
+			continue
+		}
+		target := cluster.pickNode(key)
+		resp := cluster.relay(target, conn, utils.ToCmdLineByByte(localCmd, []byte("RenameTo"), []byte(key), dump.Args[0], dump.Args[1]))
+		if protocol.IsErrorReply(resp) {
+			logger.Error("migrate " + key + " to " + target + " failed: " + string(resp.ToBytes()))
+			failed++
+			atomic.AddInt64(&cluster.migration.failed, 1)
+			continue
+		}
+		cluster.db.ExecWithLock(conn, utils.ToCmdLine("RenameFrom", key))
+		atomic.AddInt64(&cluster.migration.moved, 1)
+	}
+	cluster.db.AddVersion(dbIndex, keys...)
+	return failed
+}
+
+// execMigrateDone _migratedone node，所有旧节点都迁移完成后结束rehash
+func execMigrateDone(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 2 {
+		return protocol.MakeArgNumErrorReply(migrateDoneCmd)
+	}
+	cluster.finishMigration(string(cmdLine[1]))
+	return protocol.MakeOkReply()
+}
+
+// finishMigration 记录node迁移完成，所有旧节点都完成后清除旧拓扑并关闭不再使用的连接池
+func (cluster *Cluster) finishMigration(node string) {
+	cluster.mu.Lock()
+	defer cluster.mu.Unlock()
+	delete(cluster.migratingNodes, node)
+	if cluster.oldPicker == nil || len(cluster.migratingNodes) > 0 {
+		return
+	}
+	inUse := make(map[string]struct{})
+	for _, shard := range cluster.nodes {
+		inUse[cluster.resolveLocked(shard)] = struct{}{}
+	}
+	for replica := range cluster.replicas {
+		inUse[replica] = struct{}{}
+	}
+	for peer, connPool := range cluster.peerConnection {
+		if _, ok := inUse[peer]; !ok {
+			connPool.Close()
+			delete(cluster.peerConnection, peer)
+		}
+	}
+	cluster.oldNodes = nil
+	cluster.oldPicker = nil
+	cluster.migratingNodes = nil
+	logger.Info(fmt.Sprintf("cluster rehash finished, nodes: %v", cluster.nodes))
+}
+
+func execMigrationStatus(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	return protocol.MakeBulkReply([]byte(cluster.migration.String()))
+}
+
+// migrationStatus 汇总所有节点的迁移进度
+func (cluster *Cluster) migrationStatus(c redis.Connection) redis.Reply {
+	nodes := cluster.getNodes()
+	rehashing := cluster.isRehashing()
+	result := make([][]byte, 0, len(nodes)+1)
+	result = append(result, []byte("rehashing="+strconv.FormatBool(rehashing)))
+	for _, node := range nodes {
+		resp := cluster.relayTx(node, c, execMigrationStatus, utils.ToCmdLine(migrationStatusCmd))
+		line := node + " "
+		if bulkReply, ok := resp.(*protocol.BulkReply); ok {
+			line += string(bulkReply.Arg)
+		} else {
+			line += "error=" + strings.TrimSpace(string(resp.ToBytes()))
+		}
+		result = append(result, []byte(line))
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/parser"
+	"gmr/go-cache/redis/protocol"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: migration_test
+ * @Version: 1.0.0
+ * @Description: 运行时增删节点以及key迁移的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+// startTestNode 在随机端口上启动一个只包含自己的集群节点
+func startTestNode(t *testing.T) (*Cluster, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	config.Properties.Self = addr
+	config.Properties.Peers = nil
+	cluster := MakeCluster()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(cluster, conn)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		cluster.Close()
+	})
+	return cluster, addr
+}
+
+func serveTestConn(cluster *Cluster, conn net.Conn) {
+	client := connection.NewConnection(conn)
+	defer cluster.AfterClientClose(client)
+	for payload := range parser.ParseStream(conn) {
+		if payload.Err != nil {
+			return
+		}
+		r, ok := payload.Data.(*protocol.MultiBulkReply)
+		if !ok {
+			continue
+		}
+		_ = client.Write(cluster.Exec(client, r.Args).ToBytes())
+	}
+}
+
+// countLocalKeys 返回直接保存在节点本地db中的key
+func countLocalKeys(cluster *Cluster, keys []string) map[string]bool {
+	result := make(map[string]bool)
+	conn := connection.NewConnection(nil)
+	for _, key := range keys {
+		reply := cluster.db.Exec(conn, utils.ToCmdLine("EXISTS", key))
+		if intReply, ok := reply.(*protocol.IntReply); ok && intReply.Code == 1 {
+			result[key] = true
+		}
+	}
+	return result
+}
+
+func waitMigration(t *testing.T, cluster *Cluster, c redis.Connection) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		reply, ok := cluster.Exec(c, utils.ToCmdLine("CLUSTER", "MIGRATION")).(*protocol.MultiBulkReply)
+		if ok && len(reply.Args) > 0 && string(reply.Args[0]) == "rehashing=false" {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("migration is not finished")
+}
+
+func TestAddAndRemoveNode(t *testing.T) {
+	self, peers := config.Properties.Self, config.Properties.Peers
+	defer func() {
+		config.Properties.Self, config.Properties.Peers = self, peers
+	}()
+
+	nodeA, _ := startTestNode(t)
+	nodeB, addrB := startTestNode(t)
+	conn := connection.NewConnection(nil)
+	size := 200
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = "key" + strconv.Itoa(i)
+		nodeA.Exec(conn, utils.ToCmdLine("SET", keys[i], strconv.Itoa(i)))
+	}
+
+	if reply := nodeA.Exec(conn, utils.ToCmdLine("CLUSTER", "ADDNODE", addrB)); !protocol.IsOKReply(reply) {
+		t.Fatalf("add node failed: %s", reply.ToBytes())
+	}
+	waitMigration(t, nodeA, conn)
+	onA, onB := countLocalKeys(nodeA, keys), countLocalKeys(nodeB, keys)
+	if len(onB) == 0 || len(onA)+len(onB) != size {
+		t.Fatalf("expect keys split between nodes, actual: %d on A, %d on B", len(onA), len(onB))
+	}
+	for _, key := range keys {
+		if onA[key] && onB[key] {
+			t.Errorf("key %s exists on both nodes", key)
+		}
+		// 迁移之后key保存在新拓扑中负责它的节点上
+		owner := nodeA.pickNode(key)
+		if (owner == addrB) != onB[key] {
+			t.Errorf("key %s is not stored on its owner %s", key, owner)
+		}
+	}
+	// 两个节点都可以读取所有key
+	for i, key := range keys {
+		for _, node := range []*Cluster{nodeA, nodeB} {
+			reply, ok := node.Exec(connection.NewConnection(nil), utils.ToCmdLine("GET", key)).(*protocol.BulkReply)
+			if !ok || string(reply.Arg) != strconv.Itoa(i) {
+				t.Fatalf("expect %s = %d from %s", key, i, node.self)
+			}
+		}
+	}
+
+	if reply := nodeB.Exec(conn, utils.ToCmdLine("CLUSTER", "DELNODE", addrB)); !protocol.IsOKReply(reply) {
+		t.Fatalf("remove node failed: %s", reply.ToBytes())
+	}
+	waitMigration(t, nodeA, conn)
+	if onA := countLocalKeys(nodeA, keys); len(onA) != size {
+		t.Errorf("expect all keys back on A, actual: %d", len(onA))
+	}
+	if onB := countLocalKeys(nodeB, keys); len(onB) != 0 {
+		t.Errorf("expect no keys left on B, actual: %d", len(onB))
+	}
+	status := nodeA.Exec(conn, utils.ToCmdLine("CLUSTER", "MIGRATION")).(*protocol.MultiBulkReply)
+	if len(status.Args) != 2 || !strings.Contains(string(status.Args[1]), "state=idle") {
+		t.Errorf("expect one idle node, actual: %q", status.Args)
+	}
+}
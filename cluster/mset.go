@@ -0,0 +1,44 @@
+package cluster
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+)
+
+/**
+ * @Author: wanglei
+ * @File: mset
+ * @Version: 1.0.0
+ * @Description: 集群模式下的MGET，MSET等跨节点写命令通过分布式事务执行
+ * @Date: 2026/10/18 10:12
+ */
+
+// MGet 按节点分组读取，再按参数顺序合并结果
+func MGet(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("mget")
+	}
+	keys := argsToKeys(cmdLine[1:])
+
+	values := make(map[string][]byte)
+	for peer, group := range cluster.groupByPeer(keys) {
+		resp := cluster.relay(peer, c, utils.ToCmdLineByString("MGET", group...))
+		if protocol.IsErrorReply(resp) {
+			return resp
+		}
+		arrReply, ok := resp.(*protocol.MultiBulkReply)
+		if !ok || len(arrReply.Args) != len(group) {
+			return protocol.MakeErrorReply("ERR unexpected reply from " + peer + ": " + string(resp.ToBytes()))
+		}
+		for i, key := range group {
+			values[key] = arrReply.Args[i]
+		}
+	}
+
+	result := make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i] = values[key]
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
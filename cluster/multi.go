@@ -0,0 +1,272 @@
+package cluster
+
+import (
+	database2 "gmr/go-cache/database"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/parser"
+	"gmr/go-cache/redis/protocol"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: multi
+ * @Version: 1.0.0
+ * @Description: 分布式事务的协调者，以及集群模式下的MULTI/EXEC/WATCH
+ * @Date: 2026/10/18 10:12
+ */
+
+// TxExecFunc 在载入了相关key的临时db中执行命令
+type TxExecFunc func(tmpDB database.EmbedDB, conn redis.Connection) redis.Reply
+
+// txGroup 一个节点上参与事务的key
+type txGroup struct {
+	writeKeys []string
+	readKeys  []string
+}
+
+// relayTx 将事务命令发送到node，本节点直接调用cmdFunc
+func (cluster *Cluster) relayTx(node string, c redis.Connection, cmdFunc CmdFunc, cmdLine CmdLine) redis.Reply {
+	if node == cluster.self {
+		return cmdFunc(cluster, c, cmdLine)
+	}
+	return cluster.relay(node, c, cmdLine)
+}
+
+// groupTxKeys 将key按节点分组，同时出现在读写集合中的key视为写
+func (cluster *Cluster) groupTxKeys(writeKeys, readKeys []string) map[string]*txGroup {
+	groups := make(map[string]*txGroup)
+	getGroup := func(key string) *txGroup {
+		node := cluster.pickNode(key)
+		group, ok := groups[node]
+		if !ok {
+			group = &txGroup{}
+			groups[node] = group
+		}
+		return group
+	}
+	writeSet := make(map[string]struct{})
+	for _, key := range writeKeys {
+		if _, ok := writeSet[key]; ok {
+			continue
+		}
+		writeSet[key] = struct{}{}
+		group := getGroup(key)
+		group.writeKeys = append(group.writeKeys, key)
+	}
+	readSet := make(map[string]struct{})
+	for _, key := range readKeys {
+		if _, ok := writeSet[key]; ok {
+			continue
+		}
+		if _, ok := readSet[key]; ok {
+			continue
+		}
+		readSet[key] = struct{}{}
+		group := getGroup(key)
+		group.readKeys = append(group.readKeys, key)
+	}
+	return groups
+}
+
+// loadDump 将DumpKey导出的RESP命令载入临时db
+func loadDump(tmpDB database.EmbedDB, conn redis.Connection, rawCmd []byte) redis.Reply {
+	reply, err := parser.ParseOne(rawCmd)
+	if err != nil {
+		return protocol.MakeErrorReply("ERR illegal dump cmd: " + err.Error())
+	}
+	cmd, ok := reply.(*protocol.MultiBulkReply)
+	if !ok {
+		return protocol.MakeErrorReply("ERR dump cmd is not multi bulk reply")
+	}
+	return tmpDB.ExecWithLock(conn, cmd.Args)
+}
+
+// execCrossNode 在多个节点上原子地执行命令
+// 先向所有节点发送Prepare锁定key并取回数据，在本地临时db中执行命令后，
+// 将写入的key以Commit提交到各节点，任意节点失败则全部Rollback
+func (cluster *Cluster) execCrossNode(c redis.Connection, writeKeys, readKeys []string,
+	watching map[string]uint32, exec TxExecFunc) redis.Reply {
+	groups := cluster.groupTxKeys(writeKeys, readKeys)
+	nodes := make([]string, 0, len(groups))
+	for node := range groups {
+		nodes = append(nodes, node)
+	}
+	// 按固定顺序加锁，避免事务之间死锁
+	sort.Strings(nodes)
+
+	txID := strconv.FormatInt(cluster.idGenerator.NextID(), 10)
+	prepared := make([]string, 0, len(nodes))
+	rollback := func() {
+		for _, node := range prepared {
+			resp := cluster.relayTx(node, c, execRollback, utils.ToCmdLine("Rollback", txID))
+			if protocol.IsErrorReply(resp) {
+				logger.Error("rollback transaction " + txID + " on " + node + " failed: " + string(resp.ToBytes()))
+			}
+		}
+	}
+
+	tmpConn := &connection.FakeConn{}
+	tmpConn.SelectDB(c.GetDBIndex())
+	// FCALL需要使用本节点加载的function
+	tmpDB := cluster.db.MakeTmpDB()
+	versions := make(map[string]uint32)
+	for _, node := range nodes {
+		group := groups[node]
+		keys := append(append([]string{}, group.writeKeys...), group.readKeys...)
+		args := append([]string{txID, strconv.Itoa(len(group.writeKeys))}, keys...)
+		resp := cluster.relayTx(node, c, execPrepare, utils.ToCmdLineByString("Prepare", args...))
+		// 即使Prepare失败，peer上也可能已经加锁，需要一并回滚
+		prepared = append(prepared, node)
+		if protocol.IsErrorReply(resp) {
+			rollback()
+			return resp
+		}
+		arrReply, ok := resp.(*protocol.MultiBulkReply)
+		if !ok || len(arrReply.Args) != 3*len(keys) {
+			rollback()
+			return protocol.MakeErrorReply("ERR unexpected prepare reply from " + node + ": " + string(resp.ToBytes()))
+		}
+		for i, key := range keys {
+			ver, err := strconv.ParseUint(string(arrReply.Args[3*i]), 10, 32)
+			if err != nil {
+				rollback()
+				return protocol.MakeErrorReply("ERR illegal version of " + key + " from " + node)
+			}
+			versions[key] = uint32(ver)
+			for _, rawCmd := range arrReply.Args[3*i+1 : 3*i+3] {
+				if rawCmd == nil {
+					continue
+				}
+				if loadResult := loadDump(tmpDB, tmpConn, rawCmd); protocol.IsErrorReply(loadResult) {
+					rollback()
+					return loadResult
+				}
+			}
+		}
+	}
+
+	for key, ver := range watching {
+		if versions[key] != ver {
+			rollback()
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+	}
+
+	result := exec(tmpDB, tmpConn)
+	if protocol.IsErrorReply(result) {
+		rollback()
+		return result
+	}
+
+	for _, node := range nodes {
+		args := [][]byte{[]byte("Commit"), []byte(txID)}
+		for _, key := range groups[node].writeKeys {
+			args = append(args, protocol.MakeMultiBulkReply(utils.ToCmdLine("DEL", key)).ToBytes())
+			dump := tmpDB.ExecWithLock(tmpConn, utils.ToCmdLine("DumpKey", key))
+			if dumpReply, ok := dump.(*protocol.MultiBulkReply); ok && len(dumpReply.Args) == 2 {
+				args = append(args, dumpReply.Args...)
+			}
+		}
+		// 只读的节点也需要Commit来释放锁
+		resp := cluster.relayTx(node, c, execCommit, args)
+		if protocol.IsErrorReply(resp) {
+			rollback()
+			return resp
+		}
+	}
+	return result
+}
+
+// execTxInMulti 处理MULTI状态下收到的命令
+func (cluster *Cluster) execTxInMulti(c redis.Connection, cmdLine CmdLine) redis.Reply {
+	switch strings.ToLower(string(cmdLine[0])) {
+	case "exec":
+		return execMulti(cluster, c, cmdLine)
+	case "watch":
+		return protocol.MakeErrorReply("ERR WATCH inside MULTI is not allowed")
+	}
+	// multi、discard以及入队都在本地完成
+	return cluster.db.Exec(c, cmdLine)
+}
+
+// execMulti 事务涉及的key都在本节点时直接执行，否则以分布式事务执行
+func execMulti(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 1 {
+		return protocol.MakeArgNumErrorReply("exec")
+	}
+	defer c.SetMultiState(false)
+
+	cmdLines := c.GetQueueCmdLine()
+	watching := c.GetWatching()
+	writeKeys := make([]string, 0)
+	readKeys := make([]string, 0)
+	for _, line := range cmdLines {
+		write, read, _ := database2.GetRelatedKeys(line)
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	for key := range watching {
+		readKeys = append(readKeys, key)
+	}
+
+	if errReply := cluster.checkSameSlot(append(append([]string{}, writeKeys...), readKeys...)); errReply != nil {
+		return errReply
+	}
+	node, errReply := cluster.pickNodeForKeys(append(append([]string{}, writeKeys...), readKeys...))
+	if errReply == nil && (node == "" || node == cluster.self) {
+		source, errReply := cluster.importSource(append(writeKeys, readKeys...))
+		if errReply != nil {
+			return errReply
+		}
+		if source != "" {
+			return makeTryAgainReply()
+		}
+		return cluster.db.ExecMulti(c, watching, cmdLines)
+	}
+	return cluster.execCrossNode(c, writeKeys, readKeys, watching, func(tmpDB database.EmbedDB, conn redis.Connection) redis.Reply {
+		results := make([]redis.Reply, 0, len(cmdLines))
+		for _, line := range cmdLines {
+			result := tmpDB.ExecWithLock(conn, line)
+			if protocol.IsErrorReply(result) {
+				return protocol.MakeErrorReply("EXEC ABORT Transaction discarded because of previous errors.")
+			}
+			results = append(results, result)
+		}
+		return protocol.MakeMultiRawReply(results)
+	})
+}
+
+// Watch 从key所在的节点获取版本号
+func Watch(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("watch")
+	}
+	keys := make([]string, 0, len(cmdLine)-1)
+	for _, arg := range cmdLine[1:] {
+		keys = append(keys, string(arg))
+	}
+	if errReply := cluster.checkSameSlot(keys); errReply != nil {
+		return errReply
+	}
+	watching := c.GetWatching()
+	for _, arg := range cmdLine[1:] {
+		key := string(arg)
+		resp := cluster.relay(cluster.pickNode(key), c, utils.ToCmdLine("GetVer", key))
+		intReply, ok := resp.(*protocol.IntReply)
+		if !ok {
+			if protocol.IsErrorReply(resp) {
+				return resp
+			}
+			return protocol.MakeErrorReply("ERR unexpected reply: " + string(resp.ToBytes()))
+		}
+		watching[key] = uint32(intReply.Code)
+	}
+	return protocol.MakeOkReply()
+}
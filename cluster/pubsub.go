@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/hashslot"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"sync"
+)
+
+/**
+ * @Author: wanglei
+ * @File: pubsub
+ * @Version: 1.0.0
+ * @Description: 集群模式下的pub/sub，publish广播到所有节点，sharded channel只在所属节点上订阅和发布
+ * @Date: 2026/10/18 10:12
+ */
+
+// getAllNodes 返回所有master和replica，订阅者可能连接在任意节点上
+func (cluster *Cluster) getAllNodes() []string {
+	nodes := cluster.getNodes()
+	cluster.mu.RLock()
+	replicas := make([]string, 0, len(cluster.replicas))
+	for replica := range cluster.replicas {
+		replicas = append(replicas, replica)
+	}
+	cluster.mu.RUnlock()
+	return unionStrings(nodes, replicas, []string{cluster.self})
+}
+
+// Publish 并发地在所有节点上发布消息，返回各节点上接收消息的订阅者总数
+func Publish(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 3 {
+		return protocol.MakeArgNumErrorReply("publish")
+	}
+	localCmdLine := append([][]byte{[]byte(localCmd)}, cmdLine...)
+	nodes := cluster.getAllNodes()
+	replies := make([]redis.Reply, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			if node == cluster.self {
+				replies[i] = cluster.db.Exec(c, cmdLine)
+			} else {
+				replies[i] = cluster.relay(node, c, localCmdLine)
+			}
+		}(i, node)
+	}
+	wg.Wait()
+
+	var count int64
+	for i, reply := range replies {
+		intReply, ok := reply.(*protocol.IntReply)
+		if !ok {
+			// 某个节点不可用时不影响其他节点上的订阅者
+			logger.Warn("publish to " + nodes[i] + " failed: " + string(reply.ToBytes()))
+			continue
+		}
+		count += intReply.Code
+	}
+	return protocol.MakeIntReply(count)
+}
+
+// SPublish sharded channel属于channel所在的节点，由该节点发布
+func SPublish(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 3 {
+		return protocol.MakeArgNumErrorReply("spublish")
+	}
+	channel := string(cmdLine[1])
+	node := cluster.pickNode(channel)
+	if node == "" || node == cluster.self {
+		return cluster.db.Exec(c, cmdLine)
+	}
+	if cluster.useSlots() {
+		return movedReply(channel, node)
+	}
+	return cluster.relay(node, c, cmdLine)
+}
+
+// SSubscribe 订阅需要保持在客户端的连接上，无法转发
+// channel不属于本节点时，hash slot模式返回MOVED，一致性hash模式返回错误并提示channel所在的节点
+func SSubscribe(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("ssubscribe")
+	}
+	channels := argsToKeys(cmdLine[1:])
+	node, errReply := cluster.pickNodeForKeys(channels)
+	if errReply != nil {
+		return errReply
+	}
+	if node != "" && node != cluster.self {
+		if cluster.useSlots() {
+			return movedReply(channels[0], node)
+		}
+		return protocol.MakeErrorReply("ERR channel " + channels[0] + " belongs to node " + node +
+			", ssubscribe on that node instead")
+	}
+	return cluster.db.Exec(c, cmdLine)
+}
+
+func movedReply(channel string, node string) redis.Reply {
+	return protocol.MakeErrorReply("MOVED " + strconv.Itoa(hashslot.KeySlot(channel)) + " " + node)
+}
@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: pubsub_test
+ * @Version: 1.0.0
+ * @Description: 集群模式下pub/sub的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+// subscriber 返回一个可以接收推送消息的连接
+func subscriber(t *testing.T) *connection.Connection {
+	server, client := net.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, client)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return connection.NewConnection(server)
+}
+
+func TestClusterPubSub(t *testing.T) {
+	self, peers, slots := config.Properties.Self, config.Properties.Peers, config.Properties.ClusterSlots
+	defer func() {
+		config.Properties.Self, config.Properties.Peers, config.Properties.ClusterSlots = self, peers, slots
+	}()
+	config.Properties.ClusterSlots = false
+
+	nodeA, _ := startTestNode(t)
+	nodeB, addrB := startTestNode(t)
+	conn := connection.NewConnection(nil)
+	if reply := nodeA.Exec(conn, utils.ToCmdLine("CLUSTER", "ADDNODE", addrB)); !protocol.IsOKReply(reply) {
+		t.Fatalf("add node failed: %s", reply.ToBytes())
+	}
+	waitMigration(t, nodeA, conn)
+	channel := ""
+	for i := 0; channel == ""; i++ {
+		if candidate := "ch" + strconv.Itoa(i); nodeA.pickNode(candidate) == addrB {
+			channel = candidate
+		}
+	}
+
+	// 一致性hash模式下没有slot，不能返回MOVED
+	reply := nodeA.Exec(subscriber(t), utils.ToCmdLine("SSUBSCRIBE", channel))
+	errReply, ok := reply.(protocol.ErrorReply)
+	if !ok || strings.HasPrefix(errReply.Error(), "MOVED") || !strings.Contains(errReply.Error(), addrB) {
+		t.Errorf("expect error pointing to %s, actual: %s", addrB, reply.ToBytes())
+	}
+	if reply, ok := nodeB.Exec(subscriber(t), utils.ToCmdLine("SSUBSCRIBE", channel)).(protocol.ErrorReply); ok {
+		t.Fatalf("ssubscribe on owner failed: %s", reply.Error())
+	}
+	if reply, ok := nodeA.Exec(conn, utils.ToCmdLine("SPUBLISH", channel, "msg")).(*protocol.IntReply); !ok || reply.Code != 1 {
+		t.Errorf("expect spublish relayed to 1 subscriber, actual: %v", reply)
+	}
+
+	// publish发送到所有节点，统计所有节点上的订阅者
+	nodeA.Exec(subscriber(t), utils.ToCmdLine("SUBSCRIBE", "news"))
+	nodeB.Exec(subscriber(t), utils.ToCmdLine("SUBSCRIBE", "news"))
+	nodeB.Exec(subscriber(t), utils.ToCmdLine("SUBSCRIBE", "news"))
+	for _, node := range []*Cluster{nodeA, nodeB} {
+		if reply, ok := node.Exec(conn, utils.ToCmdLine("PUBLISH", "news", "msg")).(*protocol.IntReply); !ok || reply.Code != 3 {
+			t.Errorf("expect 3 subscribers from %s, actual: %v", node.self, reply)
+		}
+	}
+}
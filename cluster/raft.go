@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/raft"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"strings"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: raft
+ * @Version: 1.0.0
+ * @Description: 通过节点之间的连接池传输Raft消息，follower上的提议转发给leader
+ * @Date: 2026/10/18 10:12
+ */
+
+// raftCmd _raft vote|append|propose json
+const raftCmd = "_raft"
+
+const (
+	raftHeartbeatInterval = 100 * time.Millisecond
+	raftElectionTimeout   = time.Second
+)
+
+// raftTransport 将Raft消息编码为json，以_raft命令发送到peer
+type raftTransport struct {
+	cluster *Cluster
+}
+
+func (t *raftTransport) call(peer string, op string, args interface{}, reply interface{}) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	resp := t.cluster.relay(peer, &connection.FakeConn{}, utils.ToCmdLineByByte(raftCmd, []byte(op), data))
+	bulkReply, ok := resp.(*protocol.BulkReply)
+	if !ok {
+		return errors.New("raft " + op + " to " + peer + " failed: " + strings.TrimSpace(string(resp.ToBytes())))
+	}
+	return json.Unmarshal(bulkReply.Arg, reply)
+}
+
+func (t *raftTransport) RequestVote(peer string, args *raft.RequestVoteArgs) (*raft.RequestVoteReply, error) {
+	reply := &raft.RequestVoteReply{}
+	if err := t.call(peer, "vote", args, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (t *raftTransport) AppendEntries(peer string, args *raft.AppendEntriesArgs) (*raft.AppendEntriesReply, error) {
+	reply := &raft.AppendEntriesReply{}
+	if err := t.call(peer, "append", args, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// execRaft 处理其他节点发来的Raft消息
+func execRaft(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 3 {
+		return protocol.MakeArgNumErrorReply(raftCmd)
+	}
+	if cluster.raft == nil {
+		return protocol.MakeErrorReply("ERR This instance has cluster-failover disabled")
+	}
+	op := strings.ToLower(string(cmdLine[1]))
+	var reply interface{}
+	switch op {
+	case "vote":
+		args := &raft.RequestVoteArgs{}
+		if err := json.Unmarshal(cmdLine[2], args); err != nil {
+			return protocol.MakeErrorReply("ERR illegal raft message: " + err.Error())
+		}
+		reply = cluster.raft.HandleRequestVote(args)
+	case "append":
+		args := &raft.AppendEntriesArgs{}
+		if err := json.Unmarshal(cmdLine[2], args); err != nil {
+			return protocol.MakeErrorReply("ERR illegal raft message: " + err.Error())
+		}
+		reply = cluster.raft.HandleAppendEntries(args)
+	case "propose":
+		// 只有leader接受转发来的提议，避免在节点之间循环转发
+		index, err := cluster.raft.Propose(cmdLine[2])
+		if err != nil {
+			return protocol.MakeErrorReply("ERR " + err.Error())
+		}
+		return protocol.MakeIntReply(int64(index))
+	default:
+		return protocol.MakeErrorReply("ERR unknown raft message '" + op + "'")
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return protocol.MakeErrorReply("ERR " + err.Error())
+	}
+	return protocol.MakeBulkReply(data)
+}
+
+// propose 提交一条拓扑变更，在本节点应用之后返回
+// 本节点不是leader时转发给leader，leader未知时依次尝试所有voter
+func (cluster *Cluster) propose(cmd *topologyCmd) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if cluster.raft.IsLeader() {
+		_, err = cluster.raft.Propose(data)
+		return err
+	}
+	targets := cluster.raftVoters
+	if leader := cluster.raft.Leader(); leader != "" {
+		targets = []string{leader}
+	}
+	err = errors.New("no raft leader, try again later")
+	for _, target := range targets {
+		if target == cluster.self {
+			continue
+		}
+		resp := cluster.relay(target, &connection.FakeConn{}, utils.ToCmdLineByByte(raftCmd, []byte("propose"), data))
+		if intReply, ok := resp.(*protocol.IntReply); ok {
+			return cluster.waitApplied(uint64(intReply.Code))
+		}
+		err = errors.New(strings.TrimSpace(string(resp.ToBytes())))
+	}
+	return err
+}
+
+// waitApplied 等待leader上已提交的日志在本节点应用
+func (cluster *Cluster) waitApplied(index uint64) error {
+	deadline := time.Now().Add(2 * raftElectionTimeout)
+	for cluster.raft.LastApplied() < index {
+		if time.Now().After(deadline) {
+			return raft.ErrTimeout
+		}
+		time.Sleep(raftHeartbeatInterval / 2)
+	}
+	return nil
+}
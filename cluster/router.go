@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	database2 "gmr/go-cache/database"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/hashslot"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: router
+ * @Version: 1.0.0
+ * @Description: 集群模式下的命令路由
+ * @Date: 2026/10/18 10:12
+ */
+
+// localCmd 节点间广播时使用，peer收到后直接在本地执行
+const localCmd = "_local"
+
+var router = makeRouter()
+
+func makeRouter() map[string]CmdFunc {
+	routerMap := make(map[string]CmdFunc)
+	routerMap[localCmd] = execLocal
+	routerMap[peerCmd] = execPeer
+
+	routerMap["del"] = Del
+	routerMap["exists"] = Exists
+	routerMap["mget"] = MGet
+	routerMap["keys"] = Keys
+	routerMap["flushdb"] = FlushDB
+	routerMap["flushall"] = FlushAll
+
+	routerMap["copy"] = Copy
+
+	routerMap["publish"] = Publish
+	routerMap["spublish"] = SPublish
+	routerMap["ssubscribe"] = SSubscribe
+
+	routerMap["script"] = Script
+	routerMap["function"] = Function
+
+	routerMap["watch"] = Watch
+	routerMap["prepare"] = execPrepare
+	routerMap["commit"] = execCommit
+	routerMap["rollback"] = execRollback
+
+	routerMap["cluster"] = execClusterCmd
+	routerMap["asking"] = execAsking
+	routerMap[setNodesCmd] = execSetNodes
+	routerMap[migrateCmd] = execMigrate
+	routerMap[migrateDoneCmd] = execMigrateDone
+	routerMap[migrationStatusCmd] = execMigrationStatus
+	routerMap[migratingCmd] = execMigrating
+	routerMap[raftCmd] = execRaft
+	return routerMap
+}
+
+// defaultFunc 根据命令涉及的key选择节点，没有key的命令在本地执行
+func defaultFunc(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	write, read, ok := database2.GetRelatedKeys(cmdLine)
+	if !ok {
+		// 不在命令表中的命令(select、subscribe等)以及参数错误的命令交给本地处理
+		return cluster.db.Exec(c, cmdLine)
+	}
+	node, errReply := cluster.pickNodeForKeys(append(append([]string{}, write...), read...))
+	blocking := database2.IsBlockingCmdLine(cmdLine)
+	if errReply != nil {
+		if blocking {
+			return protocol.MakeErrorReply("ERR blocking command keys are stored in different nodes")
+		}
+		// key分布在多个节点上，以分布式事务执行
+		return cluster.execCrossNode(c, write, read, nil, func(tmpDB database.EmbedDB, conn redis.Connection) redis.Reply {
+			return tmpDB.ExecWithLock(conn, cmdLine)
+		})
+	}
+	if node == "" {
+		return cluster.db.Exec(c, cmdLine)
+	}
+	if node != cluster.self && cluster.useSlots() {
+		// hash slot模式下由客户端根据重定向自行路由
+		return cluster.redirect(c, cmdLine, append(write, read...), node)
+	}
+	if node != cluster.self && blocking {
+		// 转发的阻塞命令会超过client的等待时间导致取出的数据丢失，由客户端直接连接key所在的节点
+		keys := append(write, read...)
+		return protocol.MakeErrorReply("MOVED " + strconv.Itoa(hashslot.KeySlot(keys[0])) + " " + node)
+	}
+	return cluster.relay(node, c, cmdLine)
+}
+
+func execLocal(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply(localCmd)
+	}
+	return cluster.db.Exec(c, cmdLine[1:])
+}
+
+// execClusterCmd CLUSTER子命令
+func execClusterCmd(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("cluster")
+	}
+	subCmd := strings.ToLower(string(cmdLine[1]))
+	argNum := map[string]int{
+		"addnode":   3,
+		"delnode":   3,
+		"migration": 2,
+		"keyslot":   3,
+		"slots":     2,
+		"nodes":     2,
+		"info":      2,
+		"myid":      2,
+	}
+	if expected, ok := argNum[subCmd]; ok && len(cmdLine) != expected {
+		return protocol.MakeArgNumErrorReply("cluster|" + subCmd)
+	}
+	switch subCmd {
+	case "addnode", "delnode":
+		return cluster.changeNodes(c, subCmd == "addnode", string(cmdLine[2]))
+	case "migration":
+		return cluster.migrationStatus(c)
+	case "keyslot":
+		return protocol.MakeIntReply(int64(hashslot.KeySlot(string(cmdLine[2]))))
+	case "slots":
+		return cluster.clusterSlots()
+	case "nodes":
+		return cluster.clusterNodes()
+	case "info":
+		return cluster.clusterInfo()
+	case "myid":
+		return protocol.MakeBulkReply([]byte(nodeID(cluster.self)))
+	}
+	return protocol.MakeErrorReply("ERR unknown subcommand '" + subCmd + "'")
+}
@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/redis/protocol"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: script
+ * @Version: 1.0.0
+ * @Description: 集群模式下的SCRIPT和FUNCTION命令，EVAL、EVALSHA和FCALL按照声明的key路由
+ * @Date: 2026/10/18 10:12
+ */
+
+// Script SCRIPT LOAD和SCRIPT FLUSH在所有节点上执行，保证EVALSHA被路由到任意节点时都能找到脚本
+func Script(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("script")
+	}
+	subCmd := strings.ToLower(string(cmdLine[1]))
+	if subCmd != "load" && subCmd != "flush" {
+		return cluster.db.Exec(c, cmdLine)
+	}
+	return broadcastAll(cluster, c, cmdLine)
+}
+
+// Function 修改function的子命令在所有节点上执行，LIST和DUMP在当前节点执行
+func Function(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("function")
+	}
+	switch strings.ToLower(string(cmdLine[1])) {
+	case "load", "delete", "flush", "restore":
+		return broadcastAll(cluster, c, cmdLine)
+	}
+	return cluster.db.Exec(c, cmdLine)
+}
+
+// broadcastAll 在所有节点上执行，任意节点出错时返回错误，否则返回当前节点的结果
+func broadcastAll(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	var result redis.Reply
+	for node, reply := range cluster.broadcast(c, cmdLine) {
+		if protocol.IsErrorReply(reply) {
+			return reply
+		}
+		if node == cluster.self {
+			result = reply
+		}
+	}
+	return result
+}
@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/hashslot"
+	"gmr/go-cache/redis/protocol"
+	"net"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: slots
+ * @Version: 1.0.0
+ * @Description: 与Redis Cluster兼容的CLUSTER SLOTS/NODES/INFO以及MOVED/ASK重定向
+ * @Date: 2026/10/18 10:12
+ */
+
+// nodeID 由节点地址生成，所有节点对同一地址得到相同的id
+func nodeID(node string) string {
+	sum := sha1.Sum([]byte(node))
+	return hex.EncodeToString(sum[:])
+}
+
+// slotMap hash slot模式下返回当前的slot分配，否则返回nil
+func (cluster *Cluster) slotMap() *hashslot.Map {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	slots, _ := cluster.peerPicker.(*hashslot.Map)
+	return slots
+}
+
+func (cluster *Cluster) useSlots() bool {
+	return cluster.slotMap() != nil
+}
+
+// checkSameSlot hash slot模式下多key命令的key必须属于同一个slot，否则返回CROSSSLOT
+func (cluster *Cluster) checkSameSlot(keys []string) redis.Reply {
+	if len(keys) < 2 || !cluster.useSlots() {
+		return nil
+	}
+	slot := hashslot.KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if hashslot.KeySlot(key) != slot {
+			return protocol.MakeErrorReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	return nil
+}
+
+// isExporting keys是否都属于本节点正在迁出的数据
+func (cluster *Cluster) isExporting(keys []string) bool {
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	if cluster.oldPicker == nil {
+		return false
+	}
+	if _, ok := cluster.migratingNodes[cluster.shardOfLocked(cluster.self)]; !ok {
+		return false
+	}
+	for _, key := range keys {
+		if cluster.resolveLocked(cluster.oldPicker.PickNode(key)) != cluster.self {
+			return false
+		}
+	}
+	return true
+}
+
+// redirect key不属于本节点时返回MOVED
+// 迁移过程中key仍在本节点时直接执行，已经迁出时返回ASK
+func (cluster *Cluster) redirect(c redis.Connection, cmdLine CmdLine, keys []string, node string) redis.Reply {
+	slot := hashslot.KeySlot(keys[0])
+	if cluster.isExporting(keys) {
+		resp := execMigrating(cluster, c, append([][]byte{[]byte(migratingCmd)}, cmdLine...))
+		if status, ok := resp.(*protocol.StatusReply); !ok || status.Status != movedStatus {
+			return resp
+		}
+		return protocol.MakeErrorReply("ASK " + strconv.Itoa(slot) + " " + node)
+	}
+	return protocol.MakeErrorReply("MOVED " + strconv.Itoa(slot) + " " + node)
+}
+
+// execAsking 新节点在迁移开始时已经接管了slot，ASKING无需额外处理
+func execAsking(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 1 {
+		return protocol.MakeArgNumErrorReply("asking")
+	}
+	return protocol.MakeOkReply()
+}
+
+// shardMembers 返回分片当前的master及其replica
+func (cluster *Cluster) shardMembers(shard string) []string {
+	cluster.mu.RLock()
+	master := cluster.resolveLocked(shard)
+	cluster.mu.RUnlock()
+	members := []string{master}
+	for _, replica := range cluster.shardReplicas(shard) {
+		if replica != master {
+			members = append(members, replica)
+		}
+	}
+	return members
+}
+
+func splitHostPort(node string) (string, int) {
+	host, portStr, err := net.SplitHostPort(node)
+	if err != nil {
+		return node, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+// clusterSlots CLUSTER SLOTS，每个区间返回起止slot和所在节点
+func (cluster *Cluster) clusterSlots() redis.Reply {
+	slots := cluster.slotMap()
+	if slots == nil {
+		return protocol.MakeErrorReply("ERR This instance has cluster-slots disabled")
+	}
+	ranges := slots.Ranges()
+	result := make([]redis.Reply, 0, len(ranges))
+	for _, r := range ranges {
+		// 第一个节点为master，之后是它的replica
+		nodes := make([]redis.Reply, 0)
+		for _, node := range cluster.shardMembers(r.Node) {
+			host, port := splitHostPort(node)
+			nodes = append(nodes, protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeBulkReply([]byte(host)),
+				protocol.MakeIntReply(int64(port)),
+				protocol.MakeBulkReply([]byte(nodeID(node))),
+			}))
+		}
+		result = append(result, protocol.MakeMultiRawReply(append([]redis.Reply{
+			protocol.MakeIntReply(int64(r.Start)),
+			protocol.MakeIntReply(int64(r.End)),
+		}, nodes...)))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// clusterNodes CLUSTER NODES，节点之间没有集群总线，cport固定为0
+func (cluster *Cluster) clusterNodes() redis.Reply {
+	slots := cluster.slotMap()
+	if slots == nil {
+		return protocol.MakeErrorReply("ERR This instance has cluster-slots disabled")
+	}
+	nodeSlots := make(map[string][]string)
+	for _, r := range slots.Ranges() {
+		if r.Start == r.End {
+			nodeSlots[r.Node] = append(nodeSlots[r.Node], strconv.Itoa(r.Start))
+		} else {
+			nodeSlots[r.Node] = append(nodeSlots[r.Node], fmt.Sprintf("%d-%d", r.Start, r.End))
+		}
+	}
+	cluster.mu.RLock()
+	shards := append([]string{}, cluster.nodes...)
+	cluster.mu.RUnlock()
+
+	var builder strings.Builder
+	writeNode := func(node string, flags string, master string) {
+		if node == cluster.self {
+			flags = "myself," + flags
+		}
+		builder.WriteString(fmt.Sprintf("%s %s@0 %s %s 0 0 0 connected", nodeID(node), node, flags, master))
+	}
+	for _, shard := range shards {
+		members := cluster.shardMembers(shard)
+		writeNode(members[0], "master", "-")
+		for _, s := range nodeSlots[shard] {
+			builder.WriteString(" " + s)
+		}
+		builder.WriteString("\n")
+		for _, replica := range members[1:] {
+			writeNode(replica, "slave", nodeID(members[0]))
+			builder.WriteString("\n")
+		}
+	}
+	return protocol.MakeBulkReply([]byte(builder.String()))
+}
+
+// clusterInfo CLUSTER INFO
+func (cluster *Cluster) clusterInfo() redis.Reply {
+	assigned := 0
+	if slots := cluster.slotMap(); slots != nil && !slots.IsEmpty() {
+		assigned = hashslot.SlotCount
+	}
+	cluster.mu.RLock()
+	shardCount := len(cluster.nodes)
+	nodeCount := len(unionStrings(cluster.nodes, cluster.oldNodes)) + len(cluster.replicas)
+	cluster.mu.RUnlock()
+	var epoch uint64
+	if cluster.raft != nil {
+		epoch, _ = cluster.raft.State()
+	}
+
+	lines := []string{
+		"cluster_enabled:1",
+		"cluster_state:ok",
+		"cluster_slots_assigned:" + strconv.Itoa(assigned),
+		"cluster_slots_ok:" + strconv.Itoa(assigned),
+		"cluster_slots_pfail:0",
+		"cluster_slots_fail:0",
+		"cluster_known_nodes:" + strconv.Itoa(nodeCount),
+		"cluster_size:" + strconv.Itoa(shardCount),
+		"cluster_current_epoch:" + strconv.FormatUint(epoch, 10),
+		"cluster_my_epoch:0",
+	}
+	return protocol.MakeBulkReply([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+}
@@ -0,0 +1,252 @@
+package cluster
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/timewheel"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/parser"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: tcc
+ * @Version: 1.0.0
+ * @Description: 分布式事务的参与者，实现Prepare/Commit/Rollback
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	// prepare之后超过maxLockTime未提交则自动回滚并释放锁
+	maxLockTime = 3 * time.Second
+	// commit之后保留事务一段时间，以便协调者要求回滚
+	waitBeforeCleanTx = 2 * maxLockTime
+)
+
+const (
+	createdStatus = iota
+	preparedStatus
+	committedStatus
+	rolledBackStatus
+)
+
+// Transaction 参与者一侧的事务
+type Transaction struct {
+	id        string
+	dbIndex   int
+	writeKeys []string
+	readKeys  []string
+	locked    bool
+	undoLog   []CmdLine
+	status    int8
+	mu        sync.Mutex
+	cluster   *Cluster
+}
+
+func genTaskKey(txID string) string {
+	return "tx:" + txID
+}
+
+func NewTransaction(cluster *Cluster, c redis.Connection, id string, writeKeys, readKeys []string) *Transaction {
+	return &Transaction{
+		id:        id,
+		dbIndex:   c.GetDBIndex(),
+		writeKeys: writeKeys,
+		readKeys:  readKeys,
+		status:    createdStatus,
+		cluster:   cluster,
+	}
+}
+
+func (tx *Transaction) lockKeys() {
+	if !tx.locked {
+		tx.cluster.db.RWLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		tx.locked = true
+	}
+}
+
+func (tx *Transaction) unLockKeys() {
+	if tx.locked {
+		tx.cluster.db.RWUnLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		tx.locked = false
+	}
+}
+
+// fakeConn 事务在自己的db中执行命令，不依赖发起请求的连接
+func (tx *Transaction) fakeConn() redis.Connection {
+	conn := &connection.FakeConn{}
+	conn.SelectDB(tx.dbIndex)
+	return conn
+}
+
+// prepare 锁定key并记录undo log，返回每个key的版本号和数据
+func (tx *Transaction) prepare() redis.Reply {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.lockKeys()
+	if len(tx.writeKeys) > 0 {
+		tx.undoLog = tx.cluster.db.GetUndoLogs(tx.dbIndex, utils.ToCmdLineByString("DEL", tx.writeKeys...))
+	}
+
+	conn := tx.fakeConn()
+	keys := append(append([]string{}, tx.writeKeys...), tx.readKeys...)
+	result := make([][]byte, 0, 3*len(keys))
+	for _, key := range keys {
+		ver := tx.cluster.db.ExecWithLock(conn, utils.ToCmdLine("GetVer", key))
+		intReply, ok := ver.(*protocol.IntReply)
+		if !ok {
+			tx.unLockKeys()
+			tx.cluster.transactions.Remove(tx.id)
+			return ver
+		}
+		result = append(result, []byte(strconv.FormatInt(intReply.Code, 10)))
+
+		dump := tx.cluster.db.ExecWithLock(conn, utils.ToCmdLine("DumpKey", key))
+		if dumpReply, ok := dump.(*protocol.MultiBulkReply); ok && len(dumpReply.Args) == 2 {
+			result = append(result, dumpReply.Args[0], dumpReply.Args[1])
+		} else {
+			result = append(result, nil, nil)
+		}
+	}
+	tx.status = preparedStatus
+
+	taskKey := genTaskKey(tx.id)
+	timewheel.Delay(maxLockTime, taskKey, func() {
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+		if tx.status == preparedStatus {
+			logger.Info("abort transaction: " + tx.id)
+			tx.unLockKeys()
+			tx.status = rolledBackStatus
+			tx.cluster.transactions.Remove(tx.id)
+		}
+	})
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// commit 在已锁定的key上执行命令，失败时回滚已执行的部分
+func (tx *Transaction) commit(cmdLines []CmdLine) redis.Reply {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != preparedStatus {
+		return protocol.MakeErrorReply("ERR transaction " + tx.id + " is not prepared")
+	}
+	timewheel.Cancel(genTaskKey(tx.id))
+
+	conn := tx.fakeConn()
+	for _, cmdLine := range cmdLines {
+		result := tx.cluster.db.ExecWithLock(conn, cmdLine)
+		if protocol.IsErrorReply(result) {
+			tx.rollbackWithLock(true)
+			return result
+		}
+	}
+	tx.cluster.db.AddVersion(tx.dbIndex, tx.writeKeys...)
+	tx.unLockKeys()
+	tx.status = committedStatus
+
+	timewheel.Delay(waitBeforeCleanTx, "", func() {
+		tx.cluster.transactions.Remove(tx.id)
+	})
+	return protocol.MakeOkReply()
+}
+
+// rollbackWithLock 释放锁，restore为true时执行undo log恢复数据，调用方需持有mu
+func (tx *Transaction) rollbackWithLock(restore bool) {
+	if tx.status == rolledBackStatus {
+		return
+	}
+	if restore {
+		// commit之后锁已释放，回滚前需重新加锁
+		tx.lockKeys()
+		conn := tx.fakeConn()
+		for _, cmdLine := range tx.undoLog {
+			tx.cluster.db.ExecWithLock(conn, cmdLine)
+		}
+		tx.cluster.db.AddVersion(tx.dbIndex, tx.writeKeys...)
+	}
+	tx.unLockKeys()
+	tx.status = rolledBackStatus
+}
+
+func (tx *Transaction) rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	timewheel.Cancel(genTaskKey(tx.id))
+	tx.rollbackWithLock(tx.status == committedStatus)
+}
+
+// execPrepare Prepare txID writeKeyCount key...
+func execPrepare(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 3 {
+		return protocol.MakeArgNumErrorReply("prepare")
+	}
+	txID := string(cmdLine[1])
+	writeCount, err := strconv.Atoi(string(cmdLine[2]))
+	keys := argsToKeys(cmdLine[3:])
+	if err != nil || writeCount < 0 || writeCount > len(keys) {
+		return protocol.MakeSyntaxErrorReply()
+	}
+	// 迁入中的key可能还在旧节点上，等待迁移完成后再执行事务
+	source, errReply := cluster.importSource(keys)
+	if errReply != nil {
+		return errReply
+	}
+	if source != "" {
+		return makeTryAgainReply()
+	}
+	tx := NewTransaction(cluster, c, txID, keys[:writeCount], keys[writeCount:])
+	cluster.transactions.Put(txID, tx)
+	return tx.prepare()
+}
+
+// execCommit Commit txID cmdLine...，每个cmdLine为RESP编码的命令
+func execCommit(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("commit")
+	}
+	txID := string(cmdLine[1])
+	raw, ok := cluster.transactions.Get(txID)
+	if !ok {
+		return protocol.MakeErrorReply("ERR transaction " + txID + " not found")
+	}
+	tx, _ := raw.(*Transaction)
+
+	cmdLines := make([]CmdLine, 0, len(cmdLine)-2)
+	for _, arg := range cmdLine[2:] {
+		reply, err := parser.ParseOne(arg)
+		if err != nil {
+			tx.rollback()
+			return protocol.MakeErrorReply("ERR illegal command in commit: " + err.Error())
+		}
+		mbReply, ok := reply.(*protocol.MultiBulkReply)
+		if !ok {
+			tx.rollback()
+			return protocol.MakeErrorReply("ERR illegal command in commit")
+		}
+		cmdLines = append(cmdLines, mbReply.Args)
+	}
+	return tx.commit(cmdLines)
+}
+
+// execRollback Rollback txID，事务不存在时视为已回滚
+func execRollback(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) != 2 {
+		return protocol.MakeArgNumErrorReply("rollback")
+	}
+	txID := string(cmdLine[1])
+	raw, ok := cluster.transactions.Get(txID)
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	tx, _ := raw.(*Transaction)
+	tx.rollback()
+	cluster.transactions.Remove(txID)
+	return protocol.MakeIntReply(1)
+}
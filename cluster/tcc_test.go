@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: tcc_test
+ * @Version: 1.0.0
+ * @Description: 分布式事务参与者的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+func encodeCmd(args ...string) []byte {
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes()
+}
+
+func assertValue(t *testing.T, cluster *Cluster, key string, expected string) {
+	t.Helper()
+	result := cluster.db.Exec(connection.NewConnection(nil), utils.ToCmdLine("GET", key))
+	bulk, ok := result.(*protocol.BulkReply)
+	if !ok || string(bulk.Arg) != expected {
+		t.Errorf("expect %s = %s, actual: %s", key, expected, result.ToBytes())
+	}
+}
+
+// assertUnlocked 事务结束之后key的锁已释放，其他写命令不会阻塞
+func assertUnlocked(t *testing.T, cluster *Cluster, key string) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		cluster.db.Exec(connection.NewConnection(nil), utils.ToCmdLine("SET", key+"-probe", "1"))
+		cluster.db.Exec(connection.NewConnection(nil), utils.ToCmdLine("EXISTS", key))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("key %s is still locked", key)
+	}
+}
+
+func TestTccRollbackAfterCommit(t *testing.T) {
+	cluster := MakeCluster()
+	conn := connection.NewConnection(nil)
+	cluster.db.Exec(conn, utils.ToCmdLine("SET", "a", "1"))
+
+	prepare := execPrepare(cluster, conn, utils.ToCmdLine("prepare", "tx1", "2", "a", "b"))
+	if protocol.IsErrorReply(prepare) {
+		t.Fatalf("prepare failed: %s", prepare.ToBytes())
+	}
+	commit := execCommit(cluster, conn, [][]byte{[]byte("commit"), []byte("tx1"),
+		encodeCmd("SET", "a", "2"), encodeCmd("SET", "b", "3")})
+	if !protocol.IsOKReply(commit) {
+		t.Fatalf("commit failed: %s", commit.ToBytes())
+	}
+	assertValue(t, cluster, "a", "2")
+	assertValue(t, cluster, "b", "3")
+
+	// 协调者要求回滚已提交的事务，恢复prepare之前的数据
+	rollback := execRollback(cluster, conn, utils.ToCmdLine("rollback", "tx1"))
+	if intReply, ok := rollback.(*protocol.IntReply); !ok || intReply.Code != 1 {
+		t.Fatalf("rollback failed: %s", rollback.ToBytes())
+	}
+	assertValue(t, cluster, "a", "1")
+	exists := cluster.db.Exec(conn, utils.ToCmdLine("EXISTS", "b"))
+	if intReply, ok := exists.(*protocol.IntReply); !ok || intReply.Code != 0 {
+		t.Errorf("key b should be removed by rollback")
+	}
+	assertUnlocked(t, cluster, "a")
+}
+
+func TestTccCommitFailure(t *testing.T) {
+	cluster := MakeCluster()
+	conn := connection.NewConnection(nil)
+	cluster.db.Exec(conn, utils.ToCmdLine("SET", "a", "1"))
+	cluster.db.Exec(conn, utils.ToCmdLine("SET", "s", "text"))
+
+	execPrepare(cluster, conn, utils.ToCmdLine("prepare", "tx2", "2", "a", "s"))
+	// 第二条命令执行失败，已经执行的第一条命令需要回滚
+	commit := execCommit(cluster, conn, [][]byte{[]byte("commit"), []byte("tx2"),
+		encodeCmd("SET", "a", "2"), encodeCmd("INCR", "s")})
+	if !protocol.IsErrorReply(commit) {
+		t.Fatalf("expect commit error, actual: %s", commit.ToBytes())
+	}
+	assertValue(t, cluster, "a", "1")
+	assertValue(t, cluster, "s", "text")
+	assertUnlocked(t, cluster, "a")
+}
+
+func TestTccRollbackPrepared(t *testing.T) {
+	cluster := MakeCluster()
+	conn := connection.NewConnection(nil)
+	cluster.db.Exec(conn, utils.ToCmdLine("SET", "a", "1"))
+
+	execPrepare(cluster, conn, utils.ToCmdLine("prepare", "tx3", "1", "a"))
+	execRollback(cluster, conn, utils.ToCmdLine("rollback", "tx3"))
+	assertValue(t, cluster, "a", "1")
+	assertUnlocked(t, cluster, "a")
+
+	// 回滚之后事务已经删除，不能再提交
+	commit := execCommit(cluster, conn, [][]byte{[]byte("commit"), []byte("tx3"), encodeCmd("SET", "a", "2")})
+	if !protocol.IsErrorReply(commit) {
+		t.Errorf("expect commit error after rollback, actual: %s", commit.ToBytes())
+	}
+	assertValue(t, cluster, "a", "1")
+	// 回滚不存在的事务返回0
+	rollback := execRollback(cluster, conn, utils.ToCmdLine("rollback", "tx3"))
+	if intReply, ok := rollback.(*protocol.IntReply); !ok || intReply.Code != 0 {
+		t.Errorf("expect 0 for unknown transaction, actual: %s", rollback.ToBytes())
+	}
+}
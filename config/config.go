@@ -32,23 +32,82 @@ type ServerProperties struct {
 	SlaveAnnouncePort int    `cfg:"slave-announce-port"`
 	SlaveAnnounceIP   string `cfg:"slave-announce-ip"`
 	ReplTimeout       int    `cfg:"repl-timeout"`
+	ReplBacklogSize   int    `cfg:"repl-backlog-size"`
+	// ReplOutputBufferLimit master为每个slave缓存的未发送数据上限，支持kb、mb等单位，默认为256mb，超过后断开slave
+	ReplOutputBufferLimit string `cfg:"repl-output-buffer-limit"`
+
+	// AppendFsync aof的fsync策略: always, everysec(默认), no
+	AppendFsync string `cfg:"appendfsync"`
+	// AppendDirname multi part aof的目录，默认为appendonlydir
+	AppendDirname string `cfg:"appenddirname"`
+	// AofUseRdbPreamble 默认为yes，重写时以rdb格式保存base文件
+	AofUseRdbPreamble bool `cfg:"aof-use-rdb-preamble"`
+	// AofLoadTruncated 默认为yes，aof末尾命令不完整时截断到最后一条完整命令后继续启动
+	AofLoadTruncated bool `cfg:"aof-load-truncated"`
+
+	// MaxMemory 内存上限，支持kb、mb、gb等单位，为空或0时不限制
+	MaxMemory string `cfg:"maxmemory"`
+	// MaxMemoryPolicy 达到上限时的淘汰策略，默认为noeviction
+	MaxMemoryPolicy string `cfg:"maxmemory-policy"`
+	// MaxMemorySamples 每次淘汰时每个db采样的key数量，默认为5
+	MaxMemorySamples int `cfg:"maxmemory-samples"`
+
+	// ActiveExpireEffort 主动过期的力度1~10，默认为1，越大删除过期key越及时但占用更多CPU
+	ActiveExpireEffort int `cfg:"active-expire-effort"`
+	// ExpireTimeWheel 为yes时为每个带过期时间的key在时间轮上添加定时删除任务，key较多时占用大量内存
+	ExpireTimeWheel bool `cfg:"expire-timewheel"`
+	// LuaTimeLimit 脚本执行超过该时间(毫秒)后其他客户端收到BUSY回复，可以通过SCRIPT KILL停止脚本，默认为5000
+	LuaTimeLimit int `cfg:"lua-time-limit"`
+	// LuaTimeout 脚本执行超过该时间(毫秒)后强制停止，已经执行的写命令不会回滚，默认为60000
+	LuaTimeout int `cfg:"lua-timeout"`
+	// NotifyKeyspaceEvents keyspace notifications发布的事件，与Redis的字母相同，为空时不发布
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
 
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
+	// ClusterSlots 为yes时使用Redis Cluster的16384个hash slot分配key，并返回MOVED/ASK重定向
+	ClusterSlots bool `cfg:"cluster-slots"`
+	// ClusterFailover 为yes时节点之间通过Raft同步拓扑，master失联后自动提升replica
+	ClusterFailover bool `cfg:"cluster-failover"`
+	// ClusterNodeTimeout master超过该时间(毫秒)无响应则判定下线
+	ClusterNodeTimeout int `cfg:"cluster-node-timeout"`
+	// ClusterReplicaOf 本节点作为replica复制的master，master需要在peers中
+	ClusterReplicaOf string `cfg:"cluster-replica-of"`
+	// ClusterConfigFile 保存Raft任期、投票和拓扑日志的文件，默认为raft-<port>.json
+	ClusterConfigFile string `cfg:"cluster-config-file"`
+	// ClusterSecret 节点之间握手使用的密钥，为空时使用requirepass，
+	// 都为空时只接受来自已知节点IP的握手，新加入的节点需要在peers中配置已有节点
+	ClusterSecret string `cfg:"cluster-secret"`
+
+	// Sentinel 为yes时以sentinel模式运行，也可以通过--sentinel参数启动
+	Sentinel bool `cfg:"sentinel"`
+	// SentinelMonitor 监控的master，格式为"<name> <host> <port> <quorum>"
+	SentinelMonitor string `cfg:"sentinel-monitor"`
+	// SentinelDownAfter master超过该时间(毫秒)没有有效回复则认为下线
+	SentinelDownAfter int `cfg:"sentinel-down-after-milliseconds"`
+	// SentinelFailoverTimeout 两次故障转移尝试之间的最小间隔(毫秒)
+	SentinelFailoverTimeout int `cfg:"sentinel-failover-timeout"`
+	// SentinelPeers 监控同一个master的其他sentinel，设置了requirepass时各sentinel需要使用相同的密码
+	SentinelPeers []string `cfg:"sentinel-peers"`
 }
 
 var Properties *ServerProperties
 
 func init() {
 	Properties = &ServerProperties{
-		Bind:       "127.0.0.1",
-		Port:       6389,
-		AppendOnly: false,
+		Bind:              "127.0.0.1",
+		Port:              6389,
+		AppendOnly:        false,
+		AofLoadTruncated:  true,
+		AofUseRdbPreamble: true,
 	}
 }
 
 func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
+	config := &ServerProperties{
+		AofLoadTruncated:  true,
+		AofUseRdbPreamble: true,
+	}
 
 	rawMap := make(map[string]string)
 	scanner := bufio.NewScanner(src)
@@ -0,0 +1,462 @@
+package database
+
+import (
+	"fmt"
+	"gmr/go-cache/datastruct/list"
+	"gmr/go-cache/datastruct/stream"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/timewheel"
+	"gmr/go-cache/redis/protocol"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: blocking
+ * @Version: 1.0.0
+ * @Description: 阻塞命令blpop/brpop/brpoplpush/blmove/bzpopmin/bzpopmax以及xread/xreadgroup的BLOCK，没有数据时客户端按照FIFO顺序
+ *               在key的等待队列中等待，写入key的命令执行后唤醒队首的客户端，超时由时间轮触发，精度为时间轮的1秒
+ * @Date: 2026/10/18 10:12
+ */
+
+var unblockedReply = protocol.MakeErrorReply("UNBLOCKED force unblock from blocking operation, instance state changed (master -> replica?)")
+
+// blockedClient 阻塞在一个或多个key上的客户端
+type blockedClient struct {
+	conn redis.Connection
+	keys []string
+	// wake 有数据写入、超时、连接关闭或者角色变化时唤醒客户端重新检查
+	wake     chan struct{}
+	timedOut int32
+	closed   int32
+}
+
+func (bc *blockedClient) signal() {
+	select {
+	case bc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// blockingKeys 每个key上等待的客户端队列，flushdb或者全量同步替换DB时由新的DB继承
+type blockingKeys struct {
+	mu sync.Mutex
+	// key:*list.LinkedList，队列中为*blockedClient
+	queues map[string]*list.LinkedList
+	// count 阻塞的客户端数量，为0时写命令不需要检查等待队列
+	count int32
+}
+
+func makeBlockingKeys() *blockingKeys {
+	return &blockingKeys{
+		queues: make(map[string]*list.LinkedList),
+	}
+}
+
+func (bk *blockingKeys) add(bc *blockedClient) {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	for _, key := range bc.keys {
+		queue, ok := bk.queues[key]
+		if !ok {
+			queue = list.MakeLinkedList()
+			bk.queues[key] = queue
+		}
+		queue.Add(bc)
+	}
+	atomic.AddInt32(&bk.count, 1)
+}
+
+// remove 将客户端移出等待队列，并唤醒这些key上新的队首，避免丢失发给该客户端的唤醒
+func (bk *blockingKeys) remove(bc *blockedClient) {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	removed := false
+	for _, key := range bc.keys {
+		queue, ok := bk.queues[key]
+		if !ok {
+			continue
+		}
+		if queue.RemoveAllByValue(func(a interface{}) bool {
+			return a == bc
+		}) > 0 {
+			removed = true
+		}
+		if queue.Len() == 0 {
+			delete(bk.queues, key)
+			continue
+		}
+		queue.Get(0).(*blockedClient).signal()
+	}
+	if removed {
+		atomic.AddInt32(&bk.count, -1)
+	}
+}
+
+// signal 唤醒keys上等待的队首客户端，队首客户端成功取出数据后会继续唤醒下一个
+func (bk *blockingKeys) signal(keys []string) {
+	if bk == nil || atomic.LoadInt32(&bk.count) == 0 {
+		return
+	}
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	for _, key := range keys {
+		if queue, ok := bk.queues[key]; ok {
+			queue.Get(0).(*blockedClient).signal()
+		}
+	}
+}
+
+// signalAll 唤醒所有阻塞的客户端
+func (bk *blockingKeys) signalAll() {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	for _, queue := range bk.queues {
+		queue.ForEach(func(i int, v interface{}) bool {
+			v.(*blockedClient).signal()
+			return true
+		})
+	}
+}
+
+// blockingSpec 解析阻塞命令的参数，返回需要等待的key和超时时间(0表示一直阻塞)，block为false时按照普通命令执行
+type blockingSpec func(db *DB, args [][]byte) (keys []string, timeout time.Duration, block bool, errReply protocol.ErrorReply)
+
+var blockingCommands = map[string]blockingSpec{
+	"blpop":      blockingPopSpec,
+	"brpop":      blockingPopSpec,
+	"brpoplpush": blockingMoveSpec,
+	"blmove":     blockingMoveSpec,
+	"bzpopmin":   blockingPopSpec,
+	"bzpopmax":   blockingPopSpec,
+	"xread":      xReadBlockingSpec,
+	"xreadgroup": xReadGroupBlockingSpec,
+}
+
+func isBlockingCommand(cmdName string) bool {
+	_, ok := blockingCommands[cmdName]
+	return ok
+}
+
+// IsBlockingCmdLine 命令是否会阻塞等待，xread和xreadgroup只有带BLOCK选项时才会阻塞
+func IsBlockingCmdLine(cmdLine [][]byte) bool {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if !isBlockingCommand(cmdName) {
+		return false
+	}
+	if cmdName != "xread" && cmdName != "xreadgroup" {
+		return true
+	}
+	for i := 1; i < len(cmdLine); i++ {
+		switch strings.ToLower(string(cmdLine[i])) {
+		case "block":
+			return true
+		case "group":
+			// 跳过group和consumer名称
+			i += 2
+		case "streams":
+			return false
+		}
+	}
+	return false
+}
+
+func blockingPopSpec(db *DB, args [][]byte) ([]string, time.Duration, bool, protocol.ErrorReply) {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return nil, 0, false, errReply
+	}
+	keys, _ := blockingListKeys(args)
+	return keys, timeout, true, nil
+}
+
+// blockingMoveSpec brpoplpush和blmove只在source上等待
+func blockingMoveSpec(db *DB, args [][]byte) ([]string, time.Duration, bool, protocol.ErrorReply) {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return nil, 0, false, errReply
+	}
+	return []string{string(args[0])}, timeout, true, nil
+}
+
+// xReadBlockingSpec 阻塞前将$替换为stream当前的最后一个ID，之后只返回阻塞期间新添加的entry
+func xReadBlockingSpec(db *DB, args [][]byte) ([]string, time.Duration, bool, protocol.ErrorReply) {
+	opts, errReply := parseStreamReadArgs(args, false)
+	if errReply != nil || !opts.blocking {
+		return nil, 0, false, errReply
+	}
+	db.RWLocks(nil, opts.keys)
+	defer db.RWUnLocks(nil, opts.keys)
+	for i, key := range opts.keys {
+		if opts.ids[i] != "$" {
+			continue
+		}
+		lastID := stream.MinID
+		if s, _ := db.getAsStream(key); s != nil {
+			lastID = s.LastID()
+		}
+		args[opts.idPos+i] = []byte(lastID.String())
+	}
+	return opts.keys, opts.block, true, nil
+}
+
+// xReadGroupBlockingSpec 只有读取新entry(>)时才会阻塞
+func xReadGroupBlockingSpec(db *DB, args [][]byte) ([]string, time.Duration, bool, protocol.ErrorReply) {
+	opts, errReply := parseStreamReadArgs(args, true)
+	if errReply != nil || !opts.blocking {
+		return nil, 0, false, errReply
+	}
+	return opts.keys, opts.block, true, nil
+}
+
+// parseBlockingTimeout 超时时间的单位为秒，可以是小数，0表示一直阻塞
+func parseBlockingTimeout(arg []byte) (time.Duration, protocol.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, protocol.MakeErrorReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, protocol.MakeErrorReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// execBlocking 执行阻塞命令，MULTI中和master同步过来的命令不会阻塞，直接由cmdTable中的命令执行
+func (mdb *MultiDB) execBlocking(c redis.Connection, cmdLine [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd := cmdTable[cmdName]
+	if !validateArity(cmd.arity, cmdLine) {
+		return protocol.MakeArgNumErrorReply(cmdName)
+	}
+	dbIndex := c.GetDBIndex()
+	selectedDB, selectErr := mdb.selectDB(dbIndex)
+	if selectErr != nil {
+		return selectErr
+	}
+	// spec可能会改写参数，复制一份避免影响调用方
+	cmdLine = append([][]byte{}, cmdLine...)
+	keys, timeout, block, errReply := blockingCommands[cmdName](selectedDB, cmdLine[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if !block {
+		return selectedDB.Exec(c, cmdLine)
+	}
+	bc := &blockedClient{
+		conn: c,
+		keys: keys,
+		wake: make(chan struct{}, 1),
+	}
+
+	// 先登记再检查连接状态，连接关闭时unblockClient要么能找到bc，要么这里能看到IsClosed
+	mdb.blockedClients.Store(c, bc)
+	defer mdb.blockedClients.Delete(c)
+	if result, ok := selectedDB.serveBlocked(cmd, cmdLine, bc, true); ok {
+		return result
+	}
+	if c.IsClosed() {
+		selectedDB.blocking.remove(bc)
+		return &protocol.NoReply{}
+	}
+
+	if timeout > 0 {
+		taskKey := fmt.Sprintf("blocking:%p", bc)
+		timewheel.Delay(timeout, taskKey, func() {
+			atomic.StoreInt32(&bc.timedOut, 1)
+			bc.signal()
+		})
+		defer timewheel.Cancel(taskKey)
+	}
+
+	for range bc.wake {
+		// flushdb和全量同步会替换DB，每次唤醒后重新获取
+		selectedDB = mdb.mustSelectDB(dbIndex)
+		if atomic.LoadInt32(&bc.closed) == 1 {
+			selectedDB.blocking.remove(bc)
+			return &protocol.NoReply{}
+		}
+		if atomic.LoadInt32(&mdb.role) == slaveRole {
+			selectedDB.blocking.remove(bc)
+			return unblockedReply
+		}
+		if result, ok := selectedDB.serveBlocked(cmd, cmdLine, bc, false); ok {
+			return result
+		}
+		if atomic.LoadInt32(&bc.timedOut) == 1 {
+			selectedDB.blocking.remove(bc)
+			return protocol.MakeNullMultiBulkReply()
+		}
+	}
+	return protocol.MakeNullMultiBulkReply()
+}
+
+// serveBlocked 尝试为客户端执行命令，列表为空且block为true时加入等待队列，
+// 检查和加入等待队列在同一个锁内完成，不会错过其他客户端的写入
+func (db *DB) serveBlocked(cmd *command, cmdLine [][]byte, bc *blockedClient, block bool) (redis.Reply, bool) {
+	write, read := cmd.prepare(cmdLine[1:])
+	db.RWLocks(write, read)
+	defer db.RWUnLocks(write, read)
+
+	result := cmd.executor(db, cmdLine[1:])
+	// 列表为空或者stream没有新的entry时命令返回空数组
+	if _, empty := result.(*protocol.NullMultiBulkReply); empty {
+		if block {
+			db.blocking.add(bc)
+		}
+		return nil, false
+	}
+	db.addVersion(write...)
+	db.updateSizes(write)
+	if !block {
+		db.blocking.remove(bc)
+	}
+	db.blocking.signal(write)
+	return result, true
+}
+
+// unblockClient 连接关闭时唤醒阻塞的客户端，由阻塞的命令将其移出等待队列
+func (mdb *MultiDB) unblockClient(c redis.Connection) {
+	raw, ok := mdb.blockedClients.Load(c)
+	if !ok {
+		return
+	}
+	bc := raw.(*blockedClient)
+	atomic.StoreInt32(&bc.closed, 1)
+	bc.signal()
+}
+
+// unblockAll 切换为slave时唤醒所有阻塞的客户端，返回UNBLOCKED错误
+func (mdb *MultiDB) unblockAll() {
+	for i := range mdb.dbSet {
+		mdb.mustSelectDB(i).blocking.signalAll()
+	}
+}
+
+// blockingListKeys blpop/brpop/bzpopmin/bzpopmax中除了超时时间以外的参数都是key
+func blockingListKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = string(args[i])
+	}
+	return keys, nil
+}
+
+// execBlockingPop 不阻塞地从第一个非空的列表中取出元素，都为空时返回空数组
+func execBlockingPop(db *DB, args [][]byte, pop ExecFunc) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, arg := range args[:len(args)-1] {
+		l, errReply := db.getAsList(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if l == nil {
+			continue
+		}
+		result := pop(db, [][]byte{arg})
+		bulk, ok := result.(*protocol.BulkReply)
+		if !ok {
+			return result
+		}
+		return protocol.MakeMultiBulkReply([][]byte{arg, bulk.Arg})
+	}
+	return protocol.MakeNullMultiBulkReply()
+}
+
+func execBLPop(db *DB, args [][]byte) redis.Reply {
+	return execBlockingPop(db, args, execLPop)
+}
+
+func execBRPop(db *DB, args [][]byte) redis.Reply {
+	return execBlockingPop(db, args, execRPop)
+}
+
+// undoBlockingPop 只有第一个非空的列表会被修改
+func undoBlockingPop(db *DB, args [][]byte) []CmdLine {
+	for _, arg := range args[:len(args)-1] {
+		if l, _ := db.getAsList(string(arg)); l != nil {
+			return rollbackGivenKeys(db, string(arg))
+		}
+	}
+	return nil
+}
+
+// execBlockingMove 列表为空时返回空数组而不是nil
+func execBlockingMove(db *DB, args [][]byte, move ExecFunc) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	result := move(db, args[:len(args)-1])
+	if _, ok := result.(*protocol.NullBulkReply); ok {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return result
+}
+
+func execBRPopLPush(db *DB, args [][]byte) redis.Reply {
+	return execBlockingMove(db, args, execRPopLPush)
+}
+
+func execBLMove(db *DB, args [][]byte) redis.Reply {
+	return execBlockingMove(db, args, execLMove)
+}
+
+func undoBlockingMove(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+// execBlockingZPop 不阻塞地从第一个非空的sorted set中取出元素，返回key、member和score，都为空时返回空数组
+func execBlockingZPop(db *DB, args [][]byte, pop ExecFunc) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, arg := range args[:len(args)-1] {
+		sortedSet, errReply := db.getAsSortedSet(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if sortedSet == nil {
+			continue
+		}
+		result := pop(db, [][]byte{arg})
+		multiBulk, ok := result.(*protocol.MultiBulkReply)
+		if !ok {
+			return result
+		}
+		return protocol.MakeMultiBulkReply(append([][]byte{arg}, multiBulk.Args...))
+	}
+	return protocol.MakeNullMultiBulkReply()
+}
+
+func execBZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execBlockingZPop(db, args, execZPopMin)
+}
+
+func execBZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execBlockingZPop(db, args, execZPopMax)
+}
+
+// undoBlockingZPop 只有第一个非空的sorted set会被修改
+func undoBlockingZPop(db *DB, args [][]byte) []CmdLine {
+	for _, arg := range args[:len(args)-1] {
+		if sortedSet, _ := db.getAsSortedSet(string(arg)); sortedSet != nil {
+			return rollbackGivenKeys(db, string(arg))
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterCommand("BLPop", execBLPop, blockingListKeys, undoBlockingPop, -3, flagWrite)
+	RegisterCommand("BRPop", execBRPop, blockingListKeys, undoBlockingPop, -3, flagWrite)
+	RegisterCommand("BRPopLPush", execBRPopLPush, prepareRPopLPush, undoBlockingMove, 4, flagWrite)
+	RegisterCommand("BLMove", execBLMove, prepareRPopLPush, undoBlockingMove, 6, flagWrite)
+	RegisterCommand("BZPopMin", execBZPopMin, blockingListKeys, undoBlockingZPop, -3, flagWrite)
+	RegisterCommand("BZPopMax", execBZPopMax, blockingListKeys, undoBlockingZPop, -3, flagWrite)
+}
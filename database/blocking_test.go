@@ -0,0 +1,34 @@
+package database
+
+import (
+	"gmr/go-cache/lib/utils"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: blocking_test
+ * @Version: 1.0.0
+ * @Description: 阻塞命令判断的测试
+ * @Date: 2026/10/18 2:52
+ */
+
+func TestIsBlockingCmdLine(t *testing.T) {
+	cases := []struct {
+		cmdLine  [][]byte
+		blocking bool
+	}{
+		{utils.ToCmdLine("blpop", "a", "0"), true},
+		{utils.ToCmdLine("BLMOVE", "a", "b", "left", "right", "1"), true},
+		{utils.ToCmdLine("lpop", "a"), false},
+		{utils.ToCmdLine("xread", "count", "1", "streams", "block", "0"), false},
+		{utils.ToCmdLine("xread", "block", "100", "streams", "s", "$"), true},
+		{utils.ToCmdLine("xreadgroup", "group", "block", "c", "streams", "s", ">"), false},
+		{utils.ToCmdLine("xreadgroup", "group", "g", "c", "block", "0", "streams", "s", ">"), true},
+	}
+	for _, c := range cases {
+		if IsBlockingCmdLine(c.cmdLine) != c.blocking {
+			t.Errorf("%s: expect blocking %v", c.cmdLine, c.blocking)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"gmr/go-cache/aof"
 	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
 	"gmr/go-cache/redis/parser"
 	"gmr/go-cache/redis/protocol"
 )
@@ -49,6 +50,9 @@ func execDumpKey(db *DB, args [][]byte) redis.Reply {
 func execRenameFrom(db *DB, args [][]byte) redis.Reply {
 	key := string(args[0])
 	db.Remove(key)
+	db.addAof(utils.ToCmdLineByByte("del", args[0]))
+	// 与Redis的MIGRATE一致，源节点发布del事件
+	db.notify(notifyGeneric, "del", key)
 	return protocol.MakeOkReply()
 }
 
@@ -75,7 +79,11 @@ func execRenameTo(db *DB, args [][]byte) redis.Reply {
 	}
 
 	ttlCmd.Args[1] = key
+	// 迁移写入过程中的set、expire等事件不发布，完成后与Redis的RESTORE一致发布restore事件
+	db.quietKeys.Store(string(key), struct{}{})
+	defer db.quietKeys.Delete(string(key))
 	db.Remove(string(key))
+	db.addAof(utils.ToCmdLineByByte("del", key))
 	dumpResult := db.execWithLock(dumpCmd.Args)
 	if protocol.IsErrorReply(dumpResult) {
 		return dumpResult
@@ -84,6 +92,8 @@ func execRenameTo(db *DB, args [][]byte) redis.Reply {
 	if protocol.IsErrorReply(tllResult) {
 		return tllResult
 	}
+	db.quietKeys.Delete(string(key))
+	db.notify(notifyGeneric, "restore", string(key))
 	return protocol.MakeOkReply()
 }
 
@@ -119,6 +129,7 @@ func execCopyTo(db *DB, args [][]byte) redis.Reply {
 
 	ttlCmd.Args[1] = key
 	db.Remove(string(key))
+	db.addAof(utils.ToCmdLineByByte("del", key))
 	dumpResult := db.execWithLock(dumpCmd.Args)
 	if protocol.IsErrorReply(dumpResult) {
 		return dumpResult
@@ -127,15 +138,16 @@ func execCopyTo(db *DB, args [][]byte) redis.Reply {
 	if protocol.IsErrorReply(tllResult) {
 		return tllResult
 	}
+	db.notify(notifyGeneric, "copy_to", string(key))
 	return protocol.MakeOkReply()
 }
 
 func init() {
 	RegisterCommand("DumpKey", execDumpKey, writeAllKeys, undoDel, 2, flagReadOnly)
 	RegisterCommand("ExistIn", execExistIn, readAllKeys, nil, -1, flagReadOnly)
-	RegisterCommand("RenameFrom", execRenameFrom, readFirstKey, nil, 2, flagWrite)
+	RegisterCommand("RenameFrom", execRenameFrom, writeFirstKey, rollbackFirstKey, 2, flagWrite)
 	RegisterCommand("RenameTo", execRenameTo, writeFirstKey, rollbackFirstKey, 4, flagWrite)
 	RegisterCommand("RenameNxTo", execRenameTo, writeFirstKey, rollbackFirstKey, 4, flagWrite)
 	RegisterCommand("CopyFrom", execCopyFrom, readFirstKey, nil, 2, flagReadOnly)
-	RegisterCommand("CopyTo", execCopyTo, writeFirstKey, rollbackFirstKey, 5, flagWrite)
+	RegisterCommand("CopyTo", execCopyTo, writeFirstKey, rollbackFirstKey, 4, flagWrite)
 }
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: cluster_helper_test
+ * @Version: 1.0.0
+ * @Description: 迁移key时发布的keyspace事件的测试
+ * @Date: 2026/10/18 2:41
+ */
+
+func TestMigrationNotify(t *testing.T) {
+	src := makeDB()
+	dest := makeDB()
+	var events []string
+	record := func(dbIndex int, class int, event string, key string) {
+		events = append(events, event+":"+key)
+	}
+	src.notifyEvent = record
+	dest.notifyEvent = record
+
+	src.execWithLock(utils.ToCmdLine("rpush", "list", "a", "b"))
+	src.execWithLock(utils.ToCmdLine("expire", "list", "100"))
+	dump, ok := src.execWithLock(utils.ToCmdLine("DumpKey", "list")).(*protocol.MultiBulkReply)
+	if !ok || len(dump.Args) != 2 {
+		t.Fatalf("unexpected dump reply")
+	}
+
+	events = nil
+	resp := dest.execWithLock(utils.ToCmdLineByByte("RenameTo", []byte("list"), dump.Args[0], dump.Args[1]))
+	if protocol.IsErrorReply(resp) {
+		t.Fatalf("RenameTo failed: %s", resp.ToBytes())
+	}
+	src.execWithLock(utils.ToCmdLine("RenameFrom", "list"))
+	if len(events) != 2 || events[0] != "restore:list" || events[1] != "del:list" {
+		t.Errorf("unexpected events %v", events)
+	}
+	if _, ok := dest.quietKeys.Load("list"); ok {
+		t.Errorf("quiet key should be removed after migration")
+	}
+}
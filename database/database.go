@@ -14,6 +14,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -37,10 +38,35 @@ type MultiDB struct {
 	slaveOf     string
 	role        int32
 	replication *replicationStatus
+	// 作为master时保存slave的同步状态
+	masterStatus *masterStatus
+
+	// maxmemory为0时不限制内存
+	maxMemory       int64
+	evictionPolicy  string
+	evictionSamples int
+	evictedKeys     int64
+	// evictMu 同一时间只有一个命令执行淘汰
+	evictMu sync.Mutex
+
+	// expiredKeys 惰性删除和主动过期删除的key数量
+	expiredKeys int64
+	// expireTimeCapReached 主动过期因为超过时间预算提前结束的次数
+	expireTimeCapReached int64
+
+	// notifyFlags notify-keyspace-events解析后的标志位，为0时不发布
+	notifyFlags int
+
+	// blockedClients 正在执行阻塞命令的客户端，redis.Connection:*blockedClient
+	blockedClients sync.Map
+
+	// functions 所有db共享的Redis Functions
+	functions *functionRegistry
 }
 
 func NewStandaloneServer() *MultiDB {
 	mdb := &MultiDB{}
+	mdb.functions = makeFunctionRegistry()
 
 	if config.Properties.Databases == 0 {
 		config.Properties.Databases = 16
@@ -50,12 +76,16 @@ func NewStandaloneServer() *MultiDB {
 	for i := range mdb.dbSet {
 		singleDB := makeDB()
 		singleDB.index = i
+		singleDB.afterExpire = mdb.afterExpire
+		singleDB.notifyEvent = mdb.notifyKeyspaceEvent
+		singleDB.functions = mdb.functions
 		holder := &atomic.Value{}
 		holder.Store(singleDB)
 		mdb.dbSet[i] = holder
 	}
 
 	mdb.hub = pubsub.MakeHub()
+	mdb.initNotify()
 	validAof := false
 	if config.Properties.AppendOnly {
 		aofHandler, err := aof.NewAOFHandler(mdb, func() database.EmbedDB {
@@ -76,23 +106,40 @@ func NewStandaloneServer() *MultiDB {
 		validAof = true
 	}
 
-	if config.Properties.RDBFilename != "" && !validAof {
+	// 开启aof时以aof为准，否则从rdb文件恢复
+	if !validAof {
 		loadRdbFile(mdb)
 	}
+	// 加载数据之后才开始限制内存，超出的部分在之后的写命令中淘汰
+	mdb.initMemoryLimit()
 
 	mdb.replication = initReplStatus()
+	mdb.initMasterStatus()
 	mdb.startReplCron()
+	mdb.startExpireCron()
 	mdb.role = masterRole
 	return mdb
 }
 
 func MakeBasicMultiDB() *MultiDB {
+	return makeBasicMultiDB(makeFunctionRegistry())
+}
+
+// MakeTmpDB 返回与mdb共享Redis Functions的空白db，集群中跨节点的事务在其中执行
+func (mdb *MultiDB) MakeTmpDB() database.EmbedDB {
+	return makeBasicMultiDB(mdb.functions)
+}
+
+func makeBasicMultiDB(functions *functionRegistry) *MultiDB {
 	mdb := &MultiDB{}
+	mdb.functions = functions
 	mdb.dbSet = make([]*atomic.Value, config.Properties.Databases)
 
 	for i := range mdb.dbSet {
+		singleDB := makeBasicDB()
+		singleDB.functions = mdb.functions
 		holder := &atomic.Value{}
-		holder.Store(makeBasicDB())
+		holder.Store(singleDB)
 		mdb.dbSet[i] = holder
 	}
 	return mdb
@@ -110,7 +157,7 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 	if cmdName == "auth" {
 		return Auth(c, cmdLine[1:])
 	}
-	if !isAuthenticated(c) {
+	if !IsAuthenticated(c) {
 		return protocol.MakeErrorReply("NOAUTH Authentication required")
 	}
 	if cmdName == "slaveof" {
@@ -121,15 +168,44 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 			return protocol.MakeArgNumErrorReply("SLAVEOF")
 		}
 		return mdb.execSlaveOf(c, cmdLine[1:])
+	} else if cmdName == "info" {
+		return mdb.execInfo(cmdLine[1:])
+	} else if cmdName == "replconf" {
+		return mdb.execReplConf(c, cmdLine[1:])
+	} else if cmdName == "psync" {
+		if len(cmdLine) != 3 {
+			return protocol.MakeArgNumErrorReply("PSYNC")
+		}
+		return mdb.execPSync(c, cmdLine[1:])
+	}
+
+	// 有脚本执行超时时只能执行SCRIPT KILL和FUNCTION KILL
+	if !isInternalConn(c) && !isAllowedWhenBusy(cmdLine) {
+		if errReply := running.busy(); errReply != nil {
+			return errReply
+		}
+	}
+
+	if cmdName == "select" {
+		if c != nil && c.InMultiState() {
+			return protocol.MakeErrorReply("cannot select database within multi")
+		}
+		if len(cmdLine) != 2 {
+			return protocol.MakeArgNumErrorReply("select")
+		}
+		return execSelect(c, mdb, cmdLine[1:])
 	}
 
 	role := atomic.LoadInt32(&mdb.role)
 	if role == slaveRole &&
 		c.GetRole() != connection.ReplicationRecvCli {
-		if !isReadOnlyCommand(cmdName) {
+		if !isReadOnlyCommand(cmdName) && !mdb.isReadOnlyFunctionCommand(cmdLine) {
 			return protocol.MakeErrorReply("READONLY You can't write against a read only slave.")
 		}
 	}
+	if reply := mdb.checkMemory(c, cmdName); reply != nil {
+		return reply
+	}
 
 	if cmdName == "subscribe" {
 		if len(cmdLine) < 2 {
@@ -140,6 +216,27 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 		return pubsub.Publish(mdb.hub, cmdLine[1:])
 	} else if cmdName == "unsubscribe" {
 		return pubsub.Unsubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == "psubscribe" {
+		if len(cmdLine) < 2 {
+			return protocol.MakeArgNumErrorReply("psubscribe")
+		}
+		return pubsub.PSubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == "punsubscribe" {
+		return pubsub.PUnsubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == "ssubscribe" {
+		if len(cmdLine) < 2 {
+			return protocol.MakeArgNumErrorReply("ssubscribe")
+		}
+		return pubsub.SSubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == "sunsubscribe" {
+		return pubsub.SUnsubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == "spublish" {
+		return pubsub.SPublish(mdb.hub, cmdLine[1:])
+	} else if cmdName == "pubsub" {
+		if len(cmdLine) < 2 {
+			return protocol.MakeArgNumErrorReply("pubsub")
+		}
+		return pubsub.PubSub(mdb.hub, cmdLine[1:])
 	} else if cmdName == "bgrewriteaof" {
 		return BGRewriteAOF(mdb, cmdLine[1:])
 	} else if cmdName == "rewriteaof" {
@@ -158,14 +255,6 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 		return SaveRDB(mdb, cmdLine[1:])
 	} else if cmdName == "bgsave" {
 		return BGSaveRDB(mdb, cmdLine[1:])
-	} else if cmdName == "select" {
-		if c != nil && c.InMultiState() {
-			return protocol.MakeErrorReply("cannot select database within multi")
-		}
-		if len(cmdLine) != 2 {
-			return protocol.MakeArgNumErrorReply("select")
-		}
-		return execSelect(c, mdb, cmdLine[1:])
 	} else if cmdName == "copy" {
 		if len(cmdLine) < 3 {
 			return protocol.MakeArgNumErrorReply("copy")
@@ -174,6 +263,11 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 	}
 	// todo: support multi database transaction
 
+	// MULTI中以及master同步过来的阻塞命令按照非阻塞的方式执行
+	if isBlockingCommand(cmdName) && !c.InMultiState() && c.GetRole() != connection.ReplicationRecvCli {
+		return mdb.execBlocking(c, cmdLine)
+	}
+
 	// normal commands
 	dbIndex := c.GetDBIndex()
 	selectedDB, errReply := mdb.selectDB(dbIndex)
@@ -185,10 +279,13 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 
 func (mdb *MultiDB) AfterClientClose(c redis.Connection) {
 	pubsub.UnsubscribeAll(mdb.hub, c)
+	mdb.removeSlave(c)
+	mdb.unblockClient(c)
 }
 
 func (mdb *MultiDB) Close() {
 	mdb.replication.close()
+	mdb.masterStatus.close()
 	if mdb.aofHandler != nil {
 		mdb.aofHandler.Close()
 	}
@@ -223,6 +320,10 @@ func (mdb *MultiDB) loadDB(dbIndex int, newDB *DB) redis.Reply {
 	oldDB := mdb.mustSelectDB(dbIndex)
 	newDB.index = dbIndex
 	newDB.addAof = oldDB.addAof
+	newDB.afterExpire = oldDB.afterExpire
+	newDB.notifyEvent = oldDB.notifyEvent
+	newDB.blocking = oldDB.blocking
+	newDB.functions = oldDB.functions
 	mdb.dbSet[dbIndex].Store(newDB)
 	return &protocol.OkReply{}
 }
@@ -332,3 +433,8 @@ func (mdb *MultiDB) GetDBSize(dbIndex int) (int, int) {
 	db := mdb.mustSelectDB(dbIndex)
 	return db.data.Len(), db.ttlMap.Len()
 }
+
+// AddVersion 增加key的版本号，使WATCH该key的事务失败
+func (mdb *MultiDB) AddVersion(dbIndex int, keys ...string) {
+	mdb.mustSelectDB(dbIndex).addVersion(keys...)
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"fmt"
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/logger"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: expire
+ * @Version: 1.0.0
+ * @Description: 主动过期，与Redis的active expire cycle相同，定期从ttlMap中采样删除过期key，
+ *               过期比例较高时继续采样，单次执行时间不超过时间预算，与IsExpired中的惰性删除配合使用
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	// activeExpireHz 每秒执行主动过期的次数
+	activeExpireHz = 10
+	// activeExpireKeysPerLoop 每轮从一个db中采样的key数量
+	activeExpireKeysPerLoop = 20
+	// activeExpireSlowTimePerc 主动过期最多占用的时间百分比
+	activeExpireSlowTimePerc = 25
+	// activeExpireAcceptableStale 采样中过期key的比例不超过该百分比时停止处理当前db
+	activeExpireAcceptableStale = 10
+
+	defaultActiveExpireEffort = 1
+	maxActiveExpireEffort     = 10
+)
+
+// expireCycle 根据active-expire-effort计算的主动过期参数，effort越大每轮采样越多、允许的过期比例越低
+type expireCycle struct {
+	keysPerLoop     int
+	timeLimit       time.Duration
+	acceptableStale int
+	// nextDB 下一次从该db开始处理，避免时间预算不足时总是处理前面的db
+	nextDB int
+}
+
+func makeExpireCycle() *expireCycle {
+	effort := config.Properties.ActiveExpireEffort
+	if effort < defaultActiveExpireEffort || effort > maxActiveExpireEffort {
+		effort = defaultActiveExpireEffort
+	}
+	effort--
+	timePerc := activeExpireSlowTimePerc + 2*effort
+	return &expireCycle{
+		keysPerLoop:     activeExpireKeysPerLoop + activeExpireKeysPerLoop/4*effort,
+		timeLimit:       time.Second / activeExpireHz * time.Duration(timePerc) / 100,
+		acceptableStale: activeExpireAcceptableStale - effort,
+	}
+}
+
+// startExpireCron 启动主动过期
+func (mdb *MultiDB) startExpireCron() {
+	cycle := makeExpireCycle()
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error(err)
+			}
+		}()
+
+		ticker := time.Tick(time.Second / activeExpireHz)
+		for range ticker {
+			mdb.activeExpireCycle(cycle)
+		}
+	}()
+}
+
+// activeExpireCycle 依次处理每个db，超过时间预算时返回，下一次从未处理完的db继续
+func (mdb *MultiDB) activeExpireCycle(cycle *expireCycle) {
+	start := time.Now()
+	dbNum := len(mdb.dbSet)
+	for i := 0; i < dbNum; i++ {
+		dbIndex := cycle.nextDB
+		cycle.nextDB = (cycle.nextDB + 1) % dbNum
+		db := mdb.mustSelectDB(dbIndex)
+		for {
+			if db.ttlMap.Len() == 0 {
+				break
+			}
+			keys := db.ttlMap.RandomDistinctKeys(cycle.keysPerLoop)
+			expired := 0
+			for _, key := range keys {
+				if db.expireIfNeeded(key) {
+					expired++
+				}
+			}
+			if time.Since(start) > cycle.timeLimit {
+				atomic.AddInt64(&mdb.expireTimeCapReached, 1)
+				return
+			}
+			if len(keys) == 0 || expired*100/len(keys) <= cycle.acceptableStale {
+				break
+			}
+		}
+	}
+}
+
+// expireIfNeeded 加锁后检查key是否过期，过期则删除
+func (db *DB) expireIfNeeded(key string) bool {
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWUnLocks(keys, nil)
+	return db.IsExpired(key)
+}
+
+// afterExpire 统计过期删除的key
+func (mdb *MultiDB) afterExpire(key string) {
+	atomic.AddInt64(&mdb.expiredKeys, 1)
+}
+
+// statsInfo INFO stats
+func (mdb *MultiDB) statsInfo() string {
+	lines := []string{
+		"# Stats",
+		fmt.Sprintf("expired_keys:%d", atomic.LoadInt64(&mdb.expiredKeys)),
+		fmt.Sprintf("expired_time_cap_reached_count:%d", atomic.LoadInt64(&mdb.expireTimeCapReached)),
+		fmt.Sprintf("evicted_keys:%d", atomic.LoadInt64(&mdb.evictedKeys)),
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// keyspaceInfo INFO keyspace，只列出非空的db
+func (mdb *MultiDB) keyspaceInfo() string {
+	lines := []string{"# Keyspace"}
+	for i := range mdb.dbSet {
+		db := mdb.mustSelectDB(i)
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("db%d:keys=%d,expires=%d", i, keys, db.ttlMap.Len()))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/database"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: expire_test
+ * @Version: 1.0.0
+ * @Description: 惰性删除和主动过期的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+// recordAof 记录db写入aof的命令
+func recordAof(db *DB) *[]string {
+	lines := make([]string, 0)
+	db.addAof = func(line CmdLine) {
+		lines = append(lines, string(line[0])+" "+string(line[1]))
+	}
+	return &lines
+}
+
+func TestLazyExpireAof(t *testing.T) {
+	db := makeDB()
+	lines := recordAof(db)
+	db.PutEntity("a", &database.DataEntity{Data: []byte("a")})
+	db.Expire("a", time.Now().Add(-time.Second))
+	db.PutEntity("b", &database.DataEntity{Data: []byte("b")})
+	db.Expire("b", time.Now().Add(time.Hour))
+
+	if _, ok := db.GetEntity("a"); ok {
+		t.Errorf("expired key should not be returned")
+	}
+	if _, ok := db.GetEntity("b"); !ok {
+		t.Errorf("key b should not be expired")
+	}
+	if strings.Join(*lines, ",") != "DEL a" {
+		t.Errorf("expect DEL a in aof, actual: %v", *lines)
+	}
+}
+
+func TestActiveExpireAof(t *testing.T) {
+	databases := config.Properties.Databases
+	defer func() {
+		config.Properties.Databases = databases
+	}()
+	config.Properties.Databases = 1
+	mdb := MakeBasicMultiDB()
+	db := mdb.mustSelectDB(0)
+	lines := recordAof(db)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		db.PutEntity(key, &database.DataEntity{Data: []byte(key)})
+		if i%2 == 0 {
+			db.Expire(key, time.Now().Add(-time.Second))
+		} else {
+			db.Expire(key, time.Now().Add(time.Hour))
+		}
+	}
+
+	// 过期比例较高时同一轮继续采样，直到采样中的过期比例足够低
+	cycle := makeExpireCycle()
+	for i := 0; i < 10 && len(*lines) < 50; i++ {
+		mdb.activeExpireCycle(cycle)
+	}
+	if len(*lines) != 50 {
+		t.Fatalf("expect 50 expired keys deleted, actual: %d", len(*lines))
+	}
+	for _, line := range *lines {
+		index, _ := strconv.Atoi(strings.TrimPrefix(line, "DEL key"))
+		if !strings.HasPrefix(line, "DEL key") || index%2 != 0 {
+			t.Errorf("unexpected aof line %s", line)
+		}
+	}
+	if db.data.Len() != 50 || db.ttlMap.Len() != 50 {
+		t.Errorf("expect 50 keys left, actual: %d keys, %d ttls", db.data.Len(), db.ttlMap.Len())
+	}
+}
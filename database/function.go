@@ -0,0 +1,653 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/lib/wildcard"
+	"gmr/go-cache/redis/protocol"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+/**
+ * @Author: wanglei
+ * @File: function
+ * @Version: 1.0.0
+ * @Description: Redis Functions，FUNCTION LOAD加载以"#!lua name=<library>"开头的代码，
+ *               代码中通过redis.register_function注册函数，之后通过FCALL/FCALL_RO调用。
+ *               function不属于任何db，FUNCTION命令写入aof，重写aof和生成rdb时保存所有library的代码
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	functionFlagNoWrites = "no-writes"
+	// functionDumpMagic FUNCTION DUMP的格式: magic、版本、每个library的代码长度和代码、crc32
+	functionDumpMagic   = "GCFN"
+	functionDumpVersion = 1
+)
+
+var validFunctionFlags = map[string]struct{}{
+	functionFlagNoWrites:    {},
+	"allow-oom":             {},
+	"allow-stale":           {},
+	"no-cluster":            {},
+	"allow-cross-slot-keys": {},
+}
+
+// luaFunction 通过redis.register_function注册的函数
+type luaFunction struct {
+	name        string
+	description string
+	flags       []string
+	library     *functionLibrary
+}
+
+func (f *luaFunction) readOnly() bool {
+	for _, flag := range f.flags {
+		if flag == functionFlagNoWrites {
+			return true
+		}
+	}
+	return false
+}
+
+// functionLibrary 每个library有一组已经执行过library代码的虚拟机，FCALL从中取出一个执行
+type functionLibrary struct {
+	name      string
+	code      string
+	proto     *lua.FunctionProto
+	functions map[string]*luaFunction
+	vms       sync.Pool
+}
+
+// libraryVM 加载了library的虚拟机，callbacks为注册的函数
+type libraryVM struct {
+	*luaVM
+	callbacks map[string]*lua.LFunction
+}
+
+// functionRegistry 同一个MultiDB中所有db共享的function
+type functionRegistry struct {
+	mu        sync.RWMutex
+	libraries map[string]*functionLibrary
+	// functions 函数名在所有library中唯一
+	functions map[string]*luaFunction
+}
+
+func makeFunctionRegistry() *functionRegistry {
+	return &functionRegistry{
+		libraries: make(map[string]*functionLibrary),
+		functions: make(map[string]*luaFunction),
+	}
+}
+
+func isValidFunctionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLibraryMetadata 解析第一行的"#!lua name=<library>"，返回library名称和去掉第一行之后的代码
+func parseLibraryMetadata(code string) (string, string, protocol.ErrorReply) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", protocol.MakeErrorReply("ERR Missing library metadata")
+	}
+	firstLine, body := code, ""
+	if idx := strings.IndexByte(code, '\n'); idx >= 0 {
+		// 保留换行，错误信息中的行号与原始代码一致
+		firstLine, body = code[:idx], code[idx:]
+	}
+	parts := strings.Fields(firstLine[2:])
+	if len(parts) == 0 || strings.ToLower(parts[0]) != "lua" {
+		engine := ""
+		if len(parts) > 0 {
+			engine = parts[0]
+		}
+		return "", "", protocol.MakeErrorReply("ERR Engine '" + engine + "' not found")
+	}
+	name := ""
+	for _, part := range parts[1:] {
+		if !strings.HasPrefix(part, "name=") {
+			return "", "", protocol.MakeErrorReply("ERR Invalid metadata value given: " + part)
+		}
+		name = strings.TrimPrefix(part, "name=")
+	}
+	if name == "" {
+		return "", "", protocol.MakeErrorReply("ERR Library name was not given")
+	}
+	if !isValidFunctionName(name) {
+		return "", "", protocol.MakeErrorReply("ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return name, body, nil
+}
+
+// compileLibrary 编译并执行library代码，检查注册的函数
+func compileLibrary(code string) (*functionLibrary, protocol.ErrorReply) {
+	name, body, errReply := parseLibraryMetadata(code)
+	if errReply != nil {
+		return nil, errReply
+	}
+	proto, err := compileLua("user_function", body)
+	if err != nil {
+		return nil, protocol.MakeErrorReply("ERR Error compiling function: " + singleLine(err.Error()))
+	}
+	lib := &functionLibrary{
+		name:  name,
+		code:  code,
+		proto: proto,
+	}
+	vm, functions, errReply := lib.newVM()
+	if errReply != nil {
+		return nil, errReply
+	}
+	if len(functions) == 0 {
+		return nil, protocol.MakeErrorReply("ERR No functions registered")
+	}
+	lib.functions = functions
+	lib.vms.New = func() interface{} {
+		vm, _, errReply := lib.newVM()
+		if errReply != nil {
+			return nil
+		}
+		return vm
+	}
+	lib.vms.Put(vm)
+	return lib, nil
+}
+
+// newVM 创建虚拟机并执行library代码，只有在执行library代码期间可以调用redis.register_function
+func (lib *functionLibrary) newVM() (*libraryVM, map[string]*luaFunction, protocol.ErrorReply) {
+	vm := &libraryVM{
+		luaVM:     newLuaVM(),
+		callbacks: make(map[string]*lua.LFunction),
+	}
+	functions := make(map[string]*luaFunction)
+	loading := true
+	L := vm.L
+	L.SetField(vm.redisLib, "register_function", L.NewFunction(func(L *lua.LState) int {
+		if !loading {
+			L.RaiseError("redis.register_function can only be called on FUNCTION LOAD command")
+			return 0
+		}
+		f, callback := parseRegisterFunction(L)
+		if _, ok := functions[f.name]; ok {
+			L.RaiseError("Function already exists in the library")
+			return 0
+		}
+		f.library = lib
+		functions[f.name] = f
+		vm.callbacks[f.name] = callback
+		return 0
+	}))
+	L.Push(L.NewFunctionFromProto(lib.proto))
+	err := L.PCall(0, 0, nil)
+	loading = false
+	if err != nil {
+		msg, _ := luaErrorMessage(err)
+		return nil, nil, protocol.MakeErrorReply("ERR Error registering functions: " + singleLine(msg))
+	}
+	return vm, functions, nil
+}
+
+// parseRegisterFunction redis.register_function(name, callback)
+// 或redis.register_function{function_name=name, callback=callback, flags={...}, description=description}
+func parseRegisterFunction(L *lua.LState) (*luaFunction, *lua.LFunction) {
+	f := &luaFunction{}
+	var callback lua.LValue = lua.LNil
+	if tbl, ok := L.Get(1).(*lua.LTable); ok && L.GetTop() == 1 {
+		tbl.ForEach(func(k lua.LValue, v lua.LValue) {
+			switch k.String() {
+			case "function_name":
+				f.name = v.String()
+			case "callback":
+				callback = v
+			case "description":
+				f.description = v.String()
+			case "flags":
+				flags, ok := v.(*lua.LTable)
+				if !ok {
+					L.RaiseError("flags argument to redis.register_function must be a table representing function flags")
+				}
+				flags.ForEach(func(_ lua.LValue, flag lua.LValue) {
+					if _, ok := validFunctionFlags[flag.String()]; !ok {
+						L.RaiseError("unknown flag given")
+					}
+					f.flags = append(f.flags, flag.String())
+				})
+			default:
+				L.RaiseError("unknown argument given to redis.register_function")
+			}
+		})
+	} else {
+		if L.GetTop() != 2 {
+			L.RaiseError("wrong number of arguments to redis.register_function")
+		}
+		f.name = L.Get(1).String()
+		callback = L.Get(2)
+	}
+	fn, ok := callback.(*lua.LFunction)
+	if !ok {
+		L.RaiseError("callback argument given to redis.register_function must be a function")
+	}
+	if !isValidFunctionName(f.name) {
+		L.RaiseError("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return f, fn
+}
+
+// add 加入新的library，replace为false时library已经存在会返回错误，所有library都检查通过后才会加入
+func (registry *functionRegistry) add(libs []*functionLibrary, replace bool) protocol.ErrorReply {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	replaced := make(map[string]struct{})
+	for _, lib := range libs {
+		if _, ok := registry.libraries[lib.name]; ok {
+			if !replace {
+				return protocol.MakeErrorReply("ERR Library '" + lib.name + "' already exists")
+			}
+			replaced[lib.name] = struct{}{}
+		}
+	}
+	seen := make(map[string]struct{})
+	for _, lib := range libs {
+		for name := range lib.functions {
+			existing, ok := registry.functions[name]
+			_, dup := seen[name]
+			if dup || ok && !isReplaced(existing, replaced) {
+				return protocol.MakeErrorReply("ERR Function " + name + " already exists")
+			}
+			seen[name] = struct{}{}
+		}
+	}
+	for _, lib := range libs {
+		registry.removeLocked(lib.name)
+		registry.libraries[lib.name] = lib
+		for name, f := range lib.functions {
+			registry.functions[name] = f
+		}
+	}
+	return nil
+}
+
+func isReplaced(f *luaFunction, replaced map[string]struct{}) bool {
+	_, ok := replaced[f.library.name]
+	return ok
+}
+
+func (registry *functionRegistry) removeLocked(name string) bool {
+	lib, ok := registry.libraries[name]
+	if !ok {
+		return false
+	}
+	for fname := range lib.functions {
+		delete(registry.functions, fname)
+	}
+	delete(registry.libraries, name)
+	return true
+}
+
+func (registry *functionRegistry) remove(name string) bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return registry.removeLocked(name)
+}
+
+func (registry *functionRegistry) flush() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.libraries = make(map[string]*functionLibrary)
+	registry.functions = make(map[string]*luaFunction)
+}
+
+// replaceWith 使用other中的function替换当前所有function，用于全量同步
+func (registry *functionRegistry) replaceWith(other *functionRegistry) {
+	other.mu.RLock()
+	libraries, functions := other.libraries, other.functions
+	other.mu.RUnlock()
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.libraries = libraries
+	registry.functions = functions
+}
+
+func (registry *functionRegistry) getFunction(name string) *luaFunction {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.functions[name]
+}
+
+// sortedLibraries 按照名称排序的所有library
+func (registry *functionRegistry) sortedLibraries() []*functionLibrary {
+	registry.mu.RLock()
+	libs := make([]*functionLibrary, 0, len(registry.libraries))
+	for _, lib := range registry.libraries {
+		libs = append(libs, lib)
+	}
+	registry.mu.RUnlock()
+	sort.Slice(libs, func(i, j int) bool {
+		return libs[i].name < libs[j].name
+	})
+	return libs
+}
+
+// loadCode 编译并加入一个library，返回library的名称
+func (registry *functionRegistry) loadCode(code string, replace bool) (string, protocol.ErrorReply) {
+	lib, errReply := compileLibrary(code)
+	if errReply != nil {
+		return "", errReply
+	}
+	if errReply := registry.add([]*functionLibrary{lib}, replace); errReply != nil {
+		return "", errReply
+	}
+	return lib.name, nil
+}
+
+// codes 返回所有library的代码
+func (registry *functionRegistry) codes() []string {
+	libs := registry.sortedLibraries()
+	codes := make([]string, len(libs))
+	for i, lib := range libs {
+		codes[i] = lib.code
+	}
+	return codes
+}
+
+func (registry *functionRegistry) dump() []byte {
+	buf := bytes.NewBufferString(functionDumpMagic)
+	buf.WriteByte(functionDumpVersion)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for _, code := range registry.codes() {
+		n := binary.PutUvarint(lenBuf, uint64(len(code)))
+		buf.Write(lenBuf[:n])
+		buf.WriteString(code)
+	}
+	sum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sum, crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum)
+	return buf.Bytes()
+}
+
+var errFunctionPayload = errors.New("payload version or checksum are wrong")
+
+func parseFunctionDump(payload []byte) ([]string, error) {
+	headerLen := len(functionDumpMagic) + 1
+	if len(payload) < headerLen+4 || string(payload[:len(functionDumpMagic)]) != functionDumpMagic ||
+		payload[len(functionDumpMagic)] != functionDumpVersion {
+		return nil, errFunctionPayload
+	}
+	body := payload[:len(payload)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(payload[len(payload)-4:]) {
+		return nil, errFunctionPayload
+	}
+	var codes []string
+	reader := bytes.NewReader(body[headerLen:])
+	for reader.Len() > 0 {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil || size > uint64(reader.Len()) {
+			return nil, errFunctionPayload
+		}
+		code := make([]byte, size)
+		_, _ = reader.Read(code)
+		codes = append(codes, string(code))
+	}
+	return codes, nil
+}
+
+// execFunction function load|delete|flush|list|dump|restore
+func execFunction(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		return execFunctionLoad(db, args)
+	case "delete":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrorReply("function|delete")
+		}
+		if !db.functions.remove(string(args[1])) {
+			return protocol.MakeErrorReply("ERR Library not found")
+		}
+		db.addAof(utils.ToCmdLineByByte("function", args...))
+		return protocol.MakeOkReply()
+	case "flush":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrorReply("function|flush")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return protocol.MakeErrorReply("ERR FUNCTION FLUSH only supports SYNC|ASYNC option")
+			}
+		}
+		db.functions.flush()
+		db.addAof(utils.ToCmdLineByByte("function", args...))
+		return protocol.MakeOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrorReply("function|kill")
+		}
+		return running.kill(true)
+	case "list":
+		return execFunctionList(db, args[1:])
+	case "dump":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrorReply("function|dump")
+		}
+		return protocol.MakeBulkReply(db.functions.dump())
+	case "restore":
+		return execFunctionRestore(db, args)
+	}
+	return protocol.MakeErrorReply("ERR unknown subcommand '" + subCmd + "'")
+}
+
+// execFunctionLoad function load [REPLACE] code
+func execFunctionLoad(db *DB, args [][]byte) redis.Reply {
+	replace := false
+	codeArg := args[1:]
+	if len(codeArg) == 2 && strings.ToLower(string(codeArg[0])) == "replace" {
+		replace = true
+		codeArg = codeArg[1:]
+	}
+	if len(codeArg) != 1 {
+		return protocol.MakeArgNumErrorReply("function|load")
+	}
+	name, errReply := db.functions.loadCode(string(codeArg[0]), replace)
+	if errReply != nil {
+		return errReply
+	}
+	db.addAof(utils.ToCmdLineByByte("function", args...))
+	return protocol.MakeBulkReply([]byte(name))
+}
+
+// execFunctionList function list [WITHCODE] [LIBRARYNAME pattern]
+func execFunctionList(db *DB, args [][]byte) redis.Reply {
+	withCode := false
+	var pattern *wildcard.Pattern
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		if opt == "withcode" {
+			withCode = true
+		} else if opt == "libraryname" && i+1 < len(args) {
+			var err error
+			pattern, err = wildcard.CompilePattern(string(args[i+1]))
+			if err != nil {
+				return protocol.MakeErrorReply("ERR " + err.Error())
+			}
+			i++
+		} else {
+			return protocol.MakeSyntaxErrorReply()
+		}
+	}
+
+	result := make([]redis.Reply, 0)
+	for _, lib := range db.functions.sortedLibraries() {
+		if pattern != nil && !pattern.IsMatch(lib.name) {
+			continue
+		}
+		names := make([]string, 0, len(lib.functions))
+		for name := range lib.functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		functions := make([]redis.Reply, 0, len(names))
+		for _, name := range names {
+			f := lib.functions[name]
+			var description redis.Reply = protocol.MakeNullBulkReply()
+			if f.description != "" {
+				description = protocol.MakeBulkReply([]byte(f.description))
+			}
+			flags := make([][]byte, len(f.flags))
+			for i, flag := range f.flags {
+				flags[i] = []byte(flag)
+			}
+			functions = append(functions, protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeBulkReply([]byte("name")),
+				protocol.MakeBulkReply([]byte(f.name)),
+				protocol.MakeBulkReply([]byte("description")),
+				description,
+				protocol.MakeBulkReply([]byte("flags")),
+				protocol.MakeMultiBulkReply(flags),
+			}))
+		}
+		item := []redis.Reply{
+			protocol.MakeBulkReply([]byte("library_name")),
+			protocol.MakeBulkReply([]byte(lib.name)),
+			protocol.MakeBulkReply([]byte("engine")),
+			protocol.MakeBulkReply([]byte("LUA")),
+			protocol.MakeBulkReply([]byte("functions")),
+			protocol.MakeMultiRawReply(functions),
+		}
+		if withCode {
+			item = append(item,
+				protocol.MakeBulkReply([]byte("library_code")),
+				protocol.MakeBulkReply([]byte(lib.code)),
+			)
+		}
+		result = append(result, protocol.MakeMultiRawReply(item))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// execFunctionRestore function restore payload [FLUSH|APPEND|REPLACE]
+func execFunctionRestore(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 2 && len(args) != 3 {
+		return protocol.MakeArgNumErrorReply("function|restore")
+	}
+	policy := "append"
+	if len(args) == 3 {
+		policy = strings.ToLower(string(args[2]))
+		if policy != "flush" && policy != "append" && policy != "replace" {
+			return protocol.MakeErrorReply("ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+		}
+	}
+	codes, err := parseFunctionDump(args[1])
+	if err != nil {
+		return protocol.MakeErrorReply("ERR " + err.Error())
+	}
+	libs := make([]*functionLibrary, 0, len(codes))
+	for _, code := range codes {
+		lib, errReply := compileLibrary(code)
+		if errReply != nil {
+			return errReply
+		}
+		libs = append(libs, lib)
+	}
+	if policy == "flush" {
+		db.functions.flush()
+	}
+	if errReply := db.functions.add(libs, policy != "append"); errReply != nil {
+		return errReply
+	}
+	db.addAof(utils.ToCmdLineByByte("function", args...))
+	return protocol.MakeOkReply()
+}
+
+// isReadOnlyFunctionCommand FCALL调用带有no-writes标志的函数以及FUNCTION LIST/DUMP不修改数据，可以在slave上执行
+func (mdb *MultiDB) isReadOnlyFunctionCommand(cmdLine [][]byte) bool {
+	if len(cmdLine) < 2 {
+		return false
+	}
+	switch strings.ToLower(string(cmdLine[0])) {
+	case "fcall":
+		f := mdb.functions.getFunction(string(cmdLine[1]))
+		return f != nil && f.readOnly()
+	case "function":
+		subCmd := strings.ToLower(string(cmdLine[1]))
+		return subCmd == "list" || subCmd == "dump"
+	}
+	return false
+}
+
+// FunctionLibraries 返回所有library的代码，用于重写aof和生成rdb
+func (mdb *MultiDB) FunctionLibraries() []string {
+	return mdb.functions.codes()
+}
+
+func prepareFCall(args [][]byte) ([]string, []string) {
+	return prepareEval(args)
+}
+
+func prepareFCallRO(args [][]byte) ([]string, []string) {
+	return prepareEvalRO(args)
+}
+
+func undoFCall(db *DB, args [][]byte) []CmdLine {
+	return undoEval(db, args)
+}
+
+// execFCallGeneric 函数的参数为KEYS和ARGV两个table，带有no-writes标志的函数不能执行写命令
+func execFCallGeneric(db *DB, args [][]byte, readOnlyCmd bool) redis.Reply {
+	f := db.functions.getFunction(string(args[0]))
+	if f == nil {
+		return protocol.MakeErrorReply("ERR Function not found")
+	}
+	keys, argv, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	readOnly := f.readOnly()
+	if readOnlyCmd && !readOnly {
+		return protocol.MakeErrorReply("ERR Can not execute a script with write flag using *_ro command.")
+	}
+	vm, _ := f.library.vms.Get().(*libraryVM)
+	if vm == nil {
+		return protocol.MakeErrorReply("ERR Error loading library '" + f.library.name + "'")
+	}
+	defer f.library.vms.Put(vm)
+	L := vm.L
+	keyArgs := make([][]byte, len(keys))
+	for i, key := range keys {
+		keyArgs[i] = []byte(key)
+	}
+	ctx := makeScriptContext(db, keys, readOnly)
+	ctx.function = true
+	return vm.pcall(ctx, vm.callbacks[f.name], f.name, makeLuaArray(L, keyArgs), makeLuaArray(L, argv))
+}
+
+// execFCall fcall function numkeys [key ...] [arg ...]
+func execFCall(db *DB, args [][]byte) redis.Reply {
+	return execFCallGeneric(db, args, false)
+}
+
+// execFCallRO 只能调用带有no-writes标志的函数，可以在slave上执行
+func execFCallRO(db *DB, args [][]byte) redis.Reply {
+	return execFCallGeneric(db, args, true)
+}
+
+func init() {
+	RegisterCommand("Function", execFunction, noPrepare, nil, -2, flagWrite)
+	RegisterCommand("FCall", execFCall, prepareFCall, undoFCall, -3, flagWrite)
+	RegisterCommand("FCall_RO", execFCallRO, prepareFCallRO, nil, -3, flagReadOnly)
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: function_test
+ * @Version: 1.0.0
+ * @Description: function的沙箱、FUNCTION KILL以及集群事务中使用的临时db的测试
+ * @Date: 2026/10/18 3:35
+ */
+
+const testLibrary = `#!lua name=testlib
+redis.register_function('attack', function(keys, args)
+	setmetatable(_G, nil); leaked = 'yes'; redis.call = function() return 'hijacked' end
+end)
+redis.register_function('getkey', function(keys, args) return redis.call('get', keys[1]) end)
+redis.register_function('leaked', function(keys, args) return leaked end)
+redis.register_function{function_name = 'loop', callback = function(keys, args) while true do end end, flags = {'no-writes'}}
+`
+
+func makeFunctionTestDB(t *testing.T) (*MultiDB, *connection.Connection) {
+	databases := config.Properties.Databases
+	config.Properties.Databases = 1
+	t.Cleanup(func() {
+		config.Properties.Databases = databases
+	})
+	mdb := MakeBasicMultiDB()
+	conn := connection.NewConnection(nil)
+	if reply := mdb.Exec(conn, utils.ToCmdLine("function", "load", testLibrary)); protocol.IsErrorReply(reply) {
+		t.Fatalf("load library failed: %s", reply.ToBytes())
+	}
+	return mdb, conn
+}
+
+func TestFunctionSandbox(t *testing.T) {
+	mdb, conn := makeFunctionTestDB(t)
+	mdb.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+	for i := 0; i < 3; i++ {
+		if reply := mdb.Exec(conn, utils.ToCmdLine("fcall", "attack", "0")); !protocol.IsErrorReply(reply) {
+			t.Fatalf("attack should fail, reply: %q", reply.ToBytes())
+		}
+		if reply := mdb.Exec(conn, utils.ToCmdLine("fcall", "getkey", "1", "k")); string(reply.ToBytes()) != "$1\r\nv\r\n" {
+			t.Fatalf("vm is poisoned, reply: %q", reply.ToBytes())
+		}
+		if reply := mdb.Exec(conn, utils.ToCmdLine("fcall", "leaked", "0")); !strings.Contains(string(reply.ToBytes()), "nonexistent global variable") {
+			t.Fatalf("global leaked, reply: %q", reply.ToBytes())
+		}
+	}
+	lib := "#!lua name=badlib\nsetmetatable(_G, nil)\nredis.register_function('f', function() return 1 end)"
+	if reply := mdb.Exec(conn, utils.ToCmdLine("function", "load", lib)); !protocol.IsErrorReply(reply) {
+		t.Fatalf("library should not change _G, reply: %q", reply.ToBytes())
+	}
+}
+
+func TestFunctionKill(t *testing.T) {
+	mdb, conn := makeFunctionTestDB(t)
+	limit := config.Properties.LuaTimeLimit
+	config.Properties.LuaTimeLimit = 50
+	defer func() {
+		config.Properties.LuaTimeLimit = limit
+	}()
+
+	result := make(chan string, 1)
+	go func() {
+		result <- string(mdb.Exec(connection.NewConnection(nil), utils.ToCmdLine("fcall", "loop", "0")).ToBytes())
+	}()
+	time.Sleep(150 * time.Millisecond)
+	if reply := mdb.Exec(conn, utils.ToCmdLine("get", "a")); !strings.Contains(string(reply.ToBytes()), "FUNCTION KILL") {
+		t.Fatalf("expect BUSY, actual %q", reply.ToBytes())
+	}
+	if reply := mdb.Exec(conn, utils.ToCmdLine("script", "kill")); !strings.HasPrefix(string(reply.ToBytes()), "-NOTBUSY") {
+		t.Fatalf("SCRIPT KILL should not kill functions, reply: %q", reply.ToBytes())
+	}
+	if reply := mdb.Exec(conn, utils.ToCmdLine("function", "kill")); !protocol.IsOKReply(reply) {
+		t.Fatalf("unexpected reply %q", reply.ToBytes())
+	}
+	if reply := <-result; !strings.Contains(reply, "FUNCTION KILL") {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+}
+
+func TestTmpDBSharesFunctions(t *testing.T) {
+	mdb, conn := makeFunctionTestDB(t)
+	tmpDB := mdb.MakeTmpDB()
+	tmpConn := &connection.FakeConn{}
+	tmpDB.ExecWithLock(tmpConn, utils.ToCmdLine("set", "k", "v"))
+	if reply := tmpDB.ExecWithLock(tmpConn, utils.ToCmdLine("fcall", "getkey", "1", "k")); string(reply.ToBytes()) != "$1\r\nv\r\n" {
+		t.Fatalf("unexpected reply %q", reply.ToBytes())
+	}
+	if reply := mdb.Exec(conn, utils.ToCmdLine("get", "k")); string(reply.ToBytes()) != "$-1\r\n" {
+		t.Fatalf("tmp db should not share data, reply: %q", reply.ToBytes())
+	}
+}
+
+func TestFunctionRegisterError(t *testing.T) {
+	mdb, conn := makeFunctionTestDB(t)
+	cases := map[string]string{
+		"error(redis.error_reply('boom'))": "ERR Error registering functions: boom",
+		"error({err = 'custom error'})":    "ERR Error registering functions: custom error",
+		"redis.register_function('getkey', function() return 1 end)\nredis.register_function('getkey', function() return 2 end)": "Function already exists in the library",
+	}
+	for body, expected := range cases {
+		reply := mdb.Exec(conn, utils.ToCmdLine("function", "load", "#!lua name=errlib\n"+body))
+		// table类型的错误需要取出err字段，不能返回table的地址
+		if msg := string(reply.ToBytes()); !strings.Contains(msg, expected) || strings.Contains(msg, "table: 0x") {
+			t.Errorf("expect %q, actual: %q", expected, msg)
+		}
+	}
+}
@@ -0,0 +1,642 @@
+package database
+
+import (
+	"fmt"
+	"gmr/go-cache/datastruct/sortedset"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/geohash"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: geo
+ * @Version: 1.0.0
+ * @Description: GEO命令，成员保存在zset中，score为52位的geohash，
+ *               搜索时扫描中心格子及周围8个格子的score区间，再按照距离过滤
+ * @Date: 2026/10/18 10:12
+ */
+
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func parseGeoUnit(arg []byte) (float64, protocol.ErrorReply) {
+	unit, ok := geoUnits[strings.ToLower(string(arg))]
+	if !ok {
+		return 0, protocol.MakeErrorReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return unit, nil
+}
+
+func parseGeoFloat(arg []byte) (float64, protocol.ErrorReply) {
+	val, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, protocol.MakeErrorReply("ERR value is not a valid float")
+	}
+	return val, nil
+}
+
+func parseLonLat(lonArg []byte, latArg []byte) (float64, float64, protocol.ErrorReply) {
+	lon, errReply := parseGeoFloat(lonArg)
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	lat, errReply := parseGeoFloat(latArg)
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	if !geohash.Valid(lon, lat) {
+		return 0, 0, protocol.MakeErrorReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lon, lat))
+	}
+	return lon, lat, nil
+}
+
+func formatCoord(val float64) []byte {
+	return []byte(strconv.FormatFloat(val, 'f', -1, 64))
+}
+
+func formatGeoDist(dist float64, unit float64) []byte {
+	return []byte(strconv.FormatFloat(dist/unit, 'f', 4, 64))
+}
+
+// execGeoAdd geoadd key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func execGeoAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	nx, xx, ch := false, false, false
+	i := 1
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		if opt == "nx" {
+			nx = true
+		} else if opt == "xx" {
+			xx = true
+		} else if opt == "ch" {
+			ch = true
+		} else {
+			break
+		}
+	}
+	if nx && xx {
+		return protocol.MakeErrorReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (len(args)-i)%3 != 0 || i == len(args) {
+		return protocol.MakeSyntaxErrorReply()
+	}
+
+	size := (len(args) - i) / 3
+	elements := make([]*sortedset.Element, size)
+	for j := 0; j < size; j++ {
+		lon, lat, errReply := parseLonLat(args[i+3*j], args[i+3*j+1])
+		if errReply != nil {
+			return errReply
+		}
+		elements[j] = &sortedset.Element{
+			Member: string(args[i+3*j+2]),
+			Score:  float64(geohash.Encode(lon, lat)),
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil && xx {
+		return protocol.MakeIntReply(0)
+	}
+	if sortedSet == nil {
+		sortedSet = sortedset.MakeSortedSet()
+	}
+
+	added, changed := 0, 0
+	for _, e := range elements {
+		old, exists := sortedSet.Get(e.Member)
+		if (exists && nx) || (!exists && xx) {
+			continue
+		}
+		if !exists {
+			added++
+		} else if old.Score != e.Score {
+			changed++
+		}
+		sortedSet.Add(e.Member, e.Score)
+	}
+	if added+changed > 0 {
+		db.PutEntity(key, &database.DataEntity{Data: sortedSet})
+		db.addAof(utils.ToCmdLineByByte("geoadd", args...))
+		db.notify(notifyZSet, "zadd", key)
+	}
+	if ch {
+		return protocol.MakeIntReply(int64(added + changed))
+	}
+	return protocol.MakeIntReply(int64(added))
+}
+
+func undoGeoAdd(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	var members []string
+	// 跳过选项后每三个参数中的最后一个是member
+	i := 1
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		if opt != "nx" && opt != "xx" && opt != "ch" {
+			break
+		}
+	}
+	for ; i+2 < len(args); i += 3 {
+		members = append(members, string(args[i+2]))
+	}
+	return rollbackZSetFields(db, key, members...)
+}
+
+// getGeoPos 成员不存在时返回false
+func getGeoPos(sortedSet *sortedset.SortedSet, member string) (float64, float64, bool) {
+	if sortedSet == nil {
+		return 0, 0, false
+	}
+	element, ok := sortedSet.Get(member)
+	if !ok {
+		return 0, 0, false
+	}
+	lon, lat := geohash.Decode(uint64(element.Score))
+	return lon, lat, true
+}
+
+// execGeoPos geopos key [member ...]
+func execGeoPos(db *DB, args [][]byte) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]redis.Reply, 0, len(args)-1)
+	for _, member := range args[1:] {
+		lon, lat, ok := getGeoPos(sortedSet, string(member))
+		if !ok {
+			replies = append(replies, protocol.MakeNullMultiBulkReply())
+			continue
+		}
+		replies = append(replies, protocol.MakeMultiBulkReply([][]byte{formatCoord(lon), formatCoord(lat)}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execGeoDist geodist key member1 member2 [M|KM|FT|MI]
+func execGeoDist(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 4 {
+		return protocol.MakeSyntaxErrorReply()
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply protocol.ErrorReply
+		unit, errReply = parseGeoUnit(args[3])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	lon1, lat1, ok1 := getGeoPos(sortedSet, string(args[1]))
+	lon2, lat2, ok2 := getGeoPos(sortedSet, string(args[2]))
+	if !ok1 || !ok2 {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeBulkReply(formatGeoDist(geohash.Distance(lon1, lat1, lon2, lat2), unit))
+}
+
+// execGeoHash geohash key [member ...]，返回标准的11位geohash字符串
+func execGeoHash(db *DB, args [][]byte) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]redis.Reply, 0, len(args)-1)
+	for _, member := range args[1:] {
+		if sortedSet == nil {
+			replies = append(replies, protocol.MakeNullBulkReply())
+			continue
+		}
+		element, ok := sortedSet.Get(string(member))
+		if !ok {
+			replies = append(replies, protocol.MakeNullBulkReply())
+			continue
+		}
+		replies = append(replies, protocol.MakeBulkReply([]byte(geohash.ToString(uint64(element.Score)))))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+const (
+	geoRadius = iota
+	geoRadiusByMember
+	geoSearch
+	geoSearchStore
+)
+
+const (
+	geoSortNone = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+type geoSearchArgs struct {
+	key      string
+	storeKey string
+	// storeDist 为true时保存距离而不是geohash
+	storeDist bool
+	readOnly  bool
+
+	member    string
+	hasMember bool
+	hasLonLat bool
+	shape     geohash.Shape
+	hasShape  bool
+	unit      float64
+
+	count     int64
+	any       bool
+	sort      int
+	withCoord bool
+	withDist  bool
+	withHash  bool
+}
+
+type geoPoint struct {
+	member string
+	score  float64
+	lon    float64
+	lat    float64
+	dist   float64
+}
+
+// parseGeoShape 解析半径或者矩形的长度以及单位
+func parseGeoShape(opts *geoSearchArgs, byBox bool, args [][]byte) protocol.ErrorReply {
+	var errReply protocol.ErrorReply
+	opts.unit, errReply = parseGeoUnit(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	if !byBox {
+		radius, errReply := parseGeoFloat(args[0])
+		if errReply != nil {
+			return errReply
+		}
+		if radius < 0 {
+			return protocol.MakeErrorReply("ERR radius cannot be negative")
+		}
+		opts.shape.Radius = radius * opts.unit
+	} else {
+		width, errReply := parseGeoFloat(args[0])
+		if errReply != nil {
+			return errReply
+		}
+		height, errReply := parseGeoFloat(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		if width < 0 || height < 0 {
+			return protocol.MakeErrorReply("ERR height or width cannot be negative")
+		}
+		opts.shape.ByBox = true
+		opts.shape.Width = width * opts.unit
+		opts.shape.Height = height * opts.unit
+	}
+	opts.hasShape = true
+	return nil
+}
+
+// parseGeoSearchArgs 解析GEORADIUS、GEORADIUSBYMEMBER、GEOSEARCH和GEOSEARCHSTORE的参数
+func parseGeoSearchArgs(args [][]byte, kind int, readOnly bool) (*geoSearchArgs, protocol.ErrorReply) {
+	opts := &geoSearchArgs{readOnly: readOnly}
+	var i int
+	switch kind {
+	case geoRadius:
+		if len(args) < 5 {
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+		opts.key = string(args[0])
+		lon, lat, errReply := parseLonLat(args[1], args[2])
+		if errReply != nil {
+			return nil, errReply
+		}
+		opts.shape.Lon, opts.shape.Lat, opts.hasLonLat = lon, lat, true
+		if errReply := parseGeoShape(opts, false, args[3:5]); errReply != nil {
+			return nil, errReply
+		}
+		i = 5
+	case geoRadiusByMember:
+		if len(args) < 4 {
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+		opts.key = string(args[0])
+		opts.member, opts.hasMember = string(args[1]), true
+		if errReply := parseGeoShape(opts, false, args[2:4]); errReply != nil {
+			return nil, errReply
+		}
+		i = 4
+	case geoSearch:
+		opts.key = string(args[0])
+		i = 1
+	case geoSearchStore:
+		if len(args) < 2 {
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+		opts.storeKey = string(args[0])
+		opts.key = string(args[1])
+		i = 2
+	}
+
+	isSearch := kind == geoSearch || kind == geoSearchStore
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		remain := len(args) - i - 1
+		switch {
+		case opt == "withcoord":
+			opts.withCoord = true
+		case opt == "withdist":
+			opts.withDist = true
+		case opt == "withhash":
+			opts.withHash = true
+		case opt == "asc":
+			opts.sort = geoSortAsc
+		case opt == "desc":
+			opts.sort = geoSortDesc
+		case opt == "any":
+			opts.any = true
+		case opt == "count" && remain >= 1:
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, protocol.MakeErrorReply("ERR COUNT must be > 0")
+			}
+			opts.count = count
+			i++
+		case !isSearch && !readOnly && (opt == "store" || opt == "storedist") && remain >= 1:
+			opts.storeKey = string(args[i+1])
+			opts.storeDist = opt == "storedist"
+			i++
+		case kind == geoSearchStore && opt == "storedist":
+			opts.storeDist = true
+		case isSearch && opt == "frommember" && remain >= 1:
+			if opts.hasMember || opts.hasLonLat {
+				return nil, protocol.MakeErrorReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + geoCmdName(kind))
+			}
+			opts.member, opts.hasMember = string(args[i+1]), true
+			i++
+		case isSearch && opt == "fromlonlat" && remain >= 2:
+			if opts.hasMember || opts.hasLonLat {
+				return nil, protocol.MakeErrorReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + geoCmdName(kind))
+			}
+			lon, lat, errReply := parseLonLat(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.shape.Lon, opts.shape.Lat, opts.hasLonLat = lon, lat, true
+			i += 2
+		case isSearch && opt == "byradius" && remain >= 2:
+			if opts.hasShape {
+				return nil, protocol.MakeErrorReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + geoCmdName(kind))
+			}
+			if errReply := parseGeoShape(opts, false, args[i+1:i+3]); errReply != nil {
+				return nil, errReply
+			}
+			i += 2
+		case isSearch && opt == "bybox" && remain >= 3:
+			if opts.hasShape {
+				return nil, protocol.MakeErrorReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + geoCmdName(kind))
+			}
+			if errReply := parseGeoShape(opts, true, args[i+1:i+4]); errReply != nil {
+				return nil, errReply
+			}
+			i += 3
+		default:
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+	}
+
+	if isSearch && !opts.hasMember && !opts.hasLonLat {
+		return nil, protocol.MakeErrorReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + geoCmdName(kind))
+	}
+	if isSearch && !opts.hasShape {
+		return nil, protocol.MakeErrorReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + geoCmdName(kind))
+	}
+	if opts.any && opts.count == 0 {
+		return nil, protocol.MakeErrorReply("ERR the ANY argument requires COUNT argument")
+	}
+	if opts.storeKey != "" && (opts.withCoord || opts.withDist || opts.withHash) {
+		return nil, protocol.MakeErrorReply("ERR " + geoCmdName(kind) + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	// 只返回部分结果时默认按照距离升序
+	if opts.count > 0 && !opts.any && opts.sort == geoSortNone {
+		opts.sort = geoSortAsc
+	}
+	return opts, nil
+}
+
+func geoCmdName(kind int) string {
+	switch kind {
+	case geoRadius:
+		return "GEORADIUS"
+	case geoRadiusByMember:
+		return "GEORADIUSBYMEMBER"
+	case geoSearch:
+		return "GEOSEARCH"
+	}
+	return "GEOSEARCHSTORE"
+}
+
+// searchGeoPoints 扫描搜索范围覆盖的格子，返回范围内的成员
+func searchGeoPoints(sortedSet *sortedset.SortedSet, opts *geoSearchArgs) []*geoPoint {
+	var points []*geoPoint
+	for _, r := range opts.shape.Ranges() {
+		min := &sortedset.ScoreBorder{Value: float64(r.Min)}
+		max := &sortedset.ScoreBorder{Value: float64(r.Max), Exclude: true}
+		sortedSet.ForEachByScore(min, max, 0, -1, false, func(element *sortedset.Element) bool {
+			lon, lat := geohash.Decode(uint64(element.Score))
+			dist, ok := opts.shape.Contains(lon, lat)
+			if ok {
+				points = append(points, &geoPoint{
+					member: element.Member,
+					score:  element.Score,
+					lon:    lon,
+					lat:    lat,
+					dist:   dist,
+				})
+			}
+			// ANY时找到足够的成员后立即返回
+			return !opts.any || int64(len(points)) < opts.count
+		})
+		if opts.any && int64(len(points)) >= opts.count {
+			break
+		}
+	}
+
+	if opts.sort == geoSortAsc {
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].dist < points[j].dist
+		})
+	} else if opts.sort == geoSortDesc {
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].dist > points[j].dist
+		})
+	}
+	if opts.count > 0 && int64(len(points)) > opts.count {
+		points = points[:opts.count]
+	}
+	return points
+}
+
+func makeGeoSearchReply(points []*geoPoint, opts *geoSearchArgs) redis.Reply {
+	replies := make([]redis.Reply, 0, len(points))
+	for _, point := range points {
+		if !opts.withDist && !opts.withHash && !opts.withCoord {
+			replies = append(replies, protocol.MakeBulkReply([]byte(point.member)))
+			continue
+		}
+		item := []redis.Reply{protocol.MakeBulkReply([]byte(point.member))}
+		if opts.withDist {
+			item = append(item, protocol.MakeBulkReply(formatGeoDist(point.dist, opts.unit)))
+		}
+		if opts.withHash {
+			item = append(item, protocol.MakeIntReply(int64(point.score)))
+		}
+		if opts.withCoord {
+			item = append(item, protocol.MakeMultiBulkReply([][]byte{formatCoord(point.lon), formatCoord(point.lat)}))
+		}
+		replies = append(replies, protocol.MakeMultiRawReply(item))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// storeGeoPoints 将搜索结果保存到zset中，没有结果时删除目标key
+func (db *DB) storeGeoPoints(points []*geoPoint, opts *geoSearchArgs, cmdLine CmdLine) redis.Reply {
+	if len(points) == 0 {
+		if db.Removes(opts.storeKey) > 0 {
+			db.addAof(cmdLine)
+			db.notify(notifyGeneric, "del", opts.storeKey)
+		}
+		return protocol.MakeIntReply(0)
+	}
+	sortedSet := sortedset.MakeSortedSet()
+	for _, point := range points {
+		score := point.score
+		if opts.storeDist {
+			score = point.dist / opts.unit
+		}
+		sortedSet.Add(point.member, score)
+	}
+	db.PutEntity(opts.storeKey, &database.DataEntity{Data: sortedSet})
+	db.addAof(cmdLine)
+	db.notify(notifyZSet, "georadiusstore", opts.storeKey)
+	return protocol.MakeIntReply(int64(len(points)))
+}
+
+// execGeoSearchGeneric 执行所有的搜索命令，保存结果时按照原命令写入aof
+func execGeoSearchGeneric(db *DB, name string, args [][]byte, kind int, readOnly bool) redis.Reply {
+	opts, errReply := parseGeoSearchArgs(args, kind, readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply := db.getAsSortedSet(opts.key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		if opts.storeKey != "" {
+			return db.storeGeoPoints(nil, opts, utils.ToCmdLineByByte(name, args...))
+		}
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	if opts.hasMember {
+		lon, lat, ok := getGeoPos(sortedSet, opts.member)
+		if !ok {
+			return protocol.MakeErrorReply("ERR could not decode requested zset member")
+		}
+		opts.shape.Lon, opts.shape.Lat = lon, lat
+	}
+
+	points := searchGeoPoints(sortedSet, opts)
+	if opts.storeKey != "" {
+		return db.storeGeoPoints(points, opts, utils.ToCmdLineByByte(name, args...))
+	}
+	return makeGeoSearchReply(points, opts)
+}
+
+// execGeoRadius georadius key longitude latitude radius M|KM|FT|MI [WITHCOORD] [WITHDIST] [WITHHASH]
+// [COUNT count [ANY]] [ASC|DESC] [STORE key] [STOREDIST key]
+func execGeoRadius(db *DB, args [][]byte) redis.Reply {
+	return execGeoSearchGeneric(db, "georadius", args, geoRadius, false)
+}
+
+// execGeoRadiusByMember georadiusbymember key member radius M|KM|FT|MI [...]，选项与GEORADIUS相同
+func execGeoRadiusByMember(db *DB, args [][]byte) redis.Reply {
+	return execGeoSearchGeneric(db, "georadiusbymember", args, geoRadiusByMember, false)
+}
+
+func execGeoRadiusRO(db *DB, args [][]byte) redis.Reply {
+	return execGeoSearchGeneric(db, "georadius_ro", args, geoRadius, true)
+}
+
+func execGeoRadiusByMemberRO(db *DB, args [][]byte) redis.Reply {
+	return execGeoSearchGeneric(db, "georadiusbymember_ro", args, geoRadiusByMember, true)
+}
+
+// execGeoSearch geosearch key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius M|KM|FT|MI|BYBOX width height M|KM|FT|MI [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func execGeoSearch(db *DB, args [][]byte) redis.Reply {
+	return execGeoSearchGeneric(db, "geosearch", args, geoSearch, true)
+}
+
+// execGeoSearchStore geosearchstore destination source [...] [STOREDIST]，选项与GEOSEARCH相同
+func execGeoSearchStore(db *DB, args [][]byte) redis.Reply {
+	return execGeoSearchGeneric(db, "geosearchstore", args, geoSearchStore, false)
+}
+
+// prepareGeoRadius 带有STORE选项时需要对目标key加写锁
+func prepareGeoRadius(kind int) PreFunc {
+	return func(args [][]byte) ([]string, []string) {
+		opts, errReply := parseGeoSearchArgs(args, kind, false)
+		if errReply != nil || opts.storeKey == "" {
+			return readFirstKey(args)
+		}
+		return []string{opts.storeKey}, []string{opts.key}
+	}
+}
+
+func prepareGeoSearchStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+func undoGeoRadius(kind int) UndoFunc {
+	return func(db *DB, args [][]byte) []CmdLine {
+		opts, errReply := parseGeoSearchArgs(args, kind, false)
+		if errReply != nil || opts.storeKey == "" {
+			return nil
+		}
+		return rollbackGivenKeys(db, opts.storeKey)
+	}
+}
+
+func init() {
+	RegisterCommand("GeoAdd", execGeoAdd, writeFirstKey, undoGeoAdd, -5, flagWrite)
+	RegisterCommand("GeoPos", execGeoPos, readFirstKey, nil, -2, flagReadOnly)
+	RegisterCommand("GeoDist", execGeoDist, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("GeoHash", execGeoHash, readFirstKey, nil, -2, flagReadOnly)
+	RegisterCommand("GeoRadius", execGeoRadius, prepareGeoRadius(geoRadius), undoGeoRadius(geoRadius), -6, flagWrite)
+	RegisterCommand("GeoRadiusByMember", execGeoRadiusByMember, prepareGeoRadius(geoRadiusByMember), undoGeoRadius(geoRadiusByMember), -5, flagWrite)
+	RegisterCommand("GeoRadius_RO", execGeoRadiusRO, readFirstKey, nil, -6, flagReadOnly)
+	RegisterCommand("GeoRadiusByMember_RO", execGeoRadiusByMemberRO, readFirstKey, nil, -5, flagReadOnly)
+	RegisterCommand("GeoSearch", execGeoSearch, readFirstKey, nil, -7, flagReadOnly)
+	RegisterCommand("GeoSearchStore", execGeoSearchStore, prepareGeoSearchStore, rollbackFirstKey, -8, flagWrite)
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: geo_test
+ * @Version: 1.0.0
+ * @Description: GEO命令的测试，期望结果与Redis文档中的示例相同
+ * @Date: 2026/10/18 3:10
+ */
+
+func makeSicily(t *testing.T) (*DB, func(cmd ...string) redis.Reply) {
+	db := makeDB()
+	conn := connection.NewConnection(nil)
+	exec := func(cmd ...string) redis.Reply {
+		return db.Exec(conn, utils.ToCmdLine(cmd...))
+	}
+	reply := exec("GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	if intReply, ok := reply.(*protocol.IntReply); !ok || intReply.Code != 2 {
+		t.Fatalf("expect 2 members added, actual: %s", reply.ToBytes())
+	}
+	return db, exec
+}
+
+// bulkStrings 将多行回复转换为以空格分隔的字符串，嵌套的数组以[]表示
+func bulkStrings(reply redis.Reply) string {
+	switch r := reply.(type) {
+	case *protocol.MultiBulkReply:
+		result := make([]string, len(r.Args))
+		for i, arg := range r.Args {
+			result[i] = string(arg)
+		}
+		return strings.Join(result, " ")
+	case *protocol.MultiRawReply:
+		result := make([]string, len(r.Replies))
+		for i, sub := range r.Replies {
+			if bulk, ok := sub.(*protocol.BulkReply); ok {
+				result[i] = string(bulk.Arg)
+			} else {
+				result[i] = "[" + bulkStrings(sub) + "]"
+			}
+		}
+		return strings.Join(result, " ")
+	case *protocol.BulkReply:
+		return string(r.Arg)
+	}
+	return string(reply.ToBytes())
+}
+
+func TestGeoDistAndHash(t *testing.T) {
+	_, exec := makeSicily(t)
+	cases := map[string]string{
+		"GEODIST Sicily Palermo Catania":                            "166274.1516",
+		"GEODIST Sicily Palermo Catania km":                         "166.2742",
+		"GEODIST Sicily Palermo Catania mi":                         "103.3182",
+		"GEOHASH Sicily Palermo Catania":                            "sqc8b49rny0 sqdtr74hyu0",
+		"GEORADIUS Sicily 15 37 200 km ASC":                         "Catania Palermo",
+		"GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 100 km ASC":     "Catania",
+		"GEOSEARCH Sicily FROMMEMBER Palermo BYBOX 400 400 km DESC": "Catania Palermo",
+		"GEORADIUSBYMEMBER Sicily Palermo 100 km":                   "Palermo",
+	}
+	for cmd, expected := range cases {
+		if actual := bulkStrings(exec(strings.Fields(cmd)...)); actual != expected {
+			t.Errorf("%s expect %q, actual: %q", cmd, expected, actual)
+		}
+	}
+	if reply, ok := exec("GEODIST", "Sicily", "Palermo", "missing").(*protocol.NullBulkReply); !ok {
+		t.Errorf("expect nil for missing member, actual: %v", reply)
+	}
+}
+
+func TestGeoPos(t *testing.T) {
+	_, exec := makeSicily(t)
+	reply, ok := exec("GEOPOS", "Sicily", "Palermo", "missing").(*protocol.MultiRawReply)
+	if !ok || len(reply.Replies) != 2 {
+		t.Fatalf("expect 2 positions, actual: %v", reply)
+	}
+	// geohash编码有精度损失，误差小于1米
+	pos := strings.Fields(bulkStrings(reply.Replies[0]))
+	lon, _ := strconv.ParseFloat(pos[0], 64)
+	lat, _ := strconv.ParseFloat(pos[1], 64)
+	if diff := lon - 13.361389; diff > 1e-5 || diff < -1e-5 {
+		t.Errorf("expect longitude 13.361389, actual: %s", pos[0])
+	}
+	if diff := lat - 38.115556; diff > 1e-5 || diff < -1e-5 {
+		t.Errorf("expect latitude 38.115556, actual: %s", pos[1])
+	}
+	// 与Redis相同，不存在的member返回空数组
+	if string(reply.Replies[1].ToBytes()) != "*-1\r\n" {
+		t.Errorf("expect nil position for missing member, actual: %s", reply.Replies[1].ToBytes())
+	}
+}
+
+func TestGeoSearchOptions(t *testing.T) {
+	_, exec := makeSicily(t)
+	reply := exec("GEORADIUS", "Sicily", "15", "37", "200", "km", "WITHDIST", "ASC")
+	if actual := bulkStrings(reply); actual != "[Catania 56.4413] [Palermo 190.4424]" {
+		t.Errorf("unexpected WITHDIST reply %q", actual)
+	}
+	reply = exec("GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC", "COUNT", "1")
+	if actual := bulkStrings(reply); actual != "Catania" {
+		t.Errorf("expect only Catania with COUNT 1, actual: %q", actual)
+	}
+
+	reply = exec("GEOSEARCHSTORE", "dest", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST")
+	if intReply, ok := reply.(*protocol.IntReply); !ok || intReply.Code != 2 {
+		t.Fatalf("expect 2 members stored, actual: %s", reply.ToBytes())
+	}
+	// STOREDIST以距离作为score
+	score, _ := strconv.ParseFloat(bulkStrings(exec("ZSCORE", "dest", "Catania")), 64)
+	if score < 56.44 || score > 56.45 {
+		t.Errorf("expect distance 56.4413 as score, actual: %f", score)
+	}
+}
+
+func TestGeoAddOptions(t *testing.T) {
+	_, exec := makeSicily(t)
+	cases := []struct {
+		cmd      string
+		expected string
+	}{
+		{"GEOADD Sicily NX 13 38 Palermo", ":0\r\n"},
+		{"GEOADD Sicily XX 13 38 Agrigento", ":0\r\n"},
+		{"GEOADD Sicily XX CH 13 38 Palermo", ":1\r\n"},
+		{"GEOADD Sicily 13.583333 37.316667 Agrigento", ":1\r\n"},
+		{"GEOADD Sicily NX XX 13 38 Palermo", "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{"GEOADD Sicily 13 86 Palermo", ""},
+		{"GEOADD Sicily 13 38 Palermo 14", string(protocol.MakeSyntaxErrorReply().ToBytes())},
+	}
+	for _, c := range cases {
+		actual := string(exec(strings.Fields(c.cmd)...).ToBytes())
+		if c.expected == "" {
+			if !strings.HasPrefix(actual, "-ERR invalid longitude,latitude pair") {
+				t.Errorf("%s expect invalid pair error, actual: %q", c.cmd, actual)
+			}
+		} else if actual != c.expected {
+			t.Errorf("%s expect %q, actual: %q", c.cmd, c.expected, actual)
+		}
+	}
+}
@@ -60,6 +60,7 @@ func execHSet(db *DB, args [][]byte) redis.Reply {
 
 	result := d.Put(field, value)
 	db.addAof(utils.ToCmdLineByByte("hset", args...))
+	db.notify(notifyHash, "hset", key)
 	return protocol.MakeIntReply(int64(result))
 }
 
@@ -82,6 +83,7 @@ func execHSetNX(db *DB, args [][]byte) redis.Reply {
 	result := d.PutIfAbsent(field, value)
 	if result > 0 {
 		db.addAof(utils.ToCmdLineByByte("hsetnx", args...))
+		db.notify(notifyHash, "hset", key)
 	}
 	return protocol.MakeIntReply(int64(result))
 }
@@ -152,11 +154,13 @@ func execHDel(db *DB, args [][]byte) redis.Reply {
 		deleted += result
 	}
 
-	if d.Len() == 0 {
-		db.Remove(key)
-	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLineByByte("hdel", args...))
+		db.notify(notifyHash, "hdel", key)
+	}
+	if d.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 	return protocol.MakeIntReply(int64(deleted))
 }
@@ -220,7 +224,7 @@ func execHMSet(db *DB, args [][]byte) redis.Reply {
 	values := make([][]byte, size)
 	for i := 0; i < size; i++ {
 		fields[i] = string(args[2*i+1])
-		values[i] = args[2*i+1]
+		values[i] = args[2*i+2]
 	}
 
 	d, _, err := db.getOrInitDict(key)
@@ -233,6 +237,7 @@ func execHMSet(db *DB, args [][]byte) redis.Reply {
 		d.Put(field, value)
 	}
 	db.addAof(utils.ToCmdLineByByte("hmset", args...))
+	db.notify(notifyHash, "hset", key)
 	return &protocol.OkReply{}
 }
 
@@ -334,7 +339,7 @@ func execHGetAll(db *DB, args [][]byte) redis.Reply {
 
 	size := d.Len()
 	result := make([][]byte, size*2)
-	i := 2
+	i := 0
 	d.ForEach(func(key string, val interface{}) bool {
 		result[i] = []byte(key)
 		i++
@@ -363,6 +368,7 @@ func execHIncrBy(db *DB, args [][]byte) redis.Reply {
 	if !exist {
 		d.Put(field, args[2])
 		db.addAof(utils.ToCmdLineByByte("hincrby", args...))
+		db.notify(notifyHash, "hincrby", key)
 		return protocol.MakeBulkReply(args[2])
 	}
 
@@ -374,7 +380,8 @@ func execHIncrBy(db *DB, args [][]byte) redis.Reply {
 	val += delta
 	bytes := []byte(strconv.FormatInt(val, 10))
 	d.Put(field, bytes)
-	db.addAof(utils.ToCmdLineByByte("hincrbt", args...))
+	db.addAof(utils.ToCmdLineByByte("hincrby", args...))
+	db.notify(notifyHash, "hincrby", key)
 	return protocol.MakeBulkReply(bytes)
 }
 
@@ -401,6 +408,8 @@ func execHIncrByFloat(db *DB, args [][]byte) redis.Reply {
 	value, exist := d.Get(field)
 	if !exist {
 		d.Put(field, args[2])
+		db.addAof(utils.ToCmdLineByByte("hincrbyfloat", args...))
+		db.notify(notifyHash, "hincrbyfloat", key)
 		return protocol.MakeBulkReply(args[2])
 	}
 	val, err := decimal.NewFromString(string(value.([]byte)))
@@ -411,6 +420,7 @@ func execHIncrByFloat(db *DB, args [][]byte) redis.Reply {
 	resultBytes := []byte(result.String())
 	d.Put(field, resultBytes)
 	db.addAof(utils.ToCmdLineByByte("hincrbyfloat", args...))
+	db.notify(notifyHash, "hincrbyfloat", key)
 	return protocol.MakeBulkReply(resultBytes)
 }
 
@@ -488,6 +498,32 @@ func execHRandField(db *DB, args [][]byte) redis.Reply {
 	return &protocol.EmptyMultiBulkReply{}
 }
 
+// execHScan hscan key cursor [MATCH pattern] [COUNT count]
+func execHScan(db *DB, args [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return makeScanReply(0, [][]byte{})
+	}
+	fields, cursor := d.Scan(sa.cursor, sa.count)
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		if !sa.match(field) {
+			continue
+		}
+		val, _ := d.Get(field)
+		value, _ := val.([]byte)
+		result = append(result, []byte(field), value)
+	}
+	return makeScanReply(cursor, result)
+}
+
 func init() {
 	RegisterCommand("HSet", execHSet, writeFirstKey, undoHSet, 4, flagWrite)
 	RegisterCommand("HSetNX", execHSetNX, writeFirstKey, undoHSet, 4, flagWrite)
@@ -505,4 +541,5 @@ func init() {
 	RegisterCommand("HIncrBy", execHIncrBy, writeFirstKey, undoHIncr, 4, flagWrite)
 	RegisterCommand("HIncrByFloat", execHIncrByFloat, writeFirstKey, undoHIncr, 4, flagWrite)
 	RegisterCommand("HRandField", execHRandField, readFirstKey, nil, -2, flagReadOnly)
+	RegisterCommand("HScan", execHScan, readFirstKey, nil, -3, flagReadOnly)
 }
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"strings"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: hash_test
+ * @Version: 1.0.0
+ * @Description: hash命令的keyspace notifications测试
+ * @Date: 2026/10/18 3:10
+ */
+
+func TestHashNotifications(t *testing.T) {
+	db := makeDB()
+	events := make([]string, 0)
+	db.notifyEvent = func(dbIndex int, class int, event string, key string) {
+		events = append(events, event+" "+key)
+	}
+	// 每条命令只发布一次事件，没有修改时不发布
+	cases := []struct {
+		cmd    string
+		events string
+	}{
+		{"HSET h f 1", "new h,hset h"},
+		{"HSETNX h f 2", ""},
+		{"HSETNX h g 2", "hset h"},
+		{"HMSET h a 1 b 2", "hset h"},
+		{"HINCRBY h n 1", "hincrby h"},
+		{"HINCRBY h n 1", "hincrby h"},
+		{"HINCRBYFLOAT h x 1.5", "hincrbyfloat h"},
+		{"HINCRBYFLOAT h x 1.5", "hincrbyfloat h"},
+		{"HGET h a", ""},
+		{"HGETALL h", ""},
+		{"HDEL h missing", ""},
+		{"HDEL h f g", "hdel h"},
+		{"HDEL h a b n x", "hdel h,del h"},
+	}
+	conn := connection.NewConnection(nil)
+	for _, c := range cases {
+		events = events[:0]
+		db.Exec(conn, utils.ToCmdLine(strings.Fields(c.cmd)...))
+		if actual := strings.Join(events, ","); actual != c.events {
+			t.Errorf("%s expect events %q, actual: %q", c.cmd, c.events, actual)
+		}
+	}
+}
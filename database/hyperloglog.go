@@ -0,0 +1,144 @@
+package database
+
+import (
+	"gmr/go-cache/datastruct/hll"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+)
+
+/**
+ * @Author: wanglei
+ * @File: hyperloglog
+ * @Version: 1.0.0
+ * @Description: PFADD/PFCOUNT/PFMERGE，HyperLogLog以字符串保存，可以使用GET/SET读写原始的寄存器
+ * @Date: 2026/10/18 10:12
+ */
+
+// getAsHLL key不存在时返回nil，不是合法的HyperLogLog时返回错误
+func (db *DB) getAsHLL(key string) (*hll.HyperLogLog, protocol.ErrorReply) {
+	bs, errReply := db.getAsString(key)
+	if errReply != nil || bs == nil {
+		return nil, errReply
+	}
+	h, err := hll.FromBytes(bs)
+	if err != nil {
+		return nil, protocol.MakeErrorReply(err.Error())
+	}
+	return h, nil
+}
+
+// execPFAdd pfadd key [element ...]
+func execPFAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	h, errReply := db.getAsHLL(key)
+	if errReply != nil {
+		return errReply
+	}
+	updated := false
+	if h == nil {
+		h = hll.New()
+		updated = true
+	}
+	for _, element := range args[1:] {
+		changed, err := h.Add(element)
+		if err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+		updated = updated || changed
+	}
+	if !updated {
+		return protocol.MakeIntReply(0)
+	}
+	db.PutEntity(key, &database.DataEntity{Data: h.ToBytes()})
+	db.addAof(utils.ToCmdLineByByte("pfadd", args...))
+	db.notify(notifyString, "pfadd", key)
+	return protocol.MakeIntReply(1)
+}
+
+// preparePFCount 只有一个key时会更新基数缓存，需要加写锁
+func preparePFCount(args [][]byte) ([]string, []string) {
+	if len(args) == 1 {
+		return writeFirstKey(args)
+	}
+	return readAllKeys(args)
+}
+
+// execPFCount pfcount key [key ...]，多个key时返回合并后的基数
+func execPFCount(db *DB, args [][]byte) redis.Reply {
+	if len(args) == 1 {
+		h, errReply := db.getAsHLL(string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if h == nil {
+			return protocol.MakeIntReply(0)
+		}
+		// 缓存写回保存的字符串中，与Redis一样不写入aof
+		stale := !h.CacheValid()
+		card, err := h.Count()
+		if err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+		if stale {
+			db.PutIfExist(string(args[0]), &database.DataEntity{Data: h.ToBytes()})
+		}
+		return protocol.MakeIntReply(int64(card))
+	}
+
+	regs := hll.MakeRegisters()
+	for _, arg := range args {
+		h, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if h == nil {
+			continue
+		}
+		if err := h.MergeRegisters(regs); err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+	}
+	return protocol.MakeIntReply(int64(hll.CountRegisters(regs)))
+}
+
+// execPFMerge pfmerge destkey [sourcekey ...]，所有key都是sparse编码时结果也尽量使用sparse编码
+func execPFMerge(db *DB, args [][]byte) redis.Reply {
+	destKey := string(args[0])
+	regs := hll.MakeRegisters()
+	useDense := false
+	var dest *hll.HyperLogLog
+	for i, arg := range args {
+		h, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if h == nil {
+			continue
+		}
+		if i == 0 {
+			dest = h
+		}
+		if h.IsDense() {
+			useDense = true
+		}
+		if err := h.MergeRegisters(regs); err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+	}
+	if dest == nil {
+		dest = hll.New()
+	}
+	dest.SetRegisters(regs, useDense)
+	db.PutEntity(destKey, &database.DataEntity{Data: dest.ToBytes()})
+	db.addAof(utils.ToCmdLineByByte("pfmerge", args...))
+	db.notify(notifyString, "pfadd", destKey)
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("PFAdd", execPFAdd, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	RegisterCommand("PFCount", execPFCount, preparePFCount, nil, -2, flagReadOnly)
+	RegisterCommand("PFMerge", execPFMerge, prepareSetCalculateStore, rollbackFirstKey, -2, flagWrite)
+}
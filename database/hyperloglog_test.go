@@ -0,0 +1,42 @@
+package database
+
+import (
+	"bytes"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: hyperloglog_test
+ * @Version: 1.0.0
+ * @Description: PFADD/PFCOUNT不能修改已经返回给客户端的字符串
+ * @Date: 2026/10/18 3:05
+ */
+
+func TestPFAddNotAliasGet(t *testing.T) {
+	db := makeDB()
+	db.execNormalCommand(utils.ToCmdLine("pfadd", "hll", "a", "b", "c"))
+	get, ok := db.execNormalCommand(utils.ToCmdLine("get", "hll")).(*protocol.BulkReply)
+	if !ok {
+		t.Fatal("expect bulk reply")
+	}
+	before := append([]byte{}, get.Arg...)
+
+	db.execNormalCommand(utils.ToCmdLine("pfcount", "hll"))
+	db.execNormalCommand(utils.ToCmdLine("pfadd", "hll", "d", "e", "f"))
+	if !bytes.Equal(get.Arg, before) {
+		t.Fatal("GET reply is modified by PFCOUNT/PFADD")
+	}
+
+	count, ok := db.execNormalCommand(utils.ToCmdLine("pfcount", "hll")).(*protocol.IntReply)
+	if !ok || count.Code != 6 {
+		t.Fatalf("expect 6, actual %v", count)
+	}
+	// PFCOUNT将基数缓存写回保存的字符串
+	get = db.execNormalCommand(utils.ToCmdLine("get", "hll")).(*protocol.BulkReply)
+	if get.Arg[15]&0x80 != 0 || get.Arg[8] != 6 {
+		t.Fatal("cardinality cache should be saved")
+	}
+}
@@ -1,12 +1,16 @@
 package database
 
 import (
+	"gmr/go-cache/aof"
 	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/list"
 	"gmr/go-cache/datastruct/set"
 	"gmr/go-cache/datastruct/sortedset"
+	"gmr/go-cache/datastruct/stream"
+	"gmr/go-cache/interface/database"
 	"gmr/go-cache/interface/redis"
 	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/lib/wildcard"
 	"gmr/go-cache/redis/protocol"
 	"strconv"
 	"strings"
@@ -27,7 +31,13 @@ func execDel(db *DB, args [][]byte) redis.Reply {
 		keys[i] = string(k)
 	}
 
-	deleted := db.Removes(keys...)
+	deleted := 0
+	for _, key := range keys {
+		if db.Removes(key) > 0 {
+			deleted++
+			db.notify(notifyGeneric, "del", key)
+		}
+	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLineByByte("del", args...))
 	}
@@ -55,7 +65,7 @@ func execExist(db *DB, args [][]byte) redis.Reply {
 }
 
 func execFlushDB(db *DB, args [][]byte) redis.Reply {
-	db.Flush()
+	db.FlushAll()
 	db.addAof(utils.ToCmdLineByByte("flushdb", args...))
 	return &protocol.OkReply{}
 }
@@ -66,25 +76,36 @@ func execType(db *DB, args [][]byte) redis.Reply {
 	if !exist {
 		return protocol.MakeStatusReply("none")
 	}
+	typeName := entityTypeName(entity)
+	if typeName == "" {
+		return &protocol.UnknownErrorReply{}
+	}
+	return protocol.MakeStatusReply(typeName)
+}
+
+// entityTypeName 返回TYPE命令中的类型名称，未知类型返回空字符串
+func entityTypeName(entity *database.DataEntity) string {
 	switch entity.Data.(type) {
 	case []byte:
-		return protocol.MakeStatusReply("string")
+		return "string"
 	case list.List:
-		return protocol.MakeStatusReply("list")
+		return "list"
 	case dict.Dict:
-		return protocol.MakeStatusReply("hash")
+		return "hash"
 	case *set.Set:
-		return protocol.MakeStatusReply("set")
+		return "set"
 	case *sortedset.SortedSet:
-		return protocol.MakeStatusReply("zset")
+		return "zset"
+	case *stream.Stream:
+		return "stream"
 	}
-	return &protocol.UnknownErrorReply{}
+	return ""
 }
 
 func prepareRename(args [][]byte) ([]string, []string) {
 	src := string(args[0])
 	dest := string(args[1])
-	return []string{dest}, []string{src}
+	return []string{src, dest}, nil
 }
 
 func execRename(db *DB, args [][]byte) redis.Reply {
@@ -101,6 +122,7 @@ func execRename(db *DB, args [][]byte) redis.Reply {
 	}
 
 	rawTTL, hasTTl := db.ttlMap.Get(src)
+	db.Removes(src, dest)
 	db.PutEntity(dest, entity)
 	if hasTTl {
 		db.Persist(src)
@@ -109,6 +131,8 @@ func execRename(db *DB, args [][]byte) redis.Reply {
 		db.Expire(dest, expireTime)
 	}
 	db.addAof(utils.ToCmdLineByByte("rename", args...))
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
 	return &protocol.OkReply{}
 }
 
@@ -142,6 +166,8 @@ func execRenameNx(db *DB, args [][]byte) redis.Reply {
 		db.Expire(dest, expireTime)
 	}
 	db.addAof(utils.ToCmdLineByByte("renamenx", args...))
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
 	return protocol.MakeIntReply(1)
 }
 
@@ -162,7 +188,8 @@ func execExpire(db *DB, args [][]byte) redis.Reply {
 
 	expireAt := time.Now().Add(ttl)
 	db.Expire(key, expireAt)
-	//db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notify(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -182,7 +209,8 @@ func execExpireAt(db *DB, args [][]byte) redis.Reply {
 	}
 
 	db.Expire(key, expireAt)
-	//db.addAof(aof.MakeExporCmd(key,expireAt).Args)
+	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notify(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -203,7 +231,8 @@ func execPExpire(db *DB, args [][]byte) redis.Reply {
 
 	expireAt := time.Now().Add(ttl)
 	db.Expire(key, expireAt)
-	//db.addAof(aof.MakeExporCmd(key,expireAt).Args)
+	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notify(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -223,7 +252,8 @@ func execPExpireAt(db *DB, args [][]byte) redis.Reply {
 	}
 
 	db.Expire(key, expireAt)
-	//db.addAof(aof.MakeExporCmd(key,expireAt).Args)
+	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notify(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -275,6 +305,7 @@ func execPersist(db *DB, args [][]byte) redis.Reply {
 
 	db.Persist(key)
 	db.addAof(utils.ToCmdLineByByte("persist", args...))
+	db.notify(notifyGeneric, "persist", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -293,6 +324,96 @@ func execKeys(db *DB, args [][]byte) redis.Reply {
 	return protocol.MakeMultiBulkReply(result)
 }
 
+// scanArgs SCAN系列命令的参数: cursor [MATCH pattern] [COUNT count] [TYPE type]
+type scanArgs struct {
+	cursor   uint64
+	count    int
+	pattern  *wildcard.Pattern
+	typeName string
+}
+
+// parseScanArgs allowType为false时不接受TYPE参数
+func parseScanArgs(args [][]byte, allowType bool) (*scanArgs, protocol.ErrorReply) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, protocol.MakeErrorReply("ERR invalid cursor")
+	}
+	result := &scanArgs{
+		cursor: cursor,
+		count:  10,
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			result.pattern, err = wildcard.CompilePattern(value)
+			if err != nil {
+				return nil, protocol.MakeErrorReply("ERR illegal wildcard")
+			}
+		case "count":
+			result.count, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			if result.count < 1 {
+				return nil, protocol.MakeSyntaxErrorReply()
+			}
+		case "type":
+			if !allowType {
+				return nil, protocol.MakeSyntaxErrorReply()
+			}
+			result.typeName = strings.ToLower(value)
+		default:
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+	}
+	return result, nil
+}
+
+func (sa *scanArgs) match(member string) bool {
+	return sa.pattern == nil || sa.pattern.IsMatch(member)
+}
+
+// makeScanReply 返回下一次遍历的cursor以及本次遍历的结果
+func makeScanReply(cursor uint64, items [][]byte) redis.Reply {
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		protocol.MakeMultiBulkReply(items),
+	})
+}
+
+// execScan scan cursor [MATCH pattern] [COUNT count] [TYPE type]
+// 每次只遍历一部分shard，不会像KEYS一样长时间阻塞
+func execScan(db *DB, args [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	keys, cursor := db.data.Scan(sa.cursor, sa.count)
+	now := time.Now()
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !sa.match(key) {
+			continue
+		}
+		// 没有持有key的锁，过期的key只跳过不删除
+		if expireTime, ok := db.ttlMap.Get(key); ok && now.After(expireTime.(time.Time)) {
+			continue
+		}
+		if sa.typeName != "" {
+			raw, ok := db.data.Get(key)
+			if !ok || entityTypeName(raw.(*database.DataEntity)) != sa.typeName {
+				continue
+			}
+		}
+		result = append(result, []byte(key))
+	}
+	return makeScanReply(cursor, result)
+}
+
 func toTTLCmd(db *DB, key string) *protocol.MultiBulkReply {
 	raw, exist := db.ttlMap.Get(key)
 	if !exist {
@@ -330,7 +451,7 @@ func execCopy(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
 				if err != nil {
 					return &protocol.SyntaxErrorReply{}
 				}
-				if idx >= len(mdb.dbSet) || db < 0 {
+				if idx >= len(mdb.dbSet) || idx < 0 {
 					return protocol.MakeErrorReply("ERR DB index is out of range")
 				}
 				dbIndex = idx
@@ -366,6 +487,8 @@ func execCopy(mdb *MultiDB, conn redis.Connection, args [][]byte) redis.Reply {
 		destDB.Expire(destKey, expire)
 	}
 	mdb.aofHandler.AddAof(conn.GetDBIndex(), utils.ToCmdLineByByte("copy", args...))
+	destDB.notify(notifyGeneric, "copy_to", destKey)
+	destDB.blocking.signal([]string{destKey})
 	return protocol.MakeIntReply(1)
 }
 
@@ -380,7 +503,8 @@ func init() {
 	RegisterCommand("Persist", execPersist, writeFirstKey, undoExpire, 2, flagWrite)
 	RegisterCommand("Exists", execExist, readAllKeys, nil, -2, flagReadOnly)
 	RegisterCommand("Type", execType, readFirstKey, nil, 2, flagReadOnly)
-	RegisterCommand("Rename", execRename, prepareRename, undoRename, 3, flagReadOnly)
-	RegisterCommand("RenameNx", execRenameNx, prepareRename, undoRename, 3, flagReadOnly)
+	RegisterCommand("Rename", execRename, prepareRename, undoRename, 3, flagWrite)
+	RegisterCommand("RenameNx", execRenameNx, prepareRename, undoRename, 3, flagWrite)
 	RegisterCommand("Keys", execKeys, noPrepare, nil, 2, flagReadOnly)
+	RegisterCommand("Scan", execScan, noPrepare, nil, -2, flagReadOnly)
 }
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: keys_test
+ * @Version: 1.0.0
+ * @Description: FLUSHDB、KEYS和COPY的测试
+ * @Date: 2026/10/18 3:00
+ */
+
+func TestFlushDB(t *testing.T) {
+	db := makeDB()
+	for _, key := range []string{"a", "b", "c"} {
+		db.PutEntity(key, &database.DataEntity{Data: []byte(key)})
+	}
+	execFlushDB(db, nil)
+	for _, key := range []string{"a", "b", "c"} {
+		if _, exists := db.GetEntity(key); exists {
+			t.Errorf("key %s should be flushed", key)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	db := makeDB()
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		db.PutEntity(key, &database.DataEntity{Data: []byte(key)})
+	}
+	result, ok := execKeys(db, utils.ToCmdLine("user:*")).(*protocol.MultiBulkReply)
+	if !ok {
+		t.Fatalf("expect multi bulk reply")
+	}
+	if len(result.Args) != 2 {
+		t.Errorf("expect 2 keys, actual: %d", len(result.Args))
+	}
+}
+
+func TestCopyDBIndexOutOfRange(t *testing.T) {
+	config.Properties.Databases = 4
+	mdb := MakeBasicMultiDB()
+	conn := connection.NewConnection(nil)
+	for _, idx := range []string{"-1", "4"} {
+		result := execCopy(mdb, conn, utils.ToCmdLine("src", "dest", "db", idx))
+		if _, ok := result.(protocol.ErrorReply); !ok {
+			t.Errorf("expect error for db index %s", idx)
+		}
+	}
+}
+
+func TestExpireAof(t *testing.T) {
+	db := makeDB()
+	var lines []CmdLine
+	db.addAof = func(line CmdLine) {
+		lines = append(lines, line)
+	}
+	db.PutEntity("a", &database.DataEntity{Data: []byte("a")})
+	for _, exec := range []ExecFunc{execExpire, execPExpire} {
+		lines = nil
+		exec(db, utils.ToCmdLine("a", "100"))
+		if len(lines) != 1 || string(lines[0][0]) != "PEXPIREAT" || string(lines[0][1]) != "a" {
+			t.Errorf("expect PEXPIREAT in aof, actual: %q", lines)
+		}
+	}
+	for _, exec := range []ExecFunc{execExpireAt, execPExpireAt} {
+		lines = nil
+		exec(db, utils.ToCmdLine("a", "4102444800000"))
+		if len(lines) != 1 || string(lines[0][0]) != "PEXPIREAT" {
+			t.Errorf("expect PEXPIREAT in aof, actual: %q", lines)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"gmr/go-cache/lib/utils"
 	"gmr/go-cache/redis/protocol"
 	"strconv"
+	"strings"
 )
 
 /**
@@ -100,8 +101,10 @@ func execLPop(db *DB, args [][]byte) redis.Reply {
 	}
 
 	val, _ := l.Remove(0).([]byte)
+	db.notify(notifyList, "lpop", key)
 	if l.Len() == 0 {
 		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 
 	db.addAof(utils.ToCmdLineByByte("lpop", args...))
@@ -144,6 +147,7 @@ func execLPush(db *DB, args [][]byte) redis.Reply {
 	}
 
 	db.addAof(utils.ToCmdLineByByte("lpush", args...))
+	db.notify(notifyList, "lpush", key)
 	return protocol.MakeIntReply(int64(l.Len()))
 }
 
@@ -173,6 +177,7 @@ func execLPushX(db *DB, args [][]byte) redis.Reply {
 	}
 
 	db.addAof(utils.ToCmdLineByByte("lpushx", args...))
+	db.notify(notifyList, "lpush", key)
 	return protocol.MakeIntReply(int64(l.Len()))
 }
 
@@ -265,12 +270,14 @@ func execLRem(db *DB, args [][]byte) redis.Reply {
 		}, -count)
 	}
 
-	if l.Len() == 0 {
-		db.Remove(key)
-	}
-
 	if removed > 0 {
 		db.addAof(utils.ToCmdLineByByte("lrem", args...))
+		db.notify(notifyList, "lrem", key)
+	}
+
+	if l.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 
 	return protocol.MakeIntReply(int64(removed))
@@ -307,6 +314,7 @@ func execLSet(db *DB, args [][]byte) redis.Reply {
 
 	l.Set(index, value)
 	db.addAof(utils.ToCmdLineByByte("lset", args...))
+	db.notify(notifyList, "lset", key)
 	return &protocol.OkReply{}
 }
 
@@ -363,8 +371,10 @@ func execRPop(db *DB, args [][]byte) redis.Reply {
 	}
 
 	val, _ := l.RemoveLast().([]byte)
+	db.notify(notifyList, "rpop", key)
 	if l.Len() == 0 {
 		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 	db.addAof(utils.ToCmdLineByByte("rpop", args...))
 	return protocol.MakeBulkReply(val)
@@ -420,9 +430,12 @@ func execRPopLPush(db *DB, args [][]byte) redis.Reply {
 
 	val, _ := sourceList.RemoveLast().([]byte)
 	destList.Insert(0, val)
+	db.notify(notifyList, "rpop", sourceKey)
+	db.notify(notifyList, "lpush", destKey)
 
 	if sourceList.Len() == 0 {
 		db.Remove(sourceKey)
+		db.notify(notifyGeneric, "del", sourceKey)
 	}
 
 	db.addAof(utils.ToCmdLineByByte("rpoplpush", args...))
@@ -455,6 +468,72 @@ func undoRPopLPush(db *DB, args [][]byte) []CmdLine {
 	}
 }
 
+// parseListDirection 解析LEFT/RIGHT，返回是否为LEFT
+func parseListDirection(arg []byte) (bool, protocol.ErrorReply) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, protocol.MakeSyntaxErrorReply()
+}
+
+// execLMove lmove source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) redis.Reply {
+	sourceKey := string(args[0])
+	destKey := string(args[1])
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+
+	sourceList, errReply := db.getAsList(sourceKey)
+	if errReply != nil {
+		return errReply
+	}
+	if sourceList == nil {
+		return &protocol.NullBulkReply{}
+	}
+
+	destList, _, errReply := db.getOrInitList(destKey)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val []byte
+	if fromLeft {
+		val, _ = sourceList.Remove(0).([]byte)
+		db.notify(notifyList, "lpop", sourceKey)
+	} else {
+		val, _ = sourceList.RemoveLast().([]byte)
+		db.notify(notifyList, "rpop", sourceKey)
+	}
+	if toLeft {
+		destList.Insert(0, val)
+		db.notify(notifyList, "lpush", destKey)
+	} else {
+		destList.Add(val)
+		db.notify(notifyList, "rpush", destKey)
+	}
+
+	if sourceList.Len() == 0 {
+		db.Remove(sourceKey)
+		db.notify(notifyGeneric, "del", sourceKey)
+	}
+
+	db.addAof(utils.ToCmdLineByByte("lmove", args...))
+	return protocol.MakeBulkReply(val)
+}
+
+func undoLMove(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
 func execRPush(db *DB, args [][]byte) redis.Reply {
 	key := string(args[0])
 	values := args[1:]
@@ -469,6 +548,7 @@ func execRPush(db *DB, args [][]byte) redis.Reply {
 	}
 
 	db.addAof(utils.ToCmdLineByByte("rpush", args...))
+	db.notify(notifyList, "rpush", key)
 	return protocol.MakeIntReply(int64(l.Len()))
 }
 
@@ -502,6 +582,7 @@ func execRPushX(db *DB, args [][]byte) redis.Reply {
 		l.Add(value)
 	}
 	db.addAof(utils.ToCmdLineByByte("rpushx", args...))
+	db.notify(notifyList, "rpush", key)
 	return protocol.MakeIntReply(int64(l.Len()))
 }
 
@@ -513,6 +594,7 @@ func init() {
 	RegisterCommand("LPop", execLPop, writeFirstKey, undoLPop, 2, flagWrite)
 	RegisterCommand("RPop", execRPop, writeFirstKey, undoRPop, 2, flagWrite)
 	RegisterCommand("RPopLPush", execRPopLPush, prepareRPopLPush, undoRPopLPush, 3, flagWrite)
+	RegisterCommand("LMove", execLMove, prepareRPopLPush, undoLMove, 5, flagWrite)
 	RegisterCommand("LRem", execLRem, writeFirstKey, rollbackFirstKey, 4, flagWrite)
 	RegisterCommand("LLen", execLLen, readFirstKey, nil, 2, flagReadOnly)
 	RegisterCommand("LIndex", execLIndex, readFirstKey, nil, 3, flagReadOnly)
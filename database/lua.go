@@ -0,0 +1,600 @@
+package database
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+/**
+ * @Author: wanglei
+ * @File: lua
+ * @Version: 1.0.0
+ * @Description: 嵌入的Lua虚拟机，提供redis.call/redis.pcall等函数以及Redis回复与Lua值之间的转换
+ * @Date: 2026/10/18 10:12
+ */
+
+// scriptContext 一次脚本调用的上下文，调用前已经对声明的key加锁
+type scriptContext struct {
+	db   *DB
+	keys map[string]struct{}
+	// readOnly 只读脚本中不能执行写命令
+	readOnly bool
+	// function 是否为FCALL调用的函数，SCRIPT KILL和FUNCTION KILL分别停止脚本和函数
+	function bool
+	start    time.Time
+	cancel   context.CancelFunc
+	// written 执行过写命令的脚本不能被kill，需要原子访问
+	written int32
+	killed  int32
+}
+
+// luaVM redis库中的函数通过ctx访问当前调用的DB
+type luaVM struct {
+	L   *lua.LState
+	ctx *scriptContext
+	// redisLib 脚本中的redis是它的只读代理
+	redisLib *lua.LTable
+	// readOnly 脚本不能修改的table
+	readOnly map[*lua.LTable]struct{}
+}
+
+const (
+	defaultLuaTimeLimit = 5 * time.Second
+	// defaultLuaTimeout 执行过写命令的脚本不能被kill，需要超时强制停止，否则会一直阻塞服务
+	defaultLuaTimeout = 60 * time.Second
+)
+
+// runningScripts 正在执行的脚本，用于BUSY回复以及SCRIPT KILL和FUNCTION KILL
+type runningScripts struct {
+	mu    sync.Mutex
+	count int32
+	ctxs  map[*scriptContext]struct{}
+}
+
+var running = &runningScripts{
+	ctxs: make(map[*scriptContext]struct{}),
+}
+
+func (r *runningScripts) add(ctx *scriptContext) {
+	r.mu.Lock()
+	r.ctxs[ctx] = struct{}{}
+	atomic.AddInt32(&r.count, 1)
+	r.mu.Unlock()
+}
+
+func (r *runningScripts) remove(ctx *scriptContext) {
+	r.mu.Lock()
+	delete(r.ctxs, ctx)
+	atomic.AddInt32(&r.count, -1)
+	r.mu.Unlock()
+}
+
+func luaTimeLimit() time.Duration {
+	if config.Properties.LuaTimeLimit > 0 {
+		return time.Duration(config.Properties.LuaTimeLimit) * time.Millisecond
+	}
+	return defaultLuaTimeLimit
+}
+
+func luaTimeout() time.Duration {
+	if config.Properties.LuaTimeout > 0 {
+		return time.Duration(config.Properties.LuaTimeout) * time.Millisecond
+	}
+	return defaultLuaTimeout
+}
+
+// busy 有脚本执行时间超过lua-time-limit时返回BUSY回复
+func (r *runningScripts) busy() redis.Reply {
+	if atomic.LoadInt32(&r.count) == 0 {
+		return nil
+	}
+	limit := luaTimeLimit()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for ctx := range r.ctxs {
+		if time.Since(ctx.start) > limit {
+			killCmd := "SCRIPT KILL"
+			if ctx.function {
+				killCmd = "FUNCTION KILL"
+			}
+			return protocol.MakeErrorReply("BUSY Redis is busy running a script. You can only call " + killCmd + ".")
+		}
+	}
+	return nil
+}
+
+// kill 停止正在执行的脚本(function为false)或函数(function为true)，已经执行过写命令时不能停止
+func (r *runningScripts) kill(function bool) redis.Reply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	targets := make([]*scriptContext, 0, len(r.ctxs))
+	for ctx := range r.ctxs {
+		if ctx.function != function {
+			continue
+		}
+		if atomic.LoadInt32(&ctx.written) == 1 {
+			return protocol.MakeErrorReply("UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+				"You can either wait the script termination or restart the server.")
+		}
+		targets = append(targets, ctx)
+	}
+	if len(targets) == 0 {
+		return protocol.MakeErrorReply("NOTBUSY No scripts in execution right now.")
+	}
+	for _, ctx := range targets {
+		atomic.StoreInt32(&ctx.killed, 1)
+		ctx.cancel()
+	}
+	return protocol.MakeOkReply()
+}
+
+// isAllowedWhenBusy 有脚本超时后仍然可以执行的命令
+func isAllowedWhenBusy(cmdLine [][]byte) bool {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		return true
+	}
+	if (cmdName == "script" || cmdName == "function") && len(cmdLine) == 2 {
+		return strings.ToLower(string(cmdLine[1])) == "kill"
+	}
+	return false
+}
+
+// notAllowedInScript 不能在脚本中调用的命令
+var notAllowedInScript = map[string]struct{}{
+	"eval":       {},
+	"evalsha":    {},
+	"eval_ro":    {},
+	"evalsha_ro": {},
+	"script":     {},
+	"function":   {},
+	"fcall":      {},
+	"fcall_ro":   {},
+}
+
+func makeScriptContext(db *DB, keys []string, readOnly bool) *scriptContext {
+	ctx := &scriptContext{
+		db:       db,
+		keys:     make(map[string]struct{}, len(keys)),
+		readOnly: readOnly,
+	}
+	for _, key := range keys {
+		ctx.keys[key] = struct{}{}
+	}
+	return ctx
+}
+
+// exec 执行脚本中调用的命令，只能访问声明过的key，否则没有持有对应的锁
+func (ctx *scriptContext) exec(cmdLine [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if IsInternalCommand(cmdName) {
+		return protocol.MakeErrorReply("ERR unknown command '" + cmdName + "'")
+	}
+	if _, ok := notAllowedInScript[cmdName]; ok {
+		return protocol.MakeErrorReply("ERR This Redis command is not allowed from script")
+	}
+	write, read, ok := GetRelatedKeys(cmdLine)
+	if !ok {
+		// 由execWithLock返回命令不存在或者参数数量错误
+		return ctx.db.execWithLock(cmdLine)
+	}
+	if ctx.readOnly && !isReadOnlyCommand(cmdName) {
+		return protocol.MakeErrorReply("ERR Write commands are not allowed from read-only scripts")
+	}
+	for _, key := range append(write, read...) {
+		if _, ok := ctx.keys[key]; !ok {
+			return protocol.MakeErrorReply("ERR Script attempted to access key '" + key + "' which is not declared in KEYS")
+		}
+	}
+	if !isReadOnlyCommand(cmdName) {
+		atomic.StoreInt32(&ctx.written, 1)
+	}
+	return ctx.db.execWithLock(cmdLine)
+}
+
+// newLuaVM 只加载base、table、string、math库，脚本无法访问文件和操作系统
+func newLuaVM() *luaVM {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+	// setfenv可以替换虚拟机的全局环境，之后执行的脚本都会受到影响
+	L.SetGlobal("setfenv", lua.LNil)
+
+	vm := &luaVM{L: L}
+	redisLib := L.NewTable()
+	L.SetFuncs(redisLib, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return vm.call(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return vm.call(L, false)
+		},
+		"error_reply":  luaErrorReply,
+		"status_reply": luaStatusReply,
+		"sha1hex":      luaSha1Hex,
+		"log":          luaLog,
+	})
+	L.SetField(redisLib, "LOG_DEBUG", lua.LNumber(logDebug))
+	L.SetField(redisLib, "LOG_VERBOSE", lua.LNumber(logVerbose))
+	L.SetField(redisLib, "LOG_NOTICE", lua.LNumber(logNotice))
+	L.SetField(redisLib, "LOG_WARNING", lua.LNumber(logWarning))
+	L.SetGlobal("redis", redisLib)
+	vm.redisLib = redisLib
+	vm.sandbox()
+	return vm
+}
+
+// sandbox 虚拟机会被复用，脚本不能修改其中共享的状态:
+// 库以只读代理的形式提供，_G和字符串的metatable被锁定，rawset和table库不能修改只读的table
+func (vm *luaVM) sandbox() {
+	L := vm.L
+	vm.readOnly = make(map[*lua.LTable]struct{})
+	tableLib := L.GetGlobal(lua.TabLibName).(*lua.LTable)
+	for _, name := range []string{"insert", "remove", "sort"} {
+		tableLib.RawSetString(name, vm.guardReadOnly(tableLib.RawGetString(name).(*lua.LFunction)))
+	}
+	for _, name := range []string{"redis", lua.StringLibName, lua.TabLibName, lua.MathLibName} {
+		L.SetGlobal(name, vm.makeReadOnly(L.GetGlobal(name).(*lua.LTable)))
+	}
+	L.SetGlobal("rawset", vm.guardReadOnly(L.GetGlobal("rawset").(*lua.LFunction)))
+	if mt, ok := L.GetMetatable(lua.LString("")).(*lua.LTable); ok {
+		mt.RawSetString("__metatable", lua.LFalse)
+	}
+	protectGlobals(L)
+	vm.readOnly[L.G.Global] = struct{}{}
+}
+
+// makeReadOnly 返回tbl的只读代理
+func (vm *luaVM) makeReadOnly(tbl *lua.LTable) *lua.LTable {
+	L := vm.L
+	proxy := L.NewTable()
+	mt := L.NewTable()
+	mt.RawSetString("__index", tbl)
+	mt.RawSetString("__newindex", L.NewFunction(raiseReadOnly))
+	mt.RawSetString("__metatable", lua.LFalse)
+	L.SetMetatable(proxy, mt)
+	vm.readOnly[proxy] = struct{}{}
+	return proxy
+}
+
+// guardReadOnly 第一个参数为只读table时抛出错误，否则调用fn
+func (vm *luaVM) guardReadOnly(fn *lua.LFunction) *lua.LFunction {
+	return vm.L.NewFunction(func(L *lua.LState) int {
+		if _, ok := vm.readOnly[L.CheckTable(1)]; ok {
+			return raiseReadOnly(L)
+		}
+		top := L.GetTop()
+		L.Insert(fn, 1)
+		L.Call(top, lua.MultRet)
+		return L.GetTop()
+	})
+}
+
+func raiseReadOnly(L *lua.LState) int {
+	L.RaiseError("Attempt to modify a readonly table")
+	return 0
+}
+
+// protectGlobals 禁止脚本创建、修改或者访问不存在的全局变量，也不能替换_G的metatable
+// 已有的全局变量移到只能通过__index读取的table中，对它们赋值也会触发__newindex
+func protectGlobals(L *lua.LState) {
+	globals := L.G.Global
+	builtins := L.NewTable()
+	names := make([]lua.LValue, 0)
+	globals.ForEach(func(k lua.LValue, v lua.LValue) {
+		builtins.RawSet(k, v)
+		names = append(names, k)
+	})
+	for _, name := range names {
+		globals.RawSet(name, lua.LNil)
+	}
+	builtinsMt := L.NewTable()
+	builtinsMt.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("Script attempted to access nonexistent global variable '%s'", L.Get(2).String())
+		return 0
+	}))
+	L.SetMetatable(builtins, builtinsMt)
+
+	mt := L.NewTable()
+	mt.RawSetString("__metatable", lua.LFalse)
+	mt.RawSetString("__index", builtins)
+	mt.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		if builtins.RawGet(L.Get(2)) != lua.LNil {
+			return raiseReadOnly(L)
+		}
+		L.RaiseError("Script attempted to create global variable '%s'", L.Get(2).String())
+		return 0
+	}))
+	L.SetMetatable(globals, mt)
+}
+
+// setGlobal 绕过protectGlobals设置全局变量
+func (vm *luaVM) setGlobal(name string, value lua.LValue) {
+	vm.L.G.Global.RawSetString(name, value)
+}
+
+// call redis.call出错时抛出Lua错误，redis.pcall出错时返回包含err字段的table
+func (vm *luaVM) call(L *lua.LState, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		return vm.callError(L, raise, "ERR Please specify at least one argument for this redis lib call")
+	}
+	cmdLine := make([][]byte, n)
+	for i := 1; i <= n; i++ {
+		switch arg := L.Get(i).(type) {
+		case lua.LString:
+			cmdLine[i-1] = []byte(arg)
+		case lua.LNumber:
+			cmdLine[i-1] = []byte(arg.String())
+		default:
+			return vm.callError(L, raise, "ERR Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	if vm.ctx == nil {
+		return vm.callError(L, raise, "ERR redis.call can only be used while running a script")
+	}
+	reply := vm.ctx.exec(cmdLine)
+	if raise && protocol.IsErrorReply(reply) {
+		L.Error(makeLuaErrorTable(L, errorReplyMessage(reply)), 0)
+		return 0
+	}
+	L.Push(replyToLua(L, reply))
+	return 1
+}
+
+func (vm *luaVM) callError(L *lua.LState, raise bool, msg string) int {
+	if raise {
+		L.Error(makeLuaErrorTable(L, msg), 0)
+		return 0
+	}
+	L.Push(makeLuaErrorTable(L, msg))
+	return 1
+}
+
+// pcall 以ctx作为上下文执行Lua函数，name用于错误信息
+// 脚本可以被SCRIPT KILL或FUNCTION KILL停止，超过lua-timeout后强制停止
+func (vm *luaVM) pcall(ctx *scriptContext, fn *lua.LFunction, name string, params ...lua.LValue) redis.Reply {
+	L := vm.L
+	var runCtx context.Context
+	runCtx, ctx.cancel = context.WithTimeout(context.Background(), luaTimeout())
+	ctx.start = time.Now()
+	vm.ctx = ctx
+	L.SetContext(runCtx)
+	running.add(ctx)
+	defer func() {
+		running.remove(ctx)
+		ctx.cancel()
+		L.RemoveContext()
+		vm.ctx = nil
+	}()
+	L.Push(fn)
+	for _, param := range params {
+		L.Push(param)
+	}
+	defer L.SetTop(0)
+	if err := L.PCall(len(params), 1, nil); err != nil {
+		if atomic.LoadInt32(&ctx.killed) == 1 {
+			if ctx.function {
+				return protocol.MakeErrorReply("ERR Script killed by user with FUNCTION KILL...")
+			}
+			return protocol.MakeErrorReply("ERR Script killed by user with SCRIPT KILL...")
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
+			return protocol.MakeErrorReply("ERR Script timed out after lua-timeout (call to " + name + ")")
+		}
+		return luaErrorToReply(err, name)
+	}
+	return luaToReply(L.Get(-1))
+}
+
+// compileLua 编译Lua代码，name为错误信息中的chunk名称
+func compileLua(name string, body string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(body), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+func makeLuaArray(L *lua.LState, values [][]byte) *lua.LTable {
+	tbl := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		tbl.Append(lua.LString(v))
+	}
+	return tbl
+}
+
+func makeLuaErrorTable(L *lua.LState, msg string) *lua.LTable {
+	tbl := L.NewTable()
+	tbl.RawSetString("err", lua.LString(msg))
+	return tbl
+}
+
+func makeLuaStatusTable(L *lua.LState, status string) *lua.LTable {
+	tbl := L.NewTable()
+	tbl.RawSetString("ok", lua.LString(status))
+	return tbl
+}
+
+// errorReplyMessage 返回去掉'-'和换行之后的错误信息
+func errorReplyMessage(reply redis.Reply) string {
+	if errReply, ok := reply.(protocol.ErrorReply); ok {
+		return errReply.Error()
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(reply.ToBytes()), "-"), protocol.CRLF)
+}
+
+// replyToLua 整数转换为number，bulk转换为string，空回复转换为false，
+// 数组转换为table，状态回复和错误回复分别转换为包含ok和err字段的table
+func replyToLua(L *lua.LState, reply redis.Reply) lua.LValue {
+	switch r := reply.(type) {
+	case *protocol.IntReply:
+		return lua.LNumber(r.Code)
+	case *protocol.BulkReply:
+		if r.Arg == nil {
+			return lua.LFalse
+		}
+		return lua.LString(r.Arg)
+	case *protocol.NullBulkReply, *protocol.NullMultiBulkReply:
+		return lua.LFalse
+	case *protocol.StatusReply:
+		return makeLuaStatusTable(L, r.Status)
+	case *protocol.OkReply:
+		return makeLuaStatusTable(L, "OK")
+	case *protocol.PongReply:
+		return makeLuaStatusTable(L, "PONG")
+	case *protocol.EmptyMultiBulkReply:
+		return L.NewTable()
+	case *protocol.MultiBulkReply:
+		tbl := L.CreateTable(len(r.Args), 0)
+		for _, arg := range r.Args {
+			if arg == nil {
+				tbl.Append(lua.LFalse)
+			} else {
+				tbl.Append(lua.LString(arg))
+			}
+		}
+		return tbl
+	case *protocol.MultiRawReply:
+		tbl := L.CreateTable(len(r.Replies), 0)
+		for _, item := range r.Replies {
+			tbl.Append(replyToLua(L, item))
+		}
+		return tbl
+	}
+	if protocol.IsErrorReply(reply) {
+		return makeLuaErrorTable(L, errorReplyMessage(reply))
+	}
+	return lua.LFalse
+}
+
+// luaToReply number截断为整数，true转换为1，false和nil转换为空回复，
+// table中的数组部分转换为数组，遇到第一个nil时结束
+func luaToReply(lv lua.LValue) redis.Reply {
+	switch v := lv.(type) {
+	case lua.LString:
+		return protocol.MakeBulkReply([]byte(v))
+	case lua.LNumber:
+		return protocol.MakeIntReply(int64(v))
+	case lua.LBool:
+		if v {
+			return protocol.MakeIntReply(1)
+		}
+		return protocol.MakeNullBulkReply()
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return protocol.MakeErrorReply(string(msg))
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return protocol.MakeStatusReply(string(status))
+		}
+		replies := make([]redis.Reply, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	}
+	return protocol.MakeNullBulkReply()
+}
+
+// luaErrorToReply redis.call抛出的错误原样返回，其他错误加上脚本名称
+func luaErrorToReply(err error, name string) redis.Reply {
+	msg, isErrTable := luaErrorMessage(err)
+	if isErrTable {
+		return protocol.MakeErrorReply(msg)
+	}
+	return protocol.MakeErrorReply("ERR Error running script (call to " + name + "): " + singleLine(msg))
+}
+
+// luaErrorMessage 返回Lua抛出的错误信息，error_reply等抛出的table取err字段，此时isErrTable为true
+func luaErrorMessage(err error) (msg string, isErrTable bool) {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok || apiErr.Object == nil {
+		return err.Error(), false
+	}
+	if tbl, ok := apiErr.Object.(*lua.LTable); ok {
+		if errMsg, ok := tbl.RawGetString("err").(lua.LString); ok {
+			return string(errMsg), true
+		}
+	}
+	return apiErr.Object.String(), false
+}
+
+// singleLine 错误回复中不能包含换行
+func singleLine(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+func luaErrorReply(L *lua.LState) int {
+	L.Push(makeLuaErrorTable(L, L.CheckString(1)))
+	return 1
+}
+
+func luaStatusReply(L *lua.LState) int {
+	L.Push(makeLuaStatusTable(L, L.CheckString(1)))
+	return 1
+}
+
+func luaSha1Hex(L *lua.LState) int {
+	sum := sha1.Sum([]byte(L.CheckString(1)))
+	L.Push(lua.LString(hex.EncodeToString(sum[:])))
+	return 1
+}
+
+const (
+	logDebug = iota
+	logVerbose
+	logNotice
+	logWarning
+)
+
+// luaLog redis.log(level, message ...)
+func luaLog(L *lua.LState) int {
+	level := L.CheckInt(1)
+	parts := make([]string, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		parts = append(parts, L.Get(i).String())
+	}
+	msg := strings.Join(parts, " ")
+	switch level {
+	case logDebug, logVerbose:
+		logger.Debug(msg)
+	case logNotice:
+		logger.Info(msg)
+	case logWarning:
+		logger.Warn(msg)
+	default:
+		L.ArgError(1, "Invalid debug level "+strconv.Itoa(level))
+	}
+	return 0
+}
@@ -0,0 +1,377 @@
+package database
+
+import (
+	"fmt"
+	"gmr/go-cache/config"
+	"gmr/go-cache/datastruct/dict"
+	"gmr/go-cache/datastruct/list"
+	"gmr/go-cache/datastruct/set"
+	"gmr/go-cache/datastruct/sortedset"
+	"gmr/go-cache/datastruct/stream"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: memory
+ * @Version: 1.0.0
+ * @Description: maxmemory内存上限，估算每个key的内存占用，在写命令之前按照淘汰策略采样淘汰key
+ *               LRU/LFU信息记录在DataEntity上，LFU计数器与Redis相同为对数计数并随时间衰减
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyVolatileLRU    = "volatile-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyVolatileLFU    = "volatile-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+
+	defaultMaxMemorySamples = 5
+
+	// LFU参数与Redis的默认值相同
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute
+	lfuMaxVal    = 255
+
+	// entityOverhead 每个key在dict、DataEntity等结构上的固定开销
+	entityOverhead = 64
+	// elementOverhead 集合类型中每个元素的固定开销
+	elementOverhead = 16
+	// sizeSamples 估算集合类型大小时采样的元素数量
+	sizeSamples = 5
+)
+
+var evictionPolicies = map[string]struct{}{
+	policyNoEviction:     {},
+	policyAllKeysLRU:     {},
+	policyVolatileLRU:    {},
+	policyAllKeysLFU:     {},
+	policyVolatileLFU:    {},
+	policyAllKeysRandom:  {},
+	policyVolatileRandom: {},
+	policyVolatileTTL:    {},
+}
+
+// noOOMCommands 不会增加内存占用的写命令，超过maxmemory时仍然可以执行
+var noOOMCommands = map[string]struct{}{
+	"del":       {},
+	"expire":    {},
+	"expireat":  {},
+	"pexpire":   {},
+	"pexpireat": {},
+	"persist":   {},
+	"lpop":      {},
+	"rpop":      {},
+	"lrem":      {},
+	"hdel":      {},
+	"srem":      {},
+	"spop":      {},
+	"zrem":      {},
+	"xdel":      {},
+	"xtrim":     {},
+	"xack":      {},
+}
+
+var oomErrReply = protocol.MakeErrorReply("OOM command not allowed when used memory > 'maxmemory'.")
+
+// initMemoryLimit 读取maxmemory相关配置
+func (mdb *MultiDB) initMemoryLimit() {
+	if config.Properties.MaxMemory != "" {
+		maxMemory, err := utils.ParseMemory(config.Properties.MaxMemory)
+		if err != nil {
+			logger.Fatal("illegal maxmemory " + config.Properties.MaxMemory)
+		}
+		mdb.maxMemory = maxMemory
+	}
+	mdb.evictionPolicy = strings.ToLower(config.Properties.MaxMemoryPolicy)
+	if mdb.evictionPolicy == "" {
+		mdb.evictionPolicy = policyNoEviction
+	}
+	if _, ok := evictionPolicies[mdb.evictionPolicy]; !ok {
+		logger.Warn("illegal maxmemory-policy " + mdb.evictionPolicy + ", use " + policyNoEviction)
+		mdb.evictionPolicy = policyNoEviction
+	}
+	mdb.evictionSamples = config.Properties.MaxMemorySamples
+	if mdb.evictionSamples <= 0 {
+		mdb.evictionSamples = defaultMaxMemorySamples
+	}
+}
+
+// usedMemory 所有db估算的内存占用之和
+func (mdb *MultiDB) usedMemory() int64 {
+	var used int64
+	for _, holder := range mdb.dbSet {
+		used += atomic.LoadInt64(&holder.Load().(*DB).usedMemory)
+	}
+	return used
+}
+
+// checkMemory 在写命令之前检查内存，超过maxmemory时淘汰key，无法淘汰时返回OOM错误
+// replica不淘汰key，由master同步删除
+func (mdb *MultiDB) checkMemory(c redis.Connection, cmdName string) redis.Reply {
+	if mdb.maxMemory <= 0 {
+		return nil
+	}
+	if _, ok := cmdTable[cmdName]; !ok || isReadOnlyCommand(cmdName) {
+		return nil
+	}
+	if c.GetRole() == connection.ReplicationRecvCli || atomic.LoadInt32(&mdb.role) == slaveRole {
+		return nil
+	}
+	if mdb.usedMemory() <= mdb.maxMemory {
+		return nil
+	}
+
+	mdb.evictMu.Lock()
+	defer mdb.evictMu.Unlock()
+	for mdb.usedMemory() > mdb.maxMemory {
+		if mdb.evictionPolicy == policyNoEviction || !mdb.evictOne() {
+			if _, ok := noOOMCommands[cmdName]; ok {
+				return nil
+			}
+			return oomErrReply
+		}
+	}
+	return nil
+}
+
+// evictOne 从每个db采样，淘汰其中最合适的一个key，没有可以淘汰的key时返回false
+func (mdb *MultiDB) evictOne() bool {
+	now := time.Now()
+	volatile := strings.HasPrefix(mdb.evictionPolicy, "volatile-")
+	var bestDB *DB
+	bestKey := ""
+	bestScore := int64(math.MinInt64)
+	for _, holder := range mdb.dbSet {
+		db := holder.Load().(*DB)
+		source := db.data
+		if volatile {
+			source = db.ttlMap
+		}
+		if source.Len() == 0 {
+			continue
+		}
+		for _, key := range source.RandomKeys(mdb.evictionSamples) {
+			score, ok := db.evictionScore(key, mdb.evictionPolicy, now)
+			if ok && score > bestScore {
+				bestDB, bestKey, bestScore = db, key, score
+			}
+		}
+	}
+	if bestDB == nil {
+		return false
+	}
+
+	keys := []string{bestKey}
+	bestDB.RWLocks(keys, nil)
+	if _, exists := bestDB.data.Get(bestKey); exists {
+		bestDB.Remove(bestKey)
+		bestDB.addVersion(bestKey)
+		bestDB.addAof(utils.ToCmdLine("DEL", bestKey))
+		bestDB.notify(notifyEvicted, "evicted", bestKey)
+	}
+	bestDB.RWUnLocks(keys, nil)
+	atomic.AddInt64(&mdb.evictedKeys, 1)
+	return true
+}
+
+// evictionScore 分数越大越应该被淘汰
+func (db *DB) evictionScore(key string, policy string, now time.Time) (int64, bool) {
+	raw, ok := db.data.Get(key)
+	if !ok {
+		return 0, false
+	}
+	entity, _ := raw.(*database.DataEntity)
+	switch policy {
+	case policyAllKeysLRU, policyVolatileLRU:
+		return now.UnixMilli() - atomic.LoadInt64(&entity.AccessTime), true
+	case policyAllKeysLFU, policyVolatileLFU:
+		return int64(lfuMaxVal - lfuDecr(entity, now)), true
+	case policyVolatileTTL:
+		rawExpire, ok := db.ttlMap.Get(key)
+		if !ok {
+			return 0, false
+		}
+		return -rawExpire.(time.Time).UnixMilli(), true
+	}
+	return rand.Int63(), true
+}
+
+// lfuDecr 按照距离上次访问经过的时间衰减计数器
+func lfuDecr(entity *database.DataEntity, now time.Time) uint32 {
+	counter := atomic.LoadUint32(&entity.Freq)
+	elapsed := now.UnixMilli() - atomic.LoadInt64(&entity.AccessTime)
+	periods := uint32(elapsed / lfuDecayTime.Milliseconds())
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// lfuLogIncr 计数器越大，增加的概率越小
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= lfuMaxVal {
+		return lfuMaxVal
+	}
+	base := float64(0)
+	if counter > lfuInitVal {
+		base = float64(counter - lfuInitVal)
+	}
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// touchEntity 记录一次访问
+func touchEntity(entity *database.DataEntity) {
+	now := time.Now()
+	atomic.StoreUint32(&entity.Freq, lfuLogIncr(lfuDecr(entity, now)))
+	atomic.StoreInt64(&entity.AccessTime, now.UnixMilli())
+}
+
+// trackEntity 新写入的key初始化访问信息并计入内存占用
+func (db *DB) trackEntity(key string, entity *database.DataEntity) {
+	if atomic.LoadUint32(&entity.Freq) == 0 {
+		atomic.StoreUint32(&entity.Freq, lfuInitVal)
+	}
+	atomic.StoreInt64(&entity.AccessTime, time.Now().UnixMilli())
+	size := estimateSize(key, entity)
+	atomic.StoreInt64(&entity.Size, size)
+	atomic.AddInt64(&db.usedMemory, size)
+}
+
+// untrackEntity key被删除或者覆盖时减去其内存占用
+func (db *DB) untrackEntity(raw interface{}) {
+	entity, ok := raw.(*database.DataEntity)
+	if ok && entity != nil {
+		atomic.AddInt64(&db.usedMemory, -atomic.LoadInt64(&entity.Size))
+	}
+}
+
+// updateSizes 写命令执行后重新估算被修改的key
+func (db *DB) updateSizes(keys []string) {
+	for _, key := range keys {
+		raw, ok := db.data.Get(key)
+		if !ok {
+			continue
+		}
+		entity, _ := raw.(*database.DataEntity)
+		size := estimateSize(key, entity)
+		old := atomic.SwapInt64(&entity.Size, size)
+		atomic.AddInt64(&db.usedMemory, size-old)
+	}
+}
+
+// estimateSize 估算key的内存占用，集合类型通过采样元素估算平均大小
+func estimateSize(key string, entity *database.DataEntity) int64 {
+	size := int64(entityOverhead + len(key))
+	switch val := entity.Data.(type) {
+	case []byte:
+		size += int64(len(val))
+	case list.List:
+		total, n := 0, 0
+		val.ForEach(func(i int, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			total += len(bytes)
+			n++
+			return n < sizeSamples
+		})
+		size += sampledSize(val.Len(), total, n)
+	case dict.Dict:
+		total, n := 0, 0
+		for _, field := range val.RandomKeys(sizeSamples) {
+			v, _ := val.Get(field)
+			bytes, _ := v.([]byte)
+			total += len(field) + len(bytes)
+			n++
+		}
+		size += sampledSize(val.Len(), total, n)
+	case *set.Set:
+		total, n := 0, 0
+		val.ForEach(func(member string) bool {
+			total += len(member)
+			n++
+			return n < sizeSamples
+		})
+		size += sampledSize(val.Len(), total, n)
+	case *sortedset.SortedSet:
+		total, n := 0, 0
+		if val.Len() == 0 {
+			break
+		}
+		stop := val.Len()
+		if stop > sizeSamples {
+			stop = sizeSamples
+		}
+		val.ForEach(0, stop, false, func(element *sortedset.Element) bool {
+			// score以及跳表节点的开销
+			total += len(element.Member) + 8 + elementOverhead
+			n++
+			return true
+		})
+		size += sampledSize(int(val.Len()), total, n)
+	case *stream.Stream:
+		total, n := 0, 0
+		val.ForEach(func(entry *stream.Entry) bool {
+			// ID以及B-tree节点的开销
+			total += 16 + elementOverhead
+			for _, field := range entry.Fields {
+				total += len(field)
+			}
+			n++
+			return n < sizeSamples
+		})
+		size += sampledSize(val.Len(), total, n)
+	}
+	return size
+}
+
+func sampledSize(length int, sampledTotal int, sampled int) int64 {
+	if sampled == 0 {
+		return 0
+	}
+	return int64(length) * (int64(sampledTotal)/int64(sampled) + elementOverhead)
+}
+
+func humanMemory(bytes int64) string {
+	units := []string{"B", "K", "M", "G"}
+	value := float64(bytes)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + units[i]
+}
+
+// memoryInfo INFO memory
+func (mdb *MultiDB) memoryInfo() string {
+	used := mdb.usedMemory()
+	lines := []string{
+		"# Memory",
+		"used_memory:" + strconv.FormatInt(used, 10),
+		"used_memory_human:" + humanMemory(used),
+		"maxmemory:" + strconv.FormatInt(mdb.maxMemory, 10),
+		"maxmemory_human:" + humanMemory(mdb.maxMemory),
+		"maxmemory_policy:" + mdb.evictionPolicy,
+		fmt.Sprintf("evicted_keys:%d", atomic.LoadInt64(&mdb.evictedKeys)),
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"errors"
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/pubsub"
+	"strconv"
+)
+
+/**
+ * @Author: wanglei
+ * @File: notify
+ * @Version: 1.0.0
+ * @Description: keyspace notifications，key被修改时向__keyspace@<db>__:<key>发布事件名，
+ *               向__keyevent@<db>__:<event>发布key，通过notify-keyspace-events配置需要发布的事件
+ * @Date: 2026/10/18 10:12
+ */
+
+// 与Redis notify-keyspace-events的字母对应
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m，为了兼容Redis的配置，目前不会发布
+	notifyNew                  // n
+
+	// notifyAll A，不包括m和n
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream
+)
+
+var notifyFlagChars = map[byte]int{
+	'K': notifyKeyspace,
+	'E': notifyKeyevent,
+	'g': notifyGeneric,
+	'$': notifyString,
+	'l': notifyList,
+	's': notifySet,
+	'h': notifyHash,
+	'z': notifyZSet,
+	'x': notifyExpired,
+	'e': notifyEvicted,
+	't': notifyStream,
+	'm': notifyKeyMiss,
+	'n': notifyNew,
+	'A': notifyAll,
+}
+
+// parseNotifyFlags 解析notify-keyspace-events，K和E都没有时不发布任何事件
+func parseNotifyFlags(s string) (int, error) {
+	flags := 0
+	for i := 0; i < len(s); i++ {
+		flag, ok := notifyFlagChars[s[i]]
+		if !ok {
+			return 0, errors.New("invalid notify-keyspace-events flag '" + string(s[i]) + "'")
+		}
+		flags |= flag
+	}
+	if flags&(notifyKeyspace|notifyKeyevent) == 0 {
+		return 0, nil
+	}
+	return flags, nil
+}
+
+// initNotify 读取notify-keyspace-events配置
+func (mdb *MultiDB) initNotify() {
+	flags, err := parseNotifyFlags(config.Properties.NotifyKeyspaceEvents)
+	if err != nil {
+		logger.Error(err.Error() + ", keyspace notifications are disabled")
+		return
+	}
+	mdb.notifyFlags = flags
+}
+
+// notifyKeyspaceEvent 按照配置发布keyspace和keyevent消息
+func (mdb *MultiDB) notifyKeyspaceEvent(dbIndex int, class int, event string, key string) {
+	flags := mdb.notifyFlags
+	if flags&class == 0 {
+		return
+	}
+	prefix := "@" + strconv.Itoa(dbIndex) + "__:"
+	if flags&notifyKeyspace > 0 {
+		pubsub.Publish(mdb.hub, [][]byte{[]byte("__keyspace" + prefix + key), []byte(event)})
+	}
+	if flags&notifyKeyevent > 0 {
+		pubsub.Publish(mdb.hub, [][]byte{[]byte("__keyevent" + prefix + event), []byte(key)})
+	}
+}
+
+// notify 发布当前db中key的事件
+func (db *DB) notify(class int, event string, key string) {
+	if _, ok := db.quietKeys.Load(key); ok {
+		return
+	}
+	db.notifyEvent(db.index, class, event, key)
+}
@@ -1,87 +1,209 @@
 package database
 
 import (
-	"github.com/hdt3213/rdb/core"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/hdt3213/rdb/model"
 	rdb "github.com/hdt3213/rdb/parser"
+	"gmr/go-cache/aof"
 	"gmr/go-cache/config"
 	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/list"
+	"gmr/go-cache/datastruct/set"
 	"gmr/go-cache/datastruct/sortedset"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/lib/logger"
+	"io"
 	"os"
+	"strconv"
+	"time"
 )
 
 /**
  * @Author: wanglei
  * @File: rdb
  * @Version: 1.0.0
- * @Description:
+ * @Description: 加载go-cache或Redis生成的rdb文件
  * @Date: 2023/08/04 14:25
  */
 
+const (
+	defaultRDBFilename = "dump.rdb"
+	// 支持的rdb版本，与hdt3213/rdb的解析能力一致(Redis 2.x ~ 7.2)
+	minRDBVersion = 1
+	maxRDBVersion = 11
+)
+
+var rdbMagic = []byte("REDIS")
+
+func rdbFilename() string {
+	if config.Properties.RDBFilename == "" {
+		return defaultRDBFilename
+	}
+	return config.Properties.RDBFilename
+}
+
+// loadRdbFile 启动时加载rdb文件，文件不存在时跳过
 func loadRdbFile(mdb *MultiDB) {
-	rdbFile, err := os.Open(config.Properties.RDBFilename)
+	filename := rdbFilename()
+	rdbFile, err := os.Open(filename)
 	if err != nil {
-		logger.Error("open rdb file failed" + err.Error())
+		if !os.IsNotExist(err) {
+			logger.Error("open rdb file failed: " + err.Error())
+		}
 		return
 	}
+	defer rdbFile.Close()
 
-	defer func() {
-		rdbFile.Close()
-	}()
-
-	decoder := rdb.NewDecoder(rdbFile)
-	err = dumpRDB(decoder, mdb)
+	start := time.Now()
+	keys, err := loadRDB(bufio.NewReader(rdbFile), mdb)
 	if err != nil {
-		logger.Error("dump rdb file failed" + err.Error())
+		logger.Fatal("load rdb file " + filename + " failed: " + err.Error())
 		return
 	}
+	logger.Info(fmt.Sprintf("loaded %d keys from %s in %v", keys, filename, time.Since(start)))
 }
 
-//todo
-func dumpRDB(dec *core.Decoder, mdb *MultiDB) error {
-	return dec.Parse(func(o model.RedisObject) bool {
-		db := mdb.mustSelectDB(o.GetDBIndex())
-		switch o.GetType() {
-		case rdb.StringType:
-			str := o.(*rdb.StringObject)
-			db.PutEntity(o.GetKey(), &database.DataEntity{
-				Data: str.Value,
-			})
-		case rdb.ListType:
-			listObj := o.(*rdb.ListObject)
-			l := list.NewQuickList()
-			for _, value := range listObj.Values {
-				l.Add(value)
-			}
-			db.PutEntity(o.GetKey(), &database.DataEntity{
-				Data: l,
-			})
-		case rdb.HashType:
-			hashObj := o.(*rdb.HashObject)
-			hash := dict.MakeSimpleDict()
-			for key, value := range hashObj.Values {
-				hash.Put(key, value)
+// checkRDBHeader 检查文件头和rdb版本，返回可以从头开始读取的reader
+func checkRDBHeader(reader io.Reader) (io.Reader, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, errors.New("read rdb header failed: " + err.Error())
+	}
+	if !bytes.Equal(header[:5], rdbMagic) {
+		return nil, errors.New("wrong signature, not a rdb file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return nil, errors.New("illegal rdb version " + string(header[5:]))
+	}
+	if version < minRDBVersion || version > maxRDBVersion {
+		return nil, fmt.Errorf("unsupported rdb version %d, supported versions are %d to %d",
+			version, minRDBVersion, maxRDBVersion)
+	}
+	return io.MultiReader(bytes.NewReader(header), reader), nil
+}
+
+// loadRDB 将rdb中的数据加载到mdb，跳过已经过期的key，返回加载的key数量
+func loadRDB(reader io.Reader, mdb *MultiDB) (int, error) {
+	reader, err := checkRDBHeader(reader)
+	if err != nil {
+		return 0, err
+	}
+	decoder := rdb.NewDecoder(reader).WithSpecialOpCode()
+	now := time.Now()
+	keys := 0
+	var loadErr error
+	err = decoder.Parse(func(o rdb.RedisObject) bool {
+		switch obj := o.(type) {
+		case *rdb.AuxObject:
+			if obj.Key == aof.FunctionAuxKey {
+				_, errReply := mdb.functions.loadCode(obj.Value, true)
+				if errReply != nil {
+					loadErr = errors.New(errReply.Error())
+					return false
+				}
 			}
-			db.PutEntity(o.GetKey(), &database.DataEntity{
-				Data: hash,
-			})
-		case rdb.ZSetType:
-			zsetObj := o.(*rdb.ZSetObject)
-			zset := sortedset.MakeSortedSet()
-			for _, e := range zsetObj.Entries {
-				zset.Add(e.Member, e.Score)
+			if obj.Key == aof.StreamAuxKey {
+				loadErr = loadStreamAux(mdb, obj.Value, now)
+				if loadErr != nil {
+					return false
+				}
+				keys++
 			}
-			db.PutEntity(o.GetKey(), &database.DataEntity{
-				Data: zset,
-			})
+			return true
+		case *rdb.DBSizeObject:
+			return true
 		}
-
-		if o.GetExpiration() != nil {
-			db.Expire(o.GetKey, o.GetExpiration)
+		dbIndex := o.GetDBIndex()
+		if dbIndex < 0 || dbIndex >= len(mdb.dbSet) {
+			loadErr = fmt.Errorf("db index %d is out of range, set databases to at least %d", dbIndex, dbIndex+1)
+			return false
+		}
+		expiration := o.GetExpiration()
+		if expiration != nil && expiration.Before(now) {
+			return true
+		}
+		entity := rdbObjectToEntity(o)
+		if entity == nil {
+			logger.Warn(fmt.Sprintf("skip key %s of unsupported type %s", o.GetKey(), o.GetType()))
+			return true
 		}
+		db := mdb.mustSelectDB(dbIndex)
+		db.PutEntity(o.GetKey(), entity)
+		if expiration != nil {
+			db.Expire(o.GetKey(), *expiration)
+		}
+		keys++
 		return true
 	})
+	if loadErr != nil {
+		return keys, loadErr
+	}
+	if err != nil {
+		return keys, err
+	}
+	return keys, nil
+}
+
+// loadStreamAux 加载go-cache以aux字段保存的stream
+func loadStreamAux(mdb *MultiDB, value string, now time.Time) error {
+	dbIndex, expiration, cmdLine, err := aof.ParseStreamAux(value)
+	if err != nil {
+		return errors.New("illegal stream aux field: " + err.Error())
+	}
+	if dbIndex < 0 || dbIndex >= len(mdb.dbSet) {
+		return fmt.Errorf("db index %d is out of range, set databases to at least %d", dbIndex, dbIndex+1)
+	}
+	if expiration != nil && expiration.Before(now) {
+		return nil
+	}
+	s, err := aof.CmdToStream(cmdLine[2:])
+	if err != nil {
+		return errors.New("illegal stream aux field: " + err.Error())
+	}
+	key := string(cmdLine[1])
+	db := mdb.mustSelectDB(dbIndex)
+	db.PutEntity(key, &database.DataEntity{Data: s})
+	if expiration != nil {
+		db.Expire(key, *expiration)
+	}
+	return nil
+}
+
+// rdbObjectToEntity 将rdb中的对象转换为DataEntity，不支持的类型返回nil
+func rdbObjectToEntity(o rdb.RedisObject) *database.DataEntity {
+	switch obj := o.(type) {
+	case *rdb.StringObject:
+		return &database.DataEntity{Data: obj.Value}
+	case *rdb.ListObject:
+		l := list.NewQuickList()
+		for _, value := range obj.Values {
+			l.Add(value)
+		}
+		return &database.DataEntity{Data: l}
+	case *rdb.SetObject:
+		s := set.MakeSet()
+		for _, member := range obj.Members {
+			s.Add(string(member))
+		}
+		return &database.DataEntity{Data: s}
+	case *rdb.HashObject:
+		hash := dict.MakeSimpleDict()
+		for field, value := range obj.Hash {
+			hash.Put(field, value)
+		}
+		return &database.DataEntity{Data: hash}
+	case *rdb.ZSetObject:
+		zset := sortedset.MakeSortedSet()
+		for _, entry := range obj.Entries {
+			zset.Add(entry.Member, entry.Score)
+		}
+		return &database.DataEntity{Data: zset}
+	case *model.StreamObject:
+		return &database.DataEntity{Data: aof.StreamObjectToStream(obj)}
+	}
+	return nil
 }
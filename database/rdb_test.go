@@ -0,0 +1,190 @@
+package database
+
+import (
+	"bytes"
+	"github.com/hdt3213/rdb/encoder"
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: rdb_test
+ * @Version: 1.0.0
+ * @Description: rdb文件的保存与加载测试
+ * @Date: 2026/10/18 3:10
+ */
+
+func setupRDBConfig(t *testing.T) {
+	appendOnly, dirname, filename, fsync := config.Properties.AppendOnly, config.Properties.AppendDirname,
+		config.Properties.AppendFilename, config.Properties.AppendFsync
+	rdbFilename, databases := config.Properties.RDBFilename, config.Properties.Databases
+	t.Cleanup(func() {
+		config.Properties.AppendOnly, config.Properties.AppendDirname = appendOnly, dirname
+		config.Properties.AppendFilename, config.Properties.AppendFsync = filename, fsync
+		config.Properties.RDBFilename, config.Properties.Databases = rdbFilename, databases
+	})
+	dir := t.TempDir()
+	config.Properties.AppendDirname = filepath.Join(dir, "appendonlydir")
+	config.Properties.AppendFilename = "appendonly.aof"
+	// 命令写入aof文件之后才返回，SAVE可以读取到之前的所有命令
+	config.Properties.AppendFsync = "always"
+	config.Properties.RDBFilename = filepath.Join(dir, "dump.rdb")
+	config.Properties.Databases = 16
+}
+
+func execString(mdb *MultiDB, conn *connection.Connection, args ...string) string {
+	return string(mdb.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+}
+
+func assertPTTL(t *testing.T, mdb *MultiDB, conn *connection.Connection, key string, max int64) {
+	t.Helper()
+	reply, ok := mdb.Exec(conn, utils.ToCmdLine("PTTL", key)).(*protocol.IntReply)
+	if !ok || reply.Code <= 0 || reply.Code > max {
+		t.Errorf("expect ttl of %s in (0, %d], actual: %v", key, max, reply)
+	}
+}
+
+func TestRDBRoundTrip(t *testing.T) {
+	setupRDBConfig(t)
+	config.Properties.AppendOnly = true
+	mdb := NewStandaloneServer()
+	conn := connection.NewConnection(nil)
+	execString(mdb, conn, "SET", "str", "value")
+	execString(mdb, conn, "SET", "ttl", "value", "PX", "100000")
+	// 整数集合会以intset编码，超过512个成员的集合以hashtable编码
+	execString(mdb, conn, "SADD", "intset", "1", "2", "3")
+	execString(mdb, conn, "SADD", "strset", "a", "b", "c")
+	execString(mdb, conn, "PEXPIRE", "strset", "200000")
+	bigSet := []string{"SADD", "bigset"}
+	for i := 0; i < 600; i++ {
+		bigSet = append(bigSet, "m"+strconv.Itoa(i))
+	}
+	execString(mdb, conn, bigSet...)
+	execString(mdb, conn, "SELECT", "2")
+	execString(mdb, conn, "RPUSH", "list", "a", "b")
+	execString(mdb, conn, "HSET", "hash", "f", "v")
+	execString(mdb, conn, "ZADD", "zset", "1.5", "a")
+	execString(mdb, conn, "SADD", "set2", "x")
+	if reply := mdb.Exec(conn, utils.ToCmdLine("SAVE")); !protocol.IsOKReply(reply) {
+		t.Fatalf("save failed: %s", reply.ToBytes())
+	}
+	mdb.Close()
+
+	// 关闭aof之后从rdb文件恢复
+	config.Properties.AppendOnly = false
+	loaded := NewStandaloneServer()
+	defer loaded.Close()
+	conn = connection.NewConnection(nil)
+	if actual := execString(loaded, conn, "GET", "str"); actual != "$5\r\nvalue\r\n" {
+		t.Errorf("expect str = value, actual: %q", actual)
+	}
+	assertPTTL(t, loaded, conn, "ttl", 100000)
+	assertPTTL(t, loaded, conn, "strset", 200000)
+	if actual := execString(loaded, conn, "PTTL", "intset"); actual != ":-1\r\n" {
+		t.Errorf("expect intset without ttl, actual: %q", actual)
+	}
+	for key, members := range map[string][]string{"intset": {"1", "2", "3"}, "strset": {"a", "b", "c"}} {
+		if actual := execString(loaded, conn, "SCARD", key); actual != ":3\r\n" {
+			t.Errorf("expect 3 members in %s, actual: %q", key, actual)
+		}
+		for _, member := range members {
+			if actual := execString(loaded, conn, "SISMEMBER", key, member); actual != ":1\r\n" {
+				t.Errorf("expect %s in %s", member, key)
+			}
+		}
+	}
+	if actual := execString(loaded, conn, "SCARD", "bigset"); actual != ":600\r\n" {
+		t.Errorf("expect 600 members in bigset, actual: %q", actual)
+	}
+	// db 2中的key加载到同一个db
+	if actual := execString(loaded, conn, "EXISTS", "list"); actual != ":0\r\n" {
+		t.Errorf("list should not be loaded into db 0")
+	}
+	execString(loaded, conn, "SELECT", "2")
+	expected := map[string]string{
+		"LRANGE list 0 -1": "*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		"HGET hash f":      "$1\r\nv\r\n",
+		"ZSCORE zset a":    "$3\r\n1.5\r\n",
+		"SMEMBERS set2":    "*1\r\n$1\r\nx\r\n",
+	}
+	for cmd, reply := range expected {
+		if actual := execString(loaded, conn, strings.Fields(cmd)...); actual != reply {
+			t.Errorf("%s expect %q, actual: %q", cmd, reply, actual)
+		}
+	}
+}
+
+// writeTestRDB 模拟Redis生成的rdb文件
+func writeTestRDB(t *testing.T, dbIndex uint, write func(enc *encoder.Encoder) error) []byte {
+	buf := &bytes.Buffer{}
+	enc := encoder.NewEncoder(buf)
+	if err := enc.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteDBHeader(dbIndex, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(enc); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadRDBSkipExpired(t *testing.T) {
+	setupRDBConfig(t)
+	data := writeTestRDB(t, 0, func(enc *encoder.Encoder) error {
+		past := uint64(time.Now().Add(-time.Minute).UnixNano() / 1e6)
+		if err := enc.WriteSetObject("expired", [][]byte{[]byte("a")}, encoder.WithTTL(past)); err != nil {
+			return err
+		}
+		return enc.WriteSetObject("alive", [][]byte{[]byte("1"), []byte("2")})
+	})
+	mdb := MakeBasicMultiDB()
+	keys, err := loadRDB(bytes.NewReader(data), mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != 1 {
+		t.Errorf("expect 1 key loaded, actual: %d", keys)
+	}
+	conn := connection.NewConnection(nil)
+	if actual := execString(mdb, conn, "EXISTS", "expired"); actual != ":0\r\n" {
+		t.Errorf("expired key should be skipped")
+	}
+	if actual := execString(mdb, conn, "SCARD", "alive"); actual != ":2\r\n" {
+		t.Errorf("expect 2 members in alive, actual: %q", actual)
+	}
+}
+
+func TestLoadRDBErrors(t *testing.T) {
+	setupRDBConfig(t)
+	config.Properties.Databases = 4
+	data := writeTestRDB(t, 5, func(enc *encoder.Encoder) error {
+		return enc.WriteStringObject("a", []byte("1"))
+	})
+	if _, err := loadRDB(bytes.NewReader(data), MakeBasicMultiDB()); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("expect db index out of range error, actual: %v", err)
+	}
+
+	cases := map[string]string{
+		"REDIS0099": "unsupported rdb version",
+		"NOTARDB01": "wrong signature",
+		"REDIS":     "read rdb header failed",
+	}
+	for header, expected := range cases {
+		if _, err := loadRDB(strings.NewReader(header), MakeBasicMultiDB()); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("header %q expect %s, actual: %v", header, expected, err)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	rdb "github.com/hdt3213/rdb/parser"
 	"gmr/go-cache/config"
 	"gmr/go-cache/interface/redis"
 	"gmr/go-cache/lib/logger"
@@ -33,6 +32,8 @@ const (
 	slaveRole
 )
 
+const replDialTimeout = 5 * time.Second
+
 type replicationStatus struct {
 	mutex    sync.Mutex
 	ctx      context.Context
@@ -45,8 +46,10 @@ type replicationStatus struct {
 	masterConn   net.Conn
 	masterChan   <-chan *parser.Payload
 	replId       string
-	replOffset   int64
-	lastRecvtime time.Time
+	replOffset   int64 // 已经从master接收的数据长度，断线重连时用于部分同步
+	dbIndex      int32 // 复制流当前select的db，部分同步后继续使用，需要原子访问
+	syncing      bool  // 是否正在与master进行同步
+	lastRecvtime int64 // 最后一次收到master数据的时间(UnixNano)，需要原子访问
 	running      sync.WaitGroup
 }
 
@@ -54,6 +57,15 @@ func initReplStatus() *replicationStatus {
 	return &replicationStatus{}
 }
 
+// touchRecvTime 接收aof的goroutine不持有mutex，lastRecvtime通过原子操作更新
+func (repl *replicationStatus) touchRecvTime() {
+	atomic.StoreInt64(&repl.lastRecvtime, time.Now().UnixNano())
+}
+
+func (repl *replicationStatus) getRecvTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&repl.lastRecvtime))
+}
+
 func (mdb *MultiDB) startReplCron() {
 	go func() {
 		defer func() {
@@ -65,6 +77,7 @@ func (mdb *MultiDB) startReplCron() {
 		ticker := time.Tick(time.Second)
 		for range ticker {
 			mdb.slaveCron()
+			mdb.masterCron()
 		}
 	}()
 }
@@ -72,6 +85,7 @@ func (mdb *MultiDB) startReplCron() {
 func (mdb *MultiDB) execSlaveOf(c redis.Connection, args [][]byte) redis.Reply {
 	if strings.ToLower(string(args[0])) == "no" && strings.ToLower(string(args[1])) == "one" {
 		mdb.slaveOfNone()
+		atomic.StoreInt32(&mdb.role, masterRole)
 		return protocol.MakeOkReply()
 	}
 	host := string(args[0])
@@ -87,10 +101,81 @@ func (mdb *MultiDB) execSlaveOf(c redis.Connection, args [][]byte) redis.Reply {
 
 	atomic.AddInt32(&mdb.replication.modCount, 1)
 	mdb.replication.mutex.Unlock()
+	mdb.unblockAll()
 	go mdb.syncWithMaster()
 	return protocol.MakeOkReply()
 }
 
+// execInfo INFO [section]，目前支持memory、stats、replication和keyspace，格式与Redis相同
+func (mdb *MultiDB) execInfo(args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		return protocol.MakeArgNumErrorReply("info")
+	}
+	section := "default"
+	if len(args) == 1 {
+		section = strings.ToLower(string(args[0]))
+	}
+	switch section {
+	case "replication":
+		return protocol.MakeBulkReply([]byte(mdb.replicationInfo()))
+	case "memory":
+		return protocol.MakeBulkReply([]byte(mdb.memoryInfo()))
+	case "stats":
+		return protocol.MakeBulkReply([]byte(mdb.statsInfo()))
+	case "keyspace":
+		return protocol.MakeBulkReply([]byte(mdb.keyspaceInfo()))
+	case "all", "default", "everything":
+		info := strings.Join([]string{mdb.memoryInfo(), mdb.statsInfo(), mdb.replicationInfo(), mdb.keyspaceInfo()}, "\r\n")
+		return protocol.MakeBulkReply([]byte(info))
+	}
+	return protocol.MakeBulkReply([]byte{})
+}
+
+// replicationInfo sentinel根据其中的role、slave列表和offset选择提升的slave
+func (mdb *MultiDB) replicationInfo() string {
+	lines := []string{"# Replication"}
+	if atomic.LoadInt32(&mdb.role) == slaveRole {
+		mdb.replication.mutex.Lock()
+		linkStatus := "down"
+		if mdb.replication.masterConn != nil {
+			linkStatus = "up"
+		}
+		lines = append(lines,
+			"role:slave",
+			"master_host:"+mdb.replication.masterHost,
+			"master_port:"+strconv.Itoa(mdb.replication.masterPort),
+			"master_link_status:"+linkStatus,
+			"master_sync_in_progress:"+strconv.FormatBool(mdb.replication.syncing),
+			"slave_repl_offset:"+strconv.FormatInt(atomic.LoadInt64(&mdb.replication.replOffset), 10),
+		)
+		mdb.replication.mutex.Unlock()
+		return strings.Join(lines, "\r\n") + "\r\n"
+	}
+
+	status := mdb.masterStatus
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	lines = append(lines, "role:master", "connected_slaves:"+strconv.Itoa(len(status.onlineSlaves)))
+	i := 0
+	for slave := range status.onlineSlaves {
+		ip := slave.announceIp
+		if ip == "" {
+			if conn, ok := slave.conn.(interface{ RemoteAddr() net.Addr }); ok {
+				ip, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+			}
+		}
+		lag := int64(time.Since(slave.lastAckTime) / time.Second)
+		lines = append(lines, fmt.Sprintf("slave%d:ip=%s,port=%d,state=online,offset=%d,lag=%d",
+			i, ip, slave.announcePort, slave.offset, lag))
+		i++
+	}
+	lines = append(lines,
+		"master_replid:"+status.replId,
+		"master_repl_offset:"+strconv.FormatInt(status.backlog.currentOffset, 10),
+	)
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
 func (mdb *MultiDB) slaveOfNone() {
 	mdb.replication.mutex.Lock()
 	defer mdb.replication.mutex.Unlock()
@@ -98,7 +183,7 @@ func (mdb *MultiDB) slaveOfNone() {
 	mdb.replication.masterHost = ""
 	mdb.replication.masterPort = 0
 	mdb.replication.replId = ""
-	mdb.replication.replOffset = -1
+	atomic.StoreInt64(&mdb.replication.replOffset, -1)
 	mdb.replication.stopSlaveWithMutex()
 }
 
@@ -111,6 +196,7 @@ func (repl *replicationStatus) stopSlaveWithMutex() {
 
 	repl.ctx = context.Background()
 	repl.cancel = nil
+	repl.syncing = false
 
 	if repl.masterConn != nil {
 		_ = repl.masterConn.Close()
@@ -137,29 +223,49 @@ func (mdb *MultiDB) syncWithMaster() {
 	ctx, cancel := context.WithCancel(context.Background())
 	mdb.replication.ctx = ctx
 	mdb.replication.cancel = cancel
+	mdb.replication.syncing = true
+	modCount := mdb.replication.modCount
 	mdb.replication.mutex.Unlock()
 
-	if err := mdb.connectWithMaster(); err != nil {
-		return
+	err := mdb.connectWithMaster()
+	if err == nil {
+		err = mdb.doPsync()
 	}
-
-	if err := mdb.doPsync(); err != nil {
-		return
+	if err == nil {
+		err = mdb.receiveAOF()
 	}
 
-	if err := mdb.receiveAOF(); err != nil {
+	mdb.replication.mutex.Lock()
+	defer mdb.replication.mutex.Unlock()
+	if mdb.replication.modCount != modCount {
 		return
 	}
+	mdb.replication.syncing = false
+	if err != nil {
+		// 关闭连接，由slaveCron重新连接并尝试部分同步
+		logger.Error("sync with master failed: " + err.Error())
+		if mdb.replication.masterConn != nil {
+			_ = mdb.replication.masterConn.Close()
+		}
+		mdb.replication.masterConn = nil
+		mdb.replication.masterChan = nil
+	}
 }
 
-func (mdb *MultiDB) connectWithMaster() error {
+func (mdb *MultiDB) connectWithMaster() (err error) {
 	modCount := atomic.LoadInt32(&mdb.replication.modCount)
+	mdb.replication.mutex.Lock()
 	addr := mdb.replication.masterHost + ":" + strconv.Itoa(mdb.replication.masterPort)
-	conn, err := net.Dial("tcp", addr)
+	mdb.replication.mutex.Unlock()
+	conn, err := net.DialTimeout("tcp", addr, replDialTimeout)
 	if err != nil {
-		mdb.slaveOfNone()
-		return errors.New("connect master failed" + err.Error())
+		return errors.New("connect master failed " + err.Error())
 	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
 
 	masterChan := parser.ParseStream(conn)
 
@@ -182,7 +288,7 @@ func (mdb *MultiDB) connectWithMaster() error {
 			!strings.HasPrefix(reply.Error(), "ERR operation not permitted") {
 			logger.Error("Error reply to PING from master: " + string(reply.ToBytes()))
 			mdb.slaveOfNone() // abort
-			return nil
+			return errors.New("error reply to PING from master")
 		}
 	}
 
@@ -242,19 +348,28 @@ func (mdb *MultiDB) connectWithMaster() error {
 	}
 
 	mdb.replication.mutex.Lock()
+	defer mdb.replication.mutex.Unlock()
 	if mdb.replication.modCount != modCount {
-		return nil
+		return errors.New("replication conf changed during connecting")
 	}
 
 	mdb.replication.masterConn = conn
 	mdb.replication.masterChan = masterChan
-	mdb.replication.mutex.Unlock()
+	mdb.replication.touchRecvTime()
 	return nil
 }
 
 func (mdb *MultiDB) doPsync() error {
 	modCount := atomic.LoadInt32(&mdb.replication.modCount)
+	mdb.replication.mutex.Lock()
+	replId := mdb.replication.replId
+	replOffset := atomic.LoadInt64(&mdb.replication.replOffset)
+	mdb.replication.mutex.Unlock()
 	psyncCmdLine := utils.ToCmdLine("psync", "?", "-1")
+	if replId != "" && replOffset >= 0 {
+		// 尝试从上次断开的位置继续同步
+		psyncCmdLine = utils.ToCmdLine("psync", replId, strconv.FormatInt(replOffset+1, 10))
+	}
 	psyncRep := protocol.MakeMultiBulkReply(psyncCmdLine)
 	_, err := mdb.replication.masterConn.Write(psyncRep.ToBytes())
 	if err != nil {
@@ -262,7 +377,7 @@ func (mdb *MultiDB) doPsync() error {
 	}
 	ch := mdb.replication.masterChan
 	psyncPayload1 := <-ch
-	if psyncPayload1.Err == nil {
+	if psyncPayload1.Err != nil {
 		return errors.New("read response failed: " + psyncPayload1.Err.Error())
 	}
 
@@ -271,6 +386,9 @@ func (mdb *MultiDB) doPsync() error {
 		return errors.New("illegal payload header: " + string(psyncPayload1.Data.ToBytes()))
 	}
 	headers := strings.Split(psyncHeader.Status, " ")
+	if headers[0] == "CONTINUE" {
+		return mdb.continueWithMaster(modCount, headers)
+	}
 	if len(headers) != 3 {
 		return errors.New("illegal payload header: " + psyncHeader.Status)
 	}
@@ -287,9 +405,8 @@ func (mdb *MultiDB) doPsync() error {
 	}
 	logger.Info(fmt.Sprintf("receive %d bytes of rdb from master", len(psyncData.Arg)))
 
-	rdbDec := rdb.NewDecoder(bytes.NewReader(psyncData.Arg))
 	rdbHolder := MakeBasicMultiDB()
-	err = dumpRDB(rdbDec, rdbHolder)
+	_, err = loadRDB(bytes.NewReader(psyncData.Arg), rdbHolder)
 	if err != nil {
 		return errors.New("dump rdb failed: " + err.Error())
 	}
@@ -300,29 +417,48 @@ func (mdb *MultiDB) doPsync() error {
 		// replication conf changed during connecting and waiting mutex
 		return nil
 	}
-	mdb.replication.replId = headers[1]
-	mdb.replication.replOffset, err = strconv.ParseInt(headers[2], 10, 64)
+	replOffset, err = strconv.ParseInt(headers[2], 10, 64)
 	if err != nil {
 		return errors.New("get illegal repl offset: " + headers[2])
 	}
+	mdb.replication.replId = headers[1]
+	atomic.StoreInt64(&mdb.replication.replOffset, replOffset)
+	atomic.StoreInt32(&mdb.replication.dbIndex, 0)
 	logger.Info("full resync from master: " + mdb.replication.replId)
-	logger.Info("current offset:", mdb.replication.replOffset)
+	logger.Info("current offset:", replOffset)
 	for i, h := range rdbHolder.dbSet {
 		newDB := h.Load().(*DB)
 		mdb.loadDB(i, newDB)
 	}
-	// there is no CRLF between RDB and following AOF, reset stream to avoid parser error
-	mdb.replication.masterChan = parser.ParseStream(mdb.replication.masterConn)
+	mdb.functions.replaceWith(rdbHolder.functions)
+	mdb.replication.touchRecvTime()
 	// fixme: update aof file
 	return nil
 }
 
+// continueWithMaster master回复CONTINUE，保留现有数据，从断开的位置继续接收
+func (mdb *MultiDB) continueWithMaster(modCount int32, headers []string) error {
+	mdb.replication.mutex.Lock()
+	defer mdb.replication.mutex.Unlock()
+	if mdb.replication.modCount != modCount {
+		return nil
+	}
+	if len(headers) > 1 && headers[1] != "" {
+		mdb.replication.replId = headers[1]
+	}
+	mdb.replication.touchRecvTime()
+	logger.Info(fmt.Sprintf("partial resync with master %s, current offset %d",
+		mdb.replication.replId, atomic.LoadInt64(&mdb.replication.replOffset)))
+	return nil
+}
+
 func (mdb *MultiDB) receiveAOF() error {
 	conn := connection.NewConnection(mdb.replication.masterConn)
 	conn.SetRole(connection.ReplicationRecvCli)
 	mdb.replication.mutex.Lock()
 	modCount := mdb.replication.modCount
 	done := mdb.replication.ctx.Done()
+	conn.SelectDB(int(atomic.LoadInt32(&mdb.replication.dbIndex)))
 	mdb.replication.mutex.Unlock()
 	if done == nil {
 		return nil
@@ -345,18 +481,19 @@ func (mdb *MultiDB) receiveAOF() error {
 				return errors.New("unexpected payload: " + string(payload.Data.ToBytes()))
 			}
 
-			mdb.replication.mutex.Lock()
-			if mdb.replication.modCount != modCount {
+			// 不持有mutex执行命令，避免stopSlaveWithMutex等待running时死锁
+			if atomic.LoadInt32(&mdb.replication.modCount) != modCount {
 				return nil
 			}
 
 			mdb.Exec(conn, cmdLine.Args)
 			n := len(cmdLine.ToBytes())
 
-			mdb.replication.replOffset += int64(n)
+			atomic.StoreInt32(&mdb.replication.dbIndex, int32(conn.GetDBIndex()))
+			mdb.replication.touchRecvTime()
+			replOffset := atomic.AddInt64(&mdb.replication.replOffset, int64(n))
 			logger.Info(fmt.Sprintf("receive %d bytes from master, current offset %d",
-				n, mdb.replication.replOffset))
-			mdb.replication.mutex.Unlock()
+				n, replOffset))
 
 		case <-done:
 			return nil
@@ -366,7 +503,18 @@ func (mdb *MultiDB) receiveAOF() error {
 
 func (mdb *MultiDB) slaveCron() {
 	repl := mdb.replication
-	if repl.masterConn == nil {
+	repl.mutex.Lock()
+	masterConn := repl.masterConn
+	needReconnect := masterConn == nil && repl.masterHost != "" && !repl.syncing
+	repl.mutex.Unlock()
+	if needReconnect {
+		err := mdb.reconnectWithMaster()
+		if err != nil {
+			logger.Error("reconnect failed " + err.Error())
+		}
+		return
+	}
+	if masterConn == nil {
 		return
 	}
 
@@ -375,7 +523,7 @@ func (mdb *MultiDB) slaveCron() {
 		replTimeout = time.Duration(config.Properties.ReplTimeout) * time.Second
 	}
 	minLastRecvTime := time.Now().Add(-replTimeout)
-	if repl.lastRecvtime.Before(minLastRecvTime) {
+	if repl.getRecvTime().Before(minLastRecvTime) {
 		err := mdb.reconnectWithMaster()
 		if err != nil {
 			logger.Error("send failed " + err.Error())
@@ -398,7 +546,8 @@ func (mdb *MultiDB) reconnectWithMaster() error {
 }
 
 func (repl *replicationStatus) sendAck2Master() error {
-	psyncCmdLine := utils.ToCmdLine("REPLCONF", "ACK", strconv.FormatInt(repl.replOffset, 10))
+	replOffset := atomic.LoadInt64(&repl.replOffset)
+	psyncCmdLine := utils.ToCmdLine("REPLCONF", "ACK", strconv.FormatInt(replOffset, 10))
 	psyncReq := protocol.MakeMultiBulkReply(psyncCmdLine)
 	_, err := repl.masterConn.Write(psyncReq.ToBytes())
 	return err
@@ -0,0 +1,621 @@
+package database
+
+import (
+	"errors"
+	"gmr/go-cache/config"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: replication_master
+ * @Version: 1.0.0
+ * @Description: master侧的replication，处理slave发送的PSYNC/REPLCONF
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	slaveStateHandShake = iota
+	slaveStateWaitSaveEnd
+	slaveStateSendingRDB
+	slaveStateOnline
+)
+
+const (
+	bgSaveIdle = iota
+	bgSaveRunning
+	bgSaveFinish
+)
+
+const (
+	// master向slave发送ping的间隔
+	replPingPeriod = 10 * time.Second
+	// 没有slave等待时，rdb快照保留的时间
+	replRDBKeepTime = 60 * time.Second
+	rdbSendBufSize  = 64 * 1024
+	// 默认的backlog大小
+	defaultReplBacklogSize = 1 << 20
+	// 默认的slave输出缓冲区上限
+	defaultReplOutputBufferLimit = 256 << 20
+)
+
+// slaveClient master侧保存的slave连接信息
+type slaveClient struct {
+	conn         redis.Connection
+	state        uint8
+	offset       int64 // slave通过REPLCONF ACK上报的offset
+	lastAckTime  time.Time
+	announceIp   string
+	announcePort int
+	capa         []string
+	// output slave上线后复制流通过输出缓冲区异步发送
+	output *slaveOutput
+}
+
+// slaveOutput slave的输出缓冲区，由单独的goroutine写入连接，slave写入缓慢时不会阻塞aof
+type slaveOutput struct {
+	mu      sync.Mutex
+	pending [][]byte
+	size    int
+	limit   int
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func replOutputBufferLimit() int {
+	if config.Properties.ReplOutputBufferLimit == "" {
+		return defaultReplOutputBufferLimit
+	}
+	limit, err := utils.ParseMemory(config.Properties.ReplOutputBufferLimit)
+	if err != nil || limit <= 0 {
+		logger.Error("illegal repl-output-buffer-limit " + config.Properties.ReplOutputBufferLimit)
+		return defaultReplOutputBufferLimit
+	}
+	return int(limit)
+}
+
+func makeSlaveOutput() *slaveOutput {
+	return &slaveOutput{
+		limit: replOutputBufferLimit(),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// write 将数据加入缓冲区，超过上限时返回false
+func (output *slaveOutput) write(data []byte) bool {
+	output.mu.Lock()
+	if output.size+len(data) > output.limit {
+		output.mu.Unlock()
+		return false
+	}
+	output.pending = append(output.pending, data)
+	output.size += len(data)
+	output.mu.Unlock()
+	select {
+	case output.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// take 取出缓冲区中所有待发送的数据
+func (output *slaveOutput) take() [][]byte {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	pending := output.pending
+	output.pending = nil
+	output.size = 0
+	return pending
+}
+
+func (output *slaveOutput) close() {
+	close(output.done)
+}
+
+// startOutputWithLock 启动slave的发送goroutine，发送失败时移除slave，调用方需持有mutex
+func (status *masterStatus) startOutputWithLock(slave *slaveClient) {
+	output := makeSlaveOutput()
+	slave.output = output
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error(err)
+			}
+		}()
+		for {
+			select {
+			case <-output.wake:
+			case <-output.done:
+				return
+			}
+			for _, data := range output.take() {
+				if err := slave.conn.Write(data); err != nil {
+					logger.Error("send to slave failed: " + err.Error())
+					status.mutex.Lock()
+					status.removeSlaveWithLock(slave.conn)
+					status.mutex.Unlock()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// replBacklog 固定大小的环形缓冲区，保存复制流中最近写入的数据
+type replBacklog struct {
+	buf           []byte
+	idx           int   // 下一次写入的位置
+	histLen       int   // 缓冲区中有效数据的长度
+	currentOffset int64 // 复制流的总长度，即下一个字节的offset
+}
+
+func makeReplBacklog(size int) *replBacklog {
+	if size <= 0 {
+		size = defaultReplBacklogSize
+	}
+	return &replBacklog{
+		buf: make([]byte, size),
+	}
+}
+
+func (backlog *replBacklog) appendBytes(bin []byte) {
+	size := len(backlog.buf)
+	backlog.currentOffset += int64(len(bin))
+	if len(bin) >= size {
+		// 只保留最后size个字节
+		copy(backlog.buf, bin[len(bin)-size:])
+		backlog.idx = 0
+		backlog.histLen = size
+		return
+	}
+	n := copy(backlog.buf[backlog.idx:], bin)
+	copy(backlog.buf, bin[n:])
+	backlog.idx = (backlog.idx + len(bin)) % size
+	backlog.histLen += len(bin)
+	if backlog.histLen > size {
+		backlog.histLen = size
+	}
+}
+
+// beginOffset backlog中第一个字节的offset
+func (backlog *replBacklog) beginOffset() int64 {
+	return backlog.currentOffset - int64(backlog.histLen)
+}
+
+// isValidOffset 判断从offset开始的数据是否还保存在backlog中
+func (backlog *replBacklog) isValidOffset(offset int64) bool {
+	return offset >= backlog.beginOffset() && offset <= backlog.currentOffset
+}
+
+// getFrom 返回从offset开始直到currentOffset的数据，调用方需保证offset有效
+func (backlog *replBacklog) getFrom(offset int64) []byte {
+	size := len(backlog.buf)
+	n := int(backlog.currentOffset - offset)
+	result := make([]byte, n)
+	start := (backlog.idx - n + size) % size
+	k := copy(result, backlog.buf[start:])
+	if k < n {
+		copy(result[k:], backlog.buf[:n-k])
+	}
+	return result
+}
+
+type masterStatus struct {
+	mutex        sync.Mutex
+	replId       string
+	backlog      *replBacklog
+	slaveMap     map[redis.Connection]*slaveClient
+	waitSlaves   map[*slaveClient]struct{}
+	onlineSlaves map[*slaveClient]struct{}
+	bgSaveState  uint8
+	rdbFilename  string
+	rdbSavedTime time.Time
+	rdbOffset    int64 // rdb快照对应的复制流offset
+	aofListener  *replAofListener
+	// 复制流中当前select的db，-1表示下一条命令前需要发送select
+	streamDB     int
+	lastSendTime time.Time
+}
+
+// replAofListener 接收写入aof的命令，转发给slave
+type replAofListener struct {
+	mdb *MultiDB
+}
+
+func (listener *replAofListener) Callback(dbIndex int, cmdLine CmdLine) {
+	status := listener.mdb.masterStatus
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.sendToSlavesWithLock(dbIndex, cmdLine)
+}
+
+func (mdb *MultiDB) initMasterStatus() {
+	mdb.masterStatus = &masterStatus{
+		replId:       utils.RandHexString(40),
+		backlog:      makeReplBacklog(config.Properties.ReplBacklogSize),
+		slaveMap:     make(map[redis.Connection]*slaveClient),
+		waitSlaves:   make(map[*slaveClient]struct{}),
+		onlineSlaves: make(map[*slaveClient]struct{}),
+		bgSaveState:  bgSaveIdle,
+		aofListener:  &replAofListener{mdb: mdb},
+		streamDB:     -1,
+	}
+}
+
+// sendToSlavesWithLock 将命令写入backlog并发送给所有online slave，调用方需持有mutex
+func (status *masterStatus) sendToSlavesWithLock(dbIndex int, cmdLine CmdLine) {
+	var data []byte
+	if dbIndex != status.streamDB {
+		selectCmd := utils.ToCmdLine("SELECT", strconv.Itoa(dbIndex))
+		data = append(data, protocol.MakeMultiBulkReply(selectCmd).ToBytes()...)
+		status.streamDB = dbIndex
+	}
+	data = append(data, protocol.MakeMultiBulkReply(cmdLine).ToBytes()...)
+	status.backlog.appendBytes(data)
+	status.lastSendTime = time.Now()
+
+	for slave := range status.onlineSlaves {
+		if !slave.output.write(data) {
+			logger.Error("slave output buffer exceeded " + strconv.Itoa(slave.output.limit) + " bytes, disconnect slave")
+			status.removeSlaveWithLock(slave.conn)
+			// Close会等待进行中的写入完成，不能阻塞aof
+			go func(conn redis.Connection) {
+				_ = conn.Close()
+			}(slave.conn)
+		}
+	}
+}
+
+func (status *masterStatus) removeSlaveWithLock(conn redis.Connection) {
+	slave := status.slaveMap[conn]
+	if slave == nil {
+		return
+	}
+	delete(status.slaveMap, conn)
+	delete(status.waitSlaves, slave)
+	delete(status.onlineSlaves, slave)
+	if slave.output != nil {
+		slave.output.close()
+		slave.output = nil
+	}
+}
+
+func (mdb *MultiDB) removeSlave(conn redis.Connection) {
+	if mdb.masterStatus == nil {
+		return
+	}
+	mdb.masterStatus.mutex.Lock()
+	defer mdb.masterStatus.mutex.Unlock()
+	mdb.masterStatus.removeSlaveWithLock(conn)
+}
+
+func (status *masterStatus) getOrCreateSlaveWithLock(conn redis.Connection) *slaveClient {
+	slave := status.slaveMap[conn]
+	if slave == nil {
+		slave = &slaveClient{
+			conn:        conn,
+			state:       slaveStateHandShake,
+			lastAckTime: time.Now(),
+		}
+		status.slaveMap[conn] = slave
+	}
+	return slave
+}
+
+func (mdb *MultiDB) execReplConf(c redis.Connection, args [][]byte) redis.Reply {
+	if len(args)%2 != 0 {
+		return protocol.MakeSyntaxErrorReply()
+	}
+	mdb.masterStatus.mutex.Lock()
+	defer mdb.masterStatus.mutex.Unlock()
+	slave := mdb.masterStatus.getOrCreateSlaveWithLock(c)
+	for i := 0; i < len(args); i += 2 {
+		key := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		switch key {
+		case "ack":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			slave.offset = offset
+			slave.lastAckTime = time.Now()
+			// slave不会读取ACK的响应
+			return &protocol.NoReply{}
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			slave.announcePort = port
+		case "ip-address":
+			slave.announceIp = value
+		case "capa":
+			slave.capa = append(slave.capa, value)
+		}
+	}
+	return protocol.MakeOkReply()
+}
+
+func (mdb *MultiDB) execPSync(c redis.Connection, args [][]byte) redis.Reply {
+	if mdb.aofHandler == nil {
+		return protocol.MakeErrorReply("please enable aof before using psync")
+	}
+	replId := string(args[0])
+	psyncOffset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	}
+	mdb.masterStatus.mutex.Lock()
+	defer mdb.masterStatus.mutex.Unlock()
+
+	slave := mdb.masterStatus.getOrCreateSlaveWithLock(c)
+	delete(mdb.masterStatus.onlineSlaves, slave)
+	// slave发送的是已接收的offset+1
+	if replId == mdb.masterStatus.replId && mdb.masterStatus.backlog.isValidOffset(psyncOffset-1) {
+		err = mdb.masterStatus.partialReSyncWithLock(slave, psyncOffset-1)
+		if err != nil {
+			logger.Error("partial resync with slave failed: " + err.Error())
+		}
+		return &protocol.NoReply{}
+	}
+
+	bgSaveState := mdb.masterStatus.bgSaveState
+	if bgSaveState == bgSaveFinish && !mdb.masterStatus.backlog.isValidOffset(mdb.masterStatus.rdbOffset) {
+		// rdb快照之后的命令已经被backlog覆盖，需要重新生成快照
+		bgSaveState = bgSaveIdle
+	}
+	switch bgSaveState {
+	case bgSaveIdle:
+		slave.state = slaveStateWaitSaveEnd
+		mdb.masterStatus.waitSlaves[slave] = struct{}{}
+		mdb.masterStatus.bgSaveState = bgSaveRunning
+		mdb.bgSaveForReplication()
+	case bgSaveRunning:
+		slave.state = slaveStateWaitSaveEnd
+		mdb.masterStatus.waitSlaves[slave] = struct{}{}
+	case bgSaveFinish:
+		slave.state = slaveStateSendingRDB
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					logger.Error(err)
+				}
+			}()
+			if err := mdb.masterFullReSyncWithSlave(slave); err != nil {
+				logger.Error("full resync with slave failed: " + err.Error())
+			}
+		}()
+	}
+	return &protocol.NoReply{}
+}
+
+func (mdb *MultiDB) bgSaveForReplication() {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error(err)
+			}
+		}()
+		if err := mdb.saveForReplication(); err != nil {
+			logger.Error("save rdb for replication failed: " + err.Error())
+		}
+	}()
+}
+
+// saveForReplication 生成rdb快照，完成后向所有等待中的slave发送
+func (mdb *MultiDB) saveForReplication() error {
+	status := mdb.masterStatus
+	rdbFile, err := ioutil.TempFile("", "*.rdb")
+	if err != nil {
+		mdb.abortBgSaveForReplication()
+		return err
+	}
+	rdbFilename := rdbFile.Name()
+	_ = rdbFile.Close()
+
+	err = mdb.aofHandler.Rewrite2RDBForReplication(rdbFilename, status.aofListener, func() {
+		// aof已暂停，此时的offset即为rdb快照对应的offset
+		status.mutex.Lock()
+		defer status.mutex.Unlock()
+		status.rdbOffset = status.backlog.currentOffset
+		status.streamDB = -1
+	})
+	if err != nil {
+		mdb.abortBgSaveForReplication()
+		return err
+	}
+
+	status.mutex.Lock()
+	if status.rdbFilename != "" && status.rdbFilename != rdbFilename {
+		_ = os.Remove(status.rdbFilename)
+	}
+	status.rdbFilename = rdbFilename
+	status.rdbSavedTime = time.Now()
+	status.bgSaveState = bgSaveFinish
+	waitSlaves := status.waitSlaves
+	status.waitSlaves = make(map[*slaveClient]struct{})
+	for slave := range waitSlaves {
+		slave.state = slaveStateSendingRDB
+	}
+	status.mutex.Unlock()
+
+	for slave := range waitSlaves {
+		err := mdb.masterFullReSyncWithSlave(slave)
+		if err != nil {
+			logger.Error("full resync with slave failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (mdb *MultiDB) abortBgSaveForReplication() {
+	status := mdb.masterStatus
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.bgSaveState = bgSaveIdle
+	for slave := range status.waitSlaves {
+		status.removeSlaveWithLock(slave.conn)
+	}
+}
+
+// masterFullReSyncWithSlave 向slave发送FULLRESYNC、rdb快照以及之后的backlog，然后开始实时同步
+func (mdb *MultiDB) masterFullReSyncWithSlave(slave *slaveClient) error {
+	status := mdb.masterStatus
+	status.mutex.Lock()
+	rdbFilename := status.rdbFilename
+	replId := status.replId
+	rdbOffset := status.rdbOffset
+	status.mutex.Unlock()
+
+	header := "+FULLRESYNC " + replId + " " + strconv.FormatInt(rdbOffset, 10) + protocol.CRLF
+	err := slave.conn.Write([]byte(header))
+	if err != nil {
+		mdb.removeSlave(slave.conn)
+		return errors.New("send FULLRESYNC failed: " + err.Error())
+	}
+	err = sendRDBFile(slave.conn, rdbFilename)
+	if err != nil {
+		mdb.removeSlave(slave.conn)
+		return err
+	}
+
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	if status.slaveMap[slave.conn] != slave {
+		return errors.New("slave disconnected during full resync")
+	}
+	if !status.backlog.isValidOffset(rdbOffset) {
+		// 发送rdb期间backlog被覆盖，无法补齐之后的命令
+		status.removeSlaveWithLock(slave.conn)
+		return errors.New("replication backlog overflowed during full resync")
+	}
+	return status.sendBacklogWithLock(slave, rdbOffset)
+}
+
+// partialReSyncWithLock 回复CONTINUE，并发送slave缺失的backlog，调用方需持有mutex
+func (status *masterStatus) partialReSyncWithLock(slave *slaveClient, offset int64) error {
+	header := "+CONTINUE " + status.replId + protocol.CRLF
+	err := slave.conn.Write([]byte(header))
+	if err != nil {
+		status.removeSlaveWithLock(slave.conn)
+		return errors.New("send CONTINUE failed: " + err.Error())
+	}
+	logger.Info("partial resync with slave from offset " + strconv.FormatInt(offset, 10))
+	return status.sendBacklogWithLock(slave, offset)
+}
+
+// sendBacklogWithLock 将backlog中offset之后的数据加入输出缓冲区并将slave设为online，调用方需持有mutex
+func (status *masterStatus) sendBacklogWithLock(slave *slaveClient, offset int64) error {
+	status.startOutputWithLock(slave)
+	if offset < status.backlog.currentOffset && !slave.output.write(status.backlog.getFrom(offset)) {
+		status.removeSlaveWithLock(slave.conn)
+		return errors.New("replication backlog exceeds slave output buffer limit")
+	}
+	slave.state = slaveStateOnline
+	slave.offset = status.backlog.currentOffset
+	slave.lastAckTime = time.Now()
+	status.onlineSlaves[slave] = struct{}{}
+	logger.Info("slave online, offset: " + strconv.FormatInt(slave.offset, 10))
+	return nil
+}
+
+// sendRDBFile 以bulk string发送rdb文件，结尾不带CRLF
+func sendRDBFile(conn redis.Connection, rdbFilename string) error {
+	rdbFile, err := os.Open(rdbFilename)
+	if err != nil {
+		return errors.New("open rdb file failed: " + err.Error())
+	}
+	defer func() {
+		_ = rdbFile.Close()
+	}()
+	info, err := rdbFile.Stat()
+	if err != nil {
+		return errors.New("stat rdb file failed: " + err.Error())
+	}
+
+	err = conn.Write([]byte("$" + strconv.FormatInt(info.Size(), 10) + protocol.CRLF))
+	if err != nil {
+		return errors.New("send rdb header failed: " + err.Error())
+	}
+	buf := make([]byte, rdbSendBufSize)
+	for {
+		n, err := rdbFile.Read(buf)
+		if n > 0 {
+			if err := conn.Write(buf[:n]); err != nil {
+				return errors.New("send rdb failed: " + err.Error())
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("read rdb file failed: " + err.Error())
+		}
+	}
+}
+
+func (mdb *MultiDB) masterCron() {
+	status := mdb.masterStatus
+	if status == nil {
+		return
+	}
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	replTimeout := 60 * time.Second
+	if config.Properties.ReplTimeout != 0 {
+		replTimeout = time.Duration(config.Properties.ReplTimeout) * time.Second
+	}
+	for slave := range status.onlineSlaves {
+		if time.Since(slave.lastAckTime) > replTimeout {
+			logger.Info("slave ack timeout, stop replication")
+			status.removeSlaveWithLock(slave.conn)
+		}
+	}
+
+	if len(status.onlineSlaves) > 0 && time.Since(status.lastSendTime) > replPingPeriod {
+		dbIndex := status.streamDB
+		if dbIndex < 0 {
+			dbIndex = 0
+		}
+		status.sendToSlavesWithLock(dbIndex, utils.ToCmdLine("PING"))
+	}
+
+	if status.bgSaveState == bgSaveFinish && time.Since(status.rdbSavedTime) > replRDBKeepTime {
+		for _, slave := range status.slaveMap {
+			if slave.state == slaveStateSendingRDB || slave.state == slaveStateWaitSaveEnd {
+				return
+			}
+		}
+		// 没有slave需要rdb快照，释放快照
+		_ = os.Remove(status.rdbFilename)
+		status.rdbFilename = ""
+		status.bgSaveState = bgSaveIdle
+	}
+}
+
+func (status *masterStatus) close() {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	if status.rdbFilename != "" {
+		_ = os.Remove(status.rdbFilename)
+	}
+	for conn := range status.slaveMap {
+		status.removeSlaveWithLock(conn)
+	}
+	status.slaveMap = make(map[redis.Connection]*slaveClient)
+	status.waitSlaves = make(map[*slaveClient]struct{})
+	status.onlineSlaves = make(map[*slaveClient]struct{})
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: replication_master_test
+ * @Version: 1.0.0
+ * @Description: 复制backlog环形缓冲区的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+func TestReplBacklogWrap(t *testing.T) {
+	backlog := makeReplBacklog(8)
+	var stream []byte
+	for _, data := range []string{"abc", "defgh", "ij", "klmnop", "q"} {
+		backlog.appendBytes([]byte(data))
+		stream = append(stream, data...)
+		if backlog.currentOffset != int64(len(stream)) {
+			t.Fatalf("expect offset %d, actual: %d", len(stream), backlog.currentOffset)
+		}
+		begin := backlog.beginOffset()
+		if expected := int64(len(stream)) - 8; expected > 0 && begin != expected {
+			t.Fatalf("expect begin offset %d, actual: %d", expected, begin)
+		}
+		// backlog中每个有效offset开始的数据都与复制流相同
+		for offset := begin; offset <= backlog.currentOffset; offset++ {
+			if !backlog.isValidOffset(offset) {
+				t.Fatalf("offset %d should be valid", offset)
+			}
+			if actual := backlog.getFrom(offset); !bytes.Equal(actual, stream[offset:]) {
+				t.Fatalf("getFrom(%d) expect %q, actual: %q", offset, stream[offset:], actual)
+			}
+		}
+		if backlog.isValidOffset(begin-1) || backlog.isValidOffset(backlog.currentOffset+1) {
+			t.Fatalf("offsets outside the backlog should be invalid")
+		}
+	}
+}
+
+func TestReplBacklogLargeWrite(t *testing.T) {
+	backlog := makeReplBacklog(4)
+	backlog.appendBytes([]byte("ab"))
+	// 一次写入超过backlog大小时只保留最后的数据
+	backlog.appendBytes([]byte("cdefghij"))
+	if backlog.beginOffset() != 6 || backlog.currentOffset != 10 {
+		t.Fatalf("expect offsets [6, 10], actual: [%d, %d]", backlog.beginOffset(), backlog.currentOffset)
+	}
+	if actual := string(backlog.getFrom(6)); actual != "ghij" {
+		t.Errorf("expect ghij, actual: %s", actual)
+	}
+	backlog.appendBytes([]byte("kl"))
+	if actual := string(backlog.getFrom(8)); actual != "ijkl" {
+		t.Errorf("expect ijkl, actual: %s", actual)
+	}
+}
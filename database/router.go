@@ -1,6 +1,10 @@
 package database
 
-import "strings"
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/redis/connection"
+	"strings"
+)
 
 /**
  * @Author: wanglei
@@ -15,6 +19,8 @@ var cmdTable = make(map[string]*command)
 const (
 	flagWrite    = 0
 	flagReadOnly = 1
+	// flagInternal 只能由aof/rdb加载、复制以及集群中的其他节点执行
+	flagInternal = 2
 )
 
 type command struct {
@@ -44,3 +50,32 @@ func isReadOnlyCommand(name string) bool {
 	}
 	return cmd.flags&flagReadOnly > 0
 }
+
+// IsInternalCommand 命令是否只能在内部执行，客户端调用时返回命令不存在
+func IsInternalCommand(name string) bool {
+	cmd := cmdTable[strings.ToLower(name)]
+	return cmd != nil && cmd.flags&flagInternal > 0
+}
+
+// isInternalConn 连接是否可以执行内部命令
+func isInternalConn(c redis.Connection) bool {
+	if c == nil {
+		return true
+	}
+	if _, ok := c.(*connection.FakeConn); ok {
+		return true
+	}
+	role := c.GetRole()
+	return role == connection.ReplicationRecvCli || role == connection.PeerCli
+}
+
+// GetRelatedKeys 分析命令涉及的write keys和read keys，命令不存在或参数数量错误时返回false
+func GetRelatedKeys(cmdLine [][]byte) ([]string, []string, bool) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return nil, nil, false
+	}
+	write, read := cmd.prepare(cmdLine[1:])
+	return write, read, true
+}
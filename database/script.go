@@ -0,0 +1,226 @@
+package database
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+/**
+ * @Author: wanglei
+ * @File: script
+ * @Version: 1.0.0
+ * @Description: EVAL/EVALSHA/SCRIPT，脚本编译后按照SHA1缓存，执行期间持有所有声明的key的锁，
+ *               脚本中执行的写命令各自写入aof，因此aof和slave中记录的是脚本的效果而不是脚本本身
+ * @Date: 2026/10/18 10:12
+ */
+
+// scriptCache 所有db共享的脚本缓存，sha1:*lua.FunctionProto
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.FunctionProto
+}
+
+var scripts = &scriptCache{
+	scripts: make(map[string]*lua.FunctionProto),
+}
+
+// luaVMPool 创建虚拟机的开销远大于执行简单脚本，EVAL复用空闲的虚拟机
+var luaVMPool = sync.Pool{
+	New: func() interface{} {
+		return newLuaVM()
+	},
+}
+
+func scriptSha1(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// load 编译并缓存脚本，返回脚本的sha1
+func (cache *scriptCache) load(body string) (string, *lua.FunctionProto, protocol.ErrorReply) {
+	sha := scriptSha1(body)
+	if proto := cache.get(sha); proto != nil {
+		return sha, proto, nil
+	}
+	proto, err := compileLua("user_script", body)
+	if err != nil {
+		return "", nil, protocol.MakeErrorReply("ERR Error compiling script (new function): " + singleLine(err.Error()))
+	}
+	cache.mu.Lock()
+	cache.scripts[sha] = proto
+	cache.mu.Unlock()
+	return sha, proto, nil
+}
+
+func (cache *scriptCache) get(sha string) *lua.FunctionProto {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.scripts[strings.ToLower(sha)]
+}
+
+func (cache *scriptCache) flush() {
+	cache.mu.Lock()
+	cache.scripts = make(map[string]*lua.FunctionProto)
+	cache.mu.Unlock()
+}
+
+// parseScriptKeys 解析numkeys [key ...] [arg ...]
+func parseScriptKeys(args [][]byte) ([]string, [][]byte, protocol.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, protocol.MakeErrorReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, protocol.MakeErrorReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return keys, args[numKeys+1:], nil
+}
+
+// prepareEval 脚本中可能修改任意声明的key，所有key都加写锁
+func prepareEval(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+func prepareEvalRO(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, keys
+}
+
+func undoEval(db *DB, args [][]byte) []CmdLine {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil
+	}
+	return rollbackGivenKeys(db, keys...)
+}
+
+// evalScript KEYS和ARGV以全局变量的形式传给脚本
+func evalScript(db *DB, sha string, proto *lua.FunctionProto, args [][]byte, readOnly bool) redis.Reply {
+	keys, argv, errReply := parseScriptKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	vm := luaVMPool.Get().(*luaVM)
+	defer luaVMPool.Put(vm)
+	L := vm.L
+	keyArgs := make([][]byte, len(keys))
+	for i, key := range keys {
+		keyArgs[i] = []byte(key)
+	}
+	vm.setGlobal("KEYS", makeLuaArray(L, keyArgs))
+	vm.setGlobal("ARGV", makeLuaArray(L, argv))
+	ctx := makeScriptContext(db, keys, readOnly)
+	return vm.pcall(ctx, L.NewFunctionFromProto(proto), "f_"+sha)
+}
+
+func execEvalGeneric(db *DB, args [][]byte, readOnly bool) redis.Reply {
+	sha, proto, errReply := scripts.load(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return evalScript(db, sha, proto, args[1:], readOnly)
+}
+
+func execEvalShaGeneric(db *DB, args [][]byte, readOnly bool) redis.Reply {
+	sha := strings.ToLower(string(args[0]))
+	proto := scripts.get(sha)
+	if proto == nil {
+		return protocol.MakeErrorReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return evalScript(db, sha, proto, args[1:], readOnly)
+}
+
+// execEval eval script numkeys [key ...] [arg ...]
+func execEval(db *DB, args [][]byte) redis.Reply {
+	return execEvalGeneric(db, args, false)
+}
+
+// execEvalSha evalsha sha1 numkeys [key ...] [arg ...]
+func execEvalSha(db *DB, args [][]byte) redis.Reply {
+	return execEvalShaGeneric(db, args, false)
+}
+
+// execEvalRO 只读脚本，可以在slave上执行
+func execEvalRO(db *DB, args [][]byte) redis.Reply {
+	return execEvalGeneric(db, args, true)
+}
+
+func execEvalShaRO(db *DB, args [][]byte) redis.Reply {
+	return execEvalShaGeneric(db, args, true)
+}
+
+// execScript script load|exists|flush|kill
+func execScript(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "kill":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrorReply("script|kill")
+		}
+		return running.kill(false)
+	case "load":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrorReply("script|load")
+		}
+		sha, _, errReply := scripts.load(string(args[1]))
+		if errReply != nil {
+			return errReply
+		}
+		return protocol.MakeBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return protocol.MakeArgNumErrorReply("script|exists")
+		}
+		replies := make([]redis.Reply, 0, len(args)-1)
+		for _, sha := range args[1:] {
+			exists := int64(0)
+			if scripts.get(string(sha)) != nil {
+				exists = 1
+			}
+			replies = append(replies, protocol.MakeIntReply(exists))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "flush":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrorReply("script|flush")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return protocol.MakeErrorReply("ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+			}
+		}
+		scripts.flush()
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrorReply("ERR unknown subcommand '" + subCmd + "'")
+}
+
+func init() {
+	RegisterCommand("Eval", execEval, prepareEval, undoEval, -3, flagWrite)
+	RegisterCommand("EvalSha", execEvalSha, prepareEval, undoEval, -3, flagWrite)
+	RegisterCommand("Eval_RO", execEvalRO, prepareEvalRO, nil, -3, flagReadOnly)
+	RegisterCommand("EvalSha_RO", execEvalShaRO, prepareEvalRO, nil, -3, flagReadOnly)
+	RegisterCommand("Script", execScript, noPrepare, nil, -2, flagReadOnly)
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"gmr/go-cache/config"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/protocol"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: script_test
+ * @Version: 1.0.0
+ * @Description: 脚本沙箱、BUSY以及SCRIPT KILL的测试
+ * @Date: 2026/10/18 3:20
+ */
+
+func evalOnVM(vm *luaVM, db *DB, body string, keys ...string) string {
+	proto, err := compileLua("user_script", body)
+	if err != nil {
+		return err.Error()
+	}
+	keyArgs := make([][]byte, len(keys))
+	for i, key := range keys {
+		keyArgs[i] = []byte(key)
+	}
+	vm.setGlobal("KEYS", makeLuaArray(vm.L, keyArgs))
+	vm.setGlobal("ARGV", makeLuaArray(vm.L, nil))
+	ctx := makeScriptContext(db, keys, false)
+	return string(vm.pcall(ctx, vm.L.NewFunctionFromProto(proto), "f_test").ToBytes())
+}
+
+func TestScriptSandbox(t *testing.T) {
+	db := makeDB()
+	vm := newLuaVM()
+	attacks := []string{
+		"setmetatable(_G, nil); leaked='yes'; redis.call=function() return 'hijacked' end",
+		"leaked = 'yes'",
+		"rawset(_G, 'leaked', 'yes')",
+		"redis.call = function() return 'hijacked' end",
+		"rawset(redis, 'call', function() return 'hijacked' end)",
+		"redis = {call = function() return 'hijacked' end}",
+		"string.rep = nil",
+		"getmetatable('').__index.rep = nil",
+		"setmetatable(redis, nil)",
+		"table.insert(_G, 'leaked')",
+		"setfenv(0, {leaked = 'yes'})",
+	}
+	for _, attack := range attacks {
+		if reply := evalOnVM(vm, db, attack); !strings.HasPrefix(reply, "-") {
+			t.Errorf("attack should fail: %s, reply: %q", attack, reply)
+		}
+		if reply := evalOnVM(vm, db, "return redis.call('set', KEYS[1], string.rep('v', 2))", "k"); reply != "+OK\r\n" {
+			t.Fatalf("vm is poisoned by %s, reply: %q", attack, reply)
+		}
+		if reply := evalOnVM(vm, db, "return leaked"); !strings.Contains(reply, "nonexistent global variable") {
+			t.Fatalf("global leaked by %s, reply: %q", attack, reply)
+		}
+	}
+	// 脚本自己创建的table不受影响
+	if reply := evalOnVM(vm, db, "local t = {}; rawset(t, 'a', 1); table.insert(t, 2); return t.a + t[1]"); reply != ":3\r\n" {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+}
+
+func TestScriptKill(t *testing.T) {
+	databases, limit, timeout := config.Properties.Databases, config.Properties.LuaTimeLimit, config.Properties.LuaTimeout
+	config.Properties.Databases = 1
+	config.Properties.LuaTimeLimit = 50
+	defer func() {
+		config.Properties.Databases = databases
+		config.Properties.LuaTimeLimit, config.Properties.LuaTimeout = limit, timeout
+	}()
+	mdb := MakeBasicMultiDB()
+	conn := connection.NewConnection(nil)
+
+	if reply := mdb.Exec(conn, utils.ToCmdLine("script", "kill")); !strings.HasPrefix(string(reply.ToBytes()), "-NOTBUSY") {
+		t.Fatalf("unexpected reply %q", reply.ToBytes())
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		result <- string(mdb.Exec(connection.NewConnection(nil), utils.ToCmdLine("eval", "while true do end", "0")).ToBytes())
+	}()
+	time.Sleep(150 * time.Millisecond)
+	if reply := mdb.Exec(conn, utils.ToCmdLine("get", "a")); !strings.HasPrefix(string(reply.ToBytes()), "-BUSY") {
+		t.Fatalf("expect BUSY, actual %q", reply.ToBytes())
+	}
+	if reply := mdb.Exec(conn, utils.ToCmdLine("script", "kill")); !protocol.IsOKReply(reply) {
+		t.Fatalf("unexpected reply %q", reply.ToBytes())
+	}
+	if reply := <-result; !strings.Contains(reply, "killed by user") {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	if reply := mdb.Exec(conn, utils.ToCmdLine("get", "a")); protocol.IsErrorReply(reply) {
+		t.Fatalf("unexpected reply %q", reply.ToBytes())
+	}
+
+	// 执行过写命令的脚本不能被kill，只能等待lua-timeout
+	config.Properties.LuaTimeout = 300
+	go func() {
+		result <- string(mdb.Exec(connection.NewConnection(nil), utils.ToCmdLine("eval", "redis.call('set', KEYS[1], '1') while true do end", "1", "a")).ToBytes())
+	}()
+	time.Sleep(150 * time.Millisecond)
+	if reply := mdb.Exec(conn, utils.ToCmdLine("script", "kill")); !strings.HasPrefix(string(reply.ToBytes()), "-UNKILLABLE") {
+		t.Fatalf("expect UNKILLABLE, actual %q", reply.ToBytes())
+	}
+	if reply := <-result; !strings.Contains(reply, "timed out") {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+}
+
+func TestLuaTimeoutDefault(t *testing.T) {
+	timeout := config.Properties.LuaTimeout
+	defer func() {
+		config.Properties.LuaTimeout = timeout
+	}()
+	// 未配置lua-timeout时也会强制停止，不可kill的脚本不会一直阻塞服务
+	config.Properties.LuaTimeout = 0
+	if luaTimeout() != defaultLuaTimeout {
+		t.Errorf("expect default timeout %v, actual: %v", defaultLuaTimeout, luaTimeout())
+	}
+	config.Properties.LuaTimeout = 300
+	if luaTimeout() != 300*time.Millisecond {
+		t.Errorf("expect 300ms, actual: %v", luaTimeout())
+	}
+}
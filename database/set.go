@@ -19,7 +19,7 @@ import (
 
 func (db *DB) getAsSet(key string) (*hashset.Set, protocol.ErrorReply) {
 	entity, exist := db.GetEntity(key)
-	if exist {
+	if !exist {
 		return nil, nil
 	}
 	set, ok := entity.Data.(*hashset.Set)
@@ -60,6 +60,7 @@ func execSAdd(db *DB, args [][]byte) redis.Reply {
 		counter += set.Add(string(member))
 	}
 	db.addAof(utils.ToCmdLineByByte("sadd", args...))
+	db.notify(notifySet, "sadd", key)
 	return protocol.MakeIntReply(int64(counter))
 }
 
@@ -102,12 +103,14 @@ func execSRem(db *DB, args [][]byte) redis.Reply {
 		counter += set.Remove(string(member))
 	}
 
-	if set.Len() == 0 {
-		db.Remove(key)
-	}
-
 	if counter > 0 {
 		db.addAof(utils.ToCmdLineByByte("srem", args...))
+		db.notify(notifySet, "srem", key)
+	}
+
+	if set.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 
 	return protocol.MakeIntReply(int64(counter))
@@ -151,6 +154,11 @@ func execSPop(db *DB, args [][]byte) redis.Reply {
 
 	if count > 0 {
 		db.addAof(utils.ToCmdLineByByte("spop", args...))
+		db.notify(notifySet, "spop", key)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 	return protocol.MakeMultiBulkReply(result)
 }
@@ -263,6 +271,7 @@ func execSInterStore(db *DB, args [][]byte) redis.Reply {
 		Data: set,
 	})
 	db.addAof(utils.ToCmdLineByByte("sinterstore", args...))
+	db.notify(notifySet, "sinterstore", dest)
 	return protocol.MakeIntReply(int64(set.Len()))
 }
 
@@ -340,6 +349,7 @@ func execSUnionStore(db *DB, args [][]byte) redis.Reply {
 		Data: set,
 	})
 	db.addAof(utils.ToCmdLineByByte("sunionstore", args...))
+	db.notify(notifySet, "sunionstore", dest)
 	return protocol.MakeIntReply(int64(set.Len()))
 }
 
@@ -431,6 +441,7 @@ func execSDiffStore(db *DB, args [][]byte) redis.Reply {
 		Data: set,
 	})
 	db.addAof(utils.ToCmdLineByByte("sdiffstore", args...))
+	db.notify(notifySet, "sdiffstore", dest)
 	return protocol.MakeIntReply(int64(set.Len()))
 }
 
@@ -477,6 +488,29 @@ func execSRandMember(db *DB, args [][]byte) redis.Reply {
 	return &protocol.EmptyMultiBulkReply{}
 }
 
+// execSScan sscan key cursor [MATCH pattern] [COUNT count]
+func execSScan(db *DB, args [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	set, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return makeScanReply(0, [][]byte{})
+	}
+	members, cursor := set.Scan(sa.cursor, sa.count)
+	result := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if sa.match(member) {
+			result = append(result, []byte(member))
+		}
+	}
+	return makeScanReply(cursor, result)
+}
+
 func init() {
 	RegisterCommand("SAdd", execSAdd, writeFirstKey, undoSetChange, -3, flagWrite)
 	RegisterCommand("SIsMember", execSIsMember, readFirstKey, nil, 3, flagReadOnly)
@@ -491,4 +525,5 @@ func init() {
 	RegisterCommand("SDiff", execSDiff, prepareSetCalculate, nil, -2, flagReadOnly)
 	RegisterCommand("SDiffStore", execSDiffStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite)
 	RegisterCommand("SRandMember", execSRandMember, readFirstKey, nil, -2, flagReadOnly)
+	RegisterCommand("SScan", execSScan, readFirstKey, nil, -3, flagReadOnly)
 }
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: set_test
+ * @Version: 1.0.0
+ * @Description: set命令读取已存在key的测试
+ * @Date: 2026/10/18 3:00
+ */
+
+func TestSetExistingKey(t *testing.T) {
+	db := makeDB()
+	execSAdd(db, utils.ToCmdLine("s", "a", "b"))
+	// 第二次SADD需要读取已经存在的set
+	result := execSAdd(db, utils.ToCmdLine("s", "b", "c"))
+	if intReply, ok := result.(*protocol.IntReply); !ok || intReply.Code != 1 {
+		t.Errorf("expect 1 added member, actual: %s", string(result.ToBytes()))
+	}
+	result = execSCard(db, utils.ToCmdLine("s"))
+	if intReply, ok := result.(*protocol.IntReply); !ok || intReply.Code != 3 {
+		t.Errorf("expect 3 members, actual: %s", string(result.ToBytes()))
+	}
+	result = execSIsMember(db, utils.ToCmdLine("s", "c"))
+	if intReply, ok := result.(*protocol.IntReply); !ok || intReply.Code != 1 {
+		t.Errorf("expect c to be a member, actual: %s", string(result.ToBytes()))
+	}
+	result = execSCard(db, utils.ToCmdLine("none"))
+	if intReply, ok := result.(*protocol.IntReply); !ok || intReply.Code != 0 {
+		t.Errorf("expect 0 members, actual: %s", string(result.ToBytes()))
+	}
+}
@@ -1,13 +1,17 @@
 package database
 
 import (
+	"gmr/go-cache/config"
 	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/lockmap"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/interface/redis"
-	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/timewheel"
+	"gmr/go-cache/lib/utils"
 	"gmr/go-cache/redis/protocol"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,7 +43,9 @@ type UndoFunc func(db *DB, args [][]byte) []CmdLine
 
 // DB 单个DB实例
 type DB struct {
-	index int
+	// usedMemory 估算的内存占用，需要原子访问
+	usedMemory int64
+	index      int
 	// key:DataEntity
 	data dict.Dict
 	// key:expireTime
@@ -50,27 +56,45 @@ type DB struct {
 	// mutex执行复杂命令
 	locker *lockmap.Locks
 	addAof func(CmdLine)
+	// afterExpire key因为过期被删除之后调用
+	afterExpire func(key string)
+	// notifyEvent 发布keyspace notifications
+	notifyEvent func(dbIndex int, class int, event string, key string)
+	// quietKeys 迁移写入期间不发布事件的key
+	quietKeys sync.Map
+	// blocking 阻塞列表命令的等待队列
+	blocking *blockingKeys
+	// functions 由MultiDB设置，同一个MultiDB中的db共享
+	functions *functionRegistry
 }
 
 // 返回DB实例
 func makeDB() *DB {
 	return &DB{
-		data:       dict.MakeConcurrentDict(dataDictSize),
-		ttlMap:     dict.MakeConcurrentDict(ttlDictSize),
-		versionMap: dict.MakeConcurrentDict(dataDictSize),
-		locker:     lockmap.MakeLocks(lockerSize),
-		addAof:     func(line CmdLine) {},
+		data:        dict.MakeConcurrentDict(dataDictSize),
+		ttlMap:      dict.MakeConcurrentDict(ttlDictSize),
+		versionMap:  dict.MakeConcurrentDict(dataDictSize),
+		locker:      lockmap.MakeLocks(lockerSize),
+		addAof:      func(line CmdLine) {},
+		afterExpire: func(key string) {},
+		notifyEvent: func(dbIndex int, class int, event string, key string) {},
+		blocking:    makeBlockingKeys(),
+		functions:   makeFunctionRegistry(),
 	}
 }
 
 // 返回基本DB实例，只有基础功能，不是并发安全的
 func makeBasicDB() *DB {
 	return &DB{
-		data:       dict.MakeSimpleDict(),
-		ttlMap:     dict.MakeSimpleDict(),
-		versionMap: dict.MakeSimpleDict(),
-		locker:     lockmap.MakeLocks(1),
-		addAof:     func(line CmdLine) {},
+		data:        dict.MakeSimpleDict(),
+		ttlMap:      dict.MakeSimpleDict(),
+		versionMap:  dict.MakeSimpleDict(),
+		locker:      lockmap.MakeLocks(1),
+		addAof:      func(line CmdLine) {},
+		afterExpire: func(key string) {},
+		notifyEvent: func(dbIndex int, class int, event string, key string) {},
+		blocking:    makeBlockingKeys(),
+		functions:   makeFunctionRegistry(),
 	}
 }
 
@@ -79,17 +103,17 @@ func (db *DB) Exec(conn redis.Connection, cmdLine [][]byte) redis.Reply {
 
 	switch cmdName {
 	case "multi":
-		if len(cmdName) != 1 {
+		if len(cmdLine) != 1 {
 			return protocol.MakeArgNumErrorReply(cmdName)
 		}
 		return StartMulti(conn)
 	case "discard":
-		if len(cmdName) != 1 {
+		if len(cmdLine) != 1 {
 			return protocol.MakeArgNumErrorReply(cmdName)
 		}
 		return DiscardMulti(conn)
 	case "exec":
-		if len(cmdName) != 1 {
+		if len(cmdLine) != 1 {
 			return protocol.MakeArgNumErrorReply(cmdName)
 		}
 		return execMulti(db, conn)
@@ -100,9 +124,12 @@ func (db *DB) Exec(conn redis.Connection, cmdLine [][]byte) redis.Reply {
 		return Watch(db, conn, cmdLine[1:])
 	}
 
+	if IsInternalCommand(cmdName) && !isInternalConn(conn) {
+		return protocol.MakeErrorReply("ERR unknown command '" + cmdName + "'")
+	}
+
 	if conn != nil && conn.InMultiState() {
-		EnqueueCmd(conn, cmdLine)
-		return protocol.MakeQueuedReply()
+		return EnqueueCmd(conn, cmdLine)
 	}
 
 	return db.execNormalCommand(cmdLine)
@@ -126,7 +153,10 @@ func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 	db.RWLocks(write, read)
 	defer db.RWUnLocks(write, read)
 	function := cmd.executor
-	return function(db, cmdLine[1:])
+	result := function(db, cmdLine[1:])
+	db.updateSizes(write)
+	db.blocking.signal(write)
+	return result
 }
 
 func (db *DB) execWithLock(cmdLine [][]byte) redis.Reply {
@@ -139,7 +169,11 @@ func (db *DB) execWithLock(cmdLine [][]byte) redis.Reply {
 		return protocol.MakeArgNumErrorReply(cmdName)
 	}
 	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	result := fun(db, cmdLine[1:])
+	write, _ := cmd.prepare(cmdLine[1:])
+	db.updateSizes(write)
+	db.blocking.signal(write)
+	return result
 }
 
 func validateArity(arity int, cmdArgs [][]byte) bool {
@@ -161,26 +195,48 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 	}
 
 	entity, _ := raw.(*database.DataEntity)
+	touchEntity(entity)
 	return entity, true
 }
 
 func (db *DB) PutEntity(key string, value *database.DataEntity) int {
+	if raw, exists := db.data.Get(key); exists {
+		db.untrackEntity(raw)
+	} else {
+		db.notify(notifyNew, "new", key)
+	}
+	db.trackEntity(key, value)
 	return db.data.Put(key, value)
 }
 
 func (db *DB) PutIfExist(key string, value *database.DataEntity) int {
+	raw, exists := db.data.Get(key)
+	if !exists {
+		return 0
+	}
+	db.untrackEntity(raw)
+	db.trackEntity(key, value)
 	return db.data.PutIfExist(key, value)
 }
 
 func (db *DB) PutIfAbsent(key string, value *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, value)
+	result := db.data.PutIfAbsent(key, value)
+	if result > 0 {
+		db.trackEntity(key, value)
+		db.notify(notifyNew, "new", key)
+	}
+	return result
 }
 
 func (db *DB) Remove(key string) {
+	if raw, exists := db.data.Get(key); exists {
+		db.untrackEntity(raw)
+	}
 	db.data.Remove(key)
 	db.ttlMap.Remove(key)
-	expiredTask := genExpireTask(key)
-	timewheel.Cancel(expiredTask)
+	if config.Properties.ExpireTimeWheel {
+		timewheel.Cancel(genExpireTask(key))
+	}
 }
 
 func (db *DB) Removes(keys ...string) int {
@@ -197,6 +253,7 @@ func (db *DB) Removes(keys ...string) int {
 func (db *DB) FlushAll() {
 	db.data.Clear()
 	db.ttlMap.Clear()
+	atomic.StoreInt64(&db.usedMemory, 0)
 	db.locker = lockmap.MakeLocks(lockerSize)
 }
 
@@ -212,33 +269,27 @@ func genExpireTask(key string) string {
 	return "expired" + key
 }
 
+// Expire 设置过期时间，过期的key由IsExpired惰性删除或者由主动过期删除，
+// 开启expire-timewheel时还会为每个key在时间轮上添加定时删除任务
 func (db *DB) Expire(key string, expire time.Time) {
 	db.ttlMap.Put(key, expire)
-	taskKey := genExpireTask(key)
-	timewheel.At(expire, taskKey, func() {
-		keys := []string{key}
-		db.RWLocks(keys, nil)
-		defer db.RWUnLocks(keys, nil)
+	if !config.Properties.ExpireTimeWheel {
+		return
+	}
+	timewheel.At(expire, genExpireTask(key), func() {
 		// check-lock-check, ttl may be updated during waiting lock
-		logger.Info("expire " + key)
-		rawExpireTime, ok := db.ttlMap.Get(key)
-		if !ok {
-			return
-		}
-		expireTime, _ := rawExpireTime.(time.Time)
-		expired := time.Now().After(expireTime)
-		if expired {
-			db.Remove(key)
-		}
+		db.expireIfNeeded(key)
 	})
 }
 
 func (db *DB) Persist(key string) {
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
-	timewheel.Cancel(taskKey)
+	if config.Properties.ExpireTimeWheel {
+		timewheel.Cancel(genExpireTask(key))
+	}
 }
 
+// IsExpired 检查key是否过期，过期则删除并将DEL写入aof，replica和aof重放时也会删除这个key
 func (db *DB) IsExpired(key string) bool {
 	rawExpired, ok := db.ttlMap.Get(key)
 	if !ok {
@@ -248,6 +299,9 @@ func (db *DB) IsExpired(key string) bool {
 	expire := time.Now().After(expireTime)
 	if expire {
 		db.Remove(key)
+		db.addAof(utils.ToCmdLine("DEL", key))
+		db.afterExpire(key)
+		db.notify(notifyExpired, "expired", key)
 	}
 	return expire
 }
@@ -270,11 +324,12 @@ func (db *DB) addVersion(keys ...string) {
 func (db *DB) ForEach(cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
 	db.data.ForEach(func(key string, val interface{}) bool {
 		entity, _ := val.(*database.DataEntity)
-		var expiration time.Time
+		var expiration *time.Time
 		rawExpired, ok := db.ttlMap.Get(key)
 		if ok {
-			expiration, _ = rawExpired.(time.Time)
+			expireTime, _ := rawExpired.(time.Time)
+			expiration = &expireTime
 		}
-		return cb(key, entity, &expiration)
+		return cb(key, entity, expiration)
 	})
 }
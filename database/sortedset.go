@@ -1,11 +1,14 @@
 package database
 
 import (
+	hashset "gmr/go-cache/datastruct/set"
 	"gmr/go-cache/datastruct/sortedset"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/interface/redis"
 	"gmr/go-cache/lib/utils"
 	"gmr/go-cache/redis/protocol"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -81,6 +84,7 @@ func execZAdd(db *DB, args [][]byte) redis.Reply {
 	}
 
 	db.addAof(utils.ToCmdLineByByte("zadd", args...))
+	db.notify(notifyZSet, "zadd", key)
 	return protocol.MakeIntReply(int64(i))
 }
 
@@ -173,69 +177,138 @@ func execZCard(db *DB, args [][]byte) redis.Reply {
 	return protocol.MakeIntReply(sortedSet.Len())
 }
 
-func execZRange(db *DB, args [][]byte) redis.Reply {
-	if len(args) != 3 && len(args) != 4 {
-		return protocol.MakeErrorReply("ERR wrong number of arguments for 'zrange' command")
-	}
-	withScores := false
-	if len(args) == 4 {
-		if strings.ToUpper(string(args[3])) != "WITHSCORES" {
-			return protocol.MakeErrorReply("syntax error")
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec ZRANGE以及ZRANGEBYSCORE、ZRANGEBYLEX等命令统一解析后的参数，
+// rev为true时start为范围的最大值，stop为最小值
+type zrangeSpec struct {
+	by         int
+	rev        bool
+	offset     int64
+	limit      int64
+	withScores bool
+	hasLimit   bool
+
+	start    int64
+	stop     int64
+	minScore *sortedset.ScoreBorder
+	maxScore *sortedset.ScoreBorder
+	minLex   *sortedset.LexBorder
+	maxLex   *sortedset.LexBorder
+}
+
+// parseZRangeArgs 解析start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]，
+// spec中by和rev为命令的默认值，unified为false时不接受BYSCORE、BYLEX和REV
+func parseZRangeArgs(args [][]byte, spec *zrangeSpec, unified bool, allowWithScores bool) protocol.ErrorReply {
+	spec.limit = -1
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHSCORES":
+			if !allowWithScores {
+				return protocol.MakeSyntaxErrorReply()
+			}
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return protocol.MakeSyntaxErrorReply()
+			}
+			var err error
+			spec.offset, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			spec.limit, err = strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			spec.hasLimit = true
+			i += 2
+		case "BYSCORE":
+			if !unified {
+				return protocol.MakeSyntaxErrorReply()
+			}
+			spec.by = zrangeByScore
+		case "BYLEX":
+			if !unified {
+				return protocol.MakeSyntaxErrorReply()
+			}
+			spec.by = zrangeByLex
+		case "REV":
+			if !unified {
+				return protocol.MakeSyntaxErrorReply()
+			}
+			spec.rev = true
+		default:
+			return protocol.MakeSyntaxErrorReply()
 		}
-		withScores = true
 	}
-	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	if spec.hasLimit && spec.by == zrangeByRank {
+		return protocol.MakeErrorReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
 	}
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	if spec.withScores && spec.by == zrangeByLex {
+		return protocol.MakeErrorReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
 	}
-	return range0(db, key, start, stop, withScores, false)
-}
 
-func execZRevRange(db *DB, args [][]byte) redis.Reply {
-	if len(args) != 3 && len(args) != 4 {
-		return protocol.MakeErrorReply("ERR wrong number of arguments for 'zrevrange' command")
+	first, second := string(args[0]), string(args[1])
+	if spec.rev && spec.by != zrangeByRank {
+		first, second = second, first
 	}
-	withScores := false
-	if len(args) == 4 {
-		if string(args[3]) != "WITHSCORES" {
-			return protocol.MakeErrorReply("syntax error")
+	var err error
+	switch spec.by {
+	case zrangeByRank:
+		spec.start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+		}
+		spec.stop, err = strconv.ParseInt(second, 10, 64)
+		if err != nil {
+			return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+		}
+	case zrangeByScore:
+		if spec.minScore, err = sortedset.ParseScoreBorder(first); err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+		if spec.maxScore, err = sortedset.ParseScoreBorder(second); err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+	case zrangeByLex:
+		if spec.minLex, err = sortedset.ParseLexBorder(first); err != nil {
+			return protocol.MakeErrorReply(err.Error())
+		}
+		if spec.maxLex, err = sortedset.ParseLexBorder(second); err != nil {
+			return protocol.MakeErrorReply(err.Error())
 		}
-		withScores = true
-	}
-	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
-	}
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
-	if err != nil {
-		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
 	}
-	return range0(db, key, start, stop, withScores, true)
+	return nil
 }
 
-func range0(db *DB, key string, start int64, stop int64, withScores bool, desc bool) redis.Reply {
-	sortedSet, errReply := db.getAsSortedSet(key)
-	if errReply != nil {
-		return errReply
+// zrange 返回sortedSet中符合spec的元素
+func zrange(sortedSet *sortedset.SortedSet, spec *zrangeSpec) []*sortedset.Element {
+	switch spec.by {
+	case zrangeByScore:
+		return sortedSet.RangeByScore(spec.minScore, spec.maxScore, spec.offset, spec.limit, spec.rev)
+	case zrangeByLex:
+		return sortedSet.RangeByLex(spec.minLex, spec.maxLex, spec.offset, spec.limit, spec.rev)
 	}
-
-	if sortedSet == nil {
-		return &protocol.EmptyMultiBulkReply{}
+	start, stop, ok := normalizeRankRange(spec.start, spec.stop, sortedSet.Len())
+	if !ok {
+		return nil
 	}
+	return sortedSet.Range(start, stop, spec.rev)
+}
 
-	size := sortedSet.Len()
+// normalizeRankRange 将可以为负数的闭区间[start, stop]转换为左闭右开区间，范围为空时返回false
+func normalizeRankRange(start int64, stop int64, size int64) (int64, int64, bool) {
 	if start < -1*size {
 		start = 0
 	} else if start < 0 {
 		start = size + start
 	} else if start >= size {
-		return &protocol.EmptyMultiBulkReply{}
+		return 0, 0, false
 	}
 
 	if stop < -1*size {
@@ -250,28 +323,109 @@ func range0(db *DB, key string, start int64, stop int64, withScores bool, desc b
 	if stop < start {
 		stop = start
 	}
+	return start, stop, true
+}
 
-	slice := sortedSet.Range(start, stop, desc)
+func makeElementsReply(elements []*sortedset.Element, withScores bool) redis.Reply {
+	size := len(elements)
 	if withScores {
-		result := make([][]byte, len(slice)*2)
-		i := 0
-		for _, element := range slice {
-			result[i] = []byte(element.Member)
-			i++
-			scoreStr := strconv.FormatFloat(element.Score, 'f', -1, 64)
-			result[i] = []byte(scoreStr)
-			i++
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(strconv.FormatFloat(element.Score, 'f', -1, 64)))
 		}
-		return protocol.MakeMultiBulkReply(result)
 	}
+	return protocol.MakeMultiBulkReply(result)
+}
 
-	result := make([][]byte, len(slice))
-	i := 0
-	for _, element := range slice {
-		result[i] = []byte(element.Member)
-		i++
+// execZRangeGeneric 各种ZRANGE命令的公共实现，args[0]为key
+func execZRangeGeneric(db *DB, args [][]byte, spec *zrangeSpec, unified bool) redis.Reply {
+	if errReply := parseZRangeArgs(args[1:], spec, unified, true); errReply != nil {
+		return errReply
 	}
-	return protocol.MakeMultiBulkReply(result)
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &protocol.EmptyMultiBulkReply{}
+	}
+	return makeElementsReply(zrange(sortedSet, spec), spec.withScores)
+}
+
+// execZRange zrange key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zrangeSpec{}, true)
+}
+
+func execZRevRange(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zrangeSpec{rev: true}, false)
+}
+
+func execZRangeByScore(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zrangeSpec{by: zrangeByScore}, false)
+}
+
+// execZRevRangeByScore zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zrangeSpec{by: zrangeByScore, rev: true}, false)
+}
+
+// execZRangeByLex zrangebylex key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zrangeSpec{by: zrangeByLex}, false)
+}
+
+// execZRevRangeByLex zrevrangebylex key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) redis.Reply {
+	return execZRangeGeneric(db, args, &zrangeSpec{by: zrangeByLex, rev: true}, false)
+}
+
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// execZRangeStore zrangestore dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) redis.Reply {
+	spec := &zrangeSpec{}
+	if errReply := parseZRangeArgs(args[2:], spec, true, false); errReply != nil {
+		return errReply
+	}
+	dest := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	var elements []*sortedset.Element
+	if sortedSet != nil {
+		elements = zrange(sortedSet, spec)
+	}
+	size := db.storeElements(dest, elements, "zrangestore")
+	db.addAof(utils.ToCmdLineByByte("zrangestore", args...))
+	return protocol.MakeIntReply(size)
+}
+
+// storeElements 使用elements替换dest，elements为空时删除dest，返回dest中元素的数量
+func (db *DB) storeElements(dest string, elements []*sortedset.Element, event string) int64 {
+	if len(elements) == 0 {
+		if _, exists := db.GetEntity(dest); exists {
+			db.Remove(dest)
+			db.notify(notifyGeneric, "del", dest)
+		}
+		return 0
+	}
+	sortedSet := sortedset.MakeSortedSet()
+	for _, element := range elements {
+		sortedSet.Add(element.Member, element.Score)
+	}
+	db.PutEntity(dest, &database.DataEntity{
+		Data: sortedSet,
+	})
+	db.notify(notifyZSet, event, dest)
+	return sortedSet.Len()
 }
 
 func execZCount(db *DB, args [][]byte) redis.Reply {
@@ -299,132 +453,374 @@ func execZCount(db *DB, args [][]byte) redis.Reply {
 	return protocol.MakeIntReply(sortedSet.Count(min, max))
 }
 
-func rangeByScore0(db *DB, key string, min *sortedset.ScoreBorder, max *sortedset.ScoreBorder, offset int64, limit int64, withScores bool, desc bool) redis.Reply {
-	sortedSet, errReply := db.getAsSortedSet(key)
+// execZLexCount zlexcount key min max
+func execZLexCount(db *DB, args [][]byte) redis.Reply {
+	min, err := sortedset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return protocol.MakeErrorReply(err.Error())
+	}
+	max, err := sortedset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return protocol.MakeErrorReply(err.Error())
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
 	if errReply != nil {
 		return errReply
 	}
-
 	if sortedSet == nil {
-		return &protocol.EmptyMultiBulkReply{}
+		return protocol.MakeIntReply(0)
 	}
+	return protocol.MakeIntReply(sortedSet.LexCount(min, max))
+}
 
-	slice := sortedSet.RangeByScore(min, max, offset, limit, desc)
-	if withScores {
-		result := make([][]byte, len(slice)*2)
-		i := 0
-
-		for _, element := range slice {
-			result[i] = []byte(element.Member)
-			i++
-			scoreStr := strconv.FormatFloat(element.Score, 'f', -1, 64)
-			result[i] = []byte(scoreStr)
-			i++
-		}
-		return protocol.MakeMultiBulkReply(result)
+// execZRemRangeByLex zremrangebylex key min max
+func execZRemRangeByLex(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	min, err := sortedset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return protocol.MakeErrorReply(err.Error())
+	}
+	max, err := sortedset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return protocol.MakeErrorReply(err.Error())
+	}
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return protocol.MakeIntReply(0)
 	}
 
-	result := make([][]byte, len(slice)*2)
-	i := 0
-
-	for _, element := range slice {
-		result[i] = []byte(element.Member)
-		i++
+	removed := sortedSet.RemoveByLex(min, max)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLineByByte("zremrangebylex", args...))
+		db.notify(notifyZSet, "zremrangebylex", key)
 	}
-	return protocol.MakeMultiBulkReply(result)
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return protocol.MakeIntReply(removed)
 }
 
-func execZRangeByScore(db *DB, args [][]byte) redis.Reply {
-	if len(args) < 3 {
-		return protocol.MakeErrorReply("ERR wrong number of arguments for 'zrangebyscore' command")
+// execZPopGeneric zpopmin/zpopmax key [count]
+func execZPopGeneric(db *DB, args [][]byte, max bool) redis.Reply {
+	if len(args) > 2 {
+		return protocol.MakeSyntaxErrorReply()
 	}
 	key := string(args[0])
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return protocol.MakeErrorReply("ERR value is out of range, must be positive")
+		}
+	}
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil || count == 0 {
+		return &protocol.EmptyMultiBulkReply{}
+	}
 
-	min, err := sortedset.ParseScoreBorder(string(args[1]))
-	if err != nil {
-		return protocol.MakeErrorReply(err.Error())
+	var elements []*sortedset.Element
+	cmdName := "zpopmin"
+	if max {
+		elements = sortedSet.PopMax(count)
+		cmdName = "zpopmax"
+	} else {
+		elements = sortedSet.PopMin(count)
 	}
+	db.addAof(utils.ToCmdLine(cmdName, key, strconv.Itoa(len(elements))))
+	db.notify(notifyZSet, cmdName, key)
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return makeElementsReply(elements, true)
+}
 
-	max, err := sortedset.ParseScoreBorder(string(args[2]))
+func execZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execZPopGeneric(db, args, false)
+}
+
+func execZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execZPopGeneric(db, args, true)
+}
+
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// zsetOperation ZUNION、ZINTER、ZDIFF以及对应STORE命令的参数
+type zsetOperation struct {
+	keys       []string
+	weights    []float64
+	aggregate  int
+	withScores bool
+}
+
+// parseZSetOperation 解析numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]，
+// ZDIFF不接受WEIGHTS和AGGREGATE，STORE命令不接受WITHSCORES
+func parseZSetOperation(cmdName string, args [][]byte, allowWeights bool, allowWithScores bool) (*zsetOperation, protocol.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
 	if err != nil {
-		return protocol.MakeErrorReply(err.Error())
+		return nil, protocol.MakeErrorReply("ERR value is not an integer or out of range")
 	}
-
-	withScores := false
-	var offset int64 = 0
-	var limit int64 = -1
-	if len(args) > 3 {
-		for i := 3; i < len(args); {
-			s := string(args[i])
-			if strings.ToUpper(s) == "WITHSCORES" {
-				withScores = true
-				i++
-			} else if strings.ToUpper(s) == "LIMIT" {
-				if len(args) < i+3 {
-					return protocol.MakeErrorReply("ERR syntax error")
-				}
-				offset, err = strconv.ParseInt(string(args[i+1]), 10, 64)
-				if err != nil {
-					return protocol.MakeErrorReply("ERR value is not an integer or out of range")
-				}
-				limit, err = strconv.ParseInt(string(args[i+2]), 10, 64)
+	if numKeys < 1 {
+		return nil, protocol.MakeErrorReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if numKeys > len(args)-1 {
+		return nil, protocol.MakeSyntaxErrorReply()
+	}
+	op := &zsetOperation{
+		keys:    make([]string, numKeys),
+		weights: make([]float64, numKeys),
+	}
+	for i := 0; i < numKeys; i++ {
+		op.keys[i] = string(args[i+1])
+		op.weights[i] = 1
+	}
+	for i := numKeys + 1; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WEIGHTS":
+			if !allowWeights || i+numKeys >= len(args) {
+				return nil, protocol.MakeSyntaxErrorReply()
+			}
+			for j := 0; j < numKeys; j++ {
+				op.weights[j], err = strconv.ParseFloat(string(args[i+1+j]), 64)
 				if err != nil {
-					return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+					return nil, protocol.MakeErrorReply("ERR weight value is not a float")
 				}
-				i += 3
-			} else {
-				return protocol.MakeErrorReply("ERR syntax error")
 			}
+			i += numKeys
+		case "AGGREGATE":
+			if !allowWeights || i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrorReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "SUM":
+				op.aggregate = aggregateSum
+			case "MIN":
+				op.aggregate = aggregateMin
+			case "MAX":
+				op.aggregate = aggregateMax
+			default:
+				return nil, protocol.MakeSyntaxErrorReply()
+			}
+			i++
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, protocol.MakeSyntaxErrorReply()
+			}
+			op.withScores = true
+		default:
+			return nil, protocol.MakeSyntaxErrorReply()
 		}
 	}
-	return rangeByScore0(db, key, min, max, offset, limit, withScores, false)
+	return op, nil
 }
 
-func execZRevRangeByScore(db *DB, args [][]byte) redis.Reply {
-	if len(args) < 3 {
-		return protocol.MakeErrorReply("ERR wrong number of arguments for 'zrangebyscore' command")
+// prepareZSetOperation numkeys key [key ...]
+func prepareZSetOperation(args [][]byte) ([]string, []string) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys < 0 || numKeys > len(args)-1 {
+		return nil, nil
 	}
-	key := string(args[0])
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return nil, keys
+}
 
-	min, err := sortedset.ParseScoreBorder(string(args[2]))
-	if err != nil {
-		return protocol.MakeErrorReply(err.Error())
+// prepareZSetOperationStore destination numkeys key [key ...]
+func prepareZSetOperationStore(args [][]byte) ([]string, []string) {
+	_, keys := prepareZSetOperation(args[1:])
+	return []string{string(args[0])}, keys
+}
+
+// getZSetOperand 集合运算的输入可以是zset或者set，set中元素的score为1，key不存在时返回nil
+func (db *DB) getZSetOperand(key string) (map[string]float64, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	switch val := entity.Data.(type) {
+	case *sortedset.SortedSet:
+		scores := make(map[string]float64, val.Len())
+		if val.Len() > 0 {
+			val.ForEach(0, val.Len(), false, func(element *sortedset.Element) bool {
+				scores[element.Member] = element.Score
+				return true
+			})
+		}
+		return scores, nil
+	case *hashset.Set:
+		scores := make(map[string]float64, val.Len())
+		val.ForEach(func(member string) bool {
+			scores[member] = 1
+			return true
+		})
+		return scores, nil
 	}
+	return nil, &protocol.WrongTypeErrorReply{}
+}
 
-	max, err := sortedset.ParseScoreBorder(string(args[1]))
-	if err != nil {
-		return protocol.MakeErrorReply(err.Error())
+// weightedScore inf*0的结果为NaN，与redis相同按照0处理
+func weightedScore(score float64, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0
 	}
+	return result
+}
 
-	withScores := false
-	var offset int64 = 0
-	var limit int64 = -1
-	if len(args) > 3 {
-		for i := 3; i < len(args); {
-			s := string(args[i])
-			if strings.ToUpper(s) == "WITHSCORES" {
-				withScores = true
-				i++
-			} else if strings.ToUpper(s) == "LIMIT" {
-				if len(args) < i+3 {
-					return protocol.MakeErrorReply("ERR syntax error")
+func (op *zsetOperation) aggregateScore(a float64, b float64) float64 {
+	switch op.aggregate {
+	case aggregateMin:
+		return math.Min(a, b)
+	case aggregateMax:
+		return math.Max(a, b)
+	}
+	// +inf与-inf相加的结果为NaN
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// compute 计算集合运算的结果，按照score和member排序
+func (op *zsetOperation) compute(db *DB, kind string) ([]*sortedset.Element, protocol.ErrorReply) {
+	operands := make([]map[string]float64, len(op.keys))
+	for i, key := range op.keys {
+		operand, errReply := db.getZSetOperand(key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		operands[i] = operand
+	}
+
+	result := make(map[string]float64)
+	switch kind {
+	case "union":
+		for i, operand := range operands {
+			for member, score := range operand {
+				score = weightedScore(score, op.weights[i])
+				if existing, ok := result[member]; ok {
+					score = op.aggregateScore(existing, score)
 				}
-				offset, err = strconv.ParseInt(string(args[i+1]), 10, 64)
-				if err != nil {
-					return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+				result[member] = score
+			}
+		}
+	case "inter":
+		for member, score := range operands[0] {
+			score = weightedScore(score, op.weights[0])
+			inAll := true
+			for i := 1; i < len(operands); i++ {
+				other, ok := operands[i][member]
+				if !ok {
+					inAll = false
+					break
 				}
-				limit, err = strconv.ParseInt(string(args[i+2]), 10, 64)
-				if err != nil {
-					return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+				score = op.aggregateScore(score, weightedScore(other, op.weights[i]))
+			}
+			if inAll {
+				result[member] = score
+			}
+		}
+	case "diff":
+		for member, score := range operands[0] {
+			found := false
+			for i := 1; i < len(operands); i++ {
+				if _, ok := operands[i][member]; ok {
+					found = true
+					break
 				}
-				i += 3
-			} else {
-				return protocol.MakeErrorReply("ERR syntax error")
+			}
+			if !found {
+				result[member] = score
 			}
 		}
 	}
-	return rangeByScore0(db, key, min, max, offset, limit, withScores, true)
+
+	elements := make([]*sortedset.Element, 0, len(result))
+	for member, score := range result {
+		elements = append(elements, &sortedset.Element{
+			Member: member,
+			Score:  score,
+		})
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].Score != elements[j].Score {
+			return elements[i].Score < elements[j].Score
+		}
+		return elements[i].Member < elements[j].Member
+	})
+	return elements, nil
+}
+
+// execZSetOperation zunion/zinter/zdiff numkeys key [key ...] ... [WITHSCORES]
+func execZSetOperation(db *DB, args [][]byte, kind string) redis.Reply {
+	op, errReply := parseZSetOperation("z"+kind, args, kind != "diff", true)
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := op.compute(db, kind)
+	if errReply != nil {
+		return errReply
+	}
+	return makeElementsReply(elements, op.withScores)
+}
+
+// execZSetOperationStore zunionstore/zinterstore/zdiffstore destination numkeys key [key ...] ...
+func execZSetOperationStore(db *DB, args [][]byte, kind string) redis.Reply {
+	cmdName := "z" + kind + "store"
+	op, errReply := parseZSetOperation(cmdName, args[1:], kind != "diff", false)
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := op.compute(db, kind)
+	if errReply != nil {
+		return errReply
+	}
+	size := db.storeElements(string(args[0]), elements, cmdName)
+	db.addAof(utils.ToCmdLineByByte(cmdName, args...))
+	return protocol.MakeIntReply(size)
+}
+
+func execZUnion(db *DB, args [][]byte) redis.Reply {
+	return execZSetOperation(db, args, "union")
+}
+
+func execZInter(db *DB, args [][]byte) redis.Reply {
+	return execZSetOperation(db, args, "inter")
+}
+
+func execZDiff(db *DB, args [][]byte) redis.Reply {
+	return execZSetOperation(db, args, "diff")
+}
+
+// execZUnionStore zunionstore destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func execZUnionStore(db *DB, args [][]byte) redis.Reply {
+	return execZSetOperationStore(db, args, "union")
+}
+
+// execZInterStore zinterstore destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func execZInterStore(db *DB, args [][]byte) redis.Reply {
+	return execZSetOperationStore(db, args, "inter")
+}
+
+// execZDiffStore zdiffstore destination numkeys key [key ...]
+func execZDiffStore(db *DB, args [][]byte) redis.Reply {
+	return execZSetOperationStore(db, args, "diff")
 }
+
 func execZRemRangeByScore(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 3 {
 		return protocol.MakeErrorReply("ERR wrong number of arguments for 'zremrangebyscore' command")
@@ -453,6 +849,11 @@ func execZRemRangeByScore(db *DB, args [][]byte) redis.Reply {
 	removed := sortedSet.RemoveByScore(min, max)
 	if removed > 0 {
 		db.addAof(utils.ToCmdLineByByte("zremrangebyscore", args...))
+		db.notify(notifyZSet, "zremrangebyscore", key)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 	return protocol.MakeIntReply(removed)
 }
@@ -504,6 +905,11 @@ func execZRemRangeByRank(db *DB, args [][]byte) redis.Reply {
 	removed := sortedSet.RemoveByRank(start, stop)
 	if removed > 0 {
 		db.addAof(utils.ToCmdLineByByte("zremrangebyrank", args...))
+		db.notify(notifyZSet, "zremrangebyrank", key)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 	return protocol.MakeIntReply(removed)
 }
@@ -535,6 +941,11 @@ func execZRem(db *DB, args [][]byte) redis.Reply {
 	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLineByByte("zrem", args...))
+		db.notify(notifyZSet, "zrem", key)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 	return protocol.MakeIntReply(deleted)
 }
@@ -569,12 +980,14 @@ func execZIncrBy(db *DB, args [][]byte) redis.Reply {
 	if !exists {
 		sortedSet.Add(field, delta)
 		db.addAof(utils.ToCmdLineByByte("zincrby", args...))
+		db.notify(notifyZSet, "zincr", key)
 		return protocol.MakeBulkReply(args[1])
 	}
 	score := element.Score + delta
 	sortedSet.Add(field, score)
 	bytes := []byte(strconv.FormatFloat(score, 'f', -1, 64))
 	db.addAof(utils.ToCmdLineByByte("zincrby", args...))
+	db.notify(notifyZSet, "zincr", key)
 	return protocol.MakeBulkReply(bytes)
 }
 
@@ -584,6 +997,29 @@ func undoZIncr(db *DB, args [][]byte) []CmdLine {
 	return rollbackZSetFields(db, key, field)
 }
 
+// execZScan zscan key cursor [MATCH pattern] [COUNT count]
+func execZScan(db *DB, args [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return makeScanReply(0, [][]byte{})
+	}
+	elements, cursor := sortedSet.Scan(sa.cursor, sa.count)
+	result := make([][]byte, 0, len(elements)*2)
+	for _, element := range elements {
+		if sa.match(element.Member) {
+			result = append(result, []byte(element.Member), []byte(strconv.FormatFloat(element.Score, 'f', -1, 64)))
+		}
+	}
+	return makeScanReply(cursor, result)
+}
+
 func init() {
 	RegisterCommand("ZAdd", execZAdd, writeFirstKey, undoZAdd, -4, flagWrite)
 	RegisterCommand("ZScore", execZScore, readFirstKey, nil, 3, flagReadOnly)
@@ -599,4 +1035,18 @@ func init() {
 	RegisterCommand("ZRem", execZRem, writeFirstKey, undoZRem, -3, flagWrite)
 	RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4, flagWrite)
 	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	RegisterCommand("ZScan", execZScan, readFirstKey, nil, -3, flagReadOnly)
+	RegisterCommand("ZRangeByLex", execZRangeByLex, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("ZRevRangeByLex", execZRevRangeByLex, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("ZRangeStore", execZRangeStore, prepareZRangeStore, rollbackFirstKey, -5, flagWrite)
+	RegisterCommand("ZLexCount", execZLexCount, readFirstKey, nil, 4, flagReadOnly)
+	RegisterCommand("ZRemRangeByLex", execZRemRangeByLex, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	RegisterCommand("ZPopMin", execZPopMin, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	RegisterCommand("ZPopMax", execZPopMax, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	RegisterCommand("ZUnion", execZUnion, prepareZSetOperation, nil, -3, flagReadOnly)
+	RegisterCommand("ZInter", execZInter, prepareZSetOperation, nil, -3, flagReadOnly)
+	RegisterCommand("ZDiff", execZDiff, prepareZSetOperation, nil, -3, flagReadOnly)
+	RegisterCommand("ZUnionStore", execZUnionStore, prepareZSetOperationStore, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("ZInterStore", execZInterStore, prepareZSetOperationStore, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("ZDiffStore", execZDiffStore, prepareZSetOperationStore, rollbackFirstKey, -4, flagWrite)
 }
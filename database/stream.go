@@ -0,0 +1,1101 @@
+package database
+
+import (
+	"gmr/go-cache/aof"
+	"gmr/go-cache/datastruct/stream"
+	"gmr/go-cache/interface/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: stream
+ * @Version: 1.0.0
+ * @Description: stream命令，XADD/XRANGE/XREVRANGE/XLEN/XDEL/XTRIM/XREAD以及consumer group相关的
+ *               XGROUP/XREADGROUP/XACK/XPENDING/XCLAIM，XREAD和XREADGROUP的BLOCK由blocking.go实现
+ * @Date: 2026/10/18 10:12
+ */
+
+// defaultTrimLimit 使用~近似裁剪并且没有指定LIMIT时，一次最多删除的entry数量
+const defaultTrimLimit = 10000
+
+func (db *DB) getAsStream(key string) (*stream.Stream, protocol.ErrorReply) {
+	entity, exist := db.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, &protocol.WrongTypeErrorReply{}
+	}
+	return s, nil
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func streamErrorReply(err error) protocol.ErrorReply {
+	return protocol.MakeErrorReply(err.Error())
+}
+
+func noGroupReply(key string, group string) protocol.ErrorReply {
+	return protocol.MakeErrorReply("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+func entryReply(entry *stream.Entry) redis.Reply {
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte(entry.ID.String())),
+		protocol.MakeMultiBulkReply(entry.Fields),
+	})
+}
+
+func entriesReply(entries []*stream.Entry) redis.Reply {
+	replies := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryReply(entry)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func parseStreamIDs(args [][]byte) ([]stream.ID, protocol.ErrorReply) {
+	ids := make([]stream.ID, len(args))
+	for i, arg := range args {
+		id, err := stream.ParseStrictID(string(arg))
+		if err != nil {
+			return nil, streamErrorReply(err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// trimArgs XADD和XTRIM的MAXLEN|MINID [=|~] threshold [LIMIT count]
+type trimArgs struct {
+	// strategy maxlen或者minid，为空时不裁剪
+	strategy string
+	maxLen   int
+	minID    stream.ID
+	limit    int
+}
+
+// parseTrimArgs args[i]为MAXLEN或者MINID，返回下一个参数的位置
+func parseTrimArgs(args [][]byte, i int, trim *trimArgs) (int, protocol.ErrorReply) {
+	trim.strategy = strings.ToLower(string(args[i]))
+	i++
+	approx := false
+	if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+		approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return 0, protocol.MakeSyntaxErrorReply()
+	}
+	if trim.strategy == "maxlen" {
+		maxLen, err := strconv.Atoi(string(args[i]))
+		if err != nil {
+			return 0, protocol.MakeErrorReply("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return 0, protocol.MakeErrorReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	} else {
+		minID, err := stream.ParseStrictID(string(args[i]))
+		if err != nil {
+			return 0, streamErrorReply(err)
+		}
+		trim.minID = minID
+	}
+	i++
+
+	// 近似裁剪与精确裁剪的结果相同，只是默认限制一次删除的数量
+	trim.limit = 0
+	if approx {
+		trim.limit = defaultTrimLimit
+	}
+	if i+1 < len(args) && strings.ToLower(string(args[i])) == "limit" {
+		limit, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return 0, protocol.MakeErrorReply("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return 0, protocol.MakeErrorReply("ERR The LIMIT argument must be >= 0.")
+		}
+		if !approx {
+			return 0, protocol.MakeErrorReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		trim.limit = limit
+		i += 2
+	}
+	return i, nil
+}
+
+// apply 返回删除的entry数量
+func (trim *trimArgs) apply(s *stream.Stream) int {
+	switch trim.strategy {
+	case "maxlen":
+		return s.TrimByLen(trim.maxLen, trim.limit)
+	case "minid":
+		return s.TrimByMinID(trim.minID, trim.limit)
+	}
+	return 0
+}
+
+// nextStreamID 解析XADD的ID，支持*和<ms>-*
+func nextStreamID(s *stream.Stream, arg string) (stream.ID, error) {
+	if arg == "*" {
+		return s.NextID(uint64(nowMs()))
+	}
+	if strings.HasSuffix(arg, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(arg, "-*"), 10, 64)
+		if err != nil {
+			return stream.ID{}, stream.ErrInvalidID
+		}
+		return s.NextSeqID(ms)
+	}
+	return stream.ParseStrictID(arg)
+}
+
+// execXAdd xadd key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	noMkStream := false
+	trim := &trimArgs{}
+	i := 1
+	for i < len(args) {
+		arg := strings.ToLower(string(args[i]))
+		if arg == "nomkstream" {
+			noMkStream = true
+			i++
+		} else if arg == "maxlen" || arg == "minid" {
+			next, errReply := parseTrimArgs(args, i, trim)
+			if errReply != nil {
+				return errReply
+			}
+			i = next
+		} else {
+			break
+		}
+	}
+	fieldNum := len(args) - i - 1
+	if fieldNum < 2 || fieldNum%2 != 0 {
+		return protocol.MakeArgNumErrorReply("xadd")
+	}
+
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	isNew := s == nil
+	if isNew {
+		if noMkStream {
+			return &protocol.NullBulkReply{}
+		}
+		s = stream.MakeStream()
+	}
+	id, err := nextStreamID(s, string(args[i]))
+	if err != nil {
+		return streamErrorReply(err)
+	}
+	if err := s.Add(id, args[i+1:]); err != nil {
+		return streamErrorReply(err)
+	}
+	if isNew {
+		db.PutEntity(key, &database.DataEntity{Data: s})
+	}
+	db.notify(notifyStream, "xadd", key)
+	if trim.apply(s) > 0 {
+		db.notify(notifyStream, "xtrim", key)
+	}
+
+	// 自动生成的ID写入aof时替换为实际的ID
+	idBytes := []byte(id.String())
+	aofArgs := make([][]byte, len(args))
+	copy(aofArgs, args)
+	aofArgs[i] = idBytes
+	db.addAof(utils.ToCmdLineByByte("xadd", aofArgs...))
+	return protocol.MakeBulkReply(idBytes)
+}
+
+func execXLen(db *DB, args [][]byte) redis.Reply {
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(s.Len()))
+}
+
+// execXRange xrange key start end [COUNT count]
+func execXRange(db *DB, args [][]byte) redis.Reply {
+	return streamRange(db, args[0], args[1], args[2], args[3:], false)
+}
+
+// execXRevRange xrevrange key end start [COUNT count]
+func execXRevRange(db *DB, args [][]byte) redis.Reply {
+	return streamRange(db, args[0], args[2], args[1], args[3:], true)
+}
+
+func streamRange(db *DB, key []byte, startArg []byte, endArg []byte, options [][]byte, desc bool) redis.Reply {
+	start, err := stream.ParseRangeID(string(startArg), true)
+	if err != nil {
+		return streamErrorReply(err)
+	}
+	end, err := stream.ParseRangeID(string(endArg), false)
+	if err != nil {
+		return streamErrorReply(err)
+	}
+	count := 0
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToLower(string(options[0])) != "count" {
+			return protocol.MakeSyntaxErrorReply()
+		}
+		count, err = strconv.Atoi(string(options[1]))
+		if err != nil {
+			return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+		}
+		if count <= 0 {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+	}
+
+	s, errReply := db.getAsStream(string(key))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return entriesReply(s.Range(start, end, count, desc))
+}
+
+// execXDel xdel key id [id ...]
+func execXDel(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	ids, errReply := parseStreamIDs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	deleted := 0
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.notify(notifyStream, "xdel", key)
+		db.addAof(utils.ToCmdLineByByte("xdel", args...))
+	}
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+// execXTrim xtrim key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	strategy := strings.ToLower(string(args[1]))
+	if strategy != "maxlen" && strategy != "minid" {
+		return protocol.MakeSyntaxErrorReply()
+	}
+	trim := &trimArgs{}
+	next, errReply := parseTrimArgs(args, 1, trim)
+	if errReply != nil {
+		return errReply
+	}
+	if next != len(args) {
+		return protocol.MakeSyntaxErrorReply()
+	}
+
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	removed := trim.apply(s)
+	if removed > 0 {
+		db.notify(notifyStream, "xtrim", key)
+		db.addAof(utils.ToCmdLineByByte("xtrim", args...))
+	}
+	return protocol.MakeIntReply(int64(removed))
+}
+
+// execXSetID xsetid key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+func execXSetID(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	lastID, err := stream.ParseStrictID(string(args[1]))
+	if err != nil {
+		return streamErrorReply(err)
+	}
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeErrorReply("ERR no such key")
+	}
+
+	entriesAdded := s.EntriesAdded()
+	maxDeletedID := s.MaxDeletedID()
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrorReply()
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "entriesadded":
+			n, err := strconv.ParseUint(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			entriesAdded = n
+		case "maxdeletedid":
+			id, err := stream.ParseStrictID(string(args[i+1]))
+			if err != nil {
+				return streamErrorReply(err)
+			}
+			maxDeletedID = id
+		default:
+			return protocol.MakeSyntaxErrorReply()
+		}
+	}
+
+	if entries := s.Range(stream.MinID, stream.MaxID, 1, true); len(entries) > 0 && lastID.Less(entries[0].ID) {
+		return protocol.MakeErrorReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded < uint64(s.Len()) {
+		return protocol.MakeErrorReply("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	if lastID.Less(maxDeletedID) {
+		return protocol.MakeErrorReply("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+	}
+	s.SetID(lastID, entriesAdded, maxDeletedID)
+	db.notify(notifyStream, "xsetid", key)
+	db.addAof(utils.ToCmdLineByByte("xsetid", args...))
+	return protocol.MakeOkReply()
+}
+
+// streamReadArgs XREAD和XREADGROUP的参数
+type streamReadArgs struct {
+	group    string
+	consumer string
+	count    int
+	blocking bool
+	block    time.Duration
+	noAck    bool
+	keys     []string
+	ids      []string
+	// idPos 第一个ID在args中的位置
+	idPos int
+}
+
+// parseStreamReadArgs xread [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// xreadgroup GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamReadArgs(args [][]byte, isGroup bool) (*streamReadArgs, protocol.ErrorReply) {
+	cmdName := "xread"
+	if isGroup {
+		cmdName = "xreadgroup"
+	}
+	opts := &streamReadArgs{}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		hasNext := i+1 < len(args)
+		switch {
+		case option == "count" && hasNext:
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			opts.count = count
+			i++
+		case option == "block" && hasNext:
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrorReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, protocol.MakeErrorReply("ERR timeout is negative")
+			}
+			opts.blocking = true
+			opts.block = time.Duration(ms) * time.Millisecond
+			i++
+		case option == "group" && isGroup && i+2 < len(args):
+			opts.group = string(args[i+1])
+			opts.consumer = string(args[i+2])
+			i += 2
+		case option == "noack" && isGroup:
+			opts.noAck = true
+		case option == "streams":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return nil, protocol.MakeErrorReply("ERR Unbalanced '" + cmdName +
+					"' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			n := len(streams) / 2
+			opts.keys = make([]string, n)
+			opts.ids = make([]string, n)
+			for j := 0; j < n; j++ {
+				opts.keys[j] = string(streams[j])
+				opts.ids[j] = string(streams[n+j])
+			}
+			opts.idPos = i + 1 + n
+			if isGroup && opts.group == "" {
+				return nil, protocol.MakeErrorReply("ERR Missing GROUP option for XREADGROUP")
+			}
+			return opts, nil
+		default:
+			return nil, protocol.MakeSyntaxErrorReply()
+		}
+	}
+	return nil, protocol.MakeSyntaxErrorReply()
+}
+
+func prepareXRead(args [][]byte) ([]string, []string) {
+	opts, errReply := parseStreamReadArgs(args, false)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, opts.keys
+}
+
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	opts, errReply := parseStreamReadArgs(args, true)
+	if errReply != nil {
+		return nil, nil
+	}
+	return opts.keys, nil
+}
+
+// execXRead 没有新的entry时返回空数组，BLOCK时由阻塞命令重试
+func execXRead(db *DB, args [][]byte) redis.Reply {
+	opts, errReply := parseStreamReadArgs(args, false)
+	if errReply != nil {
+		return errReply
+	}
+	var result []redis.Reply
+	for i, key := range opts.keys {
+		s, errReply := db.getAsStream(key)
+		if errReply != nil {
+			return errReply
+		}
+		var entries []*stream.Entry
+		switch opts.ids[i] {
+		case ">":
+			return protocol.MakeErrorReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		case "$":
+			// $ 表示只读取新添加的entry，阻塞时已经被替换为当时的最后一个ID
+			continue
+		case "+":
+			if s != nil {
+				entries = s.Range(stream.MinID, stream.MaxID, 1, true)
+			}
+		default:
+			after, err := stream.ParseStrictID(opts.ids[i])
+			if err != nil {
+				return streamErrorReply(err)
+			}
+			start, ok := after.Incr()
+			if s != nil && ok {
+				entries = s.Range(start, stream.MaxID, opts.count, false)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			entriesReply(entries),
+		}))
+	}
+	if len(result) == 0 {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// xClaimCmdLine XREADGROUP和XCLAIM改变PEL之后以XCLAIM的形式写入aof，重放时不依赖当前时间
+func xClaimCmdLine(key string, group *stream.Group, pending *stream.PendingEntry) CmdLine {
+	return utils.ToCmdLine("xclaim", key, group.Name, pending.Consumer.Name, "0", pending.ID.String(),
+		"TIME", strconv.FormatInt(pending.DeliveryTime, 10),
+		"RETRYCOUNT", strconv.FormatUint(pending.DeliveryCount, 10),
+		"FORCE", "JUSTID", "LASTID", group.LastID.String())
+}
+
+func xGroupSetIDCmdLine(key string, group *stream.Group) CmdLine {
+	return utils.ToCmdLine("xgroup", "setid", key, group.Name, group.LastID.String(),
+		"ENTRIESREAD", strconv.FormatInt(group.EntriesRead, 10))
+}
+
+// createConsumer 不存在时创建consumer
+func (db *DB) createConsumer(key string, group *stream.Group, name string, now int64) *stream.Consumer {
+	consumer, created := group.CreateConsumer(name, now)
+	if created {
+		db.notify(notifyStream, "xgroup-createconsumer", key)
+		db.addAof(utils.ToCmdLine("xgroup", "createconsumer", key, group.Name, name))
+	}
+	return consumer
+}
+
+// execXReadGroup ID为>时读取新的entry，其他ID读取consumer的PEL中的历史记录
+func execXReadGroup(db *DB, args [][]byte) redis.Reply {
+	opts, errReply := parseStreamReadArgs(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	// 先检查所有的key和ID，避免只执行了一部分
+	streams := make([]*stream.Stream, len(opts.keys))
+	groups := make([]*stream.Group, len(opts.keys))
+	historyIDs := make([]stream.ID, len(opts.keys))
+	for i, key := range opts.keys {
+		s, errReply := db.getAsStream(key)
+		if errReply != nil {
+			return errReply
+		}
+		var group *stream.Group
+		if s != nil {
+			group, _ = s.GetGroup(opts.group)
+		}
+		if group == nil {
+			return protocol.MakeErrorReply("NOGROUP No such key '" + key + "' or consumer group '" + opts.group +
+				"' in XREADGROUP with GROUP option")
+		}
+		switch opts.ids[i] {
+		case ">":
+		case "$":
+			return protocol.MakeErrorReply("ERR The $ ID is meaningless in the context of XREADGROUP: " +
+				"you want to read the history of this consumer by specifying a proper ID, " +
+				"or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			id, err := stream.ParseStrictID(opts.ids[i])
+			if err != nil {
+				return streamErrorReply(err)
+			}
+			historyIDs[i] = id
+		}
+		streams[i] = s
+		groups[i] = group
+	}
+
+	now := nowMs()
+	var result []redis.Reply
+	for i, key := range opts.keys {
+		s, group := streams[i], groups[i]
+		consumer := db.createConsumer(key, group, opts.consumer, now)
+		consumer.SeenTime = now
+
+		if opts.ids[i] != ">" {
+			pendings := consumer.PendingRange(historyIDs[i], stream.MaxID, opts.count)
+			items := make([]redis.Reply, len(pendings))
+			for j, pending := range pendings {
+				pending.DeliveryTime = now
+				pending.DeliveryCount++
+				db.addAof(xClaimCmdLine(key, group, pending))
+				// entry已经被删除时只返回ID
+				if entry, ok := s.Get(pending.ID); ok {
+					items[j] = entryReply(entry)
+				} else {
+					items[j] = protocol.MakeMultiRawReply([]redis.Reply{
+						protocol.MakeBulkReply([]byte(pending.ID.String())),
+						protocol.MakeNullMultiBulkReply(),
+					})
+				}
+			}
+			result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeBulkReply([]byte(key)),
+				protocol.MakeMultiRawReply(items),
+			}))
+			continue
+		}
+
+		entries := group.ReadNew(s, consumer, opts.count, opts.noAck, now)
+		if len(entries) == 0 {
+			continue
+		}
+		if !opts.noAck {
+			for _, entry := range entries {
+				pending, _ := group.GetPending(entry.ID)
+				db.addAof(xClaimCmdLine(key, group, pending))
+			}
+		}
+		db.addAof(xGroupSetIDCmdLine(key, group))
+		result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			entriesReply(entries),
+		}))
+	}
+	if len(result) == 0 {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// execXAck xack key group id [id ...]
+func execXAck(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	ids, errReply := parseStreamIDs(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.MakeIntReply(0)
+	}
+	group, ok := s.GetGroup(string(args[1]))
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.addAof(utils.ToCmdLineByByte("xack", args...))
+	}
+	return protocol.MakeIntReply(int64(acked))
+}
+
+// execXPending xpending key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	groupName := string(args[1])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	var group *stream.Group
+	if s != nil {
+		group, _ = s.GetGroup(groupName)
+	}
+	if group == nil {
+		return noGroupReply(key, groupName)
+	}
+
+	if len(args) == 2 {
+		return pendingSummary(group)
+	}
+
+	options := args[2:]
+	minIdle := int64(0)
+	if strings.ToLower(string(options[0])) == "idle" {
+		if len(options) < 2 {
+			return protocol.MakeSyntaxErrorReply()
+		}
+		idle, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil {
+			return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+		}
+		minIdle = idle
+		options = options[2:]
+	}
+	if len(options) != 3 && len(options) != 4 {
+		return protocol.MakeSyntaxErrorReply()
+	}
+	start, err := stream.ParseRangeID(string(options[0]), true)
+	if err != nil {
+		return streamErrorReply(err)
+	}
+	end, err := stream.ParseRangeID(string(options[1]), false)
+	if err != nil {
+		return streamErrorReply(err)
+	}
+	count, err := strconv.Atoi(string(options[2]))
+	if err != nil {
+		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	}
+	if count <= 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	var pendings []*stream.PendingEntry
+	if len(options) == 4 {
+		consumer, ok := group.GetConsumer(string(options[3]))
+		if !ok {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+		pendings = consumer.PendingRange(start, end, 0)
+	} else {
+		pendings = group.PendingRange(start, end, 0)
+	}
+
+	now := nowMs()
+	result := make([]redis.Reply, 0, count)
+	for _, pending := range pendings {
+		idle := now - pending.DeliveryTime
+		if idle < 0 {
+			idle = 0
+		}
+		if idle < minIdle {
+			continue
+		}
+		result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(pending.ID.String())),
+			protocol.MakeBulkReply([]byte(pending.Consumer.Name)),
+			protocol.MakeIntReply(idle),
+			protocol.MakeIntReply(int64(pending.DeliveryCount)),
+		}))
+		if len(result) == count {
+			break
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+// pendingSummary 返回PEL的数量、最小和最大ID以及每个consumer的pending数量
+func pendingSummary(group *stream.Group) redis.Reply {
+	pendings := group.PendingRange(stream.MinID, stream.MaxID, 0)
+	if len(pendings) == 0 {
+		return protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeIntReply(0),
+			protocol.MakeNullBulkReply(),
+			protocol.MakeNullBulkReply(),
+			protocol.MakeNullMultiBulkReply(),
+		})
+	}
+	var consumers []redis.Reply
+	for _, consumer := range group.Consumers() {
+		if consumer.PendingLen() == 0 {
+			continue
+		}
+		consumers = append(consumers, protocol.MakeMultiBulkReply([][]byte{
+			[]byte(consumer.Name),
+			[]byte(strconv.Itoa(consumer.PendingLen())),
+		}))
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeIntReply(int64(len(pendings))),
+		protocol.MakeBulkReply([]byte(pendings[0].ID.String())),
+		protocol.MakeBulkReply([]byte(pendings[len(pendings)-1].ID.String())),
+		protocol.MakeMultiRawReply(consumers),
+	})
+}
+
+// execXClaim xclaim key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	groupName := string(args[1])
+	consumerName := string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrorReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+
+	var ids []stream.ID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := stream.ParseStrictID(string(args[i]))
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return streamErrorReply(stream.ErrInvalidID)
+	}
+
+	now := nowMs()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		hasNext := i+1 < len(args)
+		switch {
+		case option == "force":
+			force = true
+		case option == "justid":
+			justID = true
+		case option == "idle" && hasNext:
+			idle, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR Invalid IDLE option argument for XCLAIM")
+			}
+			deliveryTime = now - idle
+			i++
+		case option == "time" && hasNext:
+			t, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR Invalid TIME option argument for XCLAIM")
+			}
+			deliveryTime = t
+			i++
+		case option == "retrycount" && hasNext:
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n < 0 {
+				return protocol.MakeErrorReply("ERR Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			retryCount = n
+			i++
+		case option == "lastid" && hasNext:
+			id, err := stream.ParseStrictID(string(args[i+1]))
+			if err != nil {
+				return streamErrorReply(err)
+			}
+			lastID = &id
+			i++
+		default:
+			return protocol.MakeErrorReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	var group *stream.Group
+	if s != nil {
+		group, _ = s.GetGroup(groupName)
+	}
+	if group == nil {
+		return noGroupReply(key, groupName)
+	}
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+	}
+
+	consumer := db.createConsumer(key, group, consumerName, now)
+	consumer.SeenTime = now
+	result := make([]redis.Reply, 0, len(ids))
+	for _, id := range ids {
+		entry, exists := s.Get(id)
+		pending, ok := group.GetPending(id)
+		if !ok {
+			// FORCE只对stream中存在的entry创建PEL
+			if !force || !exists {
+				continue
+			}
+		} else if minIdle > 0 && now-pending.DeliveryTime < minIdle {
+			continue
+		}
+		if !exists {
+			// entry已经被删除，从PEL中移除
+			group.Ack(id)
+			db.addAof(utils.ToCmdLine("xack", key, groupName, id.String()))
+			continue
+		}
+
+		deliveryCount := uint64(0)
+		if ok {
+			deliveryCount = pending.DeliveryCount
+		}
+		if retryCount >= 0 {
+			deliveryCount = uint64(retryCount)
+		} else if !justID {
+			deliveryCount++
+		}
+		pending = group.SetPending(id, consumer, deliveryTime, deliveryCount)
+		db.addAof(xClaimCmdLine(key, group, pending))
+		if justID {
+			result = append(result, protocol.MakeBulkReply([]byte(id.String())))
+		} else {
+			result = append(result, entryReply(entry))
+		}
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+func prepareXGroup(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+func undoXGroup(db *DB, args [][]byte) []CmdLine {
+	if len(args) < 2 {
+		return nil
+	}
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+var xGroupArity = map[string]int{
+	"create":         -4,
+	"setid":          -4,
+	"destroy":        3,
+	"createconsumer": 4,
+	"delconsumer":    4,
+}
+
+// execXGroup xgroup create|setid|destroy|createconsumer|delconsumer key group ...
+func execXGroup(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	arity, ok := xGroupArity[subCmd]
+	if !ok {
+		return protocol.MakeErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if !validateArity(arity, args) {
+		return protocol.MakeArgNumErrorReply("xgroup|" + subCmd)
+	}
+	key := string(args[1])
+	groupName := string(args[2])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil && subCmd != "create" {
+		return protocol.MakeErrorReply("ERR The XGROUP subcommand requires the key to exist. " +
+			"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+
+	switch subCmd {
+	case "create", "setid":
+		return execXGroupSetID(db, subCmd, key, groupName, s, args[3:])
+	case "destroy":
+		if !s.DestroyGroup(groupName) {
+			return protocol.MakeIntReply(0)
+		}
+		db.notify(notifyStream, "xgroup-destroy", key)
+		db.addAof(utils.ToCmdLineByByte("xgroup", args...))
+		return protocol.MakeIntReply(1)
+	}
+
+	group, ok := s.GetGroup(groupName)
+	if !ok {
+		return protocol.MakeErrorReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	}
+	consumerName := string(args[3])
+	if subCmd == "createconsumer" {
+		if _, created := group.CreateConsumer(consumerName, nowMs()); !created {
+			return protocol.MakeIntReply(0)
+		}
+		db.notify(notifyStream, "xgroup-createconsumer", key)
+		db.addAof(utils.ToCmdLineByByte("xgroup", args...))
+		return protocol.MakeIntReply(1)
+	}
+	pending, ok := group.DeleteConsumer(consumerName)
+	if ok {
+		db.notify(notifyStream, "xgroup-delconsumer", key)
+		db.addAof(utils.ToCmdLineByByte("xgroup", args...))
+	}
+	return protocol.MakeIntReply(int64(pending))
+}
+
+// execXGroupSetID xgroup create key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+// xgroup setid key group id|$ [ENTRIESREAD entries-read]
+func execXGroupSetID(db *DB, subCmd string, key string, groupName string, s *stream.Stream, args [][]byte) redis.Reply {
+	idArg := string(args[0])
+	mkStream := false
+	entriesRead := int64(-1)
+	hasEntriesRead := false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "mkstream" && subCmd == "create" {
+			mkStream = true
+		} else if option == "entriesread" && i+1 < len(args) {
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+			}
+			if n < 0 && n != -1 {
+				return protocol.MakeErrorReply("ERR value for ENTRIESREAD must be positive or -1")
+			}
+			entriesRead = n
+			hasEntriesRead = true
+			i++
+		} else {
+			return protocol.MakeSyntaxErrorReply()
+		}
+	}
+
+	isNew := s == nil
+	if isNew {
+		if !mkStream {
+			return protocol.MakeErrorReply("ERR The XGROUP subcommand requires the key to exist. " +
+				"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		s = stream.MakeStream()
+	}
+	var id stream.ID
+	if idArg == "$" {
+		id = s.LastID()
+		if !hasEntriesRead {
+			entriesRead = int64(s.EntriesAdded())
+		}
+	} else {
+		var err error
+		id, err = stream.ParseStrictID(idArg)
+		if err != nil {
+			return streamErrorReply(err)
+		}
+	}
+
+	var group *stream.Group
+	if subCmd == "create" {
+		var ok bool
+		group, ok = s.CreateGroup(groupName, id, entriesRead)
+		if !ok {
+			return protocol.MakeErrorReply("BUSYGROUP Consumer Group name already exists")
+		}
+		if isNew {
+			db.PutEntity(key, &database.DataEntity{Data: s})
+		}
+		db.notify(notifyStream, "xgroup-create", key)
+		db.addAof(utils.ToCmdLine("xgroup", "create", key, groupName, id.String(), "MKSTREAM",
+			"ENTRIESREAD", strconv.FormatInt(entriesRead, 10)))
+		return protocol.MakeOkReply()
+	}
+
+	group, ok := s.GetGroup(groupName)
+	if !ok {
+		return protocol.MakeErrorReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	}
+	group.LastID = id
+	group.EntriesRead = entriesRead
+	db.notify(notifyStream, "xgroup-setid", key)
+	db.addAof(xGroupSetIDCmdLine(key, group))
+	return protocol.MakeOkReply()
+}
+
+// execXRestore 内部命令，使用aof.EntityToCmd生成的参数重建stream，用于aof重写、事务回滚和集群迁移
+func execXRestore(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	s, err := aof.CmdToStream(args[1:])
+	if err != nil {
+		return protocol.MakeErrorReply("ERR illegal stream restore command: " + err.Error())
+	}
+	db.PutEntity(key, &database.DataEntity{Data: s})
+	db.addAof(utils.ToCmdLineByByte("xrestore", args...))
+	return protocol.MakeOkReply()
+}
+
+func undoXReadGroup(db *DB, args [][]byte) []CmdLine {
+	keys, _ := prepareXReadGroup(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+func init() {
+	RegisterCommand("XAdd", execXAdd, writeFirstKey, rollbackFirstKey, -5, flagWrite)
+	RegisterCommand("XLen", execXLen, readFirstKey, nil, 2, flagReadOnly)
+	RegisterCommand("XRange", execXRange, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("XRevRange", execXRevRange, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("XDel", execXDel, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("XTrim", execXTrim, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("XSetID", execXSetID, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("XRead", execXRead, prepareXRead, nil, -4, flagReadOnly)
+	RegisterCommand("XReadGroup", execXReadGroup, prepareXReadGroup, undoXReadGroup, -7, flagWrite)
+	RegisterCommand("XAck", execXAck, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("XPending", execXPending, readFirstKey, nil, -3, flagReadOnly)
+	RegisterCommand("XClaim", execXClaim, writeFirstKey, rollbackFirstKey, -6, flagWrite)
+	RegisterCommand("XGroup", execXGroup, prepareXGroup, undoXGroup, -2, flagWrite)
+	RegisterCommand("XRestore", execXRestore, writeFirstKey, rollbackFirstKey, -7, flagWrite|flagInternal)
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"github.com/shopspring/decimal"
+	"gmr/go-cache/aof"
 	"gmr/go-cache/datastruct/bitmap"
 	"gmr/go-cache/interface/database"
 	"gmr/go-cache/interface/redis"
@@ -115,9 +116,11 @@ func execGetEX(db *DB, args [][]byte) redis.Reply {
 			expireTime := time.Now().Add(time.Duration(ttl) * time.Millisecond)
 			db.Expire(key, expireTime)
 			db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+			db.notify(notifyGeneric, "expire", key)
 		} else {
 			db.Persist(key)
 			db.addAof(utils.ToCmdLineByByte("persist", args[0]))
+			db.notify(notifyGeneric, "persist", key)
 		}
 	}
 	return protocol.MakeBulkReply(bytes)
@@ -204,9 +207,12 @@ func execSet(db *DB, args [][]byte) redis.Reply {
 				args[1],
 			})
 			db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+			db.notify(notifyString, "set", key)
+			db.notify(notifyGeneric, "expire", key)
 		} else {
 			db.Persist(key)
 			db.addAof(utils.ToCmdLineByByte("set", args...))
+			db.notify(notifyString, "set", key)
 		}
 	}
 
@@ -224,6 +230,9 @@ func execSetNX(db *DB, args [][]byte) redis.Reply {
 	}
 	result := db.PutIfAbsent(key, entity)
 	db.addAof(utils.ToCmdLineByByte("setnx", args...))
+	if result > 0 {
+		db.notify(notifyString, "set", key)
+	}
 	return protocol.MakeIntReply(int64(result))
 }
 
@@ -249,6 +258,8 @@ func execSetEX(db *DB, args [][]byte) redis.Reply {
 	db.Expire(key, expireTime)
 	db.addAof(utils.ToCmdLineByByte("setex", args...))
 	db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+	db.notify(notifyString, "set", key)
+	db.notify(notifyGeneric, "expire", key)
 	return &protocol.OkReply{}
 }
 
@@ -273,6 +284,8 @@ func execPSetEX(db *DB, args [][]byte) redis.Reply {
 	db.Expire(key, expireTime)
 	db.addAof(utils.ToCmdLineByByte("setex", args...))
 	db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+	db.notify(notifyString, "set", key)
+	db.notify(notifyGeneric, "expire", key)
 
 	return &protocol.OkReply{}
 }
@@ -307,6 +320,7 @@ func execMSet(db *DB, args [][]byte) redis.Reply {
 	for i, key := range keys {
 		value := values[i]
 		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.notify(notifyString, "set", key)
 	}
 	db.addAof(utils.ToCmdLineByByte("mset", args...))
 	return &protocol.OkReply{}
@@ -366,6 +380,7 @@ func execMSetNX(db *DB, args [][]byte) redis.Reply {
 	for i, key := range keys {
 		value := values[i]
 		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.notify(notifyString, "set", key)
 	}
 	db.addAof(utils.ToCmdLineByByte("msetnx", args...))
 	return protocol.MakeIntReply(1)
@@ -383,6 +398,7 @@ func execGetSet(db *DB, args [][]byte) redis.Reply {
 	db.PutEntity(key, &database.DataEntity{Data: value})
 	db.Persist(key)
 	db.addAof(utils.ToCmdLineByByte("set", args...))
+	db.notify(notifyString, "set", key)
 	if old == nil {
 		return new(protocol.NullBulkReply)
 	}
@@ -402,6 +418,7 @@ func execGetDel(db *DB, args [][]byte) redis.Reply {
 	db.Remove(key)
 
 	db.addAof(utils.ToCmdLineByByte("del", args...))
+	db.notify(notifyGeneric, "del", key)
 	return protocol.MakeBulkReply(old)
 }
 
@@ -421,12 +438,14 @@ func execIncr(db *DB, args [][]byte) redis.Reply {
 			Data: []byte(strconv.FormatInt(val+1, 10)),
 		})
 		db.addAof(utils.ToCmdLineByByte("incr", args...))
+		db.notify(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val + 1)
 	}
 	db.PutEntity(key, &database.DataEntity{
 		Data: []byte("1"),
 	})
 	db.addAof(utils.ToCmdLineByByte("incr", args...))
+	db.notify(notifyString, "incrby", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -451,12 +470,14 @@ func execIncrBy(db *DB, args [][]byte) redis.Reply {
 			Data: []byte(strconv.FormatInt(val+delta, 10)),
 		})
 		db.addAof(utils.ToCmdLineByByte("incrby", args...))
+		db.notify(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val + delta)
 	}
 	db.PutEntity(key, &database.DataEntity{
 		Data: args[1],
 	})
 	db.addAof(utils.ToCmdLineByByte("incrby", args...))
+	db.notify(notifyString, "incrby", key)
 	return protocol.MakeIntReply(delta)
 }
 
@@ -482,12 +503,14 @@ func execIncrByFloat(db *DB, args [][]byte) redis.Reply {
 			Data: resultBytes,
 		})
 		db.addAof(utils.ToCmdLineByByte("incrbyfloat", args...))
+		db.notify(notifyString, "incrbyfloat", key)
 		return protocol.MakeBulkReply(resultBytes)
 	}
 	db.PutEntity(key, &database.DataEntity{
 		Data: args[1],
 	})
 	db.addAof(utils.ToCmdLineByByte("incrbyfloat", args...))
+	db.notify(notifyString, "incrbyfloat", key)
 	return protocol.MakeBulkReply(args[1])
 }
 
@@ -507,6 +530,7 @@ func execDecr(db *DB, args [][]byte) redis.Reply {
 			Data: []byte(strconv.FormatInt(val-1, 10)),
 		})
 		db.addAof(utils.ToCmdLineByByte("decr", args...))
+		db.notify(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val - 1)
 	}
 	entity := &database.DataEntity{
@@ -514,6 +538,7 @@ func execDecr(db *DB, args [][]byte) redis.Reply {
 	}
 	db.PutEntity(key, entity)
 	db.addAof(utils.ToCmdLineByByte("decr", args...))
+	db.notify(notifyString, "incrby", key)
 	return protocol.MakeIntReply(-1)
 }
 
@@ -538,6 +563,7 @@ func execDecrBy(db *DB, args [][]byte) redis.Reply {
 			Data: []byte(strconv.FormatInt(val-delta, 10)),
 		})
 		db.addAof(utils.ToCmdLineByByte("decrby", args...))
+		db.notify(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val - delta)
 	}
 	valueStr := strconv.FormatInt(-delta, 10)
@@ -545,6 +571,7 @@ func execDecrBy(db *DB, args [][]byte) redis.Reply {
 		Data: []byte(valueStr),
 	})
 	db.addAof(utils.ToCmdLineByByte("decrby", args...))
+	db.notify(notifyString, "incrby", key)
 	return protocol.MakeIntReply(-delta)
 }
 
@@ -571,6 +598,7 @@ func execAppend(db *DB, args [][]byte) redis.Reply {
 		Data: bytes,
 	})
 	db.addAof(utils.ToCmdLineByByte("append", args...))
+	db.notify(notifyString, "append", key)
 	return protocol.MakeIntReply(int64(len(bytes)))
 }
 
@@ -604,6 +632,7 @@ func execSetRange(db *DB, args [][]byte) redis.Reply {
 		Data: bytes,
 	})
 	db.addAof(utils.ToCmdLineByByte("setRange", args...))
+	db.notify(notifyString, "setrange", key)
 	return protocol.MakeIntReply(int64(len(bytes)))
 }
 
@@ -656,6 +685,8 @@ func execSetBit(db *DB, args [][]byte) redis.Reply {
 	former := bm.GetBit(offset)
 	bm.SetBit(offset, v)
 	db.PutEntity(key, &database.DataEntity{Data: bm.ToBytes()})
+	db.addAof(utils.ToCmdLineByByte("setbit", args...))
+	db.notify(notifyString, "setbit", key)
 	return protocol.MakeIntReply(int64(former))
 }
 
@@ -41,7 +41,7 @@ func Auth(c redis.Connection, args [][]byte) redis.Reply {
 	return &protocol.OkReply{}
 }
 
-func isAuthenticated(c redis.Connection) bool {
+func IsAuthenticated(c redis.Connection) bool {
 	if config.Properties.RequirePass == "" {
 		return true
 	}
@@ -156,16 +156,3 @@ func (db *DB) GetUndoLogs(cmdLine [][]byte) []CmdLine {
 	}
 	return undo(db, cmdLine[1:])
 }
-
-func GetRelateKeys(cmdLine [][]byte) ([]string, []string) {
-	cmdName := strings.ToLower(string(cmdLine[0]))
-	cmd, ok := cmdTable[cmdName]
-	if !ok {
-		return nil, nil
-	}
-	prepare := cmd.prepare
-	if prepare == nil {
-		return nil, nil
-	}
-	return prepare(cmdLine[1:])
-}
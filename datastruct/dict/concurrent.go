@@ -305,6 +305,36 @@ func (d *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 	return arr
 }
 
+// Scan 以shard为单位遍历，cursor为shard的下标，每次遍历完整的shard。
+// shard数量固定，key很少时大部分shard是空的，访问空shard只需要加读锁，最多访问count*100个空shard
+func (d *ConcurrentDict) Scan(cursor uint64, count int) ([]string, uint64) {
+	if d == nil {
+		panic("dict is nil")
+	}
+	if count < 1 {
+		count = 1
+	}
+	mask := uint64(len(d.table) - 1)
+	keys := make([]string, 0, count)
+	emptyVisits := count * 100
+	for {
+		s := d.table[cursor&mask]
+		s.mutex.RLock()
+		for key := range s.m {
+			keys = append(keys, key)
+		}
+		empty := len(s.m) == 0
+		s.mutex.RUnlock()
+		cursor = nextCursor(cursor, mask)
+		if empty {
+			emptyVisits--
+		}
+		if cursor == 0 || len(keys) >= count || emptyVisits <= 0 {
+			return keys, cursor
+		}
+	}
+}
+
 // 通过MakeConcurrentDict覆盖dict，实现清空dict
 func (d *ConcurrentDict) Clear() {
 	*d = *MakeConcurrentDict(d.shadCount)
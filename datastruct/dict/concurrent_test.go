@@ -301,3 +301,51 @@ func TestConcurrentDict_Keys(t *testing.T) {
 		t.Errorf("expect %d keys, actual: %d", size, len(d.Keys()))
 	}
 }
+
+func TestConcurrentDict_Scan(t *testing.T) {
+	d := MakeConcurrentDict(64)
+	size := 1000
+	for i := 0; i < size; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]struct{})
+	cursor := uint64(0)
+	for {
+		var keys []string
+		keys, cursor = d.Scan(cursor, 10)
+		for _, key := range keys {
+			seen[key] = struct{}{}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != size {
+		t.Errorf("expect %d keys, actual: %d", size, len(seen))
+	}
+}
+
+// 中途换成shard数量不同的dict，已经存在的key仍然都会被遍历到
+func TestConcurrentDict_ScanResize(t *testing.T) {
+	small := MakeConcurrentDict(16)
+	large := MakeConcurrentDict(256)
+	size := 1000
+	for i := 0; i < size; i++ {
+		small.Put("k"+strconv.Itoa(i), i)
+		large.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]struct{})
+	keys, cursor := small.Scan(0, 200)
+	for _, key := range keys {
+		seen[key] = struct{}{}
+	}
+	for cursor != 0 {
+		keys, cursor = large.Scan(cursor, 10)
+		for _, key := range keys {
+			seen[key] = struct{}{}
+		}
+	}
+	if len(seen) != size {
+		t.Errorf("expect %d keys, actual: %d", size, len(seen))
+	}
+}
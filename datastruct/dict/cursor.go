@@ -0,0 +1,20 @@
+package dict
+
+import "math/bits"
+
+/**
+ * @Author: wanglei
+ * @File: cursor
+ * @Version: 1.0.0
+ * @Description: SCAN使用的无状态cursor，与redis相同按照反向二进制顺序递增，
+ *               table大小变化之后，已经遍历过的位置仍然不会被再次遍历
+ * @Date: 2026/10/18 10:12
+ */
+
+// nextCursor 反转cursor之后加1再反转回来，mask为table大小减1
+func nextCursor(cursor uint64, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
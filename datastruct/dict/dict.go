@@ -23,5 +23,7 @@ type Dict interface {
 	Keys() []string
 	RandomKeys(limit int) []string
 	RandomDistinctKeys(limit int) []string
+	// Scan 从cursor开始遍历至少count个key，返回的cursor为0表示遍历结束
+	Scan(cursor uint64, count int) ([]string, uint64)
 	Clear()
 }
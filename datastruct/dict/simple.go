@@ -1,5 +1,7 @@
 package dict
 
+import "math/rand"
+
 /**
  * @Author: wanglei
  * @File: simple
@@ -8,13 +10,56 @@ package dict
  * @Date: 2023/07/11 12:22
  */
 
+const (
+	// 平均每个bucket的key数量超过maxBucketLoad时扩容
+	maxBucketLoad = 8
+	// key数量少于bucket数量的一半时缩容
+	minBucketLoad = 2
+)
+
+// SimpleDict key按照fnv32(key)&mask分配到bucket中，bucket数量为2的幂，
+// SCAN以bucket为单位遍历，每次调用只访问少量bucket
 type SimpleDict struct {
-	m map[string]interface{}
+	buckets []map[string]interface{}
+	count   int
+	// iterating 正在执行的ForEach数量，大于0时不调整bucket数量
+	iterating int
 }
 
 func MakeSimpleDict() *SimpleDict {
 	return &SimpleDict{
-		m: make(map[string]interface{}),
+		buckets: []map[string]interface{}{make(map[string]interface{})},
+	}
+}
+
+func (d *SimpleDict) bucket(key string) map[string]interface{} {
+	return d.buckets[fnv32(key)&uint32(len(d.buckets)-1)]
+}
+
+// resize 调整bucket数量并重新分配全部key
+func (d *SimpleDict) resize(size int) {
+	buckets := make([]map[string]interface{}, size)
+	for i := range buckets {
+		buckets[i] = make(map[string]interface{})
+	}
+	mask := uint32(size - 1)
+	for _, b := range d.buckets {
+		for key, val := range b {
+			buckets[fnv32(key)&mask][key] = val
+		}
+	}
+	d.buckets = buckets
+}
+
+func (d *SimpleDict) grow() {
+	if d.iterating == 0 && d.count > len(d.buckets)*maxBucketLoad {
+		d.resize(len(d.buckets) * 2)
+	}
+}
+
+func (d *SimpleDict) shrink() {
+	if d.iterating == 0 && len(d.buckets) > 1 && d.count*minBucketLoad < len(d.buckets) {
+		d.resize(len(d.buckets) / 2)
 	}
 }
 
@@ -22,7 +67,7 @@ func (d *SimpleDict) Len() int {
 	if d == nil {
 		panic("dict is nil")
 	}
-	return len(d.m)
+	return d.count
 }
 
 func (d *SimpleDict) Get(key string) (val interface{}, exist bool) {
@@ -30,7 +75,7 @@ func (d *SimpleDict) Get(key string) (val interface{}, exist bool) {
 		panic("dict is nil")
 	}
 
-	val, exist = d.m[key]
+	val, exist = d.bucket(key)[key]
 	return
 }
 
@@ -38,13 +83,16 @@ func (d *SimpleDict) Put(key string, val interface{}) (result int) {
 	if d == nil {
 		panic("dict is nil")
 	}
-	_, ok := d.m[key]
-	d.m[key] = val
+	b := d.bucket(key)
+	_, ok := b[key]
+	b[key] = val
 
 	if ok {
 		return 0
 	}
 
+	d.count++
+	d.grow()
 	return 1
 }
 
@@ -53,12 +101,15 @@ func (d *SimpleDict) PutIfAbsent(key string, val interface{}) (result int) {
 		panic("dict is nil")
 	}
 
-	if _, ok := d.m[key]; ok {
+	b := d.bucket(key)
+	if _, ok := b[key]; ok {
 		return 0
 	}
 
-	// 值不存在则向shard添加key
-	d.m[key] = val
+	// 值不存在则向bucket添加key
+	b[key] = val
+	d.count++
+	d.grow()
 	return 1
 }
 
@@ -67,12 +118,12 @@ func (d *SimpleDict) PutIfExist(key string, val interface{}) (result int) {
 		panic("dict is nil")
 	}
 
-	if _, ok := d.m[key]; ok {
-		d.m[key] = val
+	b := d.bucket(key)
+	if _, ok := b[key]; ok {
+		b[key] = val
 		return 1
 	}
 
-	// 值不存在则向shard添加key
 	return 0
 }
 
@@ -81,9 +132,12 @@ func (d *SimpleDict) Remove(key string) (result int) {
 		panic("dict is nil")
 	}
 
-	if _, ok := d.m[key]; ok {
-		delete(d.m, key)
+	b := d.bucket(key)
+	if _, ok := b[key]; ok {
+		delete(b, key)
 		// 删除key之后减少count值
+		d.count--
+		d.shrink()
 		return 1
 	}
 	return 0
@@ -94,23 +148,41 @@ func (d *SimpleDict) ForEach(consumer Consumer) {
 		panic("dict is nil")
 	}
 
-	for key, value := range d.m {
-		continues := consumer(key, value)
-		if !continues {
-			break
+	// consumer中可能修改dict，遍历期间不调整bucket数量
+	d.iterating++
+	defer func() {
+		d.iterating--
+	}()
+	for _, b := range d.buckets {
+		for key, value := range b {
+			continues := consumer(key, value)
+			if !continues {
+				return
+			}
 		}
 	}
 }
 
 func (d *SimpleDict) Keys() []string {
-	result := make([]string, d.Len())
-	i := 0
-	for key := range d.m {
-		result[i] = key
+	result := make([]string, 0, d.Len())
+	for _, b := range d.buckets {
+		for key := range b {
+			result = append(result, key)
+		}
 	}
 	return result
 }
 
+// randomBucket 随机返回一个非空bucket的下标，dict不能为空
+func (d *SimpleDict) randomBucket() int {
+	for {
+		i := rand.Intn(len(d.buckets))
+		if len(d.buckets[i]) > 0 {
+			return i
+		}
+	}
+}
+
 // 随机获取keys
 func (d *SimpleDict) RandomKeys(limit int) []string {
 	size := d.Len()
@@ -121,8 +193,9 @@ func (d *SimpleDict) RandomKeys(limit int) []string {
 
 	result := make([]string, limit)
 
-	for i := 0; i < limit; {
-		for key := range d.m {
+	// 每次遍历map的起始位置是随机的
+	for i := 0; i < limit; i++ {
+		for key := range d.buckets[d.randomBucket()] {
 			result[i] = key
 			break
 		}
@@ -136,19 +209,48 @@ func (d *SimpleDict) RandomDistinctKeys(limit int) []string {
 		return d.Keys()
 	}
 
-	result := make([]string, size)
+	result := make([]string, 0, limit)
 
-	i := 0
-	for k := range d.m {
-		if i == limit {
-			break
+	// 从随机的bucket开始依次取key
+	start := d.randomBucket()
+	for i := 0; len(result) < limit; i++ {
+		for key := range d.buckets[(start+i)%len(d.buckets)] {
+			if len(result) == limit {
+				break
+			}
+			result = append(result, key)
 		}
-		result[i] = k
-		i++
 	}
 	return result
 }
 
+// Scan 与ConcurrentDict.Scan相同，从cursor对应的bucket开始按照反向二进制顺序遍历，
+// 至少返回count个key或者遍历结束，返回的cursor为0表示遍历结束
+func (d *SimpleDict) Scan(cursor uint64, count int) ([]string, uint64) {
+	if d == nil {
+		panic("dict is nil")
+	}
+	if count < 1 {
+		count = 1
+	}
+	mask := uint64(len(d.buckets) - 1)
+	keys := make([]string, 0, count)
+	emptyVisits := count * 100
+	for {
+		b := d.buckets[cursor&mask]
+		for key := range b {
+			keys = append(keys, key)
+		}
+		cursor = nextCursor(cursor, mask)
+		if len(b) == 0 {
+			emptyVisits--
+		}
+		if cursor == 0 || len(keys) >= count || emptyVisits <= 0 {
+			return keys, cursor
+		}
+	}
+}
+
 func (d *SimpleDict) Clear() {
 	*d = *MakeSimpleDict()
 }
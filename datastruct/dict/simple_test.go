@@ -2,6 +2,7 @@ package dict
 
 import (
 	"gmr/go-cache/lib/utils"
+	"strconv"
 	"testing"
 )
 
@@ -45,3 +46,133 @@ func TestSimpleDict_PutIfExist(t *testing.T) {
 		return
 	}
 }
+
+func TestSimpleDict_Scan(t *testing.T) {
+	d := MakeSimpleDict()
+	size := 1000
+	for i := 0; i < size; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	for {
+		var keys []string
+		keys, cursor = d.Scan(cursor, 7)
+		for _, key := range keys {
+			seen[key]++
+		}
+		// 遍历过程中删除和新增的key不影响其他key
+		d.Remove("k" + strconv.Itoa(len(seen)))
+		d.Put("new"+strconv.Itoa(len(seen)), 0)
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < size; i++ {
+		key := "k" + strconv.Itoa(i)
+		if _, ok := d.Get(key); ok && seen[key] != 1 {
+			t.Errorf("expect key %s returned once, actual: %d", key, seen[key])
+		}
+	}
+}
+
+func TestSimpleDict_ScanBounded(t *testing.T) {
+	d := MakeSimpleDict()
+	size := 100000
+	for i := 0; i < size; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]struct{})
+	cursor := uint64(0)
+	steps := 0
+	for {
+		var keys []string
+		keys, cursor = d.Scan(cursor, 10)
+		steps++
+		// 每次只访问少量bucket，而不是遍历全部key
+		if len(keys) > 10+maxBucketLoad*4 {
+			t.Fatalf("expect about 10 keys per step, actual: %d", len(keys))
+		}
+		for _, key := range keys {
+			seen[key] = struct{}{}
+		}
+		// 遍历过程中扩容和缩容
+		if steps == 100 {
+			for i := size; i < size*2; i++ {
+				d.Put("k"+strconv.Itoa(i), i)
+			}
+		}
+		if steps == 200 {
+			for i := size; i < size*2; i++ {
+				d.Remove("k" + strconv.Itoa(i))
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < size; i++ {
+		if _, ok := seen["k"+strconv.Itoa(i)]; !ok {
+			t.Fatalf("key k%d is not returned", i)
+		}
+	}
+}
+
+func TestSimpleDict_ForEachRemove(t *testing.T) {
+	d := MakeSimpleDict()
+	size := 1000
+	for i := 0; i < size; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	visited := 0
+	d.ForEach(func(key string, val interface{}) bool {
+		visited++
+		d.Remove(key)
+		return true
+	})
+	if visited != size || d.Len() != 0 {
+		t.Errorf("expect %d keys visited and removed, actual: %d, remain: %d", size, visited, d.Len())
+	}
+}
+
+func TestSimpleDict_RandomKeys(t *testing.T) {
+	d := MakeSimpleDict()
+	size := 10
+	for i := 0; i < size; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	for _, limit := range []int{5, 20} {
+		for _, key := range d.RandomKeys(limit) {
+			if _, ok := d.Get(key); !ok {
+				t.Errorf("random key %q does not exist", key)
+			}
+		}
+	}
+	distinct := d.RandomDistinctKeys(5)
+	if len(distinct) != 5 {
+		t.Errorf("expect 5 distinct keys, actual: %d", len(distinct))
+	}
+	for _, key := range distinct {
+		if _, ok := d.Get(key); !ok {
+			t.Errorf("random key %q does not exist", key)
+		}
+	}
+}
+
+func TestSimpleDict_KeysContent(t *testing.T) {
+	d := MakeSimpleDict()
+	size := 10
+	for i := 0; i < size; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]bool)
+	for _, key := range d.Keys() {
+		if _, ok := d.Get(key); !ok {
+			t.Errorf("key %q does not exist", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) != size {
+		t.Errorf("expect %d distinct keys, actual: %d", size, len(seen))
+	}
+}
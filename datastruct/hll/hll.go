@@ -0,0 +1,254 @@
+package hll
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+/**
+ * @Author: wanglei
+ * @File: hll
+ * @Version: 1.0.0
+ * @Description: HyperLogLog，与Redis的存储格式一致，以字符串保存:
+ *               16字节的header("HYLL"、编码、3字节保留、8字节小端序的基数缓存)之后是sparse或dense编码的16384个寄存器
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	// precision 寄存器数量为2^precision
+	precision    = 14
+	registers    = 1 << precision
+	registerMask = registers - 1
+	registerBits = 6
+	registerMax  = 1<<registerBits - 1
+	// q 哈希值中用于计算前导零的位数
+	q = 64 - precision
+
+	headerSize = 16
+	denseSize  = headerSize + (registers*registerBits+7)/8
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// SparseMaxBytes sparse编码超过这个长度时转换为dense，与Redis的hll-sparse-max-bytes默认值一致
+	SparseMaxBytes = 3000
+
+	alphaInf = 0.721347520444481703680
+)
+
+var magic = []byte("HYLL")
+
+var (
+	ErrInvalid   = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+type HyperLogLog []byte
+
+// New 创建空的HyperLogLog，使用sparse编码
+func New() *HyperLogLog {
+	h := make(HyperLogLog, headerSize, headerSize+2)
+	copy(h, magic)
+	h[4] = encodingSparse
+	h = append(h, encodeSparse(make([]uint8, registers))...)
+	return &h
+}
+
+// FromBytes 检查header和长度，不是合法的HyperLogLog时返回ErrInvalid
+// 返回的HyperLogLog是b的拷贝，Add和Count不会修改b
+func FromBytes(b []byte) (*HyperLogLog, error) {
+	if len(b) < headerSize || !bytes.Equal(b[:4], magic) {
+		return nil, ErrInvalid
+	}
+	switch b[4] {
+	case encodingDense:
+		if len(b) != denseSize {
+			return nil, ErrInvalid
+		}
+	case encodingSparse:
+	default:
+		return nil, ErrInvalid
+	}
+	h := make(HyperLogLog, len(b))
+	copy(h, b)
+	return &h, nil
+}
+
+func (h *HyperLogLog) ToBytes() []byte {
+	return *h
+}
+
+func (h *HyperLogLog) isSparse() bool {
+	return (*h)[4] == encodingSparse
+}
+
+// CacheValid header中缓存的基数是否有效
+func (h *HyperLogLog) CacheValid() bool {
+	return (*h)[15]&(1<<7) == 0
+}
+
+func (h *HyperLogLog) invalidateCache() {
+	(*h)[15] |= 1 << 7
+}
+
+// hashElement 返回element对应的寄存器以及哈希值中第一个1出现的位置
+func hashElement(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, hashSeed)
+	index := int(hash & registerMask)
+	hash >>= precision
+	// 保证循环能够结束并且结果不超过q+1
+	hash |= 1 << q
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// Add 添加元素，有寄存器被修改时返回true
+func (h *HyperLogLog) Add(element []byte) (bool, error) {
+	index, count := hashElement(element)
+	if h.isSparse() {
+		updated, err := h.sparseSet(index, count)
+		if err != nil || !updated {
+			return false, err
+		}
+	} else {
+		regs := (*h)[headerSize:]
+		if denseGet(regs, index) >= count {
+			return false, nil
+		}
+		denseSet(regs, index, count)
+	}
+	h.invalidateCache()
+	return true, nil
+}
+
+// Count 返回估计的基数，缓存有效时直接使用缓存，否则计算后写入缓存
+func (h *HyperLogLog) Count() (uint64, error) {
+	if h.CacheValid() {
+		return binary.LittleEndian.Uint64((*h)[8:headerSize]), nil
+	}
+	var histogram [registerMax + 1]int
+	if h.isSparse() {
+		if err := sparseHistogram((*h)[headerSize:], &histogram); err != nil {
+			return 0, err
+		}
+	} else {
+		regs := (*h)[headerSize:]
+		for i := 0; i < registers; i++ {
+			histogram[denseGet(regs, i)]++
+		}
+	}
+	card := estimate(&histogram)
+	binary.LittleEndian.PutUint64((*h)[8:headerSize], card)
+	return card, nil
+}
+
+// MergeRegisters 将寄存器的值合并到max中，每个寄存器取较大的值
+func (h *HyperLogLog) MergeRegisters(max []uint8) error {
+	if h.isSparse() {
+		return sparseMerge((*h)[headerSize:], max)
+	}
+	regs := (*h)[headerSize:]
+	for i := 0; i < registers; i++ {
+		if val := denseGet(regs, i); val > max[i] {
+			max[i] = val
+		}
+	}
+	return nil
+}
+
+// SetRegisters 使用regs替换所有寄存器，useDense为false时尽量使用sparse编码
+func (h *HyperLogLog) SetRegisters(regs []uint8, useDense bool) {
+	header := append([]byte{}, (*h)[:headerSize]...)
+	if !useDense {
+		if sparse := encodeSparse(regs); sparse != nil && headerSize+len(sparse) <= SparseMaxBytes {
+			header[4] = encodingSparse
+			*h = append(header, sparse...)
+			h.invalidateCache()
+			return
+		}
+	}
+	*h = makeDense(header, regs)
+	h.invalidateCache()
+}
+
+// IsDense 是否使用dense编码
+func (h *HyperLogLog) IsDense() bool {
+	return !h.isSparse()
+}
+
+// MakeRegisters 创建用于MergeRegisters的寄存器数组
+func MakeRegisters() []uint8 {
+	return make([]uint8, registers)
+}
+
+// CountRegisters 计算合并后的寄存器的基数，用于PFCOUNT多个key
+func CountRegisters(regs []uint8) uint64 {
+	var histogram [registerMax + 1]int
+	for _, val := range regs {
+		histogram[val]++
+	}
+	return estimate(&histogram)
+}
+
+func makeDense(header []byte, regs []uint8) HyperLogLog {
+	dense := make(HyperLogLog, denseSize)
+	copy(dense, header)
+	dense[4] = encodingDense
+	for i, val := range regs {
+		if val > 0 {
+			denseSet(dense[headerSize:], i, val)
+		}
+	}
+	return dense
+}
+
+// estimate Otmar Ertl的改进算法，与Redis的hllCount一致
+func estimate(histogram *[registerMax + 1]int) uint64 {
+	m := float64(registers)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
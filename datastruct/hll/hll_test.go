@@ -0,0 +1,166 @@
+package hll
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: hll_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestEmpty(t *testing.T) {
+	h := New()
+	// 与Redis中空的HyperLogLog完全一致
+	expected := append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xff)
+	if !bytes.Equal(h.ToBytes(), expected) {
+		t.Fatalf("unexpected empty hll %q", h.ToBytes())
+	}
+	if card, err := h.Count(); err != nil || card != 0 {
+		t.Fatalf("expect 0, actual %d %v", card, err)
+	}
+}
+
+func TestAddAndCount(t *testing.T) {
+	h := New()
+	for _, n := range []int{10, 100, 1000, 100000} {
+		for i := 0; i < n; i++ {
+			h.Add([]byte("element:" + strconv.Itoa(i)))
+		}
+		card, err := h.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 标准误差为0.81%，这里允许3%
+		if math.Abs(float64(card)-float64(n))/float64(n) > 0.03 {
+			t.Fatalf("count %d elements, actual %d", n, card)
+		}
+		if n <= 100 && !h.isSparse() {
+			t.Fatal("small hll should be sparse")
+		}
+	}
+	if h.isSparse() || len(h.ToBytes()) != denseSize {
+		t.Fatal("large hll should be dense")
+	}
+	if updated, _ := h.Add([]byte("element:0")); updated {
+		t.Fatal("add existing element should not update registers")
+	}
+}
+
+func TestSparseAndDenseEqual(t *testing.T) {
+	sparse := New()
+	for i := 0; i < 200; i++ {
+		sparse.Add([]byte(strconv.Itoa(i)))
+	}
+	if !sparse.isSparse() {
+		t.Fatal("expect sparse")
+	}
+	regs := MakeRegisters()
+	if err := sparse.MergeRegisters(regs); err != nil {
+		t.Fatal(err)
+	}
+	dense := New()
+	dense.SetRegisters(regs, true)
+	if dense.isSparse() {
+		t.Fatal("expect dense")
+	}
+	for i := 0; i < registers; i++ {
+		if val, _ := sparseGet(sparse.ToBytes()[headerSize:], i); val != denseGet(dense.ToBytes()[headerSize:], i) {
+			t.Fatalf("register %d not equal", i)
+		}
+	}
+	c1, _ := sparse.Count()
+	c2, _ := dense.Count()
+	if c1 != c2 || c1 != CountRegisters(regs) {
+		t.Fatalf("count not equal: %d %d", c1, c2)
+	}
+}
+
+func TestFromBytes(t *testing.T) {
+	if _, err := FromBytes([]byte("hello")); err != ErrInvalid {
+		t.Fatal("expect ErrInvalid")
+	}
+	h := New()
+	corrupted := append([]byte{}, h.ToBytes()[:headerSize]...)
+	corrupted = append(corrupted, 0x00)
+	h, err := FromBytes(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.invalidateCache()
+	if _, err := h.Count(); err != ErrCorrupted {
+		t.Fatal("expect ErrCorrupted")
+	}
+}
+
+// redisHeader Redis中PFADD之后基数缓存失效的header
+func redisHeader(encoding byte) []byte {
+	return []byte{'H', 'Y', 'L', 'L', encoding, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80}
+}
+
+// 寄存器1000为2，1020和1021为3，sparse编码取自Redis hyperloglog.c中的示例:
+// XZERO:1000 VAL:2,1 ZERO:19 VAL:3,2 XZERO:15362
+var redisSparse = append(redisHeader(encodingSparse), 0x43, 0xe7, 0x84, 0x12, 0x89, 0x7c, 0x01)
+
+// redisDense 同样的寄存器在Redis中的dense编码，每个寄存器6位，从低位开始存放
+func redisDense() []byte {
+	b := append(redisHeader(encodingDense), make([]byte, denseSize-headerSize)...)
+	b[headerSize+750] = 0x02 // 寄存器1000
+	b[headerSize+765] = 0xc3 // 寄存器1020和1021
+	return b
+}
+
+func TestRedisEncoding(t *testing.T) {
+	for name, raw := range map[string][]byte{"sparse": redisSparse, "dense": redisDense()} {
+		stored := append([]byte{}, raw...)
+		h, err := FromBytes(stored)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		regs := MakeRegisters()
+		if err := h.MergeRegisters(regs); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i, val := range regs {
+			expected := uint8(0)
+			switch i {
+			case 1000:
+				expected = 2
+			case 1020, 1021:
+				expected = 3
+			}
+			if val != expected {
+				t.Fatalf("%s: register %d expect %d, actual %d", name, i, expected, val)
+			}
+		}
+		if card, err := h.Count(); err != nil || card != 3 {
+			t.Fatalf("%s: expect 3, actual %d %v", name, card, err)
+		}
+		if !h.CacheValid() || h.ToBytes()[8] != 3 {
+			t.Fatalf("%s: cardinality should be cached", name)
+		}
+		h.Add([]byte("a"))
+		// Count和Add只修改拷贝，不修改保存的字符串
+		if !bytes.Equal(stored, raw) {
+			t.Fatalf("%s: stored bytes are modified", name)
+		}
+	}
+
+	h, _ := FromBytes(redisSparse)
+	regs := MakeRegisters()
+	h.MergeRegisters(regs)
+	h.SetRegisters(regs, false)
+	if !bytes.Equal(h.ToBytes()[headerSize:], redisSparse[headerSize:]) {
+		t.Fatalf("sparse encoding differs from redis: %x", h.ToBytes()[headerSize:])
+	}
+	h.SetRegisters(regs, true)
+	if !bytes.Equal(h.ToBytes()[headerSize:], redisDense()[headerSize:]) {
+		t.Fatal("dense encoding differs from redis")
+	}
+}
@@ -0,0 +1,210 @@
+package hll
+
+/**
+ * @Author: wanglei
+ * @File: sparse
+ * @Version: 1.0.0
+ * @Description: sparse编码，由三种操作码组成:
+ *               ZERO  00xxxxxx          xxxxxx+1个值为0的寄存器，最多64个
+ *               XZERO 01xxxxxx yyyyyyyy 14位长度+1个值为0的寄存器，最多16384个
+ *               VAL   1vvvvvxx          xx+1个值为vvvvv+1的寄存器，值最大为32，最多4个
+ *               dense编码每个寄存器占6位，按照小端序依次排列
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	sparseXZeroBit   = 0x40
+	sparseValBit     = 0x80
+	sparseValMax     = 32
+	sparseValMaxLen  = 4
+	sparseZeroMaxLen = 64
+	sparseXZeroMax   = registers
+)
+
+// sparseForEach 依次解析操作码，fn返回false时停止
+func sparseForEach(data []byte, fn func(val uint8, runLen int) bool) error {
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b&0xc0 == 0:
+			if !fn(0, int(b&0x3f)+1) {
+				return nil
+			}
+			i++
+		case b&0xc0 == sparseXZeroBit:
+			if i+1 >= len(data) {
+				return ErrCorrupted
+			}
+			if !fn(0, (int(b&0x3f)<<8|int(data[i+1]))+1) {
+				return nil
+			}
+			i += 2
+		default:
+			if !fn((b>>2)&0x1f+1, int(b&0x3)+1) {
+				return nil
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// decodeSparse 将sparse编码展开为寄存器数组
+func decodeSparse(data []byte) ([]uint8, error) {
+	regs := make([]uint8, registers)
+	index := 0
+	overflow := false
+	err := sparseForEach(data, func(val uint8, runLen int) bool {
+		if index+runLen > registers {
+			overflow = true
+			return false
+		}
+		if val > 0 {
+			for i := 0; i < runLen; i++ {
+				regs[index+i] = val
+			}
+		}
+		index += runLen
+		return true
+	})
+	if err != nil || overflow || index != registers {
+		return nil, ErrCorrupted
+	}
+	return regs, nil
+}
+
+// encodeSparse 将寄存器数组编码为sparse，有寄存器的值超过32时返回nil
+func encodeSparse(regs []uint8) []byte {
+	var data []byte
+	for i := 0; i < len(regs); {
+		val := regs[i]
+		if val > sparseValMax {
+			return nil
+		}
+		j := i + 1
+		for j < len(regs) && regs[j] == val {
+			j++
+		}
+		for runLen := j - i; runLen > 0; {
+			n := runLen
+			switch {
+			case val > 0:
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				data = append(data, sparseValBit|(val-1)<<2|byte(n-1))
+			case n > sparseZeroMaxLen:
+				if n > sparseXZeroMax {
+					n = sparseXZeroMax
+				}
+				data = append(data, sparseXZeroBit|byte((n-1)>>8), byte((n-1)&0xff))
+			default:
+				data = append(data, byte(n-1))
+			}
+			runLen -= n
+		}
+		i = j
+	}
+	return data
+}
+
+// sparseGet 返回寄存器的值
+func sparseGet(data []byte, index int) (uint8, error) {
+	var result uint8
+	pos := 0
+	found := false
+	err := sparseForEach(data, func(val uint8, runLen int) bool {
+		if index < pos+runLen {
+			result = val
+			found = true
+			return false
+		}
+		pos += runLen
+		return true
+	})
+	if err != nil || !found {
+		return 0, ErrCorrupted
+	}
+	return result, nil
+}
+
+// sparseSet count大于寄存器当前的值时更新寄存器，值超过32或者编码后超过SparseMaxBytes时转换为dense
+func (h *HyperLogLog) sparseSet(index int, count uint8) (bool, error) {
+	data := (*h)[headerSize:]
+	current, err := sparseGet(data, index)
+	if err != nil {
+		return false, err
+	}
+	if count <= current {
+		return false, nil
+	}
+	regs, err := decodeSparse(data)
+	if err != nil {
+		return false, err
+	}
+	regs[index] = count
+	header := (*h)[:headerSize]
+	if sparse := encodeSparse(regs); sparse != nil && headerSize+len(sparse) <= SparseMaxBytes {
+		*h = append(append(make(HyperLogLog, 0, headerSize+len(sparse)), header...), sparse...)
+		return true, nil
+	}
+	*h = makeDense(header, regs)
+	return true, nil
+}
+
+func sparseHistogram(data []byte, histogram *[registerMax + 1]int) error {
+	total := 0
+	err := sparseForEach(data, func(val uint8, runLen int) bool {
+		histogram[val] += runLen
+		total += runLen
+		return true
+	})
+	if err != nil || total != registers {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+func sparseMerge(data []byte, max []uint8) error {
+	index := 0
+	overflow := false
+	err := sparseForEach(data, func(val uint8, runLen int) bool {
+		if index+runLen > registers {
+			overflow = true
+			return false
+		}
+		for i := index; i < index+runLen; i++ {
+			if val > max[i] {
+				max[i] = val
+			}
+		}
+		index += runLen
+		return true
+	})
+	if err != nil || overflow || index != registers {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// denseGet 返回第index个6位寄存器的值
+func denseGet(regs []byte, index int) uint8 {
+	pos := index * registerBits / 8
+	fb := uint(index * registerBits & 7)
+	val := regs[pos] >> fb
+	if pos+1 < len(regs) {
+		val |= regs[pos+1] << (8 - fb)
+	}
+	return val & registerMax
+}
+
+func denseSet(regs []byte, index int, val uint8) {
+	pos := index * registerBits / 8
+	fb := uint(index * registerBits & 7)
+	regs[pos] &^= registerMax << fb
+	regs[pos] |= val << fb
+	if pos+1 < len(regs) {
+		regs[pos+1] &^= registerMax >> (8 - fb)
+		regs[pos+1] |= val >> (8 - fb)
+	}
+}
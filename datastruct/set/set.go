@@ -117,3 +117,8 @@ func (s *Set) RandomMembers(limit int) []string {
 func (s *Set) RandomDistinctMembers(limit int) []string {
 	return s.dict.RandomDistinctKeys(limit)
 }
+
+// Scan 从cursor开始遍历至少count个member，返回的cursor为0表示遍历结束
+func (s *Set) Scan(cursor uint64, count int) ([]string, uint64) {
+	return s.dict.Scan(cursor, count)
+}
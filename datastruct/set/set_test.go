@@ -38,3 +38,26 @@ func TestSet(t *testing.T) {
 		}
 	}
 }
+
+func TestSet_Scan(t *testing.T) {
+	size := 100
+	set := MakeSet()
+	for i := 0; i < size; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	result := MakeSet()
+	cursor := uint64(0)
+	for {
+		var members []string
+		members, cursor = set.Scan(cursor, 10)
+		for _, member := range members {
+			result.Add(member)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if result.Len() != size {
+		t.Errorf("expect %d members, actual: %d", size, result.Len())
+	}
+}
@@ -18,13 +18,23 @@ const (
 	positiveInf int8 = 1
 )
 
+// border ScoreBorder和LexBorder的公共接口，skiplist按照border查找范围内的元素
+type border interface {
+	// greater border大于element，不包含边界时等于也返回false
+	greater(element *Element) bool
+	// less border小于element，不包含边界时等于也返回false
+	less(element *Element) bool
+	// isIntersected 以当前border为min，max为上界的范围内是否可能有元素
+	isIntersected(max border) bool
+}
+
 type ScoreBorder struct {
 	Inf     int8
 	Value   float64
 	Exclude bool
 }
 
-func (b *ScoreBorder) greater(val float64) bool {
+func (b *ScoreBorder) greater(element *Element) bool {
 	if b.Inf == negativeInf {
 		return false
 	} else if b.Inf == positiveInf {
@@ -32,12 +42,12 @@ func (b *ScoreBorder) greater(val float64) bool {
 	}
 
 	if b.Exclude {
-		return b.Value > val
+		return b.Value > element.Score
 	}
-	return b.Value >= val
+	return b.Value >= element.Score
 }
 
-func (b *ScoreBorder) less(val float64) bool {
+func (b *ScoreBorder) less(element *Element) bool {
 	if b.Inf == negativeInf {
 		return true
 	} else if b.Inf == positiveInf {
@@ -45,9 +55,20 @@ func (b *ScoreBorder) less(val float64) bool {
 	}
 
 	if b.Exclude {
-		return b.Value < val
+		return b.Value < element.Score
 	}
-	return b.Value <= val
+	return b.Value <= element.Score
+}
+
+func (b *ScoreBorder) isIntersected(max border) bool {
+	m := max.(*ScoreBorder)
+	if b.Inf == positiveInf || m.Inf == negativeInf {
+		return false
+	}
+	if b.Inf == negativeInf || m.Inf == positiveInf {
+		return true
+	}
+	return b.Value < m.Value || (b.Value == m.Value && !b.Exclude && !m.Exclude)
 }
 
 var positiveInfBorder = &ScoreBorder{
@@ -66,7 +87,7 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		return negativeInfBorder, nil
 	}
 
-	if s[0] == '(' {
+	if len(s) > 0 && s[0] == '(' {
 		value, err := strconv.ParseFloat(s[1:], 64)
 		if err != nil {
 			return nil, errors.New("ERR min or max is not a float")
@@ -88,3 +109,73 @@ func ParseScoreBorder(s string) (*ScoreBorder, error) {
 		Exclude: false,
 	}, nil
 }
+
+// LexBorder ZRANGEBYLEX等命令中的member范围，"-"和"+"表示负无穷和正无穷，
+// "["表示包含边界，"("表示不包含边界。所有member的score相同时才有意义
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (b *LexBorder) greater(element *Element) bool {
+	if b.Inf == negativeInf {
+		return false
+	} else if b.Inf == positiveInf {
+		return true
+	}
+
+	if b.Exclude {
+		return b.Value > element.Member
+	}
+	return b.Value >= element.Member
+}
+
+func (b *LexBorder) less(element *Element) bool {
+	if b.Inf == negativeInf {
+		return true
+	} else if b.Inf == positiveInf {
+		return false
+	}
+
+	if b.Exclude {
+		return b.Value < element.Member
+	}
+	return b.Value <= element.Member
+}
+
+func (b *LexBorder) isIntersected(max border) bool {
+	m := max.(*LexBorder)
+	if b.Inf == positiveInf || m.Inf == negativeInf {
+		return false
+	}
+	if b.Inf == negativeInf || m.Inf == positiveInf {
+		return true
+	}
+	return b.Value < m.Value || (b.Value == m.Value && !b.Exclude && !m.Exclude)
+}
+
+var positiveInfLexBorder = &LexBorder{
+	Inf: positiveInf,
+}
+
+var negativeInfLexBorder = &LexBorder{
+	Inf: negativeInf,
+}
+
+func ParseLexBorder(s string) (*LexBorder, error) {
+	if s == "+" {
+		return positiveInfLexBorder, nil
+	}
+	if s == "-" {
+		return negativeInfLexBorder, nil
+	}
+	if s == "" || (s[0] != '(' && s[0] != '[') {
+		return nil, errors.New("ERR min or max not valid string range item")
+	}
+	return &LexBorder{
+		Inf:     0,
+		Value:   s[1:],
+		Exclude: s[0] == '(',
+	}, nil
+}
@@ -201,7 +201,8 @@ func (s *skiplist) getRank(member string, score float64) int64 {
 			x = x.level[i].forward
 		}
 
-		if x.Member == member {
+		// header的member为空字符串，不能与member为空字符串的元素混淆
+		if x != s.header && x.Member == member {
 			return rank
 		}
 	}
@@ -229,26 +230,26 @@ func (s *skiplist) getByRank(rank int64) *node {
 	return nil
 }
 
-func (s *skiplist) hasInRange(min *ScoreBorder, max *ScoreBorder) bool {
-	if min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+func (s *skiplist) hasInRange(min border, max border) bool {
+	if !min.isIntersected(max) {
 		return false
 	}
 
 	n := s.tail
 
-	if n == nil || !min.less(n.Score) {
+	if n == nil || !min.less(&n.Element) {
 		return false
 	}
 
 	n = s.header.level[0].forward
-	if n == nil || !max.greater(n.Score) {
+	if n == nil || !max.greater(&n.Element) {
 		return false
 	}
 
 	return true
 }
 
-func (s *skiplist) getFirstInScoreRange(min *ScoreBorder, max *ScoreBorder) *node {
+func (s *skiplist) getFirstInRange(min border, max border) *node {
 	// 判断是否在限定范围内
 	if !s.hasInRange(min, max) {
 		return nil
@@ -260,38 +261,38 @@ func (s *skiplist) getFirstInScoreRange(min *ScoreBorder, max *ScoreBorder) *nod
 	for level := s.level - 1; level >= 0; level-- {
 		// 若forward节点未在范围则向前查找
 		// 若forward在范围，当 level > 0 时 forward 节点不能保证是 *第一个* 在 min 范围内的节点， 因此需进入下一层查找
-		for n.level[level].forward != nil && !min.less(n.level[level].forward.Score) {
+		for n.level[level].forward != nil && !min.less(&n.level[level].forward.Element) {
 			n = n.level[level].forward
 		}
 	}
 
 	// 当从外层循环退出时 level=0 (最下层), n.level[0].forward 一定是 min 范围内的第一个节点
 	n = n.level[0].forward
-	if !max.greater(n.Score) {
+	if !max.greater(&n.Element) {
 		return nil
 	}
 	return n
 }
 
-func (s *skiplist) getLastInScoreRange(min *ScoreBorder, max *ScoreBorder) *node {
+func (s *skiplist) getLastInRange(min border, max border) *node {
 	if !s.hasInRange(min, max) {
 		return nil
 	}
 
 	n := s.header
 	for level := s.level - 1; level >= 0; level-- {
-		for n.level[level].forward != nil && max.greater(n.level[level].forward.Score) {
+		for n.level[level].forward != nil && max.greater(&n.level[level].forward.Element) {
 			n = n.level[level].forward
 		}
 	}
 
-	if !min.less(n.Score) {
+	if !min.less(&n.Element) {
 		return nil
 	}
 	return n
 }
 
-func (s *skiplist) RemoveRangeByScore(min *ScoreBorder, max *ScoreBorder) (removed []*Element) {
+func (s *skiplist) RemoveRange(min border, max border) (removed []*Element) {
 	update := make([]*node, maxLevel)
 	removed = make([]*Element, 0)
 
@@ -299,7 +300,7 @@ func (s *skiplist) RemoveRangeByScore(min *ScoreBorder, max *ScoreBorder) (remov
 
 	for i := s.level - 1; i >= 0; i-- {
 		for node.level[i].forward != nil {
-			if min.less(node.level[i].forward.Score) {
+			if min.less(&node.level[i].forward.Element) {
 				break
 			}
 			node = node.level[i].forward
@@ -310,7 +311,7 @@ func (s *skiplist) RemoveRangeByScore(min *ScoreBorder, max *ScoreBorder) (remov
 	node = node.level[0].forward
 
 	for node != nil {
-		if !max.greater(node.Score) {
+		if !max.greater(&node.Element) {
 			break
 		}
 
@@ -1,6 +1,9 @@
 package sortedset
 
-import "strconv"
+import (
+	"gmr/go-cache/datastruct/dict"
+	"strconv"
+)
 
 /**
  * @Author: wanglei
@@ -11,23 +14,31 @@ import "strconv"
  */
 
 type SortedSet struct {
-	dict     map[string]*Element
+	dict     *dict.SimpleDict
 	skiplist *skiplist
 }
 
 func MakeSortedSet() *SortedSet {
 	return &SortedSet{
-		dict:     make(map[string]*Element),
+		dict:     dict.MakeSimpleDict(),
 		skiplist: makeSkiplist(),
 	}
 }
 
+func (ss *SortedSet) getElement(member string) (*Element, bool) {
+	val, ok := ss.dict.Get(member)
+	if !ok {
+		return nil, false
+	}
+	return val.(*Element), true
+}
+
 func (ss *SortedSet) Add(member string, score float64) bool {
-	element, ok := ss.dict[member]
-	ss.dict[member] = &Element{
+	element, ok := ss.getElement(member)
+	ss.dict.Put(member, &Element{
 		Member: member,
 		Score:  score,
-	}
+	})
 
 	if ok {
 		if score != element.Score {
@@ -41,11 +52,11 @@ func (ss *SortedSet) Add(member string, score float64) bool {
 }
 
 func (ss *SortedSet) Len() int64 {
-	return int64(len(ss.dict))
+	return int64(ss.dict.Len())
 }
 
 func (ss *SortedSet) Get(member string) (element *Element, ok bool) {
-	element, ok = ss.dict[member]
+	element, ok = ss.getElement(member)
 	if !ok {
 		return nil, false
 	}
@@ -53,17 +64,17 @@ func (ss *SortedSet) Get(member string) (element *Element, ok bool) {
 }
 
 func (ss *SortedSet) Remove(member string) bool {
-	v, ok := ss.dict[member]
+	v, ok := ss.getElement(member)
 	if ok {
 		ss.skiplist.remove(member, v.Score)
-		delete(ss.dict, member)
+		ss.dict.Remove(member)
 		return true
 	}
 	return false
 }
 
 func (ss *SortedSet) GetRank(member string, desc bool) (rank int64) {
-	element, ok := ss.dict[member]
+	element, ok := ss.getElement(member)
 	if !ok {
 		return -1
 	}
@@ -125,28 +136,39 @@ func (ss *SortedSet) Range(start int64, stop int64, desc bool) []*Element {
 }
 
 func (ss *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
-	var i int64 = 0
-	ss.ForEach(0, ss.Len(), false, func(element *Element) bool {
-		gtMin := min.less(element.Score) // greater than min
-		if !gtMin {
-			return true
-		}
-		ltMax := max.greater(element.Score) // less than max
-		if !ltMax {
-			return false
-		}
-		i++
-		return true
-	})
-	return i
+	return ss.rangeCount(min, max)
+}
+
+// LexCount 返回member在[min, max]范围内的元素数量
+func (ss *SortedSet) LexCount(min *LexBorder, max *LexBorder) int64 {
+	return ss.rangeCount(min, max)
+}
+
+// rangeCount 通过范围内第一个和最后一个元素的排名计算数量
+func (ss *SortedSet) rangeCount(min border, max border) int64 {
+	first := ss.skiplist.getFirstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := ss.skiplist.getLastInRange(min, max)
+	return ss.skiplist.getRank(last.Member, last.Score) - ss.skiplist.getRank(first.Member, first.Score) + 1
 }
 
 func (ss *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	ss.forEachInRange(min, max, offset, limit, desc, consumer)
+}
+
+// ForEachByLex 按照member的字典序遍历范围内的元素，limit小于0时不限制数量
+func (ss *SortedSet) ForEachByLex(min *LexBorder, max *LexBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	ss.forEachInRange(min, max, offset, limit, desc, consumer)
+}
+
+func (ss *SortedSet) forEachInRange(min border, max border, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
 	var node *node
 	if desc {
-		node = ss.skiplist.getLastInScoreRange(min, max)
+		node = ss.skiplist.getLastInRange(min, max)
 	} else {
-		node = ss.skiplist.getFirstInScoreRange(min, max)
+		node = ss.skiplist.getFirstInRange(min, max)
 	}
 
 	for node != nil && offset > 0 {
@@ -160,6 +182,9 @@ func (ss *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset i
 
 	// A negative limit returns all elements from the offset
 	for i := 0; (i < int(limit) || limit < 0) && node != nil; i++ {
+		if !min.less(&node.Element) || !max.greater(&node.Element) {
+			break // break through border
+		}
 		if !consumer(&node.Element) {
 			break
 		}
@@ -168,25 +193,27 @@ func (ss *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset i
 		} else {
 			node = node.level[0].forward
 		}
-		if node == nil {
-			break
-		}
-		gtMin := min.less(node.Element.Score) // greater than min
-		ltMax := max.greater(node.Element.Score)
-		if !gtMin || !ltMax {
-			break // break through score border
-		}
 	}
 }
 
 // RangeByScore returns members which score within the given border
 // param limit: <0 means no limit
 func (ss *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool) []*Element {
+	return ss.rangeByBorder(min, max, offset, limit, desc)
+}
+
+// RangeByLex returns members within the given lex border
+// param limit: <0 means no limit
+func (ss *SortedSet) RangeByLex(min *LexBorder, max *LexBorder, offset int64, limit int64, desc bool) []*Element {
+	return ss.rangeByBorder(min, max, offset, limit, desc)
+}
+
+func (ss *SortedSet) rangeByBorder(min border, max border, offset int64, limit int64, desc bool) []*Element {
 	if limit == 0 || offset < 0 {
 		return make([]*Element, 0)
 	}
 	slice := make([]*Element, 0)
-	ss.ForEachByScore(min, max, offset, limit, desc, func(element *Element) bool {
+	ss.forEachInRange(min, max, offset, limit, desc, func(element *Element) bool {
 		slice = append(slice, element)
 		return true
 	})
@@ -195,9 +222,18 @@ func (ss *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int
 
 // RemoveByScore removes members which score within the given border
 func (ss *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
-	removed := ss.skiplist.RemoveRangeByScore(min, max)
+	return ss.removeByBorder(min, max)
+}
+
+// RemoveByLex removes members within the given lex border
+func (ss *SortedSet) RemoveByLex(min *LexBorder, max *LexBorder) int64 {
+	return ss.removeByBorder(min, max)
+}
+
+func (ss *SortedSet) removeByBorder(min border, max border) int64 {
+	removed := ss.skiplist.RemoveRange(min, max)
 	for _, element := range removed {
-		delete(ss.dict, element.Member)
+		ss.dict.Remove(element.Member)
 	}
 	return int64(len(removed))
 }
@@ -205,7 +241,45 @@ func (ss *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
 func (ss *SortedSet) RemoveByRank(start int64, stop int64) int64 {
 	removed := ss.skiplist.RemoveRangeByRank(start+1, stop+1)
 	for _, element := range removed {
-		delete(ss.dict, element.Member)
+		ss.dict.Remove(element.Member)
 	}
 	return int64(len(removed))
 }
+
+// PopMin 删除并返回score最小的count个元素，按照score从小到大排列
+func (ss *SortedSet) PopMin(count int64) []*Element {
+	if count > ss.Len() {
+		count = ss.Len()
+	}
+	removed := ss.skiplist.RemoveRangeByRank(1, count+1)
+	for _, element := range removed {
+		ss.dict.Remove(element.Member)
+	}
+	return removed
+}
+
+// PopMax 删除并返回score最大的count个元素，按照score从大到小排列
+func (ss *SortedSet) PopMax(count int64) []*Element {
+	size := ss.Len()
+	if count > size {
+		count = size
+	}
+	removed := ss.skiplist.RemoveRangeByRank(size-count+1, size+1)
+	for _, element := range removed {
+		ss.dict.Remove(element.Member)
+	}
+	for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+		removed[i], removed[j] = removed[j], removed[i]
+	}
+	return removed
+}
+
+// Scan 按照dict的bucket遍历，返回的cursor为0表示遍历结束
+func (ss *SortedSet) Scan(cursor uint64, count int) ([]*Element, uint64) {
+	members, next := ss.dict.Scan(cursor, count)
+	elements := make([]*Element, len(members))
+	for i, member := range members {
+		elements[i], _ = ss.getElement(member)
+	}
+	return elements, next
+}
@@ -0,0 +1,187 @@
+package sortedset
+
+import (
+	"strconv"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: sortedset_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func membersOf(elements []*Element) string {
+	s := ""
+	for _, element := range elements {
+		s += element.Member
+	}
+	return s
+}
+
+func mustScoreBorder(t *testing.T, s string) *ScoreBorder {
+	b, err := ParseScoreBorder(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustLexBorder(t *testing.T, s string) *LexBorder {
+	b, err := ParseLexBorder(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSortedSet_RangeByScore(t *testing.T) {
+	ss := MakeSortedSet()
+	for i := 0; i < 10; i++ {
+		ss.Add(strconv.Itoa(i), float64(i-5))
+	}
+	cases := []struct {
+		min, max string
+		offset   int64
+		limit    int64
+		desc     bool
+		expect   string
+	}{
+		{"-inf", "+inf", 0, -1, false, "0123456789"},
+		{"-inf", "-3", 0, -1, false, "012"},
+		{"(-3", "0", 0, -1, false, "345"},
+		{"2", "+inf", 0, -1, true, "987"},
+		{"-inf", "+inf", 2, 3, false, "234"},
+		{"-inf", "-4", 1, 5, true, "0"},
+		{"-inf", "-4", 5, 5, false, ""},
+		{"3", "(3", 0, -1, false, ""},
+		{"5", "-5", 0, -1, false, ""},
+	}
+	for _, c := range cases {
+		min, max := mustScoreBorder(t, c.min), mustScoreBorder(t, c.max)
+		actual := membersOf(ss.RangeByScore(min, max, c.offset, c.limit, c.desc))
+		if actual != c.expect {
+			t.Errorf("range %s %s: expect %q, actual %q", c.min, c.max, c.expect, actual)
+		}
+		if c.offset == 0 && c.limit < 0 && ss.Count(min, max) != int64(len(c.expect)) {
+			t.Errorf("count %s %s: expect %d, actual %d", c.min, c.max, len(c.expect), ss.Count(min, max))
+		}
+	}
+}
+
+func TestSortedSet_RangeByLex(t *testing.T) {
+	ss := MakeSortedSet()
+	for _, member := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		ss.Add(member, 0)
+	}
+	cases := []struct {
+		min, max string
+		desc     bool
+		expect   string
+	}{
+		{"-", "+", false, "abcdefg"},
+		{"-", "[c", false, "abc"},
+		{"-", "(c", false, "ab"},
+		{"[aaa", "(g", false, "bcdef"},
+		{"[b", "[d", true, "dcb"},
+		{"(g", "+", false, ""},
+		{"[e", "[b", false, ""},
+	}
+	for _, c := range cases {
+		min, max := mustLexBorder(t, c.min), mustLexBorder(t, c.max)
+		actual := membersOf(ss.RangeByLex(min, max, 0, -1, c.desc))
+		if actual != c.expect {
+			t.Errorf("range %s %s: expect %q, actual %q", c.min, c.max, c.expect, actual)
+		}
+		if ss.LexCount(min, max) != int64(len(c.expect)) {
+			t.Errorf("count %s %s: expect %d, actual %d", c.min, c.max, len(c.expect), ss.LexCount(min, max))
+		}
+	}
+	if _, err := ParseLexBorder("a"); err == nil {
+		t.Error("expect error for lex border without ( or [")
+	}
+
+	removed := ss.RemoveByLex(mustLexBorder(t, "(b"), mustLexBorder(t, "[e"))
+	if removed != 3 || membersOf(ss.RangeByLex(negativeInfLexBorder, positiveInfLexBorder, 0, -1, false)) != "abfg" {
+		t.Errorf("unexpected result after RemoveByLex, removed %d", removed)
+	}
+	if _, ok := ss.Get("c"); ok {
+		t.Error("removed member still exists")
+	}
+}
+
+func TestSortedSet_Pop(t *testing.T) {
+	ss := MakeSortedSet()
+	for i := 0; i < 6; i++ {
+		ss.Add(strconv.Itoa(i), float64(i))
+	}
+	if actual := membersOf(ss.PopMin(2)); actual != "01" {
+		t.Errorf("expect 01, actual %q", actual)
+	}
+	if actual := membersOf(ss.PopMax(2)); actual != "54" {
+		t.Errorf("expect 54, actual %q", actual)
+	}
+	if actual := membersOf(ss.PopMax(10)); actual != "32" {
+		t.Errorf("expect 32, actual %q", actual)
+	}
+	if ss.Len() != 0 || len(ss.PopMin(1)) != 0 {
+		t.Error("expect empty sorted set")
+	}
+}
+
+// scanAll 使用cursor遍历整个有序集合
+func scanAll(ss *SortedSet) map[string]float64 {
+	result := make(map[string]float64)
+	var cursor uint64
+	for {
+		elements, next := ss.Scan(cursor, 10)
+		for _, element := range elements {
+			result[element.Member] = element.Score
+		}
+		if next == 0 {
+			return result
+		}
+		cursor = next
+	}
+}
+
+func TestSortedSet_Scan(t *testing.T) {
+	ss := MakeSortedSet()
+	for i := 0; i < 1000; i++ {
+		ss.Add(strconv.Itoa(i), float64(i))
+	}
+	ss.Add("0", -1)
+	scanned := scanAll(ss)
+	if len(scanned) != 1000 {
+		t.Fatalf("expect 1000 members scanned, actual: %d", len(scanned))
+	}
+	if scanned["0"] != -1 || scanned["999"] != 999 {
+		t.Errorf("unexpected scores %v %v", scanned["0"], scanned["999"])
+	}
+
+	for i := 0; i < 1000; i += 2 {
+		if !ss.Remove(strconv.Itoa(i)) {
+			t.Fatalf("remove %d failed", i)
+		}
+	}
+	if ss.Remove("0") {
+		t.Errorf("member 0 has been removed")
+	}
+	if ss.Len() != 500 {
+		t.Errorf("expect 500 members, actual: %d", ss.Len())
+	}
+	scanned = scanAll(ss)
+	if len(scanned) != 500 {
+		t.Fatalf("expect 500 members scanned, actual: %d", len(scanned))
+	}
+	for member := range scanned {
+		if i, _ := strconv.Atoi(member); i%2 == 0 {
+			t.Errorf("removed member %s scanned", member)
+		}
+	}
+	if rank := ss.GetRank("1", false); rank != 0 {
+		t.Errorf("expect rank 0, actual: %d", rank)
+	}
+}
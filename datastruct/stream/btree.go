@@ -0,0 +1,335 @@
+package stream
+
+import "sort"
+
+/**
+ * @Author: wanglei
+ * @File: btree
+ * @Version: 1.0.0
+ * @Description: 以ID为key的B-tree，stream的entries和pending entries list都保存在B-tree中，
+ *               支持按照ID有序遍历以及从任意ID开始的范围查询
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	// degree B-tree的最小度数，除根节点外每个节点有degree-1到2*degree-1个item
+	degree   = 16
+	maxItems = 2*degree - 1
+)
+
+type item struct {
+	id    ID
+	value interface{}
+}
+
+type node struct {
+	items    []item
+	children []*node
+}
+
+type btree struct {
+	root   *node
+	length int
+}
+
+func makeBTree() *btree {
+	return &btree{}
+}
+
+func (t *btree) Len() int {
+	return t.length
+}
+
+// find 返回第一个不小于id的item的位置，以及该位置的item是否等于id
+func (n *node) find(id ID) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return !n.items[i].id.Less(id)
+	})
+	return i, i < len(n.items) && n.items[i].id == id
+}
+
+func (n *node) leaf() bool {
+	return len(n.children) == 0
+}
+
+func insertItem(items []item, i int, it item) []item {
+	items = append(items, item{})
+	copy(items[i+1:], items[i:])
+	items[i] = it
+	return items
+}
+
+func removeItem(items []item, i int) []item {
+	copy(items[i:], items[i+1:])
+	items[len(items)-1] = item{}
+	return items[:len(items)-1]
+}
+
+func insertChild(children []*node, i int, child *node) []*node {
+	children = append(children, nil)
+	copy(children[i+1:], children[i:])
+	children[i] = child
+	return children
+}
+
+func removeChild(children []*node, i int) []*node {
+	copy(children[i:], children[i+1:])
+	children[len(children)-1] = nil
+	return children[:len(children)-1]
+}
+
+func (t *btree) Get(id ID) (interface{}, bool) {
+	n := t.root
+	for n != nil {
+		i, found := n.find(id)
+		if found {
+			return n.items[i].value, true
+		}
+		if n.leaf() {
+			return nil, false
+		}
+		n = n.children[i]
+	}
+	return nil, false
+}
+
+// Put 插入或者覆盖，新插入时返回true
+func (t *btree) Put(id ID, value interface{}) bool {
+	it := item{id: id, value: value}
+	if t.root == nil {
+		t.root = &node{items: []item{it}}
+		t.length++
+		return true
+	}
+	if len(t.root.items) == maxItems {
+		root := &node{children: []*node{t.root}}
+		root.splitChild(0)
+		t.root = root
+	}
+	if t.root.insertNonFull(it) {
+		t.length++
+		return true
+	}
+	return false
+}
+
+// splitChild 将已满的第i个子节点从中间拆分成两个节点，中间的item上移到当前节点
+func (n *node) splitChild(i int) {
+	child := n.children[i]
+	mid := degree - 1
+	right := &node{
+		items: append([]item(nil), child.items[mid+1:]...),
+	}
+	if !child.leaf() {
+		right.children = append([]*node(nil), child.children[mid+1:]...)
+		for j := mid + 1; j < len(child.children); j++ {
+			child.children[j] = nil
+		}
+		child.children = child.children[:mid+1]
+	}
+	midItem := child.items[mid]
+	for j := mid; j < len(child.items); j++ {
+		child.items[j] = item{}
+	}
+	child.items = child.items[:mid]
+	n.items = insertItem(n.items, i, midItem)
+	n.children = insertChild(n.children, i+1, right)
+}
+
+func (n *node) insertNonFull(it item) bool {
+	for {
+		i, found := n.find(it.id)
+		if found {
+			n.items[i].value = it.value
+			return false
+		}
+		if n.leaf() {
+			n.items = insertItem(n.items, i, it)
+			return true
+		}
+		if len(n.children[i].items) == maxItems {
+			n.splitChild(i)
+			switch it.id.Compare(n.items[i].id) {
+			case 0:
+				n.items[i].value = it.value
+				return false
+			case 1:
+				i++
+			}
+		}
+		n = n.children[i]
+	}
+}
+
+// Remove 删除id，返回被删除的value
+func (t *btree) Remove(id ID) (interface{}, bool) {
+	if t.root == nil {
+		return nil, false
+	}
+	value, ok := t.root.remove(id)
+	if len(t.root.items) == 0 {
+		if t.root.leaf() {
+			t.root = nil
+		} else {
+			t.root = t.root.children[0]
+		}
+	}
+	if ok {
+		t.length--
+	}
+	return value, ok
+}
+
+// remove 进入子节点之前保证子节点至少有degree个item，删除之后子节点不会少于degree-1个item
+func (n *node) remove(id ID) (interface{}, bool) {
+	i, found := n.find(id)
+	if n.leaf() {
+		if !found {
+			return nil, false
+		}
+		value := n.items[i].value
+		n.items = removeItem(n.items, i)
+		return value, true
+	}
+	if found {
+		value := n.items[i].value
+		if len(n.children[i].items) >= degree {
+			pred := n.children[i].max()
+			n.items[i] = pred
+			n.children[i].remove(pred.id)
+			return value, true
+		}
+		if len(n.children[i+1].items) >= degree {
+			succ := n.children[i+1].min()
+			n.items[i] = succ
+			n.children[i+1].remove(succ.id)
+			return value, true
+		}
+		n.merge(i)
+		return n.children[i].remove(id)
+	}
+	if len(n.children[i].items) < degree {
+		if i > 0 && len(n.children[i-1].items) >= degree {
+			n.borrowFromLeft(i)
+		} else if i < len(n.children)-1 && len(n.children[i+1].items) >= degree {
+			n.borrowFromRight(i)
+		} else if i < len(n.children)-1 {
+			n.merge(i)
+		} else {
+			n.merge(i - 1)
+			i--
+		}
+	}
+	return n.children[i].remove(id)
+}
+
+func (n *node) borrowFromLeft(i int) {
+	child, left := n.children[i], n.children[i-1]
+	child.items = insertItem(child.items, 0, n.items[i-1])
+	n.items[i-1] = left.items[len(left.items)-1]
+	left.items = removeItem(left.items, len(left.items)-1)
+	if !left.leaf() {
+		child.children = insertChild(child.children, 0, left.children[len(left.children)-1])
+		left.children = removeChild(left.children, len(left.children)-1)
+	}
+}
+
+func (n *node) borrowFromRight(i int) {
+	child, right := n.children[i], n.children[i+1]
+	child.items = append(child.items, n.items[i])
+	n.items[i] = right.items[0]
+	right.items = removeItem(right.items, 0)
+	if !right.leaf() {
+		child.children = append(child.children, right.children[0])
+		right.children = removeChild(right.children, 0)
+	}
+}
+
+// merge 将第i个item和第i+1个子节点合并到第i个子节点中
+func (n *node) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	n.items = removeItem(n.items, i)
+	n.children = removeChild(n.children, i+1)
+}
+
+func (n *node) min() item {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *node) max() item {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
+
+// Min 返回最小的item
+func (t *btree) Min() (ID, interface{}, bool) {
+	if t.root == nil {
+		return ID{}, nil, false
+	}
+	it := t.root.min()
+	return it.id, it.value, true
+}
+
+// Max 返回最大的item
+func (t *btree) Max() (ID, interface{}, bool) {
+	if t.root == nil {
+		return ID{}, nil, false
+	}
+	it := t.root.max()
+	return it.id, it.value, true
+}
+
+// Ascend 从不小于from的item开始按照ID递增遍历，consumer返回false时停止
+func (t *btree) Ascend(from ID, consumer func(id ID, value interface{}) bool) {
+	if t.root != nil {
+		t.root.ascend(from, consumer)
+	}
+}
+
+func (n *node) ascend(from ID, consumer func(id ID, value interface{}) bool) bool {
+	i, _ := n.find(from)
+	for ; i < len(n.items); i++ {
+		if !n.leaf() && !n.children[i].ascend(from, consumer) {
+			return false
+		}
+		if !consumer(n.items[i].id, n.items[i].value) {
+			return false
+		}
+	}
+	if !n.leaf() {
+		return n.children[i].ascend(from, consumer)
+	}
+	return true
+}
+
+// Descend 从不大于from的item开始按照ID递减遍历，consumer返回false时停止
+func (t *btree) Descend(from ID, consumer func(id ID, value interface{}) bool) {
+	if t.root != nil {
+		t.root.descend(from, consumer)
+	}
+}
+
+func (n *node) descend(from ID, consumer func(id ID, value interface{}) bool) bool {
+	i, found := n.find(from)
+	if found && !consumer(n.items[i].id, n.items[i].value) {
+		return false
+	}
+	// 第i个子节点中的item都小于items[i]，之后依次是items[j]和第j个子节点
+	for j := i; j >= 0; j-- {
+		if j < i && !consumer(n.items[j].id, n.items[j].value) {
+			return false
+		}
+		if !n.leaf() && !n.children[j].descend(from, consumer) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: btree_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestBTree(t *testing.T) {
+	tree := makeBTree()
+	expected := make(map[ID]int)
+	for i := 0; i < 5000; i++ {
+		id := ID{Ms: uint64(rand.Intn(2000)), Seq: uint64(rand.Intn(3))}
+		if rand.Intn(3) == 0 {
+			_, ok := tree.Remove(id)
+			_, exists := expected[id]
+			if ok != exists {
+				t.Fatalf("remove %s: expect %v actual %v", id, exists, ok)
+			}
+			delete(expected, id)
+			continue
+		}
+		tree.Put(id, i)
+		expected[id] = i
+	}
+	if tree.Len() != len(expected) {
+		t.Fatalf("expect len %d actual %d", len(expected), tree.Len())
+	}
+
+	ids := make([]ID, 0, len(expected))
+	for id := range expected {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+
+	i := 0
+	tree.Ascend(MinID, func(id ID, value interface{}) bool {
+		if id != ids[i] || value.(int) != expected[id] {
+			t.Fatalf("ascend at %d: expect %s actual %s", i, ids[i], id)
+		}
+		i++
+		return true
+	})
+	if i != len(ids) {
+		t.Fatalf("ascend visited %d items, expect %d", i, len(ids))
+	}
+
+	from := ID{Ms: 1000}
+	start := sort.Search(len(ids), func(i int) bool {
+		return !ids[i].Less(from)
+	})
+	i = start
+	tree.Ascend(from, func(id ID, value interface{}) bool {
+		if id != ids[i] {
+			t.Fatalf("ascend from %s: expect %s actual %s", from, ids[i], id)
+		}
+		i++
+		return true
+	})
+
+	i = start - 1
+	if start < len(ids) && ids[start] == from {
+		i = start
+	}
+	tree.Descend(from, func(id ID, value interface{}) bool {
+		if id != ids[i] {
+			t.Fatalf("descend from %s: expect %s actual %s", from, ids[i], id)
+		}
+		i--
+		return true
+	})
+	if i != -1 {
+		t.Fatalf("descend stopped at %d", i)
+	}
+
+	for _, id := range ids {
+		if _, ok := tree.Remove(id); !ok {
+			t.Fatalf("remove %s failed", id)
+		}
+	}
+	if tree.Len() != 0 || tree.root != nil {
+		t.Fatal("tree should be empty")
+	}
+}
@@ -0,0 +1,170 @@
+package stream
+
+import "sort"
+
+/**
+ * @Author: wanglei
+ * @File: group
+ * @Version: 1.0.0
+ * @Description: consumer group，pending entries list(PEL)保存已经投递但是没有XACK的entry，
+ *               每个consumer也保存一份自己的PEL，方便按照consumer查询
+ * @Date: 2026/10/18 10:12
+ */
+
+// Group consumer group
+type Group struct {
+	Name string
+	// LastID 最后一个投递给consumer的ID
+	LastID ID
+	// EntriesRead 已经读取的entry数量，-1表示未知
+	EntriesRead int64
+	// ID:*PendingEntry
+	pel       *btree
+	consumers map[string]*Consumer
+}
+
+// PendingEntry 已经投递但是没有确认的entry
+type PendingEntry struct {
+	ID       ID
+	Consumer *Consumer
+	// DeliveryTime 最后一次投递的毫秒时间戳
+	DeliveryTime  int64
+	DeliveryCount uint64
+}
+
+type Consumer struct {
+	Name string
+	// SeenTime 最后一次读取或者claim的毫秒时间戳
+	SeenTime int64
+	// ID:*PendingEntry
+	pending *btree
+}
+
+func (c *Consumer) PendingLen() int {
+	return c.pending.Len()
+}
+
+// PendingRange 返回consumer的PEL中[start, end]之间的entry，count小于等于0时不限制数量
+func (c *Consumer) PendingRange(start ID, end ID, count int) []*PendingEntry {
+	return pendingRange(c.pending, start, end, count)
+}
+
+func (g *Group) GetConsumer(name string) (*Consumer, bool) {
+	consumer, ok := g.consumers[name]
+	return consumer, ok
+}
+
+// CreateConsumer 创建consumer，已经存在时返回已有的consumer和false
+func (g *Group) CreateConsumer(name string, now int64) (*Consumer, bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{
+		Name:     name,
+		SeenTime: now,
+		pending:  makeBTree(),
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer 删除consumer以及它的pending entries，返回删除的pending entries数量
+func (g *Group) DeleteConsumer(name string) (int, bool) {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0, false
+	}
+	count := consumer.pending.Len()
+	consumer.pending.Ascend(MinID, func(id ID, value interface{}) bool {
+		g.pel.Remove(id)
+		return true
+	})
+	delete(g.consumers, name)
+	return count, true
+}
+
+// Consumers 按照名称排序返回所有consumer
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+func (g *Group) PendingLen() int {
+	return g.pel.Len()
+}
+
+func (g *Group) GetPending(id ID) (*PendingEntry, bool) {
+	raw, ok := g.pel.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*PendingEntry), true
+}
+
+// SetPending 将id加入consumer的PEL，已经属于其他consumer时转移给consumer
+func (g *Group) SetPending(id ID, consumer *Consumer, deliveryTime int64, deliveryCount uint64) *PendingEntry {
+	pending, ok := g.GetPending(id)
+	if !ok {
+		pending = &PendingEntry{ID: id}
+		g.pel.Put(id, pending)
+	} else if pending.Consumer != consumer {
+		pending.Consumer.pending.Remove(id)
+	}
+	pending.Consumer = consumer
+	pending.DeliveryTime = deliveryTime
+	pending.DeliveryCount = deliveryCount
+	consumer.pending.Put(id, pending)
+	return pending
+}
+
+// Ack 将id从PEL中删除
+func (g *Group) Ack(id ID) bool {
+	raw, ok := g.pel.Remove(id)
+	if !ok {
+		return false
+	}
+	raw.(*PendingEntry).Consumer.pending.Remove(id)
+	return true
+}
+
+// PendingRange 返回PEL中[start, end]之间的entry，count小于等于0时不限制数量
+func (g *Group) PendingRange(start ID, end ID, count int) []*PendingEntry {
+	return pendingRange(g.pel, start, end, count)
+}
+
+func pendingRange(pel *btree, start ID, end ID, count int) []*PendingEntry {
+	var result []*PendingEntry
+	pel.Ascend(start, func(id ID, value interface{}) bool {
+		if end.Less(id) {
+			return false
+		}
+		result = append(result, value.(*PendingEntry))
+		return count <= 0 || len(result) < count
+	})
+	return result
+}
+
+// ReadNew 读取LastID之后的entry并投递给consumer，noAck为true时不加入PEL
+func (g *Group) ReadNew(s *Stream, consumer *Consumer, count int, noAck bool, now int64) []*Entry {
+	start, ok := g.LastID.Incr()
+	if !ok {
+		return nil
+	}
+	entries := s.Range(start, MaxID, count, false)
+	for _, entry := range entries {
+		g.LastID = entry.ID
+		if g.EntriesRead >= 0 {
+			g.EntriesRead++
+		}
+		if !noAck {
+			g.SetPending(entry.ID, consumer, now, 1)
+		}
+	}
+	return entries
+}
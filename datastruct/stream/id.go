@@ -0,0 +1,138 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: id
+ * @Version: 1.0.0
+ * @Description: stream entry ID，由毫秒时间戳和同一毫秒内的序号组成，格式为<ms>-<seq>
+ * @Date: 2026/10/18 10:12
+ */
+
+// ID stream entry ID
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinID 0-0，不能作为entry的ID
+	MinID = ID{}
+	// MaxID 最大的ID
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+	ErrInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+)
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 返回-1、0、1
+func (id ID) Compare(other ID) int {
+	if id.Ms != other.Ms {
+		if id.Ms < other.Ms {
+			return -1
+		}
+		return 1
+	}
+	if id.Seq != other.Seq {
+		if id.Seq < other.Seq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// Incr 返回下一个ID，已经是最大ID时返回false
+func (id ID) Incr() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Decr 返回上一个ID，已经是最小ID时返回false
+func (id ID) Decr() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseID 解析<ms>-<seq>，只有<ms>时序号为missingSeq
+func ParseID(s string, missingSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// ParseStrictID 解析完整的ID，同时支持<ms>
+func ParseStrictID(s string) (ID, error) {
+	return ParseID(s, 0)
+}
+
+// ParseRangeID 解析XRANGE的边界，支持-、+和(开头的开区间
+func ParseRangeID(s string, isStart bool) (ID, error) {
+	switch s {
+	case "-":
+		return MinID, nil
+	case "+":
+		return MaxID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	missingSeq := uint64(0)
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	id, err := ParseID(s, missingSeq)
+	if err != nil {
+		return ID{}, err
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		id, ok = id.Incr()
+	} else {
+		id, ok = id.Decr()
+	}
+	if !ok {
+		if isStart {
+			return ID{}, errors.New("ERR invalid start ID for the interval")
+		}
+		return ID{}, errors.New("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
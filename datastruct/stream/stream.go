@@ -0,0 +1,227 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+/**
+ * @Author: wanglei
+ * @File: stream
+ * @Version: 1.0.0
+ * @Description: stream数据结构，entries按照ID保存在B-tree中，ID只能递增，
+ *               consumer group记录已经投递的位置以及未确认的pending entries
+ * @Date: 2026/10/18 10:12
+ */
+
+var (
+	ErrIDTooSmall  = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrIDZero      = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrIDExhausted = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+)
+
+// Entry stream中的一条消息，Fields中field和value交替排列
+type Entry struct {
+	ID     ID
+	Fields [][]byte
+}
+
+type Stream struct {
+	// ID:*Entry
+	entries *btree
+	lastID  ID
+	// maxDeletedID 被XDEL或者XTRIM删除的最大ID
+	maxDeletedID ID
+	// entriesAdded 所有添加过的entry数量，包括已经删除的
+	entriesAdded uint64
+	groups       map[string]*Group
+}
+
+func MakeStream() *Stream {
+	return &Stream{
+		entries: makeBTree(),
+		groups:  make(map[string]*Group),
+	}
+}
+
+func (s *Stream) Len() int {
+	return s.entries.Len()
+}
+
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+// FirstID 返回第一个entry的ID，stream为空时返回false
+func (s *Stream) FirstID() (ID, bool) {
+	id, _, ok := s.entries.Min()
+	return id, ok
+}
+
+// SetID XSETID，lastID不能小于当前最大的entry ID
+func (s *Stream) SetID(lastID ID, entriesAdded uint64, maxDeletedID ID) {
+	s.lastID = lastID
+	s.entriesAdded = entriesAdded
+	s.maxDeletedID = maxDeletedID
+}
+
+// NextID 生成自增ID，当前毫秒时间戳大于lastID时使用<ms>-0，否则在lastID的基础上序号加一
+func (s *Stream) NextID(nowMs uint64) (ID, error) {
+	if nowMs > s.lastID.Ms {
+		return ID{Ms: nowMs}, nil
+	}
+	id, ok := s.lastID.Incr()
+	if !ok {
+		return ID{}, ErrIDExhausted
+	}
+	return id, nil
+}
+
+// NextSeqID <ms>-*，毫秒时间戳由调用方指定，序号自动生成
+func (s *Stream) NextSeqID(ms uint64) (ID, error) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms}, nil
+	}
+	if ms < s.lastID.Ms || s.lastID.Seq == math.MaxUint64 {
+		return ID{}, ErrIDTooSmall
+	}
+	return ID{Ms: ms, Seq: s.lastID.Seq + 1}, nil
+}
+
+// Add 添加entry，id必须大于lastID
+func (s *Stream) Add(id ID, fields [][]byte) error {
+	if id == MinID {
+		return ErrIDZero
+	}
+	if !s.lastID.Less(id) {
+		return ErrIDTooSmall
+	}
+	s.entries.Put(id, &Entry{ID: id, Fields: fields})
+	s.lastID = id
+	s.entriesAdded++
+	return nil
+}
+
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	raw, ok := s.entries.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*Entry), true
+}
+
+// Range 返回[start, end]之间的entry，count小于等于0时不限制数量，desc为true时从end开始逆序返回
+func (s *Stream) Range(start ID, end ID, count int, desc bool) []*Entry {
+	var result []*Entry
+	if end.Less(start) {
+		return result
+	}
+	consumer := func(id ID, value interface{}) bool {
+		if desc && id.Less(start) || !desc && end.Less(id) {
+			return false
+		}
+		result = append(result, value.(*Entry))
+		return count <= 0 || len(result) < count
+	}
+	if desc {
+		s.entries.Descend(end, consumer)
+	} else {
+		s.entries.Ascend(start, consumer)
+	}
+	return result
+}
+
+// ForEach 按照ID递增遍历所有entry
+func (s *Stream) ForEach(consumer func(entry *Entry) bool) {
+	s.entries.Ascend(MinID, func(id ID, value interface{}) bool {
+		return consumer(value.(*Entry))
+	})
+}
+
+// Delete 删除entry，pending entries list中的记录不受影响
+func (s *Stream) Delete(id ID) bool {
+	if _, ok := s.entries.Remove(id); !ok {
+		return false
+	}
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// TrimByLen 从头部删除entry直到长度不超过maxLen，limit大于0时最多删除limit个，返回删除的数量
+func (s *Stream) TrimByLen(maxLen int, limit int) int {
+	return s.trim(func(id ID) bool {
+		return s.Len() > maxLen
+	}, limit)
+}
+
+// TrimByMinID 删除ID小于minID的entry，limit大于0时最多删除limit个，返回删除的数量
+func (s *Stream) TrimByMinID(minID ID, limit int) int {
+	return s.trim(func(id ID) bool {
+		return id.Less(minID)
+	}, limit)
+}
+
+func (s *Stream) trim(shouldRemove func(id ID) bool, limit int) int {
+	removed := 0
+	for limit <= 0 || removed < limit {
+		id, _, ok := s.entries.Min()
+		if !ok || !shouldRemove(id) {
+			break
+		}
+		s.Delete(id)
+		removed++
+	}
+	return removed
+}
+
+// CreateGroup 创建consumer group，已经存在时返回false
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) (*Group, bool) {
+	if _, ok := s.groups[name]; ok {
+		return nil, false
+	}
+	group := &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		pel:         makeBTree(),
+		consumers:   make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group, true
+}
+
+func (s *Stream) GetGroup(name string) (*Group, bool) {
+	group, ok := s.groups[name]
+	return group, ok
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 按照名称排序返回所有consumer group
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
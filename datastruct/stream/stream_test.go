@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"strconv"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: stream_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestStreamAddAndRange(t *testing.T) {
+	s := MakeStream()
+	for i := 0; i < 10; i++ {
+		id, err := s.NextID(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(id, [][]byte{[]byte("n"), []byte(strconv.Itoa(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.LastID() != (ID{Ms: 100, Seq: 9}) {
+		t.Fatalf("unexpected last id %s", s.LastID())
+	}
+	if err := s.Add(ID{Ms: 100, Seq: 9}, nil); err != ErrIDTooSmall {
+		t.Fatalf("expect ErrIDTooSmall, actual %v", err)
+	}
+
+	entries := s.Range(ID{Ms: 100, Seq: 3}, MaxID, 2, false)
+	if len(entries) != 2 || entries[0].ID.Seq != 3 || entries[1].ID.Seq != 4 {
+		t.Fatalf("unexpected range result %v", entries)
+	}
+	entries = s.Range(MinID, ID{Ms: 100, Seq: 3}, 0, true)
+	if len(entries) != 4 || entries[0].ID.Seq != 3 || entries[3].ID.Seq != 0 {
+		t.Fatalf("unexpected reverse range result %v", entries)
+	}
+
+	s.Delete(ID{Ms: 100, Seq: 5})
+	if s.Len() != 9 || s.MaxDeletedID() != (ID{Ms: 100, Seq: 5}) {
+		t.Fatal("delete failed")
+	}
+	if removed := s.TrimByLen(5, 0); removed != 4 {
+		t.Fatalf("expect 4 removed, actual %d", removed)
+	}
+	if first, _ := s.FirstID(); first != (ID{Ms: 100, Seq: 4}) {
+		t.Fatalf("unexpected first id %s", first)
+	}
+	if removed := s.TrimByMinID(ID{Ms: 100, Seq: 8}, 0); removed != 3 {
+		t.Fatalf("expect 3 removed, actual %d", removed)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	s := MakeStream()
+	for i := 1; i <= 5; i++ {
+		_ = s.Add(ID{Ms: uint64(i)}, [][]byte{[]byte("f"), []byte("v")})
+	}
+	group, _ := s.CreateGroup("g", MinID, 0)
+	alice, _ := group.CreateConsumer("alice", 0)
+	bob, _ := group.CreateConsumer("bob", 0)
+
+	entries := group.ReadNew(s, alice, 3, false, 10)
+	if len(entries) != 3 || group.LastID != (ID{Ms: 3}) || group.EntriesRead != 3 {
+		t.Fatalf("unexpected read result %v", entries)
+	}
+	entries = group.ReadNew(s, bob, 0, false, 20)
+	if len(entries) != 2 || group.PendingLen() != 5 || bob.PendingLen() != 2 {
+		t.Fatal("unexpected pending entries")
+	}
+
+	group.SetPending(ID{Ms: 1}, bob, 30, 2)
+	if alice.PendingLen() != 2 || bob.PendingLen() != 3 {
+		t.Fatal("claim failed")
+	}
+	if !group.Ack(ID{Ms: 1}) || group.Ack(ID{Ms: 1}) {
+		t.Fatal("ack failed")
+	}
+	pending := group.PendingRange(MinID, MaxID, 0)
+	if len(pending) != 4 || pending[0].ID != (ID{Ms: 2}) {
+		t.Fatalf("unexpected pending range %v", pending)
+	}
+	if count, _ := group.DeleteConsumer("bob"); count != 2 || group.PendingLen() != 2 {
+		t.Fatal("delete consumer failed")
+	}
+}
+
+func TestParseRangeID(t *testing.T) {
+	id, err := ParseRangeID("(5-1", true)
+	if err != nil || id != (ID{Ms: 5, Seq: 2}) {
+		t.Fatalf("unexpected id %s %v", id, err)
+	}
+	id, err = ParseRangeID("7", false)
+	if err != nil || id.Ms != 7 || id.Seq != MaxID.Seq {
+		t.Fatalf("unexpected id %s %v", id, err)
+	}
+	if _, err = ParseRangeID("abc", true); err == nil {
+		t.Fatal("expect error")
+	}
+}
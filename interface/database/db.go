@@ -33,9 +33,21 @@ type EmbedDB interface {
 	RWLocks(dbIndex int, writeKeys []string, readKeys []string)
 	RWUnLocks(dbIndex int, writeKeys []string, readKeys []string)
 	GetDBSize(dbIndex int) (int, int)
+	AddVersion(dbIndex int, keys ...string)
+	// FunctionLibraries 返回所有Redis Functions library的代码
+	FunctionLibraries() []string
+	// MakeTmpDB 返回共享Redis Functions的空白db
+	MakeTmpDB() EmbedDB
 }
 
 // DataEntity 为不同的key存储值(list、hash、set等)
 type DataEntity struct {
 	Data interface{}
+	// 以下字段由db维护，用于maxmemory淘汰，需要原子访问
+	// AccessTime 最近一次访问的时间(unix毫秒)
+	AccessTime int64
+	// Size 估算的内存占用(字节)
+	Size int64
+	// Freq LFU的对数访问计数
+	Freq uint32
 }
@@ -17,8 +17,17 @@ type Connection interface {
 	// subscribe channel
 	Subscribe(channel string)
 	Unsubscribe(channel string)
+	// subscribe pattern
+	PSubscribe(pattern string)
+	PUnsubscribe(pattern string)
+	// SubCount channel和pattern的总数
 	SubCount() int
 	GetChannels() []string
+	GetPatterns() []string
+	// subscribe sharded channel
+	SSubscribe(channel string)
+	SUnsubscribe(channel string)
+	GetShardChannels() []string
 
 	// multi 命令
 	InMultiState() bool
@@ -35,4 +44,9 @@ type Connection interface {
 	// 获取连接的role
 	GetRole() int32
 	SetRole(int32)
+
+	// IsClosed 客户端是否已经断开，阻塞命令通过它判断是否继续等待
+	IsClosed() bool
+	// Close 断开连接，例如slave的输出缓冲区超过上限时
+	Close() error
 }
@@ -31,7 +31,7 @@ func New(replicas int, fn HashFunc) *Map {
 		hashMap:  make(map[int]string),
 	}
 
-	if m.hashMap == nil {
+	if m.hashFunc == nil {
 		m.hashFunc = crc32.ChecksumIEEE
 	}
 	return m
@@ -0,0 +1,34 @@
+package consistenthash
+
+import "testing"
+
+/**
+ * @Author: wanglei
+ * @File: consistenthash_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestPickNode(t *testing.T) {
+	m := New(3, nil)
+	if m.PickNode("a") != "" {
+		t.Error("empty map should pick nothing")
+	}
+	m.AddNode("127.0.0.1:6399", "127.0.0.1:7379", "127.0.0.1:8379")
+	nodes := make(map[string]struct{})
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		node := m.PickNode(key)
+		if node != m.PickNode(key) {
+			t.Error("pick node is not stable, key: " + key)
+		}
+		nodes[node] = struct{}{}
+	}
+	if len(nodes) < 2 {
+		t.Error("keys should be distributed to different nodes")
+	}
+	// 相同hash tag的key分配到同一节点
+	if m.PickNode("{user1}.name") != m.PickNode("{user1}.age") {
+		t.Error("keys with same hash tag should be picked to same node")
+	}
+}
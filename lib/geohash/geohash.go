@@ -0,0 +1,198 @@
+package geohash
+
+import "math"
+
+/**
+ * @Author: wanglei
+ * @File: geohash
+ * @Version: 1.0.0
+ * @Description: 与Redis一致的geohash，经纬度各26位交错编码为52位整数作为zset的score，
+ *               纬度限制在EPSG:3857的范围内，偶数位为纬度，奇数位为经度
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	// MaxStep 经纬度各自的编码位数
+	MaxStep = 26
+
+	LonMin = -180.0
+	LonMax = 180.0
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// EarthRadius 地球半径，单位为米
+	EarthRadius = 6372797.560856
+	// mercatorMax 墨卡托投影的最大值，用于估算搜索半径对应的精度
+	mercatorMax = 20037726.37
+)
+
+// Bits 经过step次二分的geohash
+type Bits struct {
+	Value uint64
+	Step  uint
+}
+
+// Area geohash对应的经纬度范围
+type Area struct {
+	LonMin, LonMax float64
+	LatMin, LatMax float64
+}
+
+func (b Bits) isZero() bool {
+	return b.Value == 0 && b.Step == 0
+}
+
+// Valid 检查经纬度是否可以编码
+func Valid(lon float64, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// Encode 将经纬度编码为52位的score
+func Encode(lon float64, lat float64) uint64 {
+	return encode(lon, lat, LatMin, LatMax, MaxStep).Value
+}
+
+// Decode 返回score对应区域的中心点
+func Decode(score uint64) (float64, float64) {
+	area := decode(Bits{Value: score, Step: MaxStep}, LatMin, LatMax)
+	lon := math.Max(LonMin, math.Min(LonMax, (area.LonMin+area.LonMax)/2))
+	lat := math.Max(LatMin, math.Min(LatMax, (area.LatMin+area.LatMax)/2))
+	return lon, lat
+}
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// ToString 转换为标准的11位geohash字符串，标准geohash的纬度范围为[-90, 90]
+func ToString(score uint64) string {
+	lon, lat := Decode(score)
+	value := encode(lon, lat, -90, 90, MaxStep).Value
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		// 52位不能被5整除，最后一个字符补0
+		if i < 10 {
+			idx = int(value>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+func encode(lon float64, lat float64, latMin float64, latMax float64, step uint) Bits {
+	scale := float64(uint64(1) << step)
+	latOffset := clampOffset((lat-latMin)/(latMax-latMin)*scale, step)
+	lonOffset := clampOffset((lon-LonMin)/(LonMax-LonMin)*scale, step)
+	return Bits{
+		Value: interleave(latOffset, lonOffset),
+		Step:  step,
+	}
+}
+
+// clampOffset 坐标恰好等于最大值时仍然落在最后一个区间中
+func clampOffset(offset float64, step uint) uint32 {
+	max := uint32(1)<<step - 1
+	if offset >= float64(max) {
+		return max
+	}
+	if offset < 0 {
+		return 0
+	}
+	return uint32(offset)
+}
+
+func decode(hash Bits, latMin float64, latMax float64) Area {
+	scale := float64(uint64(1) << hash.Step)
+	ilat := float64(squash(hash.Value))
+	ilon := float64(squash(hash.Value >> 1))
+	latScale := latMax - latMin
+	lonScale := LonMax - LonMin
+	return Area{
+		LatMin: latMin + ilat/scale*latScale,
+		LatMax: latMin + (ilat+1)/scale*latScale,
+		LonMin: LonMin + ilon/scale*lonScale,
+		LonMax: LonMin + (ilon+1)/scale*lonScale,
+	}
+}
+
+// interleave 纬度放在偶数位，经度放在奇数位
+func interleave(lat uint32, lon uint32) uint64 {
+	return spread(lat) | spread(lon)<<1
+}
+
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+func squash(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+// moveX 经度方向移动一个格子，d大于0时向东
+func moveX(hash Bits, d int) Bits {
+	x := hash.Value & 0xaaaaaaaaaaaaaaaa
+	y := hash.Value & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.Step*2)
+	if d > 0 {
+		x = x + (zz + 1)
+	} else {
+		x = x | zz
+		x = x - (zz + 1)
+	}
+	x &= uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.Step*2)
+	return Bits{Value: x | y, Step: hash.Step}
+}
+
+// moveY 纬度方向移动一个格子，d大于0时向北
+func moveY(hash Bits, d int) Bits {
+	x := hash.Value & 0xaaaaaaaaaaaaaaaa
+	y := hash.Value & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.Step*2)
+	if d > 0 {
+		y = y + (zz + 1)
+	} else {
+		y = y | zz
+		y = y - (zz + 1)
+	}
+	y &= uint64(0x5555555555555555) >> (64 - hash.Step*2)
+	return Bits{Value: x | y, Step: hash.Step}
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance haversine公式计算两点之间的距离，单位为米
+func Distance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+	lat1r := degToRad(lat1)
+	lon1r := degToRad(lon1)
+	lat2r := degToRad(lat2)
+	lon2r := degToRad(lon2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// 经度相同时只需要计算纬度的距离
+	if v == 0 {
+		return latDistance(lat1, lat2)
+	}
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
+
+func latDistance(lat1 float64, lat2 float64) float64 {
+	return EarthRadius * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
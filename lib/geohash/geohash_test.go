@@ -0,0 +1,104 @@
+package geohash
+
+import (
+	"math"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: geohash_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestEncode(t *testing.T) {
+	// 与Redis文档中的示例一致
+	cases := []struct {
+		lon, lat float64
+		score    uint64
+		hash     string
+	}{
+		{13.361389, 38.115556, 3479099956230698, "sqc8b49rny0"},
+		{15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0"},
+	}
+	for _, c := range cases {
+		score := Encode(c.lon, c.lat)
+		if score != c.score {
+			t.Fatalf("encode %f,%f expect %d, actual %d", c.lon, c.lat, c.score, score)
+		}
+		if s := ToString(score); s != c.hash {
+			t.Fatalf("expect %s, actual %s", c.hash, s)
+		}
+		lon, lat := Decode(score)
+		if math.Abs(lon-c.lon) > 1e-5 || math.Abs(lat-c.lat) > 1e-5 {
+			t.Fatalf("decode %d: %f,%f", score, lon, lat)
+		}
+	}
+	if score := Encode(LonMax, LatMax); score>>52 != 0 {
+		t.Fatal("score should be 52 bits")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	lon1, lat1 := Decode(Encode(13.361389, 38.115556))
+	lon2, lat2 := Decode(Encode(15.087269, 37.502669))
+	if d := Distance(lon1, lat1, lon2, lat2); math.Abs(d-166274.1516) > 0.001 {
+		t.Fatalf("unexpected distance %f", d)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	hash := encode(13.361389, 38.115556, LatMin, LatMax, 10)
+	area := decode(hash, LatMin, LatMax)
+	cells := neighbors(hash)
+	north := decode(cells[cellNorth], LatMin, LatMax)
+	east := decode(cells[cellEast], LatMin, LatMax)
+	southWest := decode(cells[cellSouthWest], LatMin, LatMax)
+	if math.Abs(north.LatMin-area.LatMax) > 1e-9 || math.Abs(north.LonMin-area.LonMin) > 1e-9 {
+		t.Fatal("wrong north neighbor")
+	}
+	if math.Abs(east.LonMin-area.LonMax) > 1e-9 || math.Abs(east.LatMin-area.LatMin) > 1e-9 {
+		t.Fatal("wrong east neighbor")
+	}
+	if math.Abs(southWest.LatMax-area.LatMin) > 1e-9 || math.Abs(southWest.LonMax-area.LonMin) > 1e-9 {
+		t.Fatal("wrong south west neighbor")
+	}
+}
+
+func TestShape(t *testing.T) {
+	points := [][2]float64{{13.361389, 38.115556}, {15.087269, 37.502669}, {2.349014, 48.864716}}
+	search := func(shape *Shape) int {
+		n := 0
+		for _, p := range points {
+			score := Encode(p[0], p[1])
+			inRange := false
+			for _, r := range shape.Ranges() {
+				if score >= r.Min && score < r.Max {
+					inRange = true
+				}
+			}
+			lon, lat := Decode(score)
+			if _, ok := shape.Contains(lon, lat); ok {
+				if !inRange {
+					t.Fatalf("point %v in shape but not in ranges", p)
+				}
+				n++
+			}
+		}
+		return n
+	}
+	if n := search(&Shape{Lon: 15, Lat: 37, Radius: 200000}); n != 2 {
+		t.Fatalf("expect 2, actual %d", n)
+	}
+	if n := search(&Shape{Lon: 15, Lat: 37, Radius: 100000}); n != 1 {
+		t.Fatalf("expect 1, actual %d", n)
+	}
+	if n := search(&Shape{Lon: 15, Lat: 37, ByBox: true, Width: 400000, Height: 400000}); n != 2 {
+		t.Fatalf("expect 2, actual %d", n)
+	}
+	if n := search(&Shape{Lon: 15, Lat: 37, Radius: 5000000}); n != 3 {
+		t.Fatalf("expect 3, actual %d", n)
+	}
+}
@@ -0,0 +1,178 @@
+package geohash
+
+import "math"
+
+/**
+ * @Author: wanglei
+ * @File: shape
+ * @Version: 1.0.0
+ * @Description: 按照圆形或者矩形搜索，根据搜索范围估算geohash的精度，
+ *               扫描中心格子以及周围8个格子对应的score区间，再逐个计算距离过滤
+ * @Date: 2026/10/18 10:12
+ */
+
+// Shape 搜索范围，长度单位都是米
+type Shape struct {
+	Lon, Lat float64
+	// ByBox 为true时按照Width和Height搜索矩形，否则按照Radius搜索圆形
+	ByBox  bool
+	Radius float64
+	Width  float64
+	Height float64
+}
+
+// ScoreRange score的区间[Min, Max)
+type ScoreRange struct {
+	Min uint64
+	Max uint64
+}
+
+// Contains 返回点到中心的距离以及点是否在范围内
+func (s *Shape) Contains(lon float64, lat float64) (float64, bool) {
+	if !s.ByBox {
+		dist := Distance(s.Lon, s.Lat, lon, lat)
+		return dist, dist <= s.Radius
+	}
+	// 纬度方向的距离计算较快，先检查纬度
+	if latDistance(lat, s.Lat) > s.Height/2 {
+		return 0, false
+	}
+	if Distance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return Distance(s.Lon, s.Lat, lon, lat), true
+}
+
+// boundingBox 返回包含搜索范围的经纬度矩形: 最小经度、最小纬度、最大经度、最大纬度
+func (s *Shape) boundingBox() (float64, float64, float64, float64) {
+	height, width := s.Radius, s.Radius
+	if s.ByBox {
+		height, width = s.Height/2, s.Width/2
+	}
+	latDelta := radToDeg(height / EarthRadius)
+	lonDeltaTop := radToDeg(width / EarthRadius / math.Cos(degToRad(s.Lat+latDelta)))
+	lonDeltaBottom := radToDeg(width / EarthRadius / math.Cos(degToRad(s.Lat-latDelta)))
+	// 南半球靠近赤道的一侧在上方
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return s.Lon - lonDelta, s.Lat - latDelta, s.Lon + lonDelta, s.Lat + latDelta
+}
+
+// estimateStep 根据搜索半径估算geohash的精度，保证中心格子加上周围8个格子能够覆盖搜索范围
+func estimateStep(rangeMeters float64, lat float64) uint {
+	if rangeMeters == 0 {
+		return MaxStep
+	}
+	step := 1
+	for rangeMeters < mercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	step -= 2
+	// 靠近两极时格子变窄，需要降低精度
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxStep {
+		step = MaxStep
+	}
+	return uint(step)
+}
+
+// neighbors 返回中心格子以及周围的8个格子
+func neighbors(hash Bits) []Bits {
+	north := moveY(hash, 1)
+	south := moveY(hash, -1)
+	return []Bits{
+		hash,
+		north,
+		south,
+		moveX(hash, 1),
+		moveX(hash, -1),
+		moveX(north, 1),
+		moveX(north, -1),
+		moveX(south, 1),
+		moveX(south, -1),
+	}
+}
+
+const (
+	cellCenter = iota
+	cellNorth
+	cellSouth
+	cellEast
+	cellWest
+	cellNorthEast
+	cellNorthWest
+	cellSouthEast
+	cellSouthWest
+)
+
+// Ranges 返回需要扫描的score区间，已经去掉了不需要扫描和重复的格子
+func (s *Shape) Ranges() []ScoreRange {
+	minLon, minLat, maxLon, maxLat := s.boundingBox()
+	radius := s.Radius
+	if s.ByBox {
+		radius = math.Sqrt((s.Width/2)*(s.Width/2) + (s.Height/2)*(s.Height/2))
+	}
+	step := estimateStep(radius, s.Lat)
+	hash := encode(s.Lon, s.Lat, LatMin, LatMax, step)
+	cells := neighbors(hash)
+
+	// 周围的格子不能覆盖搜索范围时降低一级精度
+	if step > 1 {
+		north := decode(cells[cellNorth], LatMin, LatMax)
+		south := decode(cells[cellSouth], LatMin, LatMax)
+		east := decode(cells[cellEast], LatMin, LatMax)
+		west := decode(cells[cellWest], LatMin, LatMax)
+		if north.LatMax < maxLat || south.LatMin > minLat || east.LonMax < maxLon || west.LonMin > minLon {
+			step--
+			hash = encode(s.Lon, s.Lat, LatMin, LatMax, step)
+			cells = neighbors(hash)
+		}
+	}
+
+	// 去掉完全在搜索范围以外的格子
+	if step >= 2 {
+		area := decode(hash, LatMin, LatMax)
+		if area.LatMin < minLat {
+			cells[cellSouth], cells[cellSouthEast], cells[cellSouthWest] = Bits{}, Bits{}, Bits{}
+		}
+		if area.LatMax > maxLat {
+			cells[cellNorth], cells[cellNorthEast], cells[cellNorthWest] = Bits{}, Bits{}, Bits{}
+		}
+		if area.LonMin < minLon {
+			cells[cellWest], cells[cellSouthWest], cells[cellNorthWest] = Bits{}, Bits{}, Bits{}
+		}
+		if area.LonMax > maxLon {
+			cells[cellEast], cells[cellSouthEast], cells[cellNorthEast] = Bits{}, Bits{}, Bits{}
+		}
+	}
+
+	var ranges []ScoreRange
+	// 搜索范围很大时相邻的格子可能相同
+	seen := make(map[Bits]struct{}, len(cells))
+	for _, cell := range cells {
+		if cell.isZero() {
+			continue
+		}
+		if _, ok := seen[cell]; ok {
+			continue
+		}
+		seen[cell] = struct{}{}
+		shift := 2 * (MaxStep - cell.Step)
+		ranges = append(ranges, ScoreRange{
+			Min: cell.Value << shift,
+			Max: (cell.Value + 1) << shift,
+		})
+	}
+	return ranges
+}
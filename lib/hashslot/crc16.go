@@ -0,0 +1,36 @@
+package hashslot
+
+/**
+ * @Author: wanglei
+ * @File: crc16
+ * @Version: 1.0.0
+ * @Description: Redis Cluster使用的CRC16/XMODEM校验
+ * @Date: 2026/10/18 10:12
+ */
+
+var crc16Table = makeCRC16Table(0x1021)
+
+func makeCRC16Table(poly uint16) [256]uint16 {
+	var table [256]uint16
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// CRC16 计算data的CRC16/XMODEM校验值
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
@@ -0,0 +1,99 @@
+package hashslot
+
+import (
+	"sort"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: hashslot
+ * @Version: 1.0.0
+ * @Description: 与Redis Cluster兼容的16384个hash slot，按节点地址排序后平均分配
+ * @Date: 2026/10/18 10:12
+ */
+
+// SlotCount hash slot的数量
+const SlotCount = 16384
+
+// Range 分配给同一个节点的连续slot
+type Range struct {
+	Start int
+	End   int
+	Node  string
+}
+
+type Map struct {
+	nodes []string
+	slots []string
+}
+
+func New() *Map {
+	return &Map{
+		slots: make([]string, SlotCount),
+	}
+}
+
+// hashTag 与Redis一致，只对第一个{和其后第一个}之间的非空内容计算hash
+func hashTag(key string) string {
+	beg := strings.IndexByte(key, '{')
+	if beg == -1 {
+		return key
+	}
+	end := strings.IndexByte(key[beg+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[beg+1 : beg+1+end]
+}
+
+// KeySlot 返回key所在的slot
+func KeySlot(key string) int {
+	return int(CRC16([]byte(hashTag(key)))) % SlotCount
+}
+
+func (m *Map) IsEmpty() bool {
+	return len(m.nodes) == 0
+}
+
+// AddNode 加入节点后重新分配所有slot，相同的节点集合总是得到相同的分配结果
+func (m *Map) AddNode(nodes ...string) {
+	for _, node := range nodes {
+		if node != "" {
+			m.nodes = append(m.nodes, node)
+		}
+	}
+	sort.Strings(m.nodes)
+	count := len(m.nodes)
+	for i, node := range m.nodes {
+		for slot := i * SlotCount / count; slot < (i+1)*SlotCount/count; slot++ {
+			m.slots[slot] = node
+		}
+	}
+}
+
+func (m *Map) PickNode(key string) string {
+	return m.slots[KeySlot(key)]
+}
+
+// PickSlotNode 返回slot所在的节点
+func (m *Map) PickSlotNode(slot int) string {
+	return m.slots[slot]
+}
+
+// Ranges 返回每个节点负责的slot区间
+func (m *Map) Ranges() []Range {
+	result := make([]Range, 0, len(m.nodes))
+	for slot := 0; slot < SlotCount; slot++ {
+		node := m.slots[slot]
+		if node == "" {
+			continue
+		}
+		if len(result) > 0 && result[len(result)-1].Node == node && result[len(result)-1].End == slot-1 {
+			result[len(result)-1].End = slot
+			continue
+		}
+		result = append(result, Range{Start: slot, End: slot, Node: node})
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package hashslot
+
+import "testing"
+
+/**
+ * @Author: wanglei
+ * @File: hashslot_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestKeySlot(t *testing.T) {
+	// 与redis-cli CLUSTER KEYSLOT的结果一致
+	cases := map[string]int{
+		"123456789":            12739,
+		"foo":                  12182,
+		"bar":                  5061,
+		"{user1000}.following": 3443,
+		"{user1000}.followers": 3443,
+		"foo{}{bar}":           8363,
+		"foo{{bar}}zap":        4015,
+		"foo{bar}{zap}":        5061,
+	}
+	for key, expected := range cases {
+		if slot := KeySlot(key); slot != expected {
+			t.Errorf("slot of %s: expected %d, actual %d", key, expected, slot)
+		}
+	}
+}
+
+func TestRanges(t *testing.T) {
+	m := New()
+	if !m.IsEmpty() || m.PickNode("a") != "" {
+		t.Error("empty map should pick nothing")
+	}
+	m.AddNode("127.0.0.1:7002", "127.0.0.1:7001")
+	m.AddNode("127.0.0.1:7003")
+	ranges := m.Ranges()
+	expected := []Range{
+		{Start: 0, End: 5460, Node: "127.0.0.1:7001"},
+		{Start: 5461, End: 10921, Node: "127.0.0.1:7002"},
+		{Start: 10922, End: 16383, Node: "127.0.0.1:7003"},
+	}
+	if len(ranges) != len(expected) {
+		t.Fatalf("expected %d ranges, actual %v", len(expected), ranges)
+	}
+	for i := range expected {
+		if ranges[i] != expected[i] {
+			t.Errorf("expected %v, actual %v", expected[i], ranges[i])
+		}
+	}
+	if m.PickNode("foo") != "127.0.0.1:7003" || m.PickSlotNode(5061) != "127.0.0.1:7001" {
+		t.Error("wrong node picked")
+	}
+}
@@ -0,0 +1,145 @@
+package pool
+
+import (
+	"errors"
+	"sync"
+)
+
+/**
+ * @Author: wanglei
+ * @File: pool
+ * @Version: 1.0.0
+ * @Description: 通用的对象池，用于复用与其他节点的连接
+ * @Date: 2026/10/18 10:12
+ */
+
+var (
+	ErrClosed = errors.New("pool closed")
+	ErrMax    = errors.New("reach max connection limit")
+)
+
+type request chan interface{}
+
+type Config struct {
+	MaxIdle   uint // 最多保留的空闲对象数
+	MaxActive uint // 最多同时存在的对象数，0表示不限制
+}
+
+// Pool 对象池，对象数量达到MaxActive时Get会阻塞直到有对象归还
+type Pool struct {
+	Config
+	factory     func() (interface{}, error)
+	finalizer   func(x interface{})
+	idles       chan interface{}
+	waitingReqs []request
+	activeCount uint // 已创建且未销毁的对象数
+	mu          sync.Mutex
+	closed      bool
+}
+
+func New(factory func() (interface{}, error), finalizer func(x interface{}), cfg Config) *Pool {
+	return &Pool{
+		factory:     factory,
+		finalizer:   finalizer,
+		idles:       make(chan interface{}, cfg.MaxIdle),
+		waitingReqs: make([]request, 0),
+		Config:      cfg,
+	}
+}
+
+// getOnNoIdle 没有空闲对象时创建新对象，数量已达上限则等待归还，调用方需持有mu
+func (pool *Pool) getOnNoIdle() (interface{}, error) {
+	if pool.MaxActive > 0 && pool.activeCount >= pool.MaxActive {
+		req := make(chan interface{}, 1)
+		pool.waitingReqs = append(pool.waitingReqs, req)
+		pool.mu.Unlock()
+		x, ok := <-req
+		if !ok {
+			return nil, ErrMax
+		}
+		return x, nil
+	}
+
+	pool.activeCount++
+	pool.mu.Unlock()
+	x, err := pool.factory()
+	if err != nil {
+		pool.mu.Lock()
+		pool.activeCount--
+		pool.mu.Unlock()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (pool *Pool) Get() (interface{}, error) {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return nil, ErrClosed
+	}
+
+	select {
+	case item := <-pool.idles:
+		pool.mu.Unlock()
+		return item, nil
+	default:
+		return pool.getOnNoIdle()
+	}
+}
+
+// Put 归还对象，优先交给等待中的请求
+func (pool *Pool) Put(x interface{}) {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		pool.finalizer(x)
+		return
+	}
+
+	if len(pool.waitingReqs) > 0 {
+		req := pool.waitingReqs[0]
+		copy(pool.waitingReqs, pool.waitingReqs[1:])
+		pool.waitingReqs = pool.waitingReqs[:len(pool.waitingReqs)-1]
+		req <- x
+		pool.mu.Unlock()
+		return
+	}
+
+	select {
+	case pool.idles <- x:
+		pool.mu.Unlock()
+	default:
+		// 空闲对象已满，销毁
+		pool.activeCount--
+		pool.mu.Unlock()
+		pool.finalizer(x)
+	}
+}
+
+// Discard 销毁一个已经失效的对象，不再放回池中
+func (pool *Pool) Discard(x interface{}) {
+	pool.mu.Lock()
+	pool.activeCount--
+	pool.mu.Unlock()
+	pool.finalizer(x)
+}
+
+func (pool *Pool) Close() {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return
+	}
+	pool.closed = true
+	close(pool.idles)
+	for _, req := range pool.waitingReqs {
+		close(req)
+	}
+	pool.waitingReqs = nil
+	pool.mu.Unlock()
+
+	for x := range pool.idles {
+		pool.finalizer(x)
+	}
+}
@@ -0,0 +1,93 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: pool_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+type mockConn struct {
+	open bool
+}
+
+func TestPool(t *testing.T) {
+	connNum := 0
+	factory := func() (interface{}, error) {
+		connNum++
+		return &mockConn{open: true}, nil
+	}
+	finalizer := func(x interface{}) {
+		connNum--
+		x.(*mockConn).open = false
+	}
+	pool := New(factory, finalizer, Config{
+		MaxIdle:   2,
+		MaxActive: 3,
+	})
+
+	var conns []interface{}
+	for i := 0; i < 3; i++ {
+		x, err := pool.Get()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns = append(conns, x)
+	}
+	if connNum != 3 {
+		t.Errorf("expect 3 conns, actual: %d", connNum)
+	}
+
+	// 达到MaxActive后Get阻塞，直到有对象归还
+	got := make(chan interface{})
+	go func() {
+		x, _ := pool.Get()
+		got <- x
+	}()
+	select {
+	case <-got:
+		t.Error("get should block when reach max active")
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+	pool.Put(conns[0])
+	if x := <-got; x != conns[0] {
+		t.Error("expect the returned conn")
+	}
+
+	for _, x := range conns {
+		pool.Put(x)
+	}
+	// 只保留MaxIdle个空闲对象
+	if connNum != 2 {
+		t.Errorf("expect 2 conns, actual: %d", connNum)
+	}
+
+	pool.Close()
+	if connNum != 0 {
+		t.Errorf("expect 0 conns after close, actual: %d", connNum)
+	}
+	if _, err := pool.Get(); !errors.Is(err, ErrClosed) {
+		t.Error("expect ErrClosed")
+	}
+}
+
+func TestPoolFactoryError(t *testing.T) {
+	factoryErr := errors.New("mock error")
+	pool := New(func() (interface{}, error) {
+		return nil, factoryErr
+	}, func(x interface{}) {}, Config{MaxIdle: 1, MaxActive: 1})
+	for i := 0; i < 2; i++ {
+		if _, err := pool.Get(); err != factoryErr {
+			t.Error("expect factory error")
+		}
+	}
+}
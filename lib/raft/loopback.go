@@ -0,0 +1,84 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+)
+
+/**
+ * @Author: wanglei
+ * @File: loopback
+ * @Version: 1.0.0
+ * @Description: 进程内的Transport，用于测试，可以模拟节点断开
+ * @Date: 2026/10/18 10:12
+ */
+
+var ErrUnreachable = errors.New("raft: peer unreachable")
+
+type LoopbackTransport struct {
+	mu           sync.RWMutex
+	nodes        map[string]*Node
+	disconnected map[string]bool
+}
+
+func NewLoopbackTransport() *LoopbackTransport {
+	return &LoopbackTransport{
+		nodes:        make(map[string]*Node),
+		disconnected: make(map[string]bool),
+	}
+}
+
+func (t *LoopbackTransport) Register(node *Node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nodes[node.ID()] = node
+}
+
+// Disconnect 断开节点与其他所有节点之间的通信
+func (t *LoopbackTransport) Disconnect(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.disconnected[id] = true
+}
+
+func (t *LoopbackTransport) Connect(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.disconnected, id)
+}
+
+// From 返回以id身份发送请求的Transport
+func (t *LoopbackTransport) From(id string) Transport {
+	return &loopbackSender{transport: t, from: id}
+}
+
+func (t *LoopbackTransport) getNode(from, to string) (*Node, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node, ok := t.nodes[to]
+	if !ok || t.disconnected[from] || t.disconnected[to] {
+		return nil, ErrUnreachable
+	}
+	return node, nil
+}
+
+type loopbackSender struct {
+	transport *LoopbackTransport
+	from      string
+}
+
+func (s *loopbackSender) RequestVote(peer string, args *RequestVoteArgs) (*RequestVoteReply, error) {
+	node, err := s.transport.getNode(s.from, peer)
+	if err != nil {
+		return nil, err
+	}
+	return node.HandleRequestVote(args), nil
+}
+
+func (s *loopbackSender) AppendEntries(peer string, args *AppendEntriesArgs) (*AppendEntriesReply, error) {
+	node, err := s.transport.getNode(s.from, peer)
+	if err != nil {
+		return nil, err
+	}
+	return node.HandleAppendEntries(args), nil
+}
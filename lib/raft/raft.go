@@ -0,0 +1,634 @@
+package raft
+
+import (
+	"errors"
+	"gmr/go-cache/lib/logger"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: raft
+ * @Version: 1.0.0
+ * @Description: 简化的Raft实现，包括选主和日志复制，任期、投票和日志在回复请求之前写入StateFile，
+ *               不支持快照和成员变更
+ * @Date: 2026/10/18 10:12
+ */
+
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Leader:
+		return "leader"
+	case Candidate:
+		return "candidate"
+	}
+	return "follower"
+}
+
+var (
+	ErrNotLeader       = errors.New("raft: not leader")
+	ErrProposalDropped = errors.New("raft: proposal dropped")
+	ErrTimeout         = errors.New("raft: proposal timeout")
+	ErrStopped         = errors.New("raft: node stopped")
+)
+
+// Entry 一条日志，Data为nil的是leader上任时写入的空日志
+type Entry struct {
+	Term  uint64
+	Index uint64
+	Data  []byte
+}
+
+type RequestVoteArgs struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type RequestVoteReply struct {
+	Term        uint64
+	VoteGranted bool
+}
+
+type AppendEntriesArgs struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []Entry
+	LeaderCommit uint64
+}
+
+type AppendEntriesReply struct {
+	Term    uint64
+	Success bool
+	// ConflictIndex 失败时leader下一次从该位置开始发送日志
+	ConflictIndex uint64
+}
+
+// Transport 节点之间的通信方式
+type Transport interface {
+	RequestVote(peer string, args *RequestVoteArgs) (*RequestVoteReply, error)
+	AppendEntries(peer string, args *AppendEntriesArgs) (*AppendEntriesReply, error)
+}
+
+type Config struct {
+	ID string
+	// Voters 参与选举的节点，learner只接收日志，不在其中
+	Voters            []string
+	HeartbeatInterval time.Duration
+	// ElectionTimeout 实际超时时间在[ElectionTimeout, 2*ElectionTimeout)之间随机
+	ElectionTimeout time.Duration
+	Transport       Transport
+	// Apply 按日志顺序应用已提交的日志，节点重启后会从第一条日志开始重新应用
+	Apply func(entry Entry)
+	// StateFile 保存currentTerm、votedFor和日志的文件，为空时只保存在内存中
+	StateFile string
+}
+
+type Node struct {
+	mu  sync.Mutex
+	cfg Config
+
+	role        Role
+	currentTerm uint64
+	votedFor    string
+	// dirty currentTerm、votedFor或日志修改之后尚未持久化
+	dirty    bool
+	leaderID string
+	// log[0]为哨兵，下标与日志index相同
+	log         []Entry
+	commitIndex uint64
+	lastApplied uint64
+
+	learners   map[string]struct{}
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	// replicating 正在向peer发送日志，避免请求堆积
+	replicating map[string]bool
+
+	electionDeadline time.Time
+	applyCh          chan struct{}
+	waiters          map[uint64]chan uint64
+	stopCh           chan struct{}
+	stopOnce         sync.Once
+}
+
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = 100 * time.Millisecond
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = 10 * cfg.HeartbeatInterval
+	}
+	n := &Node{
+		cfg:         cfg,
+		log:         []Entry{{}},
+		learners:    make(map[string]struct{}),
+		nextIndex:   make(map[string]uint64),
+		matchIndex:  make(map[string]uint64),
+		replicating: make(map[string]bool),
+		applyCh:     make(chan struct{}, 1),
+		waiters:     make(map[uint64]chan uint64),
+		stopCh:      make(chan struct{}),
+	}
+	if cfg.StateFile != "" {
+		state, err := loadState(cfg.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			n.currentTerm = state.Term
+			n.votedFor = state.VotedFor
+			n.log = append(n.log, state.Log...)
+		}
+	}
+	n.resetElectionDeadline()
+	return n, nil
+}
+
+func (n *Node) Start() {
+	go n.tickLoop()
+	go n.applyLoop()
+}
+
+func (n *Node) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.stopCh)
+	})
+}
+
+func (n *Node) ID() string {
+	return n.cfg.ID
+}
+
+// State 返回当前任期和角色
+func (n *Node) State() (uint64, Role) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.currentTerm, n.role
+}
+
+func (n *Node) IsLeader() bool {
+	_, role := n.State()
+	return role == Leader
+}
+
+// Leader 返回已知的leader，未知时返回空字符串
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaderID
+}
+
+// CommitIndex 返回已提交的最大日志index
+func (n *Node) CommitIndex() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.commitIndex
+}
+
+// LastApplied 返回已应用的最大日志index
+func (n *Node) LastApplied() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.lastApplied
+}
+
+// AddLearner leader会向learner复制日志，但learner不参与选举和提交
+func (n *Node) AddLearner(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if id == n.cfg.ID || n.isVoter(id) {
+		return
+	}
+	if _, ok := n.learners[id]; ok {
+		return
+	}
+	n.learners[id] = struct{}{}
+	n.nextIndex[id] = n.lastIndex() + 1
+	n.matchIndex[id] = 0
+}
+
+func (n *Node) isVoter(id string) bool {
+	for _, voter := range n.cfg.Voters {
+		if voter == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *Node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+func (n *Node) resetElectionDeadline() {
+	timeout := n.cfg.ElectionTimeout + time.Duration(rand.Int63n(int64(n.cfg.ElectionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// becomeFollower 调用方需持有mu
+func (n *Node) becomeFollower(term uint64) {
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		n.dirty = true
+	}
+	n.role = Follower
+}
+
+// persist 将修改过的状态写入StateFile，调用方需持有mu
+func (n *Node) persist() error {
+	if !n.dirty {
+		return nil
+	}
+	if n.cfg.StateFile != "" {
+		err := saveState(n.cfg.StateFile, &persistentState{
+			Term:     n.currentTerm,
+			VotedFor: n.votedFor,
+			Log:      n.log[1:],
+		})
+		if err != nil {
+			logger.Error("raft: save state failed: " + err.Error())
+			return err
+		}
+	}
+	n.dirty = false
+	return nil
+}
+
+// Propose 由leader追加一条日志，日志被应用之后返回其index
+func (n *Node) Propose(data []byte) (uint64, error) {
+	n.mu.Lock()
+	if n.role != Leader {
+		n.mu.Unlock()
+		return 0, ErrNotLeader
+	}
+	entry := Entry{Term: n.currentTerm, Index: n.lastIndex() + 1, Data: data}
+	n.log = append(n.log, entry)
+	n.dirty = true
+	if err := n.persist(); err != nil {
+		n.log = n.log[:len(n.log)-1]
+		n.mu.Unlock()
+		return 0, err
+	}
+	waiter := make(chan uint64, 1)
+	n.waiters[entry.Index] = waiter
+	n.mu.Unlock()
+
+	n.broadcastAppendEntries()
+
+	timer := time.NewTimer(2 * n.cfg.ElectionTimeout)
+	defer timer.Stop()
+	select {
+	case term := <-waiter:
+		if term != entry.Term {
+			return 0, ErrProposalDropped
+		}
+		return entry.Index, nil
+	case <-timer.C:
+		n.mu.Lock()
+		delete(n.waiters, entry.Index)
+		n.mu.Unlock()
+		return 0, ErrTimeout
+	case <-n.stopCh:
+		return 0, ErrStopped
+	}
+}
+
+func (n *Node) tickLoop() {
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-ticker.C:
+		}
+		n.mu.Lock()
+		role := n.role
+		timeout := time.Now().After(n.electionDeadline)
+		voter := n.isVoter(n.cfg.ID)
+		n.mu.Unlock()
+
+		if role == Leader {
+			n.broadcastAppendEntries()
+		} else if timeout && voter {
+			n.startElection()
+		}
+	}
+}
+
+func (n *Node) startElection() {
+	n.mu.Lock()
+	n.role = Candidate
+	n.currentTerm++
+	n.votedFor = n.cfg.ID
+	n.dirty = true
+	n.leaderID = ""
+	n.resetElectionDeadline()
+	if err := n.persist(); err != nil {
+		// 投票没有持久化时不能开始选举
+		n.role = Follower
+		n.mu.Unlock()
+		return
+	}
+	term := n.currentTerm
+	args := &RequestVoteArgs{
+		Term:         term,
+		CandidateID:  n.cfg.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	voters := append([]string{}, n.cfg.Voters...)
+	n.mu.Unlock()
+
+	// votes在持有mu时修改
+	votes := 1
+	for _, peer := range voters {
+		if peer == n.cfg.ID {
+			continue
+		}
+		go func(peer string) {
+			reply, err := n.cfg.Transport.RequestVote(peer, args)
+			if err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if reply.Term > n.currentTerm {
+				n.becomeFollower(reply.Term)
+				_ = n.persist()
+				return
+			}
+			if !reply.VoteGranted || n.role != Candidate || n.currentTerm != term {
+				return
+			}
+			votes++
+			if votes == len(voters)/2+1 {
+				n.becomeLeader()
+			}
+		}(peer)
+	}
+	if len(voters) == 1 {
+		n.mu.Lock()
+		if n.role == Candidate && n.currentTerm == term {
+			n.becomeLeader()
+		}
+		n.mu.Unlock()
+	}
+}
+
+// becomeLeader 调用方需持有mu，上任时写入一条空日志以提交之前任期的日志
+func (n *Node) becomeLeader() {
+	n.log = append(n.log, Entry{Term: n.currentTerm, Index: n.lastIndex() + 1})
+	n.dirty = true
+	if err := n.persist(); err != nil {
+		n.log = n.log[:len(n.log)-1]
+		n.role = Follower
+		return
+	}
+	n.role = Leader
+	n.leaderID = n.cfg.ID
+	for _, peer := range n.peers() {
+		n.nextIndex[peer] = n.lastIndex()
+		n.matchIndex[peer] = 0
+	}
+	n.maybeCommit()
+	go n.broadcastAppendEntries()
+}
+
+// peers 需要复制日志的节点，调用方需持有mu
+func (n *Node) peers() []string {
+	result := make([]string, 0, len(n.cfg.Voters)+len(n.learners))
+	for _, voter := range n.cfg.Voters {
+		if voter != n.cfg.ID {
+			result = append(result, voter)
+		}
+	}
+	for learner := range n.learners {
+		result = append(result, learner)
+	}
+	return result
+}
+
+func (n *Node) broadcastAppendEntries() {
+	n.mu.Lock()
+	peers := n.peers()
+	n.mu.Unlock()
+	for _, peer := range peers {
+		go n.replicateTo(peer)
+	}
+}
+
+func (n *Node) replicateTo(peer string) {
+	n.mu.Lock()
+	if n.role != Leader || n.replicating[peer] {
+		n.mu.Unlock()
+		return
+	}
+	n.replicating[peer] = true
+	next := n.nextIndex[peer]
+	if next < 1 {
+		next = 1
+	}
+	if next > n.lastIndex()+1 {
+		next = n.lastIndex() + 1
+	}
+	args := &AppendEntriesArgs{
+		Term:         n.currentTerm,
+		LeaderID:     n.cfg.ID,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.log[next-1].Term,
+		Entries:      append([]Entry{}, n.log[next:]...),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	reply, err := n.cfg.Transport.AppendEntries(peer, args)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.replicating[peer] = false
+	if err != nil {
+		return
+	}
+	if reply.Term > n.currentTerm {
+		n.becomeFollower(reply.Term)
+		n.resetElectionDeadline()
+		_ = n.persist()
+		return
+	}
+	if n.role != Leader || n.currentTerm != args.Term {
+		return
+	}
+	if reply.Success {
+		match := args.PrevLogIndex + uint64(len(args.Entries))
+		if match > n.matchIndex[peer] {
+			n.matchIndex[peer] = match
+		}
+		n.nextIndex[peer] = match + 1
+		n.maybeCommit()
+		return
+	}
+	if reply.ConflictIndex > 0 {
+		n.nextIndex[peer] = reply.ConflictIndex
+	} else if n.nextIndex[peer] > 1 {
+		n.nextIndex[peer]--
+	}
+}
+
+// maybeCommit 大多数voter已复制的当前任期日志即可提交，调用方需持有mu
+func (n *Node) maybeCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.log[index].Term != n.currentTerm {
+			break
+		}
+		count := 0
+		for _, voter := range n.cfg.Voters {
+			if voter == n.cfg.ID || n.matchIndex[voter] >= index {
+				count++
+			}
+		}
+		if count > len(n.cfg.Voters)/2 {
+			n.commitIndex = index
+			n.notifyApply()
+			return
+		}
+	}
+}
+
+func (n *Node) notifyApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) applyLoop() {
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-n.applyCh:
+		}
+		n.mu.Lock()
+		entries := append([]Entry{}, n.log[n.lastApplied+1:n.commitIndex+1]...)
+		n.mu.Unlock()
+
+		for _, entry := range entries {
+			if entry.Data != nil && n.cfg.Apply != nil {
+				n.cfg.Apply(entry)
+			}
+			n.mu.Lock()
+			n.lastApplied = entry.Index
+			if waiter, ok := n.waiters[entry.Index]; ok {
+				waiter <- entry.Term
+				delete(n.waiters, entry.Index)
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+func (n *Node) HandleRequestVote(args *RequestVoteArgs) *RequestVoteReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if args.Term > n.currentTerm {
+		n.becomeFollower(args.Term)
+	}
+	reply := &RequestVoteReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply
+	}
+	// 只投票给日志至少和自己一样新的candidate
+	upToDate := args.LastLogTerm > n.lastTerm() ||
+		(args.LastLogTerm == n.lastTerm() && args.LastLogIndex >= n.lastIndex())
+	if (n.votedFor == "" || n.votedFor == args.CandidateID) && upToDate {
+		if n.votedFor != args.CandidateID {
+			n.votedFor = args.CandidateID
+			n.dirty = true
+		}
+		n.resetElectionDeadline()
+		reply.VoteGranted = true
+	}
+	// 任期和投票持久化之后才能回复，否则重启后可能在同一个任期内再次投票
+	if err := n.persist(); err != nil {
+		reply.VoteGranted = false
+	}
+	return reply
+}
+
+func (n *Node) HandleAppendEntries(args *AppendEntriesArgs) *AppendEntriesReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	reply := &AppendEntriesReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply
+	}
+	n.becomeFollower(args.Term)
+	n.leaderID = args.LeaderID
+	n.resetElectionDeadline()
+	reply.Term = n.currentTerm
+	if err := n.persist(); err != nil {
+		return reply
+	}
+
+	if args.PrevLogIndex > n.lastIndex() {
+		reply.ConflictIndex = n.lastIndex() + 1
+		return reply
+	}
+	if n.log[args.PrevLogIndex].Term != args.PrevLogTerm {
+		// 跳过整个冲突的任期
+		conflictTerm := n.log[args.PrevLogIndex].Term
+		index := args.PrevLogIndex
+		for index > 1 && n.log[index-1].Term == conflictTerm {
+			index--
+		}
+		reply.ConflictIndex = index
+		return reply
+	}
+
+	for i, entry := range args.Entries {
+		if entry.Index <= n.lastIndex() {
+			if n.log[entry.Index].Term == entry.Term {
+				continue
+			}
+			n.log = n.log[:entry.Index]
+		}
+		n.log = append(n.log, args.Entries[i:]...)
+		n.dirty = true
+		break
+	}
+	// 日志持久化之后才能回复成功，leader据此认为日志已经复制到大多数节点
+	if err := n.persist(); err != nil {
+		return reply
+	}
+
+	commitIndex := args.LeaderCommit
+	if lastNew := args.PrevLogIndex + uint64(len(args.Entries)); lastNew < commitIndex {
+		commitIndex = lastNew
+	}
+	if commitIndex > n.commitIndex {
+		n.commitIndex = commitIndex
+		n.notifyApply()
+	}
+	reply.Success = true
+	return reply
+}
@@ -0,0 +1,254 @@
+package raft
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: raft_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+type testCluster struct {
+	transport *LoopbackTransport
+	nodes     map[string]*Node
+	mu        sync.Mutex
+	applied   map[string][]string
+	voters    []string
+	learners  []string
+	// dir 不为空时节点的状态保存在dir中
+	dir string
+}
+
+func makeTestCluster(voters []string, learners ...string) *testCluster {
+	return makePersistentTestCluster("", voters, learners...)
+}
+
+func makePersistentTestCluster(dir string, voters []string, learners ...string) *testCluster {
+	tc := &testCluster{
+		transport: NewLoopbackTransport(),
+		nodes:     make(map[string]*Node),
+		applied:   make(map[string][]string),
+		voters:    voters,
+		learners:  learners,
+		dir:       dir,
+	}
+	for _, id := range append(append([]string{}, voters...), learners...) {
+		tc.startNode(id)
+	}
+	return tc
+}
+
+// startNode 启动节点，持久化的节点重启时从dir中恢复状态
+func (tc *testCluster) startNode(id string) *Node {
+	stateFile := ""
+	if tc.dir != "" {
+		stateFile = filepath.Join(tc.dir, id+".json")
+	}
+	node, err := NewNode(Config{
+		ID:                id,
+		Voters:            tc.voters,
+		HeartbeatInterval: 10 * time.Millisecond,
+		ElectionTimeout:   50 * time.Millisecond,
+		Transport:         tc.transport.From(id),
+		Apply: func(entry Entry) {
+			tc.mu.Lock()
+			defer tc.mu.Unlock()
+			tc.applied[id] = append(tc.applied[id], string(entry.Data))
+		},
+		StateFile: stateFile,
+	})
+	if err != nil {
+		panic(err)
+	}
+	for _, learner := range tc.learners {
+		node.AddLearner(learner)
+	}
+	tc.mu.Lock()
+	tc.applied[id] = nil
+	tc.mu.Unlock()
+	tc.transport.Register(node)
+	tc.nodes[id] = node
+	node.Start()
+	return node
+}
+
+func (tc *testCluster) stop() {
+	for _, node := range tc.nodes {
+		node.Stop()
+	}
+}
+
+// waitLeader 等待除excluded之外出现唯一的leader
+func (tc *testCluster) waitLeader(t *testing.T, excluded string) *Node {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		var leader *Node
+		count := 0
+		for id, node := range tc.nodes {
+			if id != excluded && node.IsLeader() {
+				leader = node
+				count++
+			}
+		}
+		if count == 1 {
+			return leader
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no leader elected")
+	return nil
+}
+
+func (tc *testCluster) waitApplied(t *testing.T, id string, expected []string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		tc.mu.Lock()
+		applied := append([]string{}, tc.applied[id]...)
+		tc.mu.Unlock()
+		if len(applied) == len(expected) {
+			for i := range expected {
+				if applied[i] != expected[i] {
+					t.Fatalf("node %s applied %v, expected %v", id, applied, expected)
+				}
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("node %s did not apply %v", id, expected)
+}
+
+func TestElectionAndReplication(t *testing.T) {
+	tc := makeTestCluster([]string{"a", "b", "c"}, "d")
+	defer tc.stop()
+
+	leader := tc.waitLeader(t, "")
+	expected := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		data := "cmd" + strconv.Itoa(i)
+		if _, err := leader.Propose([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, data)
+	}
+	for id := range tc.nodes {
+		tc.waitApplied(t, id, expected)
+	}
+	if tc.nodes["d"].IsLeader() {
+		t.Error("learner should never become leader")
+	}
+
+	for id, node := range tc.nodes {
+		if node != leader {
+			if _, err := node.Propose([]byte("x")); err != ErrNotLeader {
+				t.Errorf("follower %s should reject proposal, got %v", id, err)
+			}
+		}
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	tc := makeTestCluster([]string{"a", "b", "c"})
+	defer tc.stop()
+
+	oldLeader := tc.waitLeader(t, "")
+	if _, err := oldLeader.Propose([]byte("before")); err != nil {
+		t.Fatal(err)
+	}
+	tc.transport.Disconnect(oldLeader.ID())
+	newLeader := tc.waitLeader(t, oldLeader.ID())
+	if _, err := newLeader.Propose([]byte("after")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧leader重新连接后应当退位并同步新日志
+	tc.transport.Connect(oldLeader.ID())
+	for id := range tc.nodes {
+		tc.waitApplied(t, id, []string{"before", "after"})
+	}
+	if oldLeader.IsLeader() && newLeader.IsLeader() {
+		t.Error("two leaders after reconnect")
+	}
+}
+
+func TestMinorityCannotCommit(t *testing.T) {
+	tc := makeTestCluster([]string{"a", "b", "c"})
+	defer tc.stop()
+
+	leader := tc.waitLeader(t, "")
+	for id := range tc.nodes {
+		if id != leader.ID() {
+			tc.transport.Disconnect(id)
+		}
+	}
+	if _, err := leader.Propose([]byte("lost")); err == nil {
+		t.Error("proposal without majority should not be committed")
+	}
+}
+
+func TestVotePersistedAcrossRestart(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "a.json")
+	node, err := NewNode(Config{ID: "a", Voters: []string{"a", "b", "c"}, StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := node.HandleRequestVote(&RequestVoteArgs{Term: 5, CandidateID: "b"}); !reply.VoteGranted {
+		t.Fatal("expect vote granted to b")
+	}
+	node.HandleAppendEntries(&AppendEntriesArgs{Term: 5, LeaderID: "b", Entries: []Entry{{Term: 5, Index: 1, Data: []byte("x")}}})
+
+	// 重启之后同一个任期内不能再投票给其他candidate
+	restarted, err := NewNode(Config{ID: "a", Voters: []string{"a", "b", "c"}, StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if term, _ := restarted.State(); term != 5 {
+		t.Errorf("expect term 5 after restart, actual: %d", term)
+	}
+	if reply := restarted.HandleRequestVote(&RequestVoteArgs{Term: 5, CandidateID: "c", LastLogIndex: 1, LastLogTerm: 5}); reply.VoteGranted {
+		t.Error("node voted twice in term 5 after restart")
+	}
+	if reply := restarted.HandleRequestVote(&RequestVoteArgs{Term: 5, CandidateID: "b", LastLogIndex: 1, LastLogTerm: 5}); !reply.VoteGranted {
+		t.Error("expect vote granted to the same candidate again")
+	}
+	if restarted.lastIndex() != 1 || string(restarted.log[1].Data) != "x" {
+		t.Errorf("expect log restored after restart, actual: %v", restarted.log)
+	}
+}
+
+func TestAllNodesRestart(t *testing.T) {
+	tc := makePersistentTestCluster(t.TempDir(), []string{"a", "b", "c"})
+	defer tc.stop()
+
+	leader := tc.waitLeader(t, "")
+	for _, data := range []string{"x", "y"} {
+		if _, err := leader.Propose([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := range tc.nodes {
+		tc.waitApplied(t, id, []string{"x", "y"})
+	}
+	oldTerm, _ := leader.State()
+
+	// 所有节点重启后从日志中恢复，不会丢失已提交的数据
+	tc.stop()
+	for _, id := range tc.voters {
+		tc.startNode(id)
+	}
+	newLeader := tc.waitLeader(t, "")
+	if term, _ := newLeader.State(); term <= oldTerm {
+		t.Errorf("expect term greater than %d after restart, actual: %d", oldTerm, term)
+	}
+	for id := range tc.nodes {
+		tc.waitApplied(t, id, []string{"x", "y"})
+	}
+}
@@ -0,0 +1,66 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+/**
+ * @Author: wanglei
+ * @File: storage
+ * @Version: 1.0.0
+ * @Description: 持久化currentTerm、votedFor和日志，节点重启后不会在同一个任期内重复投票
+ * @Date: 2026/10/18 3:10
+ */
+
+// persistentState 回复RequestVote和AppendEntries之前需要写入磁盘的状态
+type persistentState struct {
+	Term     uint64  `json:"term"`
+	VotedFor string  `json:"votedFor,omitempty"`
+	Log      []Entry `json:"log,omitempty"`
+}
+
+// saveState 先写入临时文件并fsync，再rename覆盖原文件，崩溃时不会留下不完整的文件
+func saveState(filename string, state *persistentState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmpFilename := filename + ".tmp"
+	file, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+// loadState 文件不存在时返回nil
+func loadState(filename string) (*persistentState, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &persistentState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.New("raft: illegal state file " + filename + ": " + err.Error())
+	}
+	for i, entry := range state.Log {
+		if entry.Index != uint64(i+1) {
+			return nil, errors.New("raft: illegal log index in state file " + filename)
+		}
+	}
+	return state, nil
+}
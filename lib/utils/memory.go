@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/**
+ * @Author: wanglei
+ * @File: memory
+ * @Version: 1.0.0
+ * @Description: 解析Redis风格的内存大小，例如100mb、1gb
+ * @Date: 2026/10/18 10:12
+ */
+
+// 与Redis相同，k/m/g以1000为单位，kb/mb/gb以1024为单位
+var memoryUnits = []struct {
+	suffix string
+	unit   int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"k", 1000},
+	{"m", 1000 * 1000},
+	{"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseMemory 将内存大小转换为字节数，不带单位时为字节
+func ParseMemory(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range memoryUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			unit = u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("illegal memory size")
+	}
+	return n * unit, nil
+}
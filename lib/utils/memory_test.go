@@ -0,0 +1,41 @@
+package utils
+
+import "testing"
+
+/**
+ * @Author: wanglei
+ * @File: memory_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestParseMemory(t *testing.T) {
+	cases := map[string]int64{
+		"0":     0,
+		"1024":  1024,
+		"100b":  100,
+		"1k":    1000,
+		"1kb":   1024,
+		"2m":    2000000,
+		"2MB":   2 << 20,
+		"1g":    1000000000,
+		" 1gb ": 1 << 30,
+		"512mb": 512 << 20,
+	}
+	for s, expected := range cases {
+		actual, err := ParseMemory(s)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", s, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("parse %q: expected %d, actual %d", s, expected, actual)
+		}
+	}
+	for _, s := range []string{"", "mb", "-1", "1tb", "abc"} {
+		if _, err := ParseMemory(s); err == nil {
+			t.Errorf("parse %q should fail", s)
+		}
+	}
+}
@@ -20,3 +20,14 @@ func RandString(n int) string {
 	}
 	return string(b)
 }
+
+var hexLetters = []rune("0123456789abcdef")
+
+// RandHexString 创建一个n个字符的随机16进制字符串
+func RandHexString(n int) string {
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = hexLetters[rand.Intn(len(hexLetters))]
+	}
+	return string(b)
+}
@@ -20,6 +20,7 @@ type Pattern struct {
 
 var replaceMap = map[byte]string{
 	'+': `\+`,
+	'(': `\(`,
 	')': `\)`,
 	'$': `\$`,
 	'.': `\.`,
@@ -55,9 +56,9 @@ func CompilePattern(src string) (*Pattern, error) {
 				}
 			} else {
 				if src[i-1] == '[' && src[i-2] != '\\' {
-					regexSrc.WriteString(`^"`)
+					regexSrc.WriteString(`^`)
 				} else {
-					regexSrc.WriteString(`\^"`)
+					regexSrc.WriteString(`\^`)
 				}
 			}
 		} else if escaped, toEscape := replaceMap[ch]; toEscape {
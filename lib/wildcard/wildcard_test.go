@@ -0,0 +1,39 @@
+package wildcard
+
+import "testing"
+
+/**
+ * @Author: wanglei
+ * @File: wildcard_test
+ * @Version: 1.0.0
+ * @Description:
+ * @Date: 2026/10/18 10:12
+ */
+
+func TestPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		src     string
+		match   bool
+	}{
+		{"orders.*", "orders.created", true},
+		{"orders.*", "ordersXcreated", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"a[b-d]e", "ace", true},
+		{"(x)*", "(x)y", true},
+		{"__keyspace@0__:*", "__keyspace@0__:foo", true},
+	}
+	for _, c := range cases {
+		p, err := CompilePattern(c.pattern)
+		if err != nil {
+			t.Errorf("compile %s failed: %v", c.pattern, err)
+			continue
+		}
+		if p.IsMatch(c.src) != c.match {
+			t.Errorf("pattern %s match %s, expect %v", c.pattern, c.src, c.match)
+		}
+	}
+}
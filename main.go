@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"gmr/go-cache/aof"
 	"gmr/go-cache/config"
 	"gmr/go-cache/lib/logger"
 	redisServer "gmr/go-cache/redis/server"
 	"gmr/go-cache/tcp"
 	"os"
+	"strings"
 )
 
 var banner = `
@@ -25,9 +27,16 @@ var defaultProperties = &config.ServerProperties{
 	AppendOnly:     false,
 	AppendFilename: "",
 	MaxClients:     1000,
+	// 与Redis相同，默认截断aof末尾不完整的命令
+	AofLoadTruncated:  true,
+	AofUseRdbPreamble: true,
 }
 
 func main() {
+	// go-cache check-aof [--fix] <file> 离线检查并修复aof文件
+	if len(os.Args) > 1 && os.Args[1] == "check-aof" {
+		os.Exit(checkAof(os.Args[2:]))
+	}
 	fmt.Print(banner)
 	logger.Info("go-cache start...")
 
@@ -41,6 +50,12 @@ func main() {
 	} else {
 		config.SetupConfig(configFile)
 	}
+	// go-cache --sentinel 以sentinel模式运行，与在配置文件中设置sentinel yes相同
+	for _, arg := range os.Args[1:] {
+		if arg == "--sentinel" {
+			config.Properties.Sentinel = true
+		}
+	}
 
 	err := tcp.ListenAmdServeWithSignal(&tcp.Config{
 		Address: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
@@ -54,3 +69,71 @@ func fileExist(fileName string) bool {
 	info, err := os.Stat(fileName)
 	return err == nil && !info.IsDir()
 }
+
+func checkAof(args []string) int {
+	fix := false
+	filename := ""
+	for _, arg := range args {
+		if arg == "--fix" {
+			fix = true
+		} else {
+			filename = arg
+		}
+	}
+	if filename == "" {
+		fmt.Println("Usage: go-cache check-aof [--fix] <file.aof|file.manifest>")
+		return 1
+	}
+	files := []string{filename}
+	if strings.HasSuffix(filename, ".manifest") {
+		var err error
+		files, err = aof.ManifestFiles(filename)
+		if err != nil {
+			fmt.Println("Cannot read manifest: " + err.Error())
+			return 1
+		}
+	}
+	code := 0
+	for i, file := range files {
+		if strings.HasSuffix(file, ".rdb") {
+			fmt.Println("Skip RDB base file " + file)
+			continue
+		}
+		// 只有最后一个文件允许截断，之前的文件损坏需要人工处理
+		if checkAofFile(file, fix && i == len(files)-1) != 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+func checkAofFile(filename string, fix bool) int {
+	fmt.Println("Checking " + filename)
+	result, err := aof.CheckAof(filename)
+	if err != nil {
+		fmt.Println("Cannot open file: " + err.Error())
+		return 1
+	}
+	if result.Err == nil {
+		fmt.Printf("AOF analyzed: size=%d, ok_up_to=%d, commands=%d\n", result.Size, result.Valid, result.Commands)
+		fmt.Println("AOF is valid")
+		return 0
+	}
+	if result.Err == aof.ErrTruncated {
+		fmt.Printf("AOF is truncated: the last command is incomplete\n")
+	} else {
+		fmt.Printf("AOF has bad format: %v\n", result.Err)
+	}
+	fmt.Printf("AOF analyzed: size=%d, ok_up_to=%d, commands=%d, diff=%d\n",
+		result.Size, result.Valid, result.Commands, result.Size-result.Valid)
+	if !fix {
+		fmt.Println("AOF is not valid. Use the --fix option to try fixing it.")
+		return 1
+	}
+	if err := aof.FixAof(filename, result); err != nil {
+		fmt.Println("Failed to truncate AOF: " + err.Error())
+		return 1
+	}
+	fmt.Printf("Successfully truncated AOF to %d bytes\n", result.Valid)
+	return 0
+}
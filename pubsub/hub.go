@@ -3,6 +3,7 @@ package pubsub
 import (
 	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/lockmap"
+	"sync"
 )
 
 /**
@@ -15,13 +16,21 @@ import (
 
 // 存储所有订阅关系
 type Hub struct {
-	subs      dict.Dict
+	subs dict.Dict
+	// shardSubs sharded channel的订阅关系，与普通channel相互独立
+	shardSubs dict.Dict
 	subLocker *lockmap.Locks
+
+	// pattern:*patternSubscribers，publish时需要遍历所有pattern，使用读写锁保护
+	patterns  map[string]*patternSubscribers
+	patternMu sync.RWMutex
 }
 
 func MakeHub() *Hub {
 	return &Hub{
 		subs:      dict.MakeConcurrentDict(4),
+		shardSubs: dict.MakeConcurrentDict(4),
 		subLocker: lockmap.MakeLocks(16),
+		patterns:  make(map[string]*patternSubscribers),
 	}
 }
@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"gmr/go-cache/datastruct/list"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/lib/wildcard"
+	"gmr/go-cache/redis/protocol"
+)
+
+/**
+ * @Author: wanglei
+ * @File: pattern
+ * @Version: 1.0.0
+ * @Description: psubscribe/punsubscribe，按照glob pattern订阅channel，匹配的消息以pmessage发送
+ * @Date: 2026/10/18 10:12
+ */
+
+var (
+	_psubscribe        = "psubscribe"
+	_punsubscribe      = "punsubscribe"
+	pmessageBytes      = []byte("pmessage")
+	pUnsubscribeNotify = []byte("*3\r\n$12\r\npunsubscribe\r\n$-1\r\n:0\r\n")
+)
+
+// patternSubscribers 订阅同一个pattern的所有connection
+type patternSubscribers struct {
+	pattern *wildcard.Pattern
+	subs    *list.LinkedList
+}
+
+// psubscribe 调用方需要持有hub.patternMu的写锁
+func psubscribe(hub *Hub, pattern string, compiled *wildcard.Pattern, conn redis.Connection) {
+	conn.PSubscribe(pattern)
+
+	ps, ok := hub.patterns[pattern]
+	if !ok {
+		ps = &patternSubscribers{
+			pattern: compiled,
+			subs:    list.MakeLinkedList(),
+		}
+		hub.patterns[pattern] = ps
+	}
+	if ps.subs.Contains(func(a interface{}) bool {
+		return a == conn
+	}) {
+		return
+	}
+	ps.subs.Add(conn)
+}
+
+// punsubscribe 调用方需要持有hub.patternMu的写锁
+func punsubscribe(hub *Hub, pattern string, conn redis.Connection) {
+	conn.PUnsubscribe(pattern)
+
+	ps, ok := hub.patterns[pattern]
+	if !ok {
+		return
+	}
+	ps.subs.RemoveAllByValue(func(a interface{}) bool {
+		return utils.Equals(a, conn)
+	})
+	if ps.subs.Len() == 0 {
+		delete(hub.patterns, pattern)
+	}
+}
+
+func PSubscribe(hub *Hub, conn redis.Connection, args [][]byte) redis.Reply {
+	patterns := make([]string, len(args))
+	compiled := make([]*wildcard.Pattern, len(args))
+	for i, b := range args {
+		pattern, err := wildcard.CompilePattern(string(b))
+		if err != nil {
+			return protocol.MakeErrorReply("ERR invalid pattern '" + string(b) + "'")
+		}
+		patterns[i] = string(b)
+		compiled[i] = pattern
+	}
+
+	hub.patternMu.Lock()
+	defer hub.patternMu.Unlock()
+
+	for i, pattern := range patterns {
+		psubscribe(hub, pattern, compiled[i], conn)
+		_ = conn.Write(makeMsg(_psubscribe, pattern, int64(conn.SubCount())))
+	}
+	return &protocol.NoReply{}
+}
+
+func PUnsubscribe(hub *Hub, conn redis.Connection, args [][]byte) redis.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, b := range args {
+			patterns[i] = string(b)
+		}
+	} else {
+		patterns = conn.GetPatterns()
+	}
+
+	if len(patterns) == 0 {
+		_ = conn.Write(pUnsubscribeNotify)
+		return &protocol.NoReply{}
+	}
+
+	hub.patternMu.Lock()
+	defer hub.patternMu.Unlock()
+
+	for _, pattern := range patterns {
+		punsubscribe(hub, pattern, conn)
+		_ = conn.Write(makeMsg(_punsubscribe, pattern, int64(conn.SubCount())))
+	}
+	return &protocol.NoReply{}
+}
+
+// punsubscribeAll 连接关闭时取消所有pattern订阅
+func punsubscribeAll(hub *Hub, conn redis.Connection) {
+	patterns := conn.GetPatterns()
+	if len(patterns) == 0 {
+		return
+	}
+
+	hub.patternMu.Lock()
+	defer hub.patternMu.Unlock()
+
+	for _, pattern := range patterns {
+		punsubscribe(hub, pattern, conn)
+	}
+}
+
+// publishPattern 向pattern匹配channel的订阅者发送pmessage，返回接收消息的订阅者数量
+func publishPattern(hub *Hub, channel string, message []byte) int {
+	hub.patternMu.RLock()
+	defer hub.patternMu.RUnlock()
+
+	count := 0
+	for pattern, ps := range hub.patterns {
+		if !ps.pattern.IsMatch(channel) {
+			continue
+		}
+		reply := protocol.MakeMultiBulkReply([][]byte{
+			pmessageBytes,
+			[]byte(pattern),
+			[]byte(channel),
+			message,
+		}).ToBytes()
+		ps.subs.ForEach(func(i int, v interface{}) bool {
+			client, _ := v.(redis.Connection)
+			_ = client.Write(reply)
+			return true
+		})
+		count += ps.subs.Len()
+	}
+	return count
+}
@@ -1,11 +1,14 @@
 package pubsub
 
 import (
+	"gmr/go-cache/datastruct/dict"
 	"gmr/go-cache/datastruct/list"
 	"gmr/go-cache/interface/redis"
 	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/lib/wildcard"
 	"gmr/go-cache/redis/protocol"
 	"strconv"
+	"strings"
 )
 
 /**
@@ -20,26 +23,35 @@ var (
 	_subscribe        = "subscribe"
 	_unsubscribe      = "unsubscribe"
 	msgBytes          = []byte("message")
-	unSubscribeNotify = []byte("*3\r\n$11\r\nunsubscribe\r\n$-1\n:0\r\n")
+	unSubscribeNotify = []byte("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
 )
 
 func makeMsg(msg string, channel string, code int64) []byte {
-	return []byte("*3\r\n$" + strconv.FormatInt(int64(len(msg)), 10) + protocol.CRLF + protocol.CRLF +
+	return []byte("*3\r\n$" + strconv.FormatInt(int64(len(msg)), 10) + protocol.CRLF + msg + protocol.CRLF +
 		"$" + strconv.FormatInt(int64(len(channel)), 10) + protocol.CRLF + channel + protocol.CRLF +
 		":" + strconv.FormatInt(code, 10) + protocol.CRLF)
 }
 
 func subscribe(hub *Hub, channel string, conn redis.Connection) bool {
+	conn.Subscribe(channel)
+	return addSubscriber(hub.subs, channel, conn)
+}
+
+func unsubscribe(hub *Hub, channel string, conn redis.Connection) bool {
 	conn.Unsubscribe(channel)
+	return removeSubscriber(hub.subs, channel, conn)
+}
 
-	raw, ok := hub.subs.Get(channel)
+// addSubscriber 将conn加入channel的订阅者，已经订阅时返回false
+func addSubscriber(subs dict.Dict, channel string, conn redis.Connection) bool {
+	raw, ok := subs.Get(channel)
 	var subscribers *list.LinkedList
 
 	if ok {
 		subscribers, _ = raw.(*list.LinkedList)
 	} else {
 		subscribers = list.MakeLinkedList()
-		Hub{}.subs.Put(channel, subscribers)
+		subs.Put(channel, subscribers)
 	}
 
 	if subscribers.Contains(func(a interface{}) bool {
@@ -51,10 +63,9 @@ func subscribe(hub *Hub, channel string, conn redis.Connection) bool {
 	return true
 }
 
-func unsubscribe(hub *Hub, channel string, conn redis.Connection) bool {
-	conn.Unsubscribe(channel)
-
-	raw, ok := hub.subs.Get(channel)
+// removeSubscriber 将conn从channel的订阅者中移除，channel没有订阅者时返回false
+func removeSubscriber(subs dict.Dict, channel string, conn redis.Connection) bool {
+	raw, ok := subs.Get(channel)
 
 	if ok {
 		subscribers, _ := raw.(*list.LinkedList)
@@ -63,7 +74,7 @@ func unsubscribe(hub *Hub, channel string, conn redis.Connection) bool {
 		})
 
 		if subscribers.Len() == 0 {
-			hub.subs.Remove(channel)
+			subs.Remove(channel)
 		}
 		return true
 	}
@@ -116,6 +127,9 @@ func Unsubscribe(hub *Hub, conn redis.Connection, args [][]byte) redis.Reply {
 }
 
 func UnsubscribeAll(hub *Hub, conn redis.Connection) {
+	punsubscribeAll(hub, conn)
+	sunsubscribeAll(hub, conn)
+
 	channels := conn.GetChannels()
 
 	hub.subLocker.Locks(channels...)
@@ -134,23 +148,87 @@ func Publish(hub *Hub, args [][]byte) redis.Reply {
 	channel := string(args[0])
 	message := args[1]
 
+	count := publishChannel(hub, hub.subs, msgBytes, channel, message)
+	count += publishPattern(hub, channel, message)
+	return protocol.MakeIntReply(int64(count))
+}
+
+// publishChannel 向channel的订阅者发送message，kind为message或smessage，返回接收消息的订阅者数量
+func publishChannel(hub *Hub, subs dict.Dict, kind []byte, channel string, message []byte) int {
 	hub.subLocker.Lock(channel)
 	defer hub.subLocker.UnLock(channel)
 
-	raw, ok := hub.subs.Get(channel)
+	raw, ok := subs.Get(channel)
 	if !ok {
-		return protocol.MakeIntReply(0)
+		return 0
 	}
 
 	subscribes, _ := raw.(*list.LinkedList)
 	subscribes.ForEach(func(i int, v interface{}) bool {
 		client, _ := v.(redis.Connection)
 		replyArgs := make([][]byte, 3)
-		replyArgs[0] = msgBytes
+		replyArgs[0] = kind
 		replyArgs[1] = []byte(channel)
 		replyArgs[2] = message
 		_ = client.Write(protocol.MakeMultiBulkReply(replyArgs).ToBytes())
 		return true
 	})
-	return protocol.MakeIntReply(int64(subscribes.Len()))
+	return subscribes.Len()
+}
+
+// PubSub PUBSUB CHANNELS|SHARDCHANNELS [pattern] | NUMSUB|SHARDNUMSUB [channel ...] | NUMPAT
+func PubSub(hub *Hub, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	subs := hub.subs
+	if subCmd == "shardchannels" || subCmd == "shardnumsub" {
+		subs = hub.shardSubs
+	}
+	switch subCmd {
+	case "channels", "shardchannels":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrorReply("pubsub|" + subCmd)
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			var err error
+			pattern, err = wildcard.CompilePattern(string(args[1]))
+			if err != nil {
+				return protocol.MakeErrorReply("ERR invalid pattern '" + string(args[1]) + "'")
+			}
+		}
+		result := make([][]byte, 0)
+		for _, channel := range subs.Keys() {
+			if pattern == nil || pattern.IsMatch(channel) {
+				result = append(result, []byte(channel))
+			}
+		}
+		return protocol.MakeMultiBulkReply(result)
+	case "numsub", "shardnumsub":
+		result := make([]redis.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			result = append(result, protocol.MakeBulkReply(arg), protocol.MakeIntReply(int64(numSub(hub, subs, string(arg)))))
+		}
+		return protocol.MakeMultiRawReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrorReply("pubsub|numpat")
+		}
+		hub.patternMu.RLock()
+		defer hub.patternMu.RUnlock()
+		return protocol.MakeIntReply(int64(len(hub.patterns)))
+	}
+	return protocol.MakeErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
+
+// numSub channel的订阅者数量，不包括pattern订阅
+func numSub(hub *Hub, subs dict.Dict, channel string) int {
+	hub.subLocker.Lock(channel)
+	defer hub.subLocker.UnLock(channel)
+
+	raw, ok := subs.Get(channel)
+	if !ok {
+		return 0
+	}
+	subscribers, _ := raw.(*list.LinkedList)
+	return subscribers.Len()
 }
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/redis/protocol"
+)
+
+/**
+ * @Author: wanglei
+ * @File: shard
+ * @Version: 1.0.0
+ * @Description: sharded pub/sub，ssubscribe/sunsubscribe/spublish，集群模式下channel属于key所在的节点，
+ *               消息只在该节点上发布，单机模式下与普通channel相互独立
+ * @Date: 2026/10/18 10:12
+ */
+
+var (
+	_ssubscribe        = "ssubscribe"
+	_sunsubscribe      = "sunsubscribe"
+	smessageBytes      = []byte("smessage")
+	sUnsubscribeNotify = []byte("*3\r\n$12\r\nsunsubscribe\r\n$-1\r\n:0\r\n")
+)
+
+func ssubscribe(hub *Hub, channel string, conn redis.Connection) bool {
+	conn.SSubscribe(channel)
+	return addSubscriber(hub.shardSubs, channel, conn)
+}
+
+func sunsubscribe(hub *Hub, channel string, conn redis.Connection) bool {
+	conn.SUnsubscribe(channel)
+	return removeSubscriber(hub.shardSubs, channel, conn)
+}
+
+func SSubscribe(hub *Hub, conn redis.Connection, args [][]byte) redis.Reply {
+	channels := make([]string, len(args))
+	for i, b := range args {
+		channels[i] = string(b)
+	}
+
+	hub.subLocker.Locks(channels...)
+	defer hub.subLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		if ssubscribe(hub, channel, conn) {
+			_ = conn.Write(makeMsg(_ssubscribe, channel, int64(len(conn.GetShardChannels()))))
+		}
+	}
+	return &protocol.NoReply{}
+}
+
+func SUnsubscribe(hub *Hub, conn redis.Connection, args [][]byte) redis.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, b := range args {
+			channels[i] = string(b)
+		}
+	} else {
+		channels = conn.GetShardChannels()
+	}
+
+	if len(channels) == 0 {
+		_ = conn.Write(sUnsubscribeNotify)
+		return &protocol.NoReply{}
+	}
+
+	hub.subLocker.Locks(channels...)
+	defer hub.subLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		sunsubscribe(hub, channel, conn)
+		_ = conn.Write(makeMsg(_sunsubscribe, channel, int64(len(conn.GetShardChannels()))))
+	}
+	return &protocol.NoReply{}
+}
+
+// sunsubscribeAll 连接关闭时取消所有sharded channel订阅
+func sunsubscribeAll(hub *Hub, conn redis.Connection) {
+	channels := conn.GetShardChannels()
+
+	hub.subLocker.Locks(channels...)
+	defer hub.subLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		sunsubscribe(hub, channel, conn)
+	}
+}
+
+// SPublish 向sharded channel的订阅者发送smessage，不会匹配pattern订阅
+func SPublish(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrorReply("spublish")
+	}
+	count := publishChannel(hub, hub.shardSubs, smessageBytes, string(args[0]), args[1])
+	return protocol.MakeIntReply(int64(count))
+}
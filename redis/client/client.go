@@ -94,6 +94,11 @@ func (client *Client) Close() {
 	close(client.waitingReqs)
 }
 
+// IsClosed 重连失败后client会被关闭，不能再使用
+func (client *Client) IsClosed() bool {
+	return atomic.LoadInt32(&client.status) == closed
+}
+
 func (client *Client) reconnect() {
 	logger.Info("reconnect with", client.addr)
 	_ = client.conn.Close()
@@ -197,12 +202,12 @@ func (client *Client) doRequest(req *request) {
 	// 请求失败重试
 	for i := 0; i < maxRetry; i++ {
 		_, err = client.conn.Write(bytes)
-		if err != nil || (!strings.Contains(err.Error(), "timeout") && !strings.Contains(err.Error(), "deadline exceeded")) {
+		if err == nil || (!strings.Contains(err.Error(), "timeout") && !strings.Contains(err.Error(), "deadline exceeded")) {
 			break
 		}
 	}
 
-	if err != nil {
+	if err == nil {
 		// 发送成功后，进入等待响应队列
 		client.waitingReqs <- req
 	} else {
@@ -20,7 +20,7 @@ import (
 func TestClient(t *testing.T) {
 	client, err := MakeClient("localhost:6379")
 	if err != nil {
-		logger.Error(err)
+		t.Skipf("redis server is not available: %v", err)
 	}
 	client.Start()
 
@@ -112,7 +112,7 @@ func TestClient(t *testing.T) {
 func TestReconnect(t *testing.T) {
 	client, err := MakeClient("localhost:6379")
 	if err != nil {
-		logger.Error(err)
+		t.Skipf("redis server is not available: %v", err)
 	}
 	client.Start()
 
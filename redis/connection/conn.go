@@ -5,6 +5,7 @@ import (
 	"gmr/go-cache/lib/sync/wait"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +22,8 @@ const (
 	NormalCli = iota
 	// fake client with replication master
 	ReplicationRecvCli
+	// 集群中其他节点的连接，通过握手之后可以执行节点间的内部命令
+	PeerCli
 )
 
 // redist-cli的connection
@@ -32,6 +35,10 @@ type Connection struct {
 	mutex sync.Mutex
 	// subscribing channels
 	subs map[string]bool
+	// subscribing patterns
+	psubs map[string]bool
+	// subscribing sharded channels
+	ssubs map[string]bool
 	// password可能在运行时被修改，password作为存储密码
 	password string
 	// queued commands for multi
@@ -42,6 +49,8 @@ type Connection struct {
 	// 却换数据库
 	selectedDB int
 	role       int32
+	// closed 读取到EOF之后设置，需要原子访问
+	closed int32
 }
 
 // 返回connection实例
@@ -102,24 +111,88 @@ func (c *Connection) Unsubscribe(channel string) {
 	delete(c.subs, channel)
 }
 
-// 返回subscribing的channel的数量
+// 将当前connection以subscriber向pattern添加
+func (c *Connection) PSubscribe(pattern string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool)
+	}
+	c.psubs[pattern] = true
+}
+
+// 将当前connection以subscriber向pattern移除
+func (c *Connection) PUnsubscribe(pattern string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.psubs) == 0 {
+		return
+	}
+	delete(c.psubs, pattern)
+}
+
+// 将当前connection以subscriber向sharded channel添加
+func (c *Connection) SSubscribe(channel string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.ssubs == nil {
+		c.ssubs = make(map[string]bool)
+	}
+	c.ssubs[channel] = true
+}
+
+// 将当前connection以subscriber向sharded channel移除
+func (c *Connection) SUnsubscribe(channel string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.ssubs) == 0 {
+		return
+	}
+	delete(c.ssubs, channel)
+}
+
+// 返回subscribing的channel和pattern的数量
 func (c *Connection) SubCount() int {
-	return len(c.subs)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.subs) + len(c.psubs)
 }
 
 // 返回所有subscribing channel
 func (c *Connection) GetChannels() []string {
-	if c.subs == nil {
-		return make([]string, 0)
-	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	channels := make([]string, len(c.subs))
-	i := 0
-	for channel := range c.subs {
-		channels[i] = channel
-		i++
+	return mapKeys(c.subs)
+}
+
+// 返回所有subscribing pattern
+func (c *Connection) GetPatterns() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return mapKeys(c.psubs)
+}
+
+// 返回所有subscribing sharded channel
+func (c *Connection) GetShardChannels() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return mapKeys(c.ssubs)
+}
+
+func mapKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	return channels
+	return keys
 }
 
 // 存储auth密码
@@ -139,6 +212,7 @@ func (c *Connection) InMultiState() bool {
 
 // 设置transaction flag
 func (c *Connection) SetMultiState(state bool) {
+	c.multiState = state
 	if !state {
 		c.watching = nil
 		c.queue = nil
@@ -195,3 +269,16 @@ func (c *Connection) GetRole() int32 {
 func (c *Connection) SetRole(role int32) {
 	c.role = role
 }
+
+// 标记客户端已经断开
+func (c *Connection) MarkClosed() {
+	atomic.StoreInt32(&c.closed, 1)
+}
+
+// 客户端是否已经断开
+func (c *Connection) IsClosed() bool {
+	if c == nil {
+		return false
+	}
+	return atomic.LoadInt32(&c.closed) == 1
+}
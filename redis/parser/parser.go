@@ -21,6 +21,8 @@ import (
 	"strings"
 )
 
+var fullReSyncPrefix = []byte("+FULLRESYNC")
+
 type Payload struct {
 	Data redis.Reply
 	Err  error
@@ -33,6 +35,8 @@ type readState struct {
 	args              [][]byte // 参数的数组，用byte数组接收
 	bulkLen           int64
 	readingRepl       bool
+	// readingBulkBody 当前行是按照bulkLen读取的数据，即使以$开头也不是bulk header
+	readingBulkBody bool
 }
 
 // ParseStream 通过读取io.Reader并将结果通过 channel 将结果返回给调用者
@@ -73,6 +77,11 @@ func ParseOne(data []byte) (redis.Reply, error) {
 	if payload == nil {
 		return nil, errors.New("no protocol")
 	}
+	// 读完剩余的payload，使解析协程能够退出
+	go func() {
+		for range ch {
+		}
+	}()
 	return payload.Data, payload.Err
 }
 
@@ -143,6 +152,14 @@ func parse(reader io.Reader, ch chan<- *Payload) {
 					state = readState{}
 					continue
 				}
+				if state.expectedArgsCount == -1 {
+					// 阻塞命令超时返回的null array
+					ch <- &Payload{
+						Data: &protocol.NullMultiBulkReply{},
+					}
+					state = readState{}
+					continue
+				}
 			} else if msg[0] == '$' {
 				err = parseBulkHeader(msg, &state)
 				if err != nil {
@@ -167,6 +184,10 @@ func parse(reader io.Reader, ch chan<- *Payload) {
 					Err:  err,
 				}
 				state = readState{}
+				// master在FULLRESYNC之后发送的RDB没有CRLF结尾
+				if bytes.HasPrefix(msg, fullReSyncPrefix) {
+					state.readingRepl = true
+				}
 				continue
 			}
 		} else {
@@ -204,6 +225,7 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 	var msg []byte
 	var err error
 
+	state.readingBulkBody = state.bulkLen != 0
 	if state.bulkLen == 0 {
 		//读行数据
 		msg, err = bufReader.ReadBytes('\n')
@@ -236,6 +258,10 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 func parseMultiBulkHeader(msg []byte, state *readState) error {
 	var err error
 	var expectedLine uint64
+	if string(msg[1:len(msg)-2]) == "-1" {
+		state.expectedArgsCount = -1
+		return nil
+	}
 	expectedLine, err = strconv.ParseUint(string(msg[1:len(msg)-2]), 10, 32)
 	if err != nil {
 		return errors.New("protocol error:" + string(msg))
@@ -301,16 +327,21 @@ func parseSingleLineReply(msg []byte) (redis.Reply, error) {
 
 // 读取后续的bulk协议数据
 func readBody(msg []byte, state *readState) error {
+	if state.readingRepl {
+		state.args = append(state.args, msg)
+		return nil
+	}
 	line := msg[0 : len(msg)-2]
 	var err error
-	if msg[0] == '$' {
+	if msg[0] == '$' && !state.readingBulkBody {
 		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
 		if err != nil {
 			return errors.New("protocol error:" + string(msg))
 		}
 
-		if state.bulkLen <= 0 {
-			state.args = append(state.args, []byte{})
+		if state.bulkLen == -1 {
+			// null bulk string
+			state.args = append(state.args, nil)
 			state.bulkLen = 0
 		}
 	} else {
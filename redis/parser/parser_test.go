@@ -6,6 +6,7 @@ import (
 	"gmr/go-cache/lib/utils"
 	"gmr/go-cache/redis/protocol"
 	"io"
+	"strconv"
 	"testing"
 )
 
@@ -29,6 +30,16 @@ func TestParseStream(t *testing.T) {
 			[]byte("\r\n"),
 		}),
 		protocol.MakeEmptyMultiBulkReply(),
+		protocol.MakeNullMultiBulkReply(),
+		protocol.MakeMultiBulkReply([][]byte{
+			[]byte("a"),
+			nil,
+			[]byte(""),
+		}),
+		protocol.MakeMultiBulkReply([][]byte{
+			[]byte("$"),
+			[]byte("$1"),
+		}),
 	}
 
 	reqs := bytes.Buffer{}
@@ -67,3 +78,37 @@ func TestParseStream(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFullReSync(t *testing.T) {
+	rdbData := []byte("REDIS0009\xfa\x09redis-ver")
+	reqs := bytes.Buffer{}
+	reqs.Write(protocol.MakeStatusReply("FULLRESYNC abc 0").ToBytes())
+	reqs.Write([]byte("$" + strconv.Itoa(len(rdbData)) + protocol.CRLF))
+	reqs.Write(rdbData)
+	reqs.Write(protocol.MakeMultiBulkReply(utils.ToCmdLine("set", "a", "a")).ToBytes())
+
+	expected := []redis.Reply{
+		protocol.MakeStatusReply("FULLRESYNC abc 0"),
+		protocol.MakeBulkReply(rdbData),
+		protocol.MakeMultiBulkReply(utils.ToCmdLine("set", "a", "a")),
+	}
+	ch := ParseStream(bytes.NewReader(reqs.Bytes()))
+	i := 0
+	for payload := range ch {
+		if payload.Err != nil {
+			if payload.Err == io.EOF {
+				break
+			}
+			t.Error(payload.Err)
+			return
+		}
+		exp := expected[i]
+		i++
+		if !utils.BytesEquals(exp.ToBytes(), payload.Data.ToBytes()) {
+			t.Error("parse failed:" + string(exp.ToBytes()))
+		}
+	}
+	if i != len(expected) {
+		t.Errorf("expect %d replies, actual: %d", len(expected), i)
+	}
+}
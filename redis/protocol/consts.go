@@ -16,7 +16,8 @@ var (
 	pongBytes           = []byte("+PONG\r\n")
 	okBytes             = []byte("+OK\r\n")
 	nullBulkBytes       = []byte("$-1\r\n")
-	queuedBytes         = []byte("+QUEUE\r\r")
+	nullMultiBulkBytes  = []byte("*-1\r\n")
+	queuedBytes         = []byte("+QUEUED\r\n")
 )
 
 // 相应PONG
@@ -58,6 +59,17 @@ func MakeNullBulkReply() *NullBulkReply {
 	return &NullBulkReply{}
 }
 
+// 空数组，阻塞命令超时时返回
+type NullMultiBulkReply struct{}
+
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
+
 // 对subscribe之类的命令不响应
 type NoReply struct{}
 
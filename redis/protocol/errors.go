@@ -10,7 +10,7 @@ package protocol
 
 var (
 	theSyntaxErrorReply = new(SyntaxErrorReply)
-	unknownErrorBytes   = []byte("-Err unknown\r\r")
+	unknownErrorBytes   = []byte("-Err unknown\r\n")
 	syntaxErrorBytes    = []byte("-Err syntax error\r\n")
 	wrongTypeErrorBytes = []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
 )
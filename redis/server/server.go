@@ -2,12 +2,16 @@ package server
 
 import (
 	"context"
+	"gmr/go-cache/cluster"
+	"gmr/go-cache/config"
+	"gmr/go-cache/database"
 	idatabase "gmr/go-cache/interface/database"
 	"gmr/go-cache/lib/logger"
 	"gmr/go-cache/lib/sync/atomic"
 	"gmr/go-cache/redis/connection"
 	"gmr/go-cache/redis/parser"
 	"gmr/go-cache/redis/protocol"
+	"gmr/go-cache/sentinel"
 
 	"io"
 	"net"
@@ -35,12 +39,13 @@ type Handler struct {
 
 func MakeHandler() *Handler {
 	var db idatabase.DB
-	// todo:cluster waiting
-	//if config.Properties.Self != "" && len(config.Properties.Peer) > 0 {
-	//	db = cluster.MakeCluster()
-	//} else {
-	//	db = database.NewStandaloneServer()
-	//}
+	if config.Properties.Sentinel {
+		db = sentinel.MakeSentinel()
+	} else if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+		db = cluster.MakeCluster()
+	} else {
+		db = database.NewStandaloneServer()
+	}
 	return &Handler{
 		db: db,
 	}
@@ -49,7 +54,7 @@ func MakeHandler() *Handler {
 // server后续实现
 func (h *Handler) closeClient(client *connection.Connection) {
 	client.Close()
-	h.db.AfterClientClosed(client)
+	h.db.AfterClientClose(client)
 	h.activeConn.Delete(client)
 }
 
@@ -62,7 +67,14 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	client := connection.NewConnection(conn)
 	h.activeConn.Store(client, 1)
 
-	ch := parser.ParseStream(conn)
+	// 读取到EOF时立即唤醒阻塞的命令，此时执行循环可能正阻塞在BLPOP之类的命令中
+	ch := parser.ParseStream(&eofReader{
+		reader: conn,
+		onEOF: func() {
+			client.MarkClosed()
+			h.db.AfterClientClose(client)
+		},
+	})
 
 	for payload := range ch {
 		if payload.Err != nil {
@@ -100,6 +112,21 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// eofReader 读取出错时调用一次onEOF
+type eofReader struct {
+	reader io.Reader
+	once   sync.Once
+	onEOF  func()
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil {
+		r.once.Do(r.onEOF)
+	}
+	return n, err
+}
+
 func (h *Handler) Close() error {
 	logger.Info("handler shutting down...")
 	h.closing.Set(true)
@@ -0,0 +1,157 @@
+package sentinel
+
+import (
+	"errors"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: failover
+ * @Version: 1.0.0
+ * @Description: master客观下线后选出leader sentinel，由leader提升replica并通知其他sentinel
+ * @Date: 2026/10/18 10:12
+ */
+
+// maxDesync 发起选举前的随机等待，避免多个sentinel同时发起选举导致票数分散
+const maxDesync = time.Second
+
+func (s *Sentinel) nextEpoch() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currentEpoch++
+	return s.currentEpoch
+}
+
+// tryFailover master客观下线时发起选举，得到多数sentinel的投票后执行故障转移
+func (s *Sentinel) tryFailover() {
+	s.mu.Lock()
+	ready := s.odown && time.Since(s.failoverStart) >= s.failoverTimeout
+	start := s.failoverStart
+	s.mu.Unlock()
+	if !ready {
+		return
+	}
+	time.Sleep(time.Duration(rand.Int63n(int64(maxDesync))))
+
+	s.mu.Lock()
+	if !s.odown || s.failoverStart != start {
+		// 等待期间已经投票给其他sentinel
+		s.mu.Unlock()
+		return
+	}
+	s.failoverStart = time.Now()
+	s.currentEpoch++
+	epoch := s.currentEpoch
+	s.leader = s.runID
+	s.leaderEpoch = epoch
+	host, port, _ := net.SplitHostPort(s.master.addr)
+	// peers不包含自己，需要全部sentinel的多数票
+	needed := (len(s.peers)+1)/2 + 1
+	if needed < s.quorum {
+		needed = s.quorum
+	}
+	s.mu.Unlock()
+	logger.Info("+try-failover master " + s.name + " epoch " + strconv.FormatUint(epoch, 10))
+
+	votes := 1
+	epochStr := strconv.FormatUint(epoch, 10)
+	cmdLine := utils.ToCmdLine("SENTINEL", "is-master-down-by-addr", host, port, epochStr, s.runID)
+	for _, resp := range s.askPeers(cmdLine) {
+		arrReply, ok := resp.(*protocol.MultiBulkReply)
+		if ok && len(arrReply.Args) == 3 && string(arrReply.Args[1]) == s.runID && string(arrReply.Args[2]) == epochStr {
+			votes++
+		}
+	}
+	if votes < needed {
+		logger.Info("-failover-abort-not-elected " + strconv.Itoa(votes) + "/" + strconv.Itoa(needed))
+		return
+	}
+	logger.Info("+elected-leader epoch " + epochStr)
+	if err := s.failover(epoch); err != nil {
+		logger.Error("-failover-abort-no-good-slave " + err.Error())
+	}
+}
+
+// selectReplica 选择可以连接并且复制offset最大的replica
+func (s *Sentinel) selectReplica() *instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	candidates := make([]*instance, 0)
+	for _, replica := range s.replicas {
+		if replica.role == "slave" && !s.isDown(replica) {
+			candidates = append(candidates, replica)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].offset != candidates[j].offset {
+			return candidates[i].offset > candidates[j].offset
+		}
+		return candidates[i].addr < candidates[j].addr
+	})
+	return candidates[0]
+}
+
+// failover 提升replica为master，再将其他replica指向新master
+func (s *Sentinel) failover(epoch uint64) error {
+	promoted := s.selectReplica()
+	if promoted == nil {
+		return errors.New("no suitable replica to promote")
+	}
+	resp := promoted.link.send(utils.ToCmdLine("SLAVEOF", "NO", "ONE"))
+	if protocol.IsErrorReply(resp) {
+		return errors.New("promote " + promoted.addr + " failed: " + string(resp.ToBytes()))
+	}
+	logger.Info("+promoted-slave " + promoted.addr)
+	s.switchMaster(promoted.addr, epoch)
+
+	s.mu.Lock()
+	replicas := make([]*instance, 0, len(s.replicas))
+	for _, replica := range s.replicas {
+		if replica.role == "slave" && !s.isDown(replica) {
+			replicas = append(replicas, replica)
+		}
+	}
+	s.mu.Unlock()
+	for _, replica := range replicas {
+		slaveOf(replica, promoted.addr)
+	}
+	s.sendHello()
+	return nil
+}
+
+// switchMaster 切换到新的master，旧master作为replica保留，恢复后会被重新配置
+func (s *Sentinel) switchMaster(addr string, epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if epoch > s.currentEpoch {
+		s.currentEpoch = epoch
+	}
+	s.configEpoch = epoch
+	if addr == s.master.addr {
+		return
+	}
+	oldMaster := s.master
+	newMaster, ok := s.replicas[addr]
+	if !ok {
+		newMaster = makeInstance(addr)
+	}
+	delete(s.replicas, addr)
+	s.replicas[oldMaster.addr] = oldMaster
+	newMaster.lastOK = time.Now()
+	s.master = newMaster
+	s.switchTime = time.Now()
+	s.sdown = false
+	s.odown = false
+	logger.Info("+switch-master " + s.name + " " + oldMaster.addr + " " + addr)
+}
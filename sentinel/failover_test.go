@@ -0,0 +1,221 @@
+package sentinel
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/connection"
+	"gmr/go-cache/redis/parser"
+	"gmr/go-cache/redis/protocol"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/**
+ * @Author: wanglei
+ * @File: failover_test
+ * @Version: 1.0.0
+ * @Description: leader选举以及提升replica的测试
+ * @Date: 2026/10/18 3:10
+ */
+
+// serve 在随机端口上启动一个由handler处理命令的服务
+func serve(t *testing.T, handler func(c redis.Connection, cmdLine [][]byte) redis.Reply) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				client := connection.NewConnection(conn)
+				for payload := range parser.ParseStream(conn) {
+					if payload.Err != nil {
+						return
+					}
+					if r, ok := payload.Data.(*protocol.MultiBulkReply); ok {
+						_ = client.Write(handler(client, r.Args).ToBytes())
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// closedAddr 返回一个没有服务监听的地址
+func closedAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	return addr
+}
+
+// makeTestSentinel 不启动cron，由测试直接驱动状态变化
+func makeTestSentinel(t *testing.T, masterAddr string, quorum int) *Sentinel {
+	s := &Sentinel{
+		runID:           utils.RandHexString(40),
+		name:            "mymaster",
+		quorum:          quorum,
+		downAfter:       defaultDownAfter,
+		failoverTimeout: defaultFailoverTimeout,
+		master:          makeInstance(masterAddr),
+		replicas:        make(map[string]*instance),
+		peers:           make(map[string]*link),
+		stopCh:          make(chan struct{}),
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// startPeers 启动其他sentinel并加入s的peers，master已经被所有sentinel判定为下线
+func startPeers(t *testing.T, s *Sentinel, n int) []*Sentinel {
+	peers := make([]*Sentinel, n)
+	for i := range peers {
+		peer := makeTestSentinel(t, s.master.addr, s.quorum)
+		peer.sdown = true
+		addr := serve(t, peer.Exec)
+		s.peers[addr] = makeLink(addr, "")
+		peers[i] = peer
+	}
+	return peers
+}
+
+// fakeReplica 记录收到的SLAVEOF命令
+type fakeReplica struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (r *fakeReplica) exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, strings.ToUpper(string(cmdLine[0]))+" "+string(cmdLine[1])+" "+string(cmdLine[2]))
+	return protocol.MakeOkReply()
+}
+
+func (r *fakeReplica) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.commands...)
+}
+
+func addReplica(t *testing.T, s *Sentinel, offset int64) (string, *fakeReplica) {
+	replica := &fakeReplica{}
+	addr := serve(t, replica.exec)
+	ins := makeInstance(addr)
+	ins.role = "slave"
+	ins.offset = offset
+	s.replicas[addr] = ins
+	return addr, replica
+}
+
+func TestVoteOncePerEpoch(t *testing.T) {
+	s := makeTestSentinel(t, closedAddr(t), 2)
+	host, port, _ := net.SplitHostPort(s.master.addr)
+	vote := func(epoch string, runID string) string {
+		reply := s.execIsMasterDown(utils.ToCmdLine(host, port, epoch, runID)).(*protocol.MultiBulkReply)
+		return string(reply.Args[1])
+	}
+	if leader := vote("1", "a"); leader != "a" {
+		t.Fatalf("expect vote for a, actual: %s", leader)
+	}
+	// 同一个纪元内不会改投其他sentinel
+	if leader := vote("1", "b"); leader != "a" {
+		t.Errorf("expect a in epoch 1, actual: %s", leader)
+	}
+	if leader := vote("2", "b"); leader != "b" {
+		t.Errorf("expect vote for b in epoch 2, actual: %s", leader)
+	}
+}
+
+func TestElectAndPromote(t *testing.T) {
+	s := makeTestSentinel(t, closedAddr(t), 2)
+	peers := startPeers(t, s, 2)
+	oldMaster := s.master.addr
+	behindAddr, behind := addReplica(t, s, 10)
+	promotedAddr, promoted := addReplica(t, s, 100)
+	s.sdown, s.odown = true, true
+
+	s.tryFailover()
+
+	s.mu.Lock()
+	master, epoch := s.master.addr, s.configEpoch
+	s.mu.Unlock()
+	if master != promotedAddr || epoch != 1 {
+		t.Fatalf("expect %s promoted in epoch 1, actual: %s in epoch %d", promotedAddr, master, epoch)
+	}
+	if cmds := promoted.received(); len(cmds) != 1 || cmds[0] != "SLAVEOF NO ONE" {
+		t.Errorf("expect SLAVEOF NO ONE on the replica with the largest offset, actual: %q", cmds)
+	}
+	host, port, _ := net.SplitHostPort(promotedAddr)
+	if cmds := behind.received(); len(cmds) != 1 || cmds[0] != "SLAVEOF "+host+" "+port {
+		t.Errorf("expect %s to replicate the new master, actual: %q", behindAddr, cmds)
+	}
+	if _, ok := s.replicas[oldMaster]; !ok {
+		t.Errorf("old master should be kept as a replica")
+	}
+	// 其他sentinel投票给了leader，并通过hello切换到新master
+	for _, peer := range peers {
+		peer.mu.Lock()
+		leader, peerMaster := peer.leader, peer.master.addr
+		peer.mu.Unlock()
+		if leader != s.runID {
+			t.Errorf("expect peer voted for %s, actual: %s", s.runID, leader)
+		}
+		if peerMaster != promotedAddr {
+			t.Errorf("expect peer switched to %s, actual: %s", promotedAddr, peerMaster)
+		}
+	}
+}
+
+func TestFailoverNeedsMajority(t *testing.T) {
+	// 4个sentinel中只有2个可以投票，没有达到多数
+	s := makeTestSentinel(t, closedAddr(t), 2)
+	startPeers(t, s, 1)
+	for i := 0; i < 2; i++ {
+		addr := closedAddr(t)
+		s.peers[addr] = makeLink(addr, "")
+	}
+	_, replica := addReplica(t, s, 100)
+	oldMaster := s.master.addr
+	s.sdown, s.odown = true, true
+
+	s.tryFailover()
+
+	if s.master.addr != oldMaster {
+		t.Errorf("failover should be aborted without a majority, master switched to %s", s.master.addr)
+	}
+	if cmds := replica.received(); len(cmds) != 0 {
+		t.Errorf("replica should not be promoted, actual: %q", cmds)
+	}
+}
+
+func TestFailoverVoteTakenByOther(t *testing.T) {
+	s := makeTestSentinel(t, closedAddr(t), 2)
+	peers := startPeers(t, s, 2)
+	// 一个sentinel已经在纪元1中投票给其他sentinel，只能得到2/3票
+	peers[0].leader, peers[0].leaderEpoch = "other", 1
+	_, replica := addReplica(t, s, 100)
+	s.sdown, s.odown = true, true
+
+	s.tryFailover()
+
+	if cmds := replica.received(); len(cmds) != 1 || cmds[0] != "SLAVEOF NO ONE" {
+		t.Errorf("expect promotion with 2 of 3 votes, actual: %q", cmds)
+	}
+	if s.configEpoch != 1 {
+		t.Errorf("expect config epoch 1, actual: %d", s.configEpoch)
+	}
+}
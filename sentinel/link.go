@@ -0,0 +1,72 @@
+package sentinel
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/client"
+	"gmr/go-cache/redis/protocol"
+	"sync"
+)
+
+/**
+ * @Author: wanglei
+ * @File: link
+ * @Version: 1.0.0
+ * @Description: sentinel与被监控节点以及其他sentinel之间的连接，断开后在下一次发送时重连
+ * @Date: 2026/10/18 10:12
+ */
+
+type link struct {
+	addr     string
+	password string
+
+	mu     sync.Mutex
+	client *client.Client
+}
+
+func makeLink(addr string, password string) *link {
+	return &link{
+		addr:     addr,
+		password: password,
+	}
+}
+
+// getClient 返回可用的client，连接已关闭时重新建立
+func (l *link) getClient() (*client.Client, redis.Reply) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client != nil && !l.client.IsClosed() {
+		return l.client, nil
+	}
+	c, err := client.MakeClient(l.addr)
+	if err != nil {
+		return nil, protocol.MakeErrorReply("ERR connect " + l.addr + " failed: " + err.Error())
+	}
+	c.Start()
+	if l.password != "" {
+		result := c.Send(utils.ToCmdLine("AUTH", l.password))
+		if protocol.IsErrorReply(result) {
+			c.Close()
+			return nil, result
+		}
+	}
+	l.client = c
+	return c, nil
+}
+
+func (l *link) send(cmdLine [][]byte) redis.Reply {
+	c, errReply := l.getClient()
+	if errReply != nil {
+		return errReply
+	}
+	return c.Send(cmdLine)
+}
+
+func (l *link) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client != nil && !l.client.IsClosed() {
+		l.client.Close()
+	}
+	l.client = nil
+}
@@ -0,0 +1,295 @@
+package sentinel
+
+import (
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: monitor
+ * @Version: 1.0.0
+ * @Description: 定期通过INFO replication检查master和replica，判断master是否下线，
+ *               并与其他sentinel交换master配置
+ * @Date: 2026/10/18 10:12
+ */
+
+// helloCmd SENTINEL _hello name host port configEpoch，向其他sentinel广播当前的master
+const helloCmd = "_hello"
+
+func (s *Sentinel) cron() {
+	ticker := time.NewTicker(cronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+		s.refresh()
+		s.checkDown()
+		s.tryFailover()
+		s.reconfigureReplicas()
+		s.sendHello()
+	}
+}
+
+// isDown 超过downAfter没有收到有效回复，调用方需持有mu
+func (s *Sentinel) isDown(ins *instance) bool {
+	return time.Since(ins.lastOK) > s.downAfter
+}
+
+// parseInfo 将INFO的输出解析为key-value
+func parseInfo(info string) map[string]string {
+	result := make(map[string]string)
+	for _, line := range strings.Split(info, "\r\n") {
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		pivot := strings.IndexByte(line, ':')
+		if pivot > 0 {
+			result[line[:pivot]] = line[pivot+1:]
+		}
+	}
+	return result
+}
+
+// parseSlaveLine 解析master的slaveN字段，例如ip=127.0.0.1,port=6380,state=online,offset=100,lag=0
+func parseSlaveLine(line string) (string, bool) {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(line, ",") {
+		pivot := strings.IndexByte(field, '=')
+		if pivot > 0 {
+			fields[field[:pivot]] = field[pivot+1:]
+		}
+	}
+	if fields["ip"] == "" || fields["port"] == "" || fields["port"] == "0" {
+		return "", false
+	}
+	return net.JoinHostPort(fields["ip"], fields["port"]), true
+}
+
+// refresh 并发地向master和所有replica发送INFO replication
+func (s *Sentinel) refresh() {
+	s.mu.Lock()
+	instances := []*instance{s.master}
+	for _, replica := range s.replicas {
+		instances = append(instances, replica)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ins := range instances {
+		wg.Add(1)
+		go func(ins *instance) {
+			defer wg.Done()
+			s.refreshInstance(ins)
+		}(ins)
+	}
+	wg.Wait()
+}
+
+func (s *Sentinel) refreshInstance(ins *instance) {
+	resp := ins.link.send(utils.ToCmdLine("INFO", "replication"))
+	bulkReply, ok := resp.(*protocol.BulkReply)
+	if !ok {
+		return
+	}
+	info := parseInfo(string(bulkReply.Arg))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ins.lastOK = time.Now()
+	ins.role = info["role"]
+	if ins.role == "slave" {
+		ins.masterAddr = net.JoinHostPort(info["master_host"], info["master_port"])
+		ins.linkUp = info["master_link_status"] == "up"
+		ins.offset, _ = strconv.ParseInt(info["slave_repl_offset"], 10, 64)
+		return
+	}
+	ins.masterAddr = ""
+	ins.linkUp = false
+	ins.offset, _ = strconv.ParseInt(info["master_repl_offset"], 10, 64)
+	if ins != s.master || ins.role != "master" {
+		return
+	}
+	// 从master的INFO中发现replica
+	for key, value := range info {
+		if !strings.HasPrefix(key, "slave") || key == "slave_repl_offset" {
+			continue
+		}
+		addr, ok := parseSlaveLine(value)
+		if !ok || addr == s.master.addr {
+			continue
+		}
+		if _, exist := s.replicas[addr]; !exist {
+			s.replicas[addr] = makeInstance(addr)
+			logger.Info("+slave " + addr + " of " + s.name)
+		}
+	}
+}
+
+// askPeers 并发地向所有sentinel发送命令
+func (s *Sentinel) askPeers(cmdLine [][]byte) []redis.Reply {
+	s.mu.Lock()
+	peers := make([]*link, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peers = append(peers, peer)
+	}
+	s.mu.Unlock()
+
+	replies := make([]redis.Reply, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer *link) {
+			defer wg.Done()
+			replies[i] = peer.send(cmdLine)
+		}(i, peer)
+	}
+	wg.Wait()
+	return replies
+}
+
+// checkDown 判断master是否主观下线，主观下线时询问其他sentinel判断是否客观下线
+func (s *Sentinel) checkDown() {
+	s.mu.Lock()
+	sdown := s.isDown(s.master)
+	if sdown != s.sdown {
+		if sdown {
+			logger.Info("+sdown master " + s.name + " " + s.master.addr)
+		} else {
+			logger.Info("-sdown master " + s.name + " " + s.master.addr)
+		}
+	}
+	s.sdown = sdown
+	host, port, _ := net.SplitHostPort(s.master.addr)
+	epoch := s.currentEpoch
+	if !sdown {
+		s.odown = false
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	votes := 1
+	cmdLine := utils.ToCmdLine("SENTINEL", "is-master-down-by-addr", host, port, strconv.FormatUint(epoch, 10), "*")
+	for _, resp := range s.askPeers(cmdLine) {
+		if arrReply, ok := resp.(*protocol.MultiBulkReply); ok && len(arrReply.Args) == 3 && string(arrReply.Args[0]) == "1" {
+			votes++
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	odown := s.sdown && votes >= s.quorum
+	if odown && !s.odown {
+		logger.Info("+odown master " + s.name + " " + s.master.addr + " #quorum " + strconv.Itoa(votes) + "/" + strconv.Itoa(s.quorum))
+	}
+	s.odown = odown
+}
+
+// execIsMasterDown SENTINEL is-master-down-by-addr ip port epoch runid
+// runid为*时只返回本sentinel是否认为master下线，否则同时为runid投票
+func (s *Sentinel) execIsMasterDown(args [][]byte) redis.Reply {
+	epoch, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	}
+	addr := net.JoinHostPort(string(args[0]), string(args[1]))
+	runID := string(args[3])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	down := "0"
+	if addr == s.master.addr && s.sdown {
+		down = "1"
+	}
+	leader, leaderEpoch := "*", uint64(0)
+	if runID != "*" {
+		if epoch > s.currentEpoch {
+			s.currentEpoch = epoch
+		}
+		// 每个纪元只投一票，投给第一个请求的sentinel
+		if s.leaderEpoch < epoch {
+			s.leader = runID
+			s.leaderEpoch = epoch
+			if runID != s.runID {
+				// 给其他sentinel投票后，在failoverTimeout内不再发起故障转移
+				s.failoverStart = time.Now()
+			}
+			logger.Info("+vote-for-leader " + runID + " " + strconv.FormatUint(epoch, 10))
+		}
+		leader, leaderEpoch = s.leader, s.leaderEpoch
+	}
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(down, leader, strconv.FormatUint(leaderEpoch, 10)))
+}
+
+// reconfigureReplicas 将没有复制当前master的replica(包括恢复的旧master)指向当前master
+func (s *Sentinel) reconfigureReplicas() {
+	s.mu.Lock()
+	if s.sdown {
+		s.mu.Unlock()
+		return
+	}
+	masterAddr := s.master.addr
+	targets := make([]*instance, 0)
+	for _, replica := range s.replicas {
+		// 切换master之后需要等待新的INFO，避免重复配置leader已经配置过的replica
+		if replica.role == "" || s.isDown(replica) || !replica.lastOK.After(s.switchTime) {
+			continue
+		}
+		if replica.role == "master" || replica.masterAddr != masterAddr {
+			targets = append(targets, replica)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, replica := range targets {
+		slaveOf(replica, masterAddr)
+	}
+}
+
+func slaveOf(replica *instance, masterAddr string) {
+	host, port, _ := net.SplitHostPort(masterAddr)
+	resp := replica.link.send(utils.ToCmdLine("SLAVEOF", host, port))
+	if protocol.IsErrorReply(resp) {
+		logger.Error("reconfigure " + replica.addr + " failed: " + string(resp.ToBytes()))
+		return
+	}
+	logger.Info("+convert-to-slave " + replica.addr + " of " + masterAddr)
+}
+
+// sendHello 向其他sentinel广播当前的master和configEpoch
+func (s *Sentinel) sendHello() {
+	s.mu.Lock()
+	host, port, _ := net.SplitHostPort(s.master.addr)
+	epoch := s.configEpoch
+	s.mu.Unlock()
+	s.askPeers(utils.ToCmdLine("SENTINEL", helloCmd, s.name, host, port, strconv.FormatUint(epoch, 10)))
+}
+
+// execHello 收到更新纪元的master配置时切换master
+func (s *Sentinel) execHello(args [][]byte) redis.Reply {
+	epoch, err := strconv.ParseUint(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrorReply("ERR value is not an integer or out of range")
+	}
+	if string(args[0]) != s.name {
+		return protocol.MakeOkReply()
+	}
+	s.mu.Lock()
+	newer := epoch > s.configEpoch
+	s.mu.Unlock()
+	if newer {
+		s.switchMaster(net.JoinHostPort(string(args[1]), string(args[2])), epoch)
+	}
+	return protocol.MakeOkReply()
+}
@@ -0,0 +1,329 @@
+package sentinel
+
+import (
+	"errors"
+	"fmt"
+	"gmr/go-cache/config"
+	database2 "gmr/go-cache/database"
+	"gmr/go-cache/interface/redis"
+	"gmr/go-cache/lib/logger"
+	"gmr/go-cache/lib/utils"
+	"gmr/go-cache/redis/protocol"
+	"net"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @Author: wanglei
+ * @File: sentinel
+ * @Version: 1.0.0
+ * @Description: sentinel模式，监控一个master及其replica，多数sentinel确认master下线后提升replica
+ *               sentinel之间通过sentinel-peers配置互相发现，只支持监控一个master
+ * @Date: 2026/10/18 10:12
+ */
+
+const (
+	defaultDownAfter       = 30 * time.Second
+	defaultFailoverTimeout = 180 * time.Second
+	// cronInterval 检查节点状态以及与其他sentinel交换配置的间隔
+	cronInterval = time.Second
+)
+
+// instance 被监控的master或replica
+type instance struct {
+	addr string
+	link *link
+	// lastOK 最近一次收到有效回复的时间
+	lastOK time.Time
+	// 以下字段来自INFO replication
+	role       string
+	masterAddr string
+	linkUp     bool
+	offset     int64
+}
+
+func makeInstance(addr string) *instance {
+	return &instance{
+		addr:   addr,
+		link:   makeLink(addr, config.Properties.MasterAuth),
+		lastOK: time.Now(),
+	}
+}
+
+// Sentinel 实现了database.DB接口，由redis server处理客户端连接
+type Sentinel struct {
+	runID           string
+	name            string
+	quorum          int
+	downAfter       time.Duration
+	failoverTimeout time.Duration
+
+	mu       sync.Mutex
+	master   *instance
+	replicas map[string]*instance
+	peers    map[string]*link
+	// sdown 本sentinel认为master下线，odown 达到quorum的sentinel认为master下线
+	sdown bool
+	odown bool
+	// currentEpoch 选举使用的纪元，configEpoch 当前master配置对应的纪元
+	currentEpoch uint64
+	configEpoch  uint64
+	// 本sentinel在leaderEpoch中投票给了leader
+	leader      string
+	leaderEpoch uint64
+	// failoverStart 最近一次尝试故障转移或者投票给其他sentinel的时间
+	failoverStart time.Time
+	// switchTime 最近一次切换master的时间，之前获取的replica信息已经过期
+	switchTime time.Time
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// parseMonitor 解析"<name> <host> <port> <quorum>"
+func parseMonitor(monitor string) (string, string, int, error) {
+	fields := strings.Fields(monitor)
+	if len(fields) != 4 {
+		return "", "", 0, errors.New("sentinel-monitor should be '<name> <host> <port> <quorum>'")
+	}
+	port, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", "", 0, errors.New("illegal master port: " + fields[2])
+	}
+	quorum, err := strconv.Atoi(fields[3])
+	if err != nil || quorum <= 0 {
+		return "", "", 0, errors.New("illegal quorum: " + fields[3])
+	}
+	return fields[0], net.JoinHostPort(fields[1], strconv.Itoa(port)), quorum, nil
+}
+
+func MakeSentinel() *Sentinel {
+	name, masterAddr, quorum, err := parseMonitor(config.Properties.SentinelMonitor)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	s := &Sentinel{
+		runID:           utils.RandHexString(40),
+		name:            name,
+		quorum:          quorum,
+		downAfter:       defaultDownAfter,
+		failoverTimeout: defaultFailoverTimeout,
+		master:          makeInstance(masterAddr),
+		replicas:        make(map[string]*instance),
+		peers:           make(map[string]*link),
+		stopCh:          make(chan struct{}),
+	}
+	if config.Properties.SentinelDownAfter > 0 {
+		s.downAfter = time.Duration(config.Properties.SentinelDownAfter) * time.Millisecond
+	}
+	if config.Properties.SentinelFailoverTimeout > 0 {
+		s.failoverTimeout = time.Duration(config.Properties.SentinelFailoverTimeout) * time.Millisecond
+	}
+	for _, peer := range config.Properties.SentinelPeers {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			// 各sentinel使用相同的requirepass
+			s.peers[peer] = makeLink(peer, config.Properties.RequirePass)
+		}
+	}
+	logger.Info(fmt.Sprintf("sentinel %s monitoring %s at %s, quorum %d", s.runID, name, masterAddr, quorum))
+	go s.cron()
+	return s
+}
+
+func (s *Sentinel) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Reply) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error(fmt.Sprintf("error occurs: %v\n%s", err, string(debug.Stack())))
+			result = &protocol.UnknownErrorReply{}
+		}
+	}()
+
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		return database2.Auth(c, cmdLine[1:])
+	}
+	if !database2.IsAuthenticated(c) {
+		return protocol.MakeErrorReply("NOAUTH Authentication required")
+	}
+
+	switch cmdName {
+	case "ping":
+		return &protocol.PongReply{}
+	case "sentinel":
+		return s.execSentinel(cmdLine)
+	}
+	return protocol.MakeErrorReply("ERR unknown command '" + cmdName + "'")
+}
+
+func (s *Sentinel) AfterClientClose(c redis.Connection) {
+}
+
+func (s *Sentinel) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stopCh)
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.master.link.close()
+	for _, replica := range s.replicas {
+		replica.link.close()
+	}
+	for _, peer := range s.peers {
+		peer.close()
+	}
+}
+
+// execSentinel SENTINEL子命令
+func (s *Sentinel) execSentinel(cmdLine [][]byte) redis.Reply {
+	if len(cmdLine) < 2 {
+		return protocol.MakeArgNumErrorReply("sentinel")
+	}
+	subCmd := strings.ToLower(string(cmdLine[1]))
+	argNum := map[string]int{
+		"get-master-addr-by-name": 3,
+		"masters":                 2,
+		"master":                  3,
+		"replicas":                3,
+		"slaves":                  3,
+		"sentinels":               3,
+		"failover":                3,
+		"myid":                    2,
+		"is-master-down-by-addr":  6,
+		helloCmd:                  6,
+	}
+	if expected, ok := argNum[subCmd]; ok && len(cmdLine) != expected {
+		return protocol.MakeArgNumErrorReply("sentinel|" + subCmd)
+	}
+	switch subCmd {
+	case "masters":
+		return protocol.MakeMultiRawReply([]redis.Reply{s.masterInfo()})
+	case "myid":
+		return protocol.MakeBulkReply([]byte(s.runID))
+	case "is-master-down-by-addr":
+		return s.execIsMasterDown(cmdLine[2:])
+	case helloCmd:
+		return s.execHello(cmdLine[2:])
+	}
+	if _, ok := argNum[subCmd]; !ok {
+		return protocol.MakeErrorReply("ERR unknown subcommand '" + subCmd + "'")
+	}
+
+	// 其余子命令的第三个参数为master名称
+	if string(cmdLine[2]) != s.name {
+		if subCmd == "get-master-addr-by-name" {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeErrorReply("ERR No such master with that name")
+	}
+	switch subCmd {
+	case "get-master-addr-by-name":
+		s.mu.Lock()
+		host, port, _ := net.SplitHostPort(s.master.addr)
+		s.mu.Unlock()
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(host, port))
+	case "master":
+		return s.masterInfo()
+	case "replicas", "slaves":
+		return s.replicasInfo()
+	case "sentinels":
+		return s.sentinelsInfo()
+	case "failover":
+		// 手动故障转移不需要其他sentinel同意
+		if err := s.failover(s.nextEpoch()); err != nil {
+			return protocol.MakeErrorReply("NOGOODSLAVE " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrorReply("ERR unknown subcommand '" + subCmd + "'")
+}
+
+// fieldsReply 将key、value交替排列，与Redis SENTINEL MASTER的格式相同
+func fieldsReply(fields ...string) redis.Reply {
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(fields...))
+}
+
+func instanceFlags(base string, down bool) string {
+	flags := base
+	if down {
+		flags += ",s_down"
+	}
+	return flags
+}
+
+func (s *Sentinel) masterInfo() redis.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host, port, _ := net.SplitHostPort(s.master.addr)
+	flags := instanceFlags("master", s.sdown)
+	if s.odown {
+		flags += ",o_down"
+	}
+	return fieldsReply(
+		"name", s.name,
+		"ip", host,
+		"port", port,
+		"flags", flags,
+		"last-ok-ping-reply", strconv.FormatInt(time.Since(s.master.lastOK).Milliseconds(), 10),
+		"down-after-milliseconds", strconv.FormatInt(s.downAfter.Milliseconds(), 10),
+		"num-slaves", strconv.Itoa(len(s.replicas)),
+		"num-other-sentinels", strconv.Itoa(len(s.peers)),
+		"quorum", strconv.Itoa(s.quorum),
+		"failover-timeout", strconv.FormatInt(s.failoverTimeout.Milliseconds(), 10),
+		"config-epoch", strconv.FormatUint(s.configEpoch, 10),
+	)
+}
+
+func (s *Sentinel) replicasInfo() redis.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]string, 0, len(s.replicas))
+	for addr := range s.replicas {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	result := make([]redis.Reply, 0, len(addrs))
+	for _, addr := range addrs {
+		replica := s.replicas[addr]
+		host, port, _ := net.SplitHostPort(addr)
+		linkStatus := "err"
+		if replica.linkUp {
+			linkStatus = "ok"
+		}
+		masterHost, masterPort, _ := net.SplitHostPort(replica.masterAddr)
+		result = append(result, fieldsReply(
+			"name", addr,
+			"ip", host,
+			"port", port,
+			"flags", instanceFlags("slave", s.isDown(replica)),
+			"last-ok-ping-reply", strconv.FormatInt(time.Since(replica.lastOK).Milliseconds(), 10),
+			"role-reported", replica.role,
+			"master-host", masterHost,
+			"master-port", masterPort,
+			"master-link-status", linkStatus,
+			"slave-repl-offset", strconv.FormatInt(replica.offset, 10),
+		))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+func (s *Sentinel) sentinelsInfo() redis.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]string, 0, len(s.peers))
+	for addr := range s.peers {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	result := make([]redis.Reply, 0, len(addrs))
+	for _, addr := range addrs {
+		host, port, _ := net.SplitHostPort(addr)
+		result = append(result, fieldsReply("name", addr, "ip", host, "port", port, "flags", "sentinel"))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
@@ -29,7 +29,7 @@ type Config struct {
 
 func ListenAmdServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	closeChan := make(chan struct{})
-	sigalChan := make(chan os.Signal)
+	sigalChan := make(chan os.Signal, 1)
 
 	signal.Notify(sigalChan, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	go func() {